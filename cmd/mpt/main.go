@@ -0,0 +1,50 @@
+// Command mpt provides maintenance tools for tries stored in a LevelDB
+// database.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of the mpt tool.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":  {"serve [flags]: serve the tries of a database over JSON-RPC on HTTP", serveCmd},
+	"verify": {"verify [flags] <root>: check the integrity of a committed trie", verifyCmd},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: mpt <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  mpt", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pavelkrolevets/mpt/ethdb/leveldb"
+	"github.com/pavelkrolevets/mpt/mpt"
+	"github.com/pavelkrolevets/mpt/server"
+)
+
+// serveCmd serves the tries of a LevelDB database over JSON-RPC on HTTP.
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var (
+		datadir = fs.String("datadir", "", "LevelDB directory holding the trie nodes")
+		cache   = fs.Int("cache", 256, "LevelDB and trie cache size in MB")
+		addr    = fs.String("addr", "localhost:8545", "HTTP listening address")
+		hsize   = fs.Int("hashsize", mpt.HashSize256, "node hash width in bytes, 32 or 64 for Streebog-512 tries")
+		keys    = fs.Int("maxkeys", server.DefaultConfig.MaxKeys, "maximum number of keys per mpt_getProof call")
+		hashes  = fs.Int("maxhashes", server.DefaultConfig.MaxHashes, "maximum number of hashes per mpt_getNodes call")
+		entries = fs.Int("maxiterate", server.DefaultConfig.MaxIterate, "maximum number of entries per mpt_iterate call")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: mpt serve [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *datadir == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *hsize != mpt.HashSize256 && *hsize != mpt.HashSize512 {
+		return fmt.Errorf("invalid hash size %d, want %d or %d", *hsize, mpt.HashSize256, mpt.HashSize512)
+	}
+	if _, err := os.Stat(*datadir); err != nil {
+		return err
+	}
+	diskdb, err := leveldb.New(*datadir, *cache/2, 0, "")
+	if err != nil {
+		return err
+	}
+	defer diskdb.Close()
+
+	db := mpt.NewDatabaseWithConfig(diskdb, &mpt.Config{Cache: *cache / 2, HashSize: *hsize})
+	config := server.DefaultConfig
+	config.MaxKeys, config.MaxHashes, config.MaxIterate = *keys, *hashes, *entries
+
+	log.Info("Serving trie database", "datadir", *datadir, "addr", *addr)
+	return http.ListenAndServe(*addr, server.New(db, &config))
+}
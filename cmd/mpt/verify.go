@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb/leveldb"
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+// verifyCmd walks the trie with the given root and prints every problem found.
+func verifyCmd(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		datadir = fs.String("datadir", "", "LevelDB directory holding the trie nodes")
+		cache   = fs.Int("cache", 16, "LevelDB cache size in MB")
+		limit   = fs.Int("limit", 100, "maximum number of problems to print, 0 prints all")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: mpt verify [flags] <root>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *datadir == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	rootBytes := common.FromHex(fs.Arg(0))
+	if len(rootBytes) != mpt.HashSize256 && len(rootBytes) != mpt.HashSize512 {
+		return fmt.Errorf("invalid root %q, want a 32 or 64 byte hash", fs.Arg(0))
+	}
+	root := mpt.BytesToNodeHash(rootBytes)
+
+	if _, err := os.Stat(*datadir); err != nil {
+		return err
+	}
+	diskdb, err := leveldb.New(*datadir, *cache, 0, "")
+	if err != nil {
+		return err
+	}
+	defer diskdb.Close()
+
+	// The width of the root tells the width of all node hashes
+	result := mpt.Verify(mpt.NewDatabaseWithConfig(diskdb, &mpt.Config{HashSize: root.Len()}), root)
+	for i, problem := range result.Problems {
+		if *limit > 0 && i == *limit {
+			fmt.Printf("... %d more\n", len(result.Problems)-i)
+			break
+		}
+		fmt.Println(problem)
+	}
+	fmt.Printf("Checked %d nodes of trie %x, %d problems\n", result.Nodes, root, len(result.Problems))
+	if len(result.Problems) > 0 {
+		return errors.New("trie is damaged")
+	}
+	return nil
+}
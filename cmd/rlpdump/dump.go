@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// value is an RLP item, decoded from the input or parsed from one of the
+// readable notations.
+type value struct {
+	offset int      // position of the item in the input
+	size   int      // length of the encoded item
+	list   bool     // whether the item is a list
+	str    []byte   // content of a string
+	binary bool     // whether the string is written in hex even if printable
+	elems  []*value // elements of a list
+	note   string   // annotation written as a comment
+}
+
+// decode splits input into RLP items. On failure, it returns the items decoded
+// before the bad one, including the lists holding it, and an error naming its
+// offset.
+func decode(input []byte) ([]*value, error) {
+	return decodeAt(input, 0)
+}
+
+func decodeAt(b []byte, offset int) ([]*value, error) {
+	var vals []*value
+	for len(b) > 0 {
+		kind, content, rest, err := rlp.Split(b)
+		if err != nil {
+			return vals, fmt.Errorf("offset %d: %v", offset, err)
+		}
+		size := len(b) - len(rest)
+		v := &value{offset: offset, size: size, list: kind == rlp.List}
+		vals = append(vals, v)
+		if v.list {
+			if v.elems, err = decodeAt(content, offset+size-len(content)); err != nil {
+				return vals, err
+			}
+		} else {
+			v.str = content
+		}
+		offset += size
+		b = rest
+	}
+	return vals, nil
+}
+
+// encode returns the canonical RLP encoding of vals.
+func encode(vals []*value) []byte {
+	w := rlp.NewEncoderBuffer(nil)
+	for _, v := range vals {
+		v.encode(w)
+	}
+	enc := w.ToBytes()
+	w.Flush()
+	return enc
+}
+
+func (v *value) encode(w rlp.EncoderBuffer) {
+	if !v.list {
+		w.WriteBytes(v.str)
+		return
+	}
+	l := w.List()
+	for _, elem := range v.elems {
+		elem.encode(w)
+	}
+	w.ListEnd(l)
+}
+
+// textWriter writes items in the text notation.
+type textWriter struct {
+	w     io.Writer
+	width int  // number of digits of the offsets
+	ascii bool // whether printable strings are quoted
+	err   error
+}
+
+// writeText writes vals, decoded from an input of the given length, in the
+// text notation.
+func writeText(w io.Writer, vals []*value, inputLen int, ascii bool) error {
+	tw := &textWriter{w: w, width: 4, ascii: ascii}
+	if n := len(strconv.Itoa(inputLen)); n > tw.width {
+		tw.width = n
+	}
+	for _, v := range vals {
+		tw.write(v, 0)
+	}
+	return tw.err
+}
+
+func (tw *textWriter) write(v *value, depth int) {
+	comma := ","
+	if depth == 0 {
+		comma = ""
+	}
+	indent := strings.Repeat("  ", depth)
+	switch {
+	case !v.list:
+		tw.printf("%0*d: %s%s%s%s\n", tw.width, v.offset, indent, tw.quote(v), comma, comment(v.note))
+	case len(v.elems) == 0:
+		tw.printf("%0*d: %s[]%s%s\n", tw.width, v.offset, indent, comma, comment(v.note))
+	default:
+		tw.printf("%0*d: %s[%s\n", tw.width, v.offset, indent, comment(v.note))
+		for _, elem := range v.elems {
+			tw.write(elem, depth+1)
+		}
+		tw.printf("%*s  %s]%s\n", tw.width, "", indent, comma)
+	}
+}
+
+func (tw *textWriter) printf(format string, args ...interface{}) {
+	if tw.err == nil {
+		_, tw.err = fmt.Fprintf(tw.w, format, args...)
+	}
+}
+
+func (tw *textWriter) quote(v *value) string {
+	if len(v.str) == 0 {
+		return `""`
+	}
+	if tw.ascii && !v.binary && isPrintable(v.str) {
+		return strconv.Quote(string(v.str))
+	}
+	return "0x" + hex.EncodeToString(v.str)
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func comment(note string) string {
+	if note == "" {
+		return ""
+	}
+	return "  // " + note
+}
+
+// writeJSON writes vals as JSON documents, one per item. Notes are left out.
+func writeJSON(w io.Writer, vals []*value) error {
+	for _, v := range vals {
+		enc, err := json.MarshalIndent(v.jsonValue(), "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *value) jsonValue() interface{} {
+	if !v.list {
+		return "0x" + hex.EncodeToString(v.str)
+	}
+	elems := make([]interface{}, len(v.elems))
+	for i, elem := range v.elems {
+		elems[i] = elem.jsonValue()
+	}
+	return elems
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+var roundTripTests = []string{
+	"80",
+	"00",
+	"C0",
+	"C88363617483646F67",
+	"8180",
+	"820102",
+	"C7C0C1C0C3C0C1C0",
+	"B8380000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000",
+	"F83C836161618B22710A5C0000FF2F2F2C5DA0FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFCA8568656C6C6FC3C28080",
+	"0180C0", // several items
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range roundTripTests {
+		input := common.FromHex(test)
+		vals, err := decode(input)
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", test, err)
+		}
+		for _, ascii := range []bool{true, false} {
+			var text bytes.Buffer
+			writeText(&text, vals, len(input), ascii)
+			parsed, err := parseText(text.String())
+			if err != nil {
+				t.Fatalf("%s: parse error: %v\n%s", test, err, text.String())
+			}
+			if enc := encode(parsed); !bytes.Equal(enc, input) {
+				t.Errorf("%s: text round trip gives %x\n%s", test, enc, text.String())
+			}
+		}
+		var js bytes.Buffer
+		writeJSON(&js, vals)
+		parsed, err := parseJSON(js.Bytes())
+		if err != nil {
+			t.Fatalf("%s: JSON parse error: %v\n%s", test, err, js.String())
+		}
+		if enc := encode(parsed); !bytes.Equal(enc, input) {
+			t.Errorf("%s: JSON round trip gives %x\n%s", test, enc, js.String())
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	vals, _ := decode(common.FromHex("CA8363617482FF01C0C18080"))
+	var text bytes.Buffer
+	writeText(&text, vals, 12, true)
+	want := `0000: [
+0001:   "cat",
+0005:   0xff01,
+0008:   [],
+0009:   [
+0010:     "",
+        ],
+      ]
+0011: ""
+`
+	if text.String() != want {
+		t.Errorf("output mismatch\nhave:\n%s\nwant:\n%s", text.String(), want)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`[ "a", 0x0102 ] // comment`, "C461820102"},
+		{"[1024, 0, 127,]", "C5820400807F"},
+		{`"\x80"`, "8180"},
+		{"12: [ 5 ] 0x", "C10580"},
+	}
+	for _, test := range tests {
+		vals, err := parseText(test.input)
+		if err != nil {
+			t.Errorf("%q: parse error: %v", test.input, err)
+			continue
+		}
+		if enc := fmt.Sprintf("%X", encode(vals)); enc != test.want {
+			t.Errorf("%q: have %s, want %s", test.input, enc, test.want)
+		}
+	}
+	for _, input := range []string{"[", "]", "[0x1]", `"abc`, "-1", "foo", "[] ]"} {
+		if _, err := parseText(input); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	// The list claims more bytes than there are.
+	vals, err := decode(common.FromHex("C6C18001"))
+	if err == nil || !strings.HasPrefix(err.Error(), "offset 0:") {
+		t.Fatalf("wrong error: %v", err)
+	}
+	// The last element of the nested list does.
+	vals, err = decode(common.FromHex("01C4C1808301"))
+	if err == nil || !strings.HasPrefix(err.Error(), "offset 4:") {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if len(vals) != 2 || len(vals[1].elems) != 1 {
+		t.Fatalf("decoded values before the error missing: %d", len(vals))
+	}
+}
+
+func TestNodeNotes(t *testing.T) {
+	tests := []struct {
+		input string
+		notes []string
+	}{
+		{
+			// odd leaf with key a1b
+			"C7823A1B83616263",
+			[]string{"leaf node", `key: "a1b" (3 nibbles)`, "value: 3 bytes"},
+		},
+		{
+			// even extension with a bad reference
+			"C20001",
+			[]string{"extension node", `key: "" (0 nibbles)`, "child: invalid reference: 1 bytes, want 0 or 32"},
+		},
+		{
+			// branch with an embedded leaf
+			"D4C32081FF" + strings.Repeat("80", 16),
+			[]string{"branch node", "child 0: embedded leaf node", "0x20,  // key", "value: 1 bytes", "child 1: empty", "no value"},
+		},
+		{
+			"D1C0" + strings.Repeat("80", 16),
+			[]string{"branch node", "child 0: embedded invalid node: 0 elements", "child 1: empty", "no value"},
+		},
+		{
+			// binary leaf with key bits 101
+			"C4824DA001",
+			[]string{"leaf node", `key: "101" (3 bits)`, "value: 1 bytes"},
+		},
+		{"C2523A", []string{"short node", "invalid key: invalid flag 0x52"}},
+	}
+	for _, test := range tests {
+		vals, err := decode(common.FromHex(test.input))
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", test.input, err)
+		}
+		annotateNode(vals[0], "", mpt.HashSize256)
+		var text bytes.Buffer
+		writeText(&text, vals, 0, true)
+		for _, note := range test.notes {
+			if !strings.Contains(text.String(), note) {
+				t.Errorf("%s: note %q missing from output\n%s", test.input, note, text.String())
+			}
+		}
+	}
+}
+
+// TestStoredNodes annotates the nodes of committed hex and binary tries.
+func TestStoredNodes(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		diskdb := memorydb.New()
+		db := mpt.NewDatabase(diskdb)
+		var (
+			root mpt.NodeHash
+			err  error
+		)
+		if binary {
+			trie, _ := mpt.NewBinary(mpt.NodeHash{}, db)
+			for i := 0; i < 100; i++ {
+				trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+			}
+			root, err = trie.Commit(nil)
+		} else {
+			trie, _ := mpt.New(mpt.NodeHash{}, db)
+			for i := 0; i < 100; i++ {
+				trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte{byte(i)})
+			}
+			root, err = trie.Commit(nil)
+		}
+		if err != nil {
+			t.Fatalf("commit error: %v", err)
+		}
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("database commit error: %v", err)
+		}
+		it := diskdb.NewIterator(nil, nil)
+		var embedded bool
+		for it.Next() {
+			var out bytes.Buffer
+			if err := dumpCmd(&out, it.Value(), false, true, mpt.HashSize256, true); err != nil {
+				t.Fatalf("dump error: %v", err)
+			}
+			if strings.Contains(out.String(), "invalid") || !strings.Contains(out.String(), " node\n") {
+				t.Errorf("binary %t: unexpected notes for node %x\n%s", binary, it.Key(), out.String())
+			}
+			embedded = embedded || strings.Contains(out.String(), "embedded")
+		}
+		it.Release()
+		if !embedded {
+			t.Errorf("binary %t: no embedded nodes found", binary)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Command rlpdump prints RLP data in a readable text notation, and converts
+// that notation back into RLP.
+//
+// The input is a hex string given with -hex, a file, or standard input. Every
+// item is printed on its own line behind its byte offset in the input:
+//
+//	0000: [
+//	0001:   "cat",
+//	0005:   0x01ff,
+//	0008:   [],
+//	      ]
+//
+// Strings of printable ASCII characters are quoted, all others are written in
+// hex. With -reverse, rlpdump reads this notation and prints the canonical RLP
+// encoding in hex. Offsets, commas and // comments are ignored, and unsigned
+// decimal integers are accepted as well. With -json, lists are written as
+// arrays and strings as 0x-prefixed hex.
+//
+// With -node, the items are interpreted as the encodings of trie nodes, and
+// comments name the node kinds, keys and child references.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+func main() {
+	var (
+		hexInput = flag.String("hex", "", "dump the given hex string instead of reading a file")
+		reverse  = flag.Bool("reverse", false, "convert the text notation, or JSON with -json, to RLP")
+		jsonMode = flag.Bool("json", false, "write (with -reverse, read) JSON instead of the text notation")
+		node     = flag.Bool("node", false, "annotate the items as trie nodes")
+		hashSize = flag.Int("hashsize", mpt.HashSize256, "size of node hashes for -node, 32 or 64")
+		noASCII  = flag.Bool("noascii", false, "write all strings in hex")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: rlpdump [flags] [file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || (*hexInput != "" && flag.NArg() > 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *hashSize != mpt.HashSize256 && *hashSize != mpt.HashSize512 {
+		fmt.Fprintf(os.Stderr, "Error: invalid -hashsize %d, want %d or %d\n", *hashSize, mpt.HashSize256, mpt.HashSize512)
+		os.Exit(2)
+	}
+	input, err := readInput(*hexInput, flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if *reverse {
+		err = reverseCmd(out, input, *jsonMode)
+	} else {
+		err = dumpCmd(out, input, *jsonMode, *node, *hashSize, !*noASCII)
+	}
+	out.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func readInput(hexInput, file string) ([]byte, error) {
+	switch {
+	case hexInput != "":
+		b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(hexInput), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -hex: %v", err)
+		}
+		return b, nil
+	case file == "" || file == "-":
+		return io.ReadAll(os.Stdin)
+	default:
+		return os.ReadFile(file)
+	}
+}
+
+// dumpCmd prints the items of input. An item that can't be decoded ends the
+// output with an error naming its offset.
+func dumpCmd(w io.Writer, input []byte, jsonMode, node bool, hashSize int, ascii bool) error {
+	vals, decErr := decode(input)
+	if node {
+		for _, v := range vals {
+			annotateNode(v, "", hashSize)
+		}
+	}
+	var err error
+	if jsonMode {
+		err = writeJSON(w, vals)
+	} else {
+		err = writeText(w, vals, len(input), ascii)
+	}
+	if decErr != nil {
+		return decErr
+	}
+	return err
+}
+
+// reverseCmd parses input and prints its RLP encoding in hex.
+func reverseCmd(w io.Writer, input []byte, jsonMode bool) error {
+	var (
+		vals []*value
+		err  error
+	)
+	if jsonMode {
+		vals, err = parseJSON(input)
+	} else {
+		vals, err = parseText(string(input))
+	}
+	if err != nil {
+		return err
+	}
+	if len(vals) == 0 {
+		return errors.New("no values in input")
+	}
+	_, err = fmt.Fprintf(w, "0x%x\n", encode(vals))
+	return err
+}
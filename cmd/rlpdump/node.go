@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// binaryFlag marks the compact keys of binary trie nodes, see package mpt.
+const binaryFlag = 0x40
+
+// annotateNode notes the node kind on v, the encoding of a trie node, and
+// the meaning of its elements. Children are referenced by hashes of hashSize
+// bytes or embedded when their encoding is shorter than that.
+func annotateNode(v *value, prefix string, hashSize int) {
+	if !v.list {
+		v.note = prefix + "invalid node: not a list"
+		return
+	}
+	switch len(v.elems) {
+	case 17:
+		v.note = prefix + "branch node"
+		for i, elem := range v.elems[:16] {
+			annotateRef(elem, fmt.Sprintf("child %x: ", i), hashSize)
+		}
+		annotateValue(v.elems[16], true)
+	case 3:
+		v.note = prefix + "binary branch node"
+		for i, elem := range v.elems[:2] {
+			annotateRef(elem, fmt.Sprintf("child %d: ", i), hashSize)
+		}
+		annotateValue(v.elems[2], true)
+	case 2:
+		key := v.elems[0]
+		if key.list {
+			v.note = prefix + "short node"
+			key.note = "invalid key: not a string"
+			return
+		}
+		key.binary = true
+		path, leaf, err := decodeCompact(key.str)
+		if err != nil {
+			v.note = prefix + "short node"
+			key.note = "invalid key: " + err.Error()
+			return
+		}
+		key.note = "key: " + path
+		if leaf {
+			v.note = prefix + "leaf node"
+			annotateValue(v.elems[1], false)
+		} else {
+			v.note = prefix + "extension node"
+			annotateRef(v.elems[1], "child: ", hashSize)
+		}
+	default:
+		v.note = fmt.Sprintf("%sinvalid node: %d elements", prefix, len(v.elems))
+	}
+}
+
+// annotateRef notes the kind of the child reference v.
+func annotateRef(v *value, prefix string, hashSize int) {
+	switch {
+	case v.list:
+		if v.size > hashSize {
+			prefix = fmt.Sprintf("%soversized (%d bytes) ", prefix, v.size)
+		}
+		annotateNode(v, prefix+"embedded ", hashSize)
+	case len(v.str) == 0:
+		v.note = prefix + "empty"
+	case len(v.str) == hashSize:
+		v.binary = true
+		v.note = prefix + "hash"
+	default:
+		v.note = fmt.Sprintf("%sinvalid reference: %d bytes, want 0 or %d", prefix, len(v.str), hashSize)
+	}
+}
+
+// annotateValue notes the value v stored in a node. Only branches may store
+// empty values.
+func annotateValue(v *value, branch bool) {
+	switch {
+	case v.list:
+		v.note = "invalid value: not a string"
+	case len(v.str) == 0 && branch:
+		v.note = "no value"
+	default:
+		v.note = fmt.Sprintf("value: %d bytes", len(v.str))
+	}
+}
+
+// decodeCompact returns the path of a compact encoded node key as nibbles or
+// bits, and whether the key is terminated, i.e. the node is a leaf.
+func decodeCompact(key []byte) (path string, leaf bool, err error) {
+	if len(key) == 0 {
+		return "", false, errors.New("empty compact key")
+	}
+	flag := key[0]
+	if flag&0xf0 == binaryFlag {
+		pad := int(flag & 7)
+		if len(key) == 1 && pad != 0 {
+			return "", false, fmt.Errorf("padded without key bytes (flag %#x)", flag)
+		}
+		if pad > 0 && key[len(key)-1]&(1<<uint(pad)-1) != 0 {
+			return "", false, fmt.Errorf("non-zero padding (flag %#x)", flag)
+		}
+		var bits strings.Builder
+		n := (len(key)-1)*8 - pad
+		for i := 0; i < n; i++ {
+			bits.WriteByte('0' + key[1+i/8]>>(7-uint(i%8))&1)
+		}
+		return fmt.Sprintf("%q (%d bits)", bits.String(), n), flag&(1<<3) != 0, nil
+	}
+	if flag>>4 > 3 {
+		return "", false, fmt.Errorf("invalid flag %#x", flag)
+	}
+	nibbles := hex.EncodeToString(key[1:])
+	if flag&(1<<4) != 0 {
+		nibbles = fmt.Sprintf("%x", flag&0x0f) + nibbles
+	} else if flag&0x0f != 0 {
+		return "", false, fmt.Errorf("even key with non-zero padding nibble (flag %#x)", flag)
+	}
+	return fmt.Sprintf("%q (%d nibbles)", nibbles, len(nibbles)), flag&(1<<5) != 0, nil
+}
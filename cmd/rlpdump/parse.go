@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// textParser reads the text notation written by writeText.
+type textParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+// parseText parses the items of the text notation in src.
+func parseText(src string) ([]*value, error) {
+	p := &textParser{src: src, line: 1}
+	var vals []*value
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok == "" {
+			return vals, nil
+		}
+		v, err := p.value(tok)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+}
+
+// value parses the item starting with tok.
+func (p *textParser) value(tok string) (*value, error) {
+	switch {
+	case tok == "[":
+		v := &value{list: true}
+		for {
+			tok, err := p.next()
+			switch {
+			case err != nil:
+				return nil, err
+			case tok == "":
+				return nil, p.errorf("unterminated list")
+			case tok == "]":
+				return v, nil
+			}
+			elem, err := p.value(tok)
+			if err != nil {
+				return nil, err
+			}
+			v.elems = append(v.elems, elem)
+		}
+	case tok == "]":
+		return nil, p.errorf("unexpected ]")
+	case tok[0] == '"':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return nil, p.errorf("invalid string %s", tok)
+		}
+		return &value{str: []byte(s)}, nil
+	case strings.HasPrefix(tok, "0x"):
+		b, err := hex.DecodeString(tok[2:])
+		if err != nil {
+			return nil, p.errorf("invalid hex string %s", tok)
+		}
+		return &value{str: b}, nil
+	default:
+		i, ok := new(big.Int).SetString(tok, 10)
+		if !ok || i.Sign() < 0 {
+			return nil, p.errorf("invalid token %q", tok)
+		}
+		return &value{str: i.Bytes()}, nil
+	}
+}
+
+// next returns the next token, skipping whitespace, commas, comments and
+// offsets. It returns "" at the end of the input.
+func (p *textParser) next() (string, error) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '[' || c == ']':
+			p.pos++
+			return string(c), nil
+		case c == '"':
+			start := p.pos
+			for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '\n'; p.pos++ {
+				switch p.src[p.pos] {
+				case '\\':
+					p.pos++
+				case '"':
+					p.pos++
+					return p.src[start:p.pos], nil
+				}
+			}
+			return "", p.errorf("unterminated string")
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n,[]\"", rune(p.src[p.pos])) && !strings.HasPrefix(p.src[p.pos:], "//") {
+				p.pos++
+			}
+			if tok := p.src[start:p.pos]; !isOffset(tok) {
+				return tok, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// isOffset reports whether tok is an offset label like "0012:".
+func isOffset(tok string) bool {
+	if len(tok) < 2 || tok[len(tok)-1] != ':' {
+		return false
+	}
+	for _, c := range tok[:len(tok)-1] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseJSON parses a sequence of JSON documents, each holding an item. Lists
+// are arrays, strings are 0x-prefixed hex, and unsigned integers are numbers.
+func parseJSON(input []byte) ([]*value, error) {
+	dec := json.NewDecoder(bytes.NewReader(input))
+	dec.UseNumber()
+	var vals []*value
+	for {
+		var x interface{}
+		if err := dec.Decode(&x); err == io.EOF {
+			return vals, nil
+		} else if err != nil {
+			return nil, err
+		}
+		v, err := fromJSON(x)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+}
+
+func fromJSON(x interface{}) (*value, error) {
+	switch x := x.(type) {
+	case []interface{}:
+		v := &value{list: true}
+		for _, elem := range x {
+			ev, err := fromJSON(elem)
+			if err != nil {
+				return nil, err
+			}
+			v.elems = append(v.elems, ev)
+		}
+		return v, nil
+	case string:
+		if !strings.HasPrefix(x, "0x") {
+			return nil, fmt.Errorf("invalid string %q, want 0x-prefixed hex", x)
+		}
+		b, err := hex.DecodeString(x[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex string %q", x)
+		}
+		return &value{str: b}, nil
+	case json.Number:
+		i, ok := new(big.Int).SetString(x.String(), 10)
+		if !ok || i.Sign() < 0 {
+			return nil, fmt.Errorf("invalid number %s, want unsigned integer", x)
+		}
+		return &value{str: i.Bytes()}, nil
+	default:
+		return nil, errors.New("invalid JSON value, want array, hex string or unsigned integer")
+	}
+}
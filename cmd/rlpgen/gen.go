@@ -0,0 +1,969 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	rlpPackage     = "github.com/pavelkrolevets/mpt/rlp"
+	uint256Package = "github.com/pavelkrolevets/mpt/uint256"
+)
+
+// Config selects the package, the types and the methods to generate.
+type Config struct {
+	Dir     string   // directory of the input package
+	Types   []string // struct types to generate methods for
+	Output  string   // output file, left out when loading the package
+	Encoder bool     // generate EncodeRLP
+	Decoder bool     // generate DecodeRLP
+}
+
+// Process loads the package and returns the formatted source of the file with
+// the generated methods.
+func (cfg *Config) Process() ([]byte, error) {
+	pkg, err := loadPackage(cfg.Dir, cfg.Output)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{pkg: pkg, imports: make(map[string]string)}
+	if pkg.Path() != rlpPackage {
+		g.rlp = "rlp."
+		g.imports[rlpPackage] = "rlp"
+	}
+	var body bytes.Buffer
+	for _, name := range cfg.Types {
+		obj, ok := pkg.Scope().Lookup(strings.TrimSpace(name)).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("type %s not found in package %s", name, pkg.Path())
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a named type", name)
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		}
+		if cfg.Encoder {
+			g.imports["io"] = "io"
+			if err := g.genEncoder(&body, named); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.Decoder {
+			if err := g.genDecoder(&body, named); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "// Code generated by rlpgen. DO NOT EDIT.")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "package", pkg.Name())
+	fmt.Fprintln(&out)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if isStd(paths[i]) != isStd(paths[j]) {
+			return isStd(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	fmt.Fprintln(&out, "import (")
+	for i, path := range paths {
+		// Standard library packages come first, in a group of their own.
+		if i > 0 && isStd(paths[i-1]) && !isStd(path) {
+			fmt.Fprintln(&out)
+		}
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	fmt.Fprintln(&out, ")")
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// isStd reports whether path is a standard library package.
+func isStd(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+// loadPackage parses and type-checks the package in dir, leaving out the
+// file named exclude so stale generated code doesn't get in the way.
+func loadPackage(dir, exclude string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if exclude != "" {
+		if exclude, err = filepath.Abs(exclude); err != nil {
+			return nil, err
+		}
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		file, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if file == exclude {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(importPath(dir, bp.Name), fset, files, nil)
+}
+
+// importPath derives the import path of the package in dir from the module
+// declared in the nearest go.mod. Without a module the package name is used.
+func importPath(dir, name string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return name
+	}
+	for root := abs; ; root = filepath.Dir(root) {
+		if module := modulePath(filepath.Join(root, "go.mod")); module != "" {
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return name
+			}
+			return path.Join(module, filepath.ToSlash(rel))
+		}
+		if filepath.Dir(root) == root {
+			return name
+		}
+	}
+}
+
+func modulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// generator writes the methods of the requested types. The encoder writes to
+// an rlp.EncoderBuffer w, the decoder reads from the stream dec into temporaries
+// and fields of the value being decoded.
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string // path => name of the packages used
+	rlp     string            // qualifier of package rlp
+	tmp     int               // counter for temporary variable names
+	stack   []*types.Named    // struct types being expanded, to stop recursion
+}
+
+func (g *generator) qualify(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+	g.imports[pkg.Path()] = pkg.Name()
+	return pkg.Name()
+}
+
+func (g *generator) typeString(typ types.Type) string {
+	return types.TypeString(typ, g.qualify)
+}
+
+func (g *generator) tmpVar(prefix string) string {
+	name := fmt.Sprintf("_%s%d", prefix, g.tmp)
+	g.tmp++
+	return name
+}
+
+// convert returns expr, which is of type from, as a value of type to.
+func (g *generator) convert(expr string, from, to types.Type) string {
+	if types.Identical(from, to) {
+		return expr
+	}
+	name := g.typeString(to)
+	if strings.HasPrefix(name, "*") || strings.HasPrefix(name, "func") || strings.HasPrefix(name, "<-") {
+		name = "(" + name + ")"
+	}
+	return name + "(" + expr + ")"
+}
+
+// Values are referred to by addressable expressions: selectors, index
+// expressions and pointer indirections made by deref. The helpers below turn
+// them into the operands needed by the emitted statements.
+
+// deref returns the indirection of the pointer expression p, parenthesized so
+// it can be indexed.
+func deref(p string) string { return "(*" + p + ")" }
+
+// pointerOf returns the pointer expression of an indirection made by deref.
+func pointerOf(v string) (string, bool) {
+	if !strings.HasPrefix(v, "(*") || !strings.HasSuffix(v, ")") {
+		return "", false
+	}
+	depth := 0
+	for i, c := range v {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 && i != len(v)-1 {
+				return "", false
+			}
+		}
+	}
+	return v[2 : len(v)-1], true
+}
+
+// operand returns v for use as an operand or assignment target.
+func operand(v string) string {
+	if p, ok := pointerOf(v); ok {
+		return "*" + p
+	}
+	return v
+}
+
+// addr returns the address of v.
+func addr(v string) string {
+	if p, ok := pointerOf(v); ok {
+		return p
+	}
+	return "&" + v
+}
+
+// selector returns the field name of the struct v, relying on the automatic
+// indirection of pointers.
+func selector(v, name string) string {
+	if p, ok := pointerOf(v); ok {
+		return p + "." + name
+	}
+	return v + "." + name
+}
+
+func (g *generator) expanding(typ types.Type) bool {
+	if named, ok := typ.(*types.Named); ok {
+		for _, t := range g.stack {
+			if t == named {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *generator) genEncoder(b *bytes.Buffer, typ *types.Named) error {
+	g.tmp = 0
+	g.stack = append(g.stack[:0], typ)
+	var body bytes.Buffer
+	if err := g.writeStruct(&body, typ, "obj"); err != nil {
+		return err
+	}
+	name := g.typeString(typ)
+	fmt.Fprintf(b, "\n// EncodeRLP implements rlp.Encoder.\n")
+	fmt.Fprintf(b, "func (obj *%s) EncodeRLP(_w io.Writer) error {\n", name)
+	fmt.Fprintf(b, "w := %sNewEncoderBuffer(_w)\n", g.rlp)
+	b.Write(body.Bytes())
+	fmt.Fprintf(b, "return w.Flush()\n}\n")
+	return nil
+}
+
+func (g *generator) genDecoder(b *bytes.Buffer, typ *types.Named) error {
+	g.tmp = 0
+	g.stack = append(g.stack[:0], typ)
+	var body bytes.Buffer
+	dst := g.tmpVar("tmp")
+	if err := g.readStruct(&body, typ, dst); err != nil {
+		return err
+	}
+	name := g.typeString(typ)
+	fmt.Fprintf(b, "\n// DecodeRLP implements rlp.Decoder.\n")
+	fmt.Fprintf(b, "func (obj *%s) DecodeRLP(dec *%sStream) error {\n", name, g.rlp)
+	fmt.Fprintf(b, "var %s %s\n", dst, name)
+	b.Write(body.Bytes())
+	fmt.Fprintf(b, "*obj = %s\nreturn nil\n}\n", dst)
+	return nil
+}
+
+// writeValue emits the encoder of v, an addressable expression of type typ.
+// The cases are tried in the order of makeWriter in package rlp.
+func (g *generator) writeValue(b *bytes.Buffer, typ types.Type, ts tags, v string) error {
+	switch {
+	case isRawValue(typ):
+		fmt.Fprintf(b, "w.Write(%s)\n", operand(v))
+	case isBigIntPtr(typ):
+		ptr := types.NewPointer(bigIntOf(typ))
+		fmt.Fprintf(b, "if %s == nil {\nw.Write(%sEmptyString)\n} else {\n", operand(v), g.rlp)
+		p := g.convert(operand(v), typ, ptr)
+		if strings.HasPrefix(p, "*") {
+			p = "(" + p + ")"
+		}
+		g.writeBigInt(b, p+".Sign()", p)
+		fmt.Fprintf(b, "}\n")
+	case isBigInt(typ):
+		g.writeBigInt(b, selector(v, "Sign()"), addr(v))
+	case isUint256Ptr(typ):
+		fmt.Fprintf(b, "if %s == nil {\nw.Write(%sEmptyString)\n} else {\n", operand(v), g.rlp)
+		fmt.Fprintf(b, "w.WriteUint256(%s)\n}\n", operand(v))
+	case isUint256(typ):
+		fmt.Fprintf(b, "w.WriteUint256(%s)\n", addr(v))
+	case isPointer(typ):
+		return g.writePointer(b, typ, ts, v)
+	case implementsEncoder(types.NewPointer(typ)) || g.expanding(typ):
+		fmt.Fprintf(b, "if err := %sEncode(w, %s); err != nil {\nreturn err\n}\n", g.rlp, addr(v))
+	case isUint(typ):
+		fmt.Fprintf(b, "w.WriteUint64(uint64(%s))\n", operand(v))
+	case ts.signed:
+		// zigzag encoding, see writeSigned in package rlp
+		i := "int64(" + operand(v) + ")"
+		fmt.Fprintf(b, "w.WriteUint64(uint64(%s<<1) ^ uint64(%s>>63))\n", i, i)
+	case isKind(typ, types.Bool):
+		fmt.Fprintf(b, "w.WriteBool(%s)\n", g.convert(operand(v), typ, types.Typ[types.Bool]))
+	case isKind(typ, types.String):
+		fmt.Fprintf(b, "w.WriteString(%s)\n", g.convert(operand(v), typ, types.Typ[types.String]))
+	case isByteSlice(typ, isByteForEncoding):
+		if err := checkByteElem(typ); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "w.WriteBytes(%s)\n", operand(v))
+	case isByteArray(typ, isByteForEncoding):
+		if err := checkByteElem(typ); err != nil {
+			return err
+		}
+		if typ.Underlying().(*types.Array).Len() == 0 {
+			fmt.Fprintf(b, "w.Write(%sEmptyString)\n", g.rlp)
+		} else {
+			fmt.Fprintf(b, "w.WriteBytes(%s[:])\n", v)
+		}
+	case isSliceOrArray(typ):
+		return g.writeList(b, typ, ts, v)
+	case isStruct(typ):
+		return g.writeStruct(b, typ, v)
+	case isInterface(typ):
+		fmt.Fprintf(b, "if %s == nil {\nw.Write(%sEmptyList)\n", operand(v), g.rlp)
+		fmt.Fprintf(b, "} else if err := %sEncode(w, %s); err != nil {\nreturn err\n}\n", g.rlp, operand(v))
+	case isMap(typ):
+		// Package rlp sorts the entries by their encoded keys.
+		fmt.Fprintf(b, "if err := %sEncode(w, %s); err != nil {\nreturn err\n}\n", g.rlp, operand(v))
+	default:
+		return fmt.Errorf("rlp: type %s is not RLP-serializable", typeName(typ))
+	}
+	return nil
+}
+
+// writeBigInt emits the encoder of the non-nil *big.Int p, whose sign is
+// returned by the expression sign.
+func (g *generator) writeBigInt(b *bytes.Buffer, sign, p string) {
+	fmt.Fprintf(b, "if %s == -1 {\nreturn %sErrNegativeBigInt\n}\n", sign, g.rlp)
+	fmt.Fprintf(b, "w.WriteBigInt(%s)\n", p)
+}
+
+func (g *generator) writePointer(b *bytes.Buffer, typ types.Type, ts tags, v string) error {
+	elem := typ.Underlying().(*types.Pointer).Elem()
+	nilKind := defaultNilKind(elem)
+	if ts.nilOK {
+		nilKind = ts.nilKind
+	}
+	empty := "EmptyList"
+	if nilKind == kindString {
+		empty = "EmptyString"
+	}
+	fmt.Fprintf(b, "if %s == nil {\nw.Write(%s%s)\n} else {\n", operand(v), g.rlp, empty)
+	if err := g.writeValue(b, elem, tags{}, deref(v)); err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "}\n")
+	return nil
+}
+
+func (g *generator) writeList(b *bytes.Buffer, typ types.Type, ts tags, v string) error {
+	var list string
+	if !ts.tail {
+		list = g.tmpVar("list")
+		fmt.Fprintf(b, "%s := w.List()\n", list)
+	}
+	index := g.tmpVar("i")
+	fmt.Fprintf(b, "for %s := range %s {\n", index, v)
+	if err := g.writeValue(b, elemType(typ), tags{}, v+"["+index+"]"); err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "}\n")
+	if !ts.tail {
+		fmt.Fprintf(b, "w.ListEnd(%s)\n", list)
+	}
+	return nil
+}
+
+func (g *generator) writeStruct(b *bytes.Buffer, typ types.Type, v string) error {
+	fields, err := structFields(typ)
+	if err != nil {
+		return err
+	}
+	if named, ok := typ.(*types.Named); ok && !g.expanding(named) {
+		g.stack = append(g.stack, named)
+		defer func() { g.stack = g.stack[:len(g.stack)-1] }()
+	}
+	// Zero-valued fields at the end are left out from the first optional
+	// field on. Field i is written if it or any field after it is non-zero.
+	first := firstOptionalField(fields)
+	var nonZero []string
+	for _, f := range fields[first:] {
+		cond, err := g.nonZero(f.Type(), selector(v, f.Name()))
+		if err != nil {
+			return structFieldError(typ, f, err)
+		}
+		tmp := g.tmpVar("nonzero")
+		fmt.Fprintf(b, "%s := %s\n", tmp, cond)
+		nonZero = append(nonZero, tmp)
+	}
+	list := g.tmpVar("list")
+	fmt.Fprintf(b, "%s := w.List()\n", list)
+	for i, f := range fields {
+		if i >= first {
+			fmt.Fprintf(b, "if %s {\n", strings.Join(nonZero[i-first:], " || "))
+		}
+		if err := g.writeValue(b, f.Type(), f.tags, selector(v, f.Name())); err != nil {
+			return structFieldError(typ, f, err)
+		}
+		if i >= first {
+			fmt.Fprintf(b, "}\n")
+		}
+	}
+	fmt.Fprintf(b, "w.ListEnd(%s)\n", list)
+	return nil
+}
+
+// nonZero returns a condition that holds when v is not the zero value of its
+// type, like reflect.Value.IsZero.
+func (g *generator) nonZero(typ types.Type, v string) (string, error) {
+	if isBigInt(typ) {
+		return fmt.Sprintf("%s.Sign() != 0", v), nil
+	}
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsBoolean != 0:
+			return operand(v), nil
+		case t.Info()&types.IsString != 0:
+			return fmt.Sprintf("%s != \"\"", operand(v)), nil
+		default:
+			return fmt.Sprintf("%s != 0", operand(v)), nil
+		}
+	case *types.Pointer, *types.Slice, *types.Interface, *types.Map, *types.Chan, *types.Signature:
+		return fmt.Sprintf("%s != nil", operand(v)), nil
+	}
+	if types.Comparable(typ) {
+		return fmt.Sprintf("%s != (%s{})", operand(v), g.typeString(typ)), nil
+	}
+	if st, ok := typ.Underlying().(*types.Struct); ok {
+		var conds []string
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if !f.Exported() && f.Pkg() != g.pkg {
+				break
+			}
+			cond, err := g.nonZero(f.Type(), selector(v, f.Name()))
+			if err != nil {
+				return "", err
+			}
+			conds = append(conds, "("+cond+")")
+		}
+		if len(conds) == st.NumFields() {
+			if len(conds) == 0 {
+				return "false", nil
+			}
+			return strings.Join(conds, " || "), nil
+		}
+	}
+	return "", fmt.Errorf("rlpgen: optional field of type %s is not supported", typeName(typ))
+}
+
+// readValue emits the decoder into dst, an addressable expression of type
+// typ. The cases are tried in the order of makeDecoder in package rlp.
+func (g *generator) readValue(b *bytes.Buffer, typ types.Type, ts tags, dst string) error {
+	byteSlice := types.NewSlice(types.Typ[types.Byte])
+	switch {
+	case isRawValue(typ):
+		g.read(b, "Raw()", byteSlice, typ, dst)
+	case isBigIntPtr(typ):
+		g.read(b, "BigInt()", types.NewPointer(bigIntOf(typ)), typ, dst)
+	case isBigInt(typ):
+		tmp := g.tmpVar("big")
+		fmt.Fprintf(b, "%s, err := dec.BigInt()\nif err != nil {\nreturn err\n}\n", tmp)
+		fmt.Fprintf(b, "%s = *%s\n", operand(dst), tmp)
+	case isUint256Ptr(typ):
+		tmp := g.tmpVar("num")
+		fmt.Fprintf(b, "%s, err := dec.Uint256()\nif err != nil {\nreturn err\n}\n", tmp)
+		fmt.Fprintf(b, "%s = &%s\n", operand(dst), tmp)
+	case isUint256(typ):
+		g.read(b, "Uint256()", typ, typ, dst)
+	case isPointer(typ):
+		return g.readPointer(b, typ, ts, dst)
+	case implementsDecoder(types.NewPointer(typ)) || g.expanding(typ):
+		fmt.Fprintf(b, "if err := dec.Decode(%s); err != nil {\nreturn err\n}\n", addr(dst))
+	case isUint(typ):
+		method, result := "Uint()", types.Typ[types.Uint64]
+		switch typ.Underlying().(*types.Basic).Kind() {
+		case types.Uint8:
+			method, result = "Uint8()", types.Typ[types.Uint8]
+		case types.Uint16:
+			method, result = "Uint16()", types.Typ[types.Uint16]
+		case types.Uint32:
+			method, result = "Uint32()", types.Typ[types.Uint32]
+		}
+		g.read(b, method, result, typ, dst)
+	case ts.signed:
+		// The zigzag encoding of an intN is at most N bits long.
+		method := "Uint()"
+		switch typ.Underlying().(*types.Basic).Kind() {
+		case types.Int8:
+			method = "Uint8()"
+		case types.Int16:
+			method = "Uint16()"
+		case types.Int32:
+			method = "Uint32()"
+		}
+		tmp := g.tmpVar("tmp")
+		fmt.Fprintf(b, "%s, err := dec.%s\nif err != nil {\nreturn err\n}\n", tmp, method)
+		i := fmt.Sprintf("int64(%s>>1) ^ -int64(%s&1)", tmp, tmp)
+		fmt.Fprintf(b, "%s = %s\n", operand(dst), g.convert(i, types.Typ[types.Int64], typ))
+	case isKind(typ, types.Bool):
+		g.read(b, "Bool()", types.Typ[types.Bool], typ, dst)
+	case isKind(typ, types.String):
+		g.read(b, "Bytes()", byteSlice, typ, dst)
+	case isByteSlice(typ, isByteForDecoding):
+		if err := checkByteElem(typ); err != nil {
+			return err
+		}
+		g.read(b, "Bytes()", byteSlice, typ, dst)
+	case isByteArray(typ, isByteForDecoding):
+		if err := checkByteElem(typ); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "if err := dec.ReadBytes(%s[:]); err != nil {\nreturn err\n}\n", dst)
+	case isSliceOrArray(typ):
+		return g.readList(b, typ, ts, dst)
+	case isStruct(typ):
+		return g.readStruct(b, typ, dst)
+	case isInterface(typ):
+		if typ.Underlying().(*types.Interface).NumMethods() != 0 {
+			return fmt.Errorf("rlp: type %s is not RLP-serializable", typeName(typ))
+		}
+		fmt.Fprintf(b, "if err := dec.Decode(%s); err != nil {\nreturn err\n}\n", addr(dst))
+	case isMap(typ):
+		fmt.Fprintf(b, "if err := dec.Decode(%s); err != nil {\nreturn err\n}\n", addr(dst))
+	default:
+		return fmt.Errorf("rlp: type %s is not RLP-serializable", typeName(typ))
+	}
+	return nil
+}
+
+// read emits a call of a Stream method returning a value of type result, and
+// its assignment to dst.
+func (g *generator) read(b *bytes.Buffer, method string, result, typ types.Type, dst string) {
+	tmp := g.tmpVar("tmp")
+	fmt.Fprintf(b, "%s, err := dec.%s\nif err != nil {\nreturn err\n}\n", tmp, method)
+	if types.AssignableTo(result, typ) {
+		fmt.Fprintf(b, "%s = %s\n", operand(dst), tmp)
+	} else {
+		fmt.Fprintf(b, "%s = %s\n", operand(dst), g.convert(tmp, result, typ))
+	}
+}
+
+func (g *generator) readPointer(b *bytes.Buffer, typ types.Type, ts tags, dst string) error {
+	elem := typ.Underlying().(*types.Pointer).Elem()
+	tmp := g.tmpVar("ptr")
+	if ts.nilOK {
+		// Empty values of the right kind decode as nil pointers.
+		kind, size := g.tmpVar("kind"), g.tmpVar("size")
+		fmt.Fprintf(b, "if %s, %s, err := dec.Kind(); err != nil {\nreturn err\n", kind, size)
+		fmt.Fprintf(b, "} else if %s != %sByte && %s == 0 {\n", kind, g.rlp, size)
+		if ts.nilKind == kindString {
+			fmt.Fprintf(b, "if %s != %sString {\nreturn %sErrExpectedString\n}\n", kind, g.rlp, g.rlp)
+			fmt.Fprintf(b, "if _, err := dec.Bytes(); err != nil {\nreturn err\n}\n")
+		} else {
+			fmt.Fprintf(b, "if %s != %sList {\nreturn %sErrExpectedList\n}\n", kind, g.rlp, g.rlp)
+			fmt.Fprintf(b, "if _, err := dec.List(); err != nil {\nreturn err\n}\n")
+			fmt.Fprintf(b, "if err := dec.ListEnd(); err != nil {\nreturn err\n}\n")
+		}
+		fmt.Fprintf(b, "%s = nil\n} else {\n", operand(dst))
+		defer fmt.Fprintf(b, "}\n")
+	}
+	fmt.Fprintf(b, "%s := new(%s)\n", tmp, g.typeString(elem))
+	if err := g.readValue(b, elem, tags{}, deref(tmp)); err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "%s = %s\n", operand(dst), tmp)
+	return nil
+}
+
+func (g *generator) readList(b *bytes.Buffer, typ types.Type, ts tags, dst string) error {
+	if !ts.tail {
+		fmt.Fprintf(b, "if _, err := dec.List(); err != nil {\nreturn err\n}\n")
+	}
+	if isArray(typ) {
+		// Missing elements fail with EOL, extra ones in ListEnd.
+		index := g.tmpVar("i")
+		fmt.Fprintf(b, "for %s := range %s {\n", index, dst)
+		if err := g.readValue(b, elemType(typ), tags{}, dst+"["+index+"]"); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "}\n")
+	} else {
+		slice, elem := g.tmpVar("slice"), g.tmpVar("elem")
+		fmt.Fprintf(b, "%s := %s{}\n", slice, g.typeString(typ))
+		fmt.Fprintf(b, "for dec.MoreDataInList() {\n")
+		fmt.Fprintf(b, "var %s %s\n", elem, g.typeString(elemType(typ)))
+		if err := g.readValue(b, elemType(typ), tags{}, elem); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s = append(%s, %s)\n}\n", slice, slice, elem)
+		fmt.Fprintf(b, "%s = %s\n", operand(dst), slice)
+	}
+	if !ts.tail {
+		fmt.Fprintf(b, "if err := dec.ListEnd(); err != nil {\nreturn err\n}\n")
+	}
+	return nil
+}
+
+func (g *generator) readStruct(b *bytes.Buffer, typ types.Type, dst string) error {
+	fields, err := structFields(typ)
+	if err != nil {
+		return err
+	}
+	if named, ok := typ.(*types.Named); ok && !g.expanding(named) {
+		g.stack = append(g.stack, named)
+		defer func() { g.stack = g.stack[:len(g.stack)-1] }()
+	}
+	fmt.Fprintf(b, "if _, err := dec.List(); err != nil {\nreturn err\n}\n")
+	// The list may end before any optional field, leaving it and all
+	// fields after it zero.
+	optional := 0
+	for _, f := range fields {
+		if f.tags.optional {
+			fmt.Fprintf(b, "if dec.MoreDataInList() {\n")
+			optional++
+		}
+		if err := g.readValue(b, f.Type(), f.tags, selector(dst, f.Name())); err != nil {
+			return structFieldError(typ, f, err)
+		}
+	}
+	fmt.Fprint(b, strings.Repeat("}\n", optional))
+	fmt.Fprintf(b, "if err := dec.ListEnd(); err != nil {\nreturn err\n}\n")
+	return nil
+}
+
+// nilKind mirrors rlp.Kind for the two kinds of empty values.
+type nilKind int
+
+const (
+	kindString nilKind = iota
+	kindList
+)
+
+// tags are the rlp struct tags of a field, see parseStructTag in package rlp.
+type tags struct {
+	nilOK    bool
+	nilKind  nilKind
+	tail     bool
+	ignored  bool
+	optional bool
+	signed   bool
+}
+
+type field struct {
+	*types.Var
+	tags tags
+}
+
+// structFields returns the encoded fields of a struct type: the exported ones
+// not ignored by a tag.
+func structFields(typ types.Type) ([]field, error) {
+	st := typ.Underlying().(*types.Struct)
+	lastPublic := 0
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Exported() {
+			lastPublic = i
+		}
+	}
+	var (
+		fields        []field
+		firstOptional string
+	)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		ts, err := parseStructTag(typ, st, i, lastPublic)
+		if err != nil {
+			return nil, err
+		}
+		if ts.ignored {
+			continue
+		}
+		if ts.optional || ts.tail {
+			if firstOptional == "" {
+				firstOptional = f.Name()
+			}
+		} else if firstOptional != "" {
+			msg := fmt.Sprintf("must be optional because preceding field %q is optional", firstOptional)
+			return nil, structTagError(typ, f, "", msg)
+		}
+		fields = append(fields, field{f, ts})
+	}
+	return fields, nil
+}
+
+func firstOptionalField(fields []field) int {
+	for i, f := range fields {
+		if f.tags.optional {
+			return i
+		}
+	}
+	return len(fields)
+}
+
+func parseStructTag(typ types.Type, st *types.Struct, i, lastPublic int) (tags, error) {
+	f := st.Field(i)
+	var ts tags
+	for _, t := range strings.Split(reflect.StructTag(st.Tag(i)).Get("rlp"), ",") {
+		switch t = strings.TrimSpace(t); t {
+		case "":
+		case "-":
+			ts.ignored = true
+		case "nil", "nilString", "nilList":
+			ts.nilOK = true
+			if !isPointer(f.Type()) {
+				return ts, structTagError(typ, f, t, "field is not a pointer")
+			}
+			switch t {
+			case "nil":
+				ts.nilKind = defaultNilKind(f.Type().Underlying().(*types.Pointer).Elem())
+			case "nilString":
+				ts.nilKind = kindString
+			case "nilList":
+				ts.nilKind = kindList
+			}
+		case "optional":
+			ts.optional = true
+			if ts.tail {
+				return ts, structTagError(typ, f, t, `also has "tail" tag`)
+			}
+		case "tail":
+			ts.tail = true
+			if ts.optional {
+				return ts, structTagError(typ, f, t, `also has "optional" tag`)
+			}
+			if i != lastPublic {
+				return ts, structTagError(typ, f, t, "must be on last field")
+			}
+			if _, ok := f.Type().Underlying().(*types.Slice); !ok {
+				return ts, structTagError(typ, f, t, "field type is not slice")
+			}
+		case "signed":
+			ts.signed = true
+			if !isInt(f.Type()) {
+				return ts, structTagError(typ, f, t, "field type is not a signed integer")
+			}
+		default:
+			return ts, fmt.Errorf("rlp: unknown struct tag %q on %s.%s", t, typeName(typ), f.Name())
+		}
+	}
+	return ts, nil
+}
+
+func structTagError(typ types.Type, f *types.Var, tag, err string) error {
+	return fmt.Errorf("rlp: invalid struct tag %q for %s.%s (%s)", tag, typeName(typ), f.Name(), err)
+}
+
+func structFieldError(typ types.Type, f field, err error) error {
+	return fmt.Errorf("%v (struct field %s.%s)", err, typeName(typ), f.Name())
+}
+
+// typeName formats typ for error messages the way package reflect does, with
+// package names rather than paths.
+func typeName(typ types.Type) string {
+	return types.TypeString(typ, func(pkg *types.Package) string { return pkg.Name() })
+}
+
+func defaultNilKind(typ types.Type) nilKind {
+	if isUint(typ) || isKind(typ, types.String) || isKind(typ, types.Bool) || isByteArray(typ, isByteForEncoding) {
+		return kindString
+	}
+	return kindList
+}
+
+func isNamed(typ types.Type, pkg, name string) bool {
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == pkg && named.Obj().Name() == name
+}
+
+func isRawValue(typ types.Type) bool { return isNamed(typ, rlpPackage, "RawValue") }
+
+func isBigInt(typ types.Type) bool { return isNamed(typ, "math/big", "Int") }
+
+func isBigIntPtr(typ types.Type) bool {
+	ptr, ok := typ.Underlying().(*types.Pointer)
+	return ok && isBigInt(ptr.Elem())
+}
+
+// bigIntOf returns the big.Int type typ points to.
+func bigIntOf(typ types.Type) types.Type {
+	return typ.Underlying().(*types.Pointer).Elem()
+}
+
+func isUint256(typ types.Type) bool { return isNamed(typ, uint256Package, "Int") }
+
+// isUint256Ptr reports whether typ is *uint256.Int. Unlike for big.Int,
+// package rlp doesn't accept named pointer types.
+func isUint256Ptr(typ types.Type) bool {
+	ptr, ok := typ.(*types.Pointer)
+	return ok && isUint256(ptr.Elem())
+}
+
+func isPointer(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Pointer)
+	return ok
+}
+
+func isStruct(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Struct)
+	return ok
+}
+
+func isInterface(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Interface)
+	return ok
+}
+
+func isMap(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Map)
+	return ok
+}
+
+func isArray(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Array)
+	return ok
+}
+
+func isSliceOrArray(typ types.Type) bool {
+	switch typ.Underlying().(type) {
+	case *types.Slice, *types.Array:
+		return true
+	}
+	return false
+}
+
+func elemType(typ types.Type) types.Type {
+	switch t := typ.Underlying().(type) {
+	case *types.Slice:
+		return t.Elem()
+	case *types.Array:
+		return t.Elem()
+	}
+	return nil
+}
+
+func isKind(typ types.Type, kind types.BasicKind) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Kind() == kind
+}
+
+func isUint(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	switch basic.Kind() {
+	case types.Uint, types.Uint8, types.Uint16, types.Uint32, types.Uint64, types.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isInt(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	switch basic.Kind() {
+	case types.Int, types.Int8, types.Int16, types.Int32, types.Int64:
+		return true
+	}
+	return false
+}
+
+// isByteForEncoding and isByteForDecoding report whether typ is encoded as a
+// byte of a string rather than as a list element, like isByte and the check
+// in makeListDecoder of package rlp.
+func isByteForEncoding(typ types.Type) bool {
+	return isKind(typ, types.Uint8) && !implementsEncoder(typ)
+}
+
+func isByteForDecoding(typ types.Type) bool {
+	return isKind(typ, types.Uint8) && !implementsDecoder(types.NewPointer(typ))
+}
+
+func isByteSlice(typ types.Type, isByte func(types.Type) bool) bool {
+	slice, ok := typ.Underlying().(*types.Slice)
+	return ok && isByte(slice.Elem())
+}
+
+func isByteArray(typ types.Type, isByte func(types.Type) bool) bool {
+	return isSliceOrArray(typ) && isByte(elemType(typ))
+}
+
+// checkByteElem rejects byte strings with a named element type, which can't
+// be converted to []byte without reflection.
+func checkByteElem(typ types.Type) error {
+	if !types.Identical(elemType(typ), types.Typ[types.Byte]) {
+		return fmt.Errorf("rlpgen: byte string %s with named element type is not supported", typeName(typ))
+	}
+	return nil
+}
+
+func implementsEncoder(typ types.Type) bool {
+	return hasMethod(typ, "EncodeRLP", "io.Writer")
+}
+
+func implementsDecoder(typ types.Type) bool {
+	return hasMethod(typ, "DecodeRLP", "*"+rlpPackage+".Stream")
+}
+
+// hasMethod reports whether typ has a method with the given name, taking a
+// single parameter of type param and returning an error.
+func hasMethod(typ types.Type, name, param string) bool {
+	sel := types.NewMethodSet(typ).Lookup(nil, name)
+	if sel == nil {
+		return false
+	}
+	sig := sel.Obj().Type().(*types.Signature)
+	return sig.Params().Len() == 1 && sig.Results().Len() == 1 &&
+		types.TypeString(sig.Params().At(0).Type(), nil) == param &&
+		types.TypeString(sig.Results().At(0).Type(), nil) == "error"
+}
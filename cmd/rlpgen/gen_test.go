@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestGentest checks that the checked-in code of the gentest package, whose
+// tests compare it with the reflective codec, is what rlpgen generates.
+func TestGentest(t *testing.T) {
+	cfg := Config{
+		Dir:     "internal/gentest",
+		Types:   []string{"Basics", "Tagged", "Nested", "Optional"},
+		Output:  "internal/gentest/gen_rlp.go",
+		Encoder: true,
+		Decoder: true,
+	}
+	have, err := cfg.Process()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(cfg.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("%s is out of date, run go generate in its directory", cfg.Output)
+	}
+}
+
+func TestInvalidTypes(t *testing.T) {
+	tests := []struct {
+		typ, err string
+	}{
+		{"TailNotLast", `rlp: invalid struct tag "tail" for invalid.TailNotLast.A (must be on last field)`},
+		{"TailNotSlice", `rlp: invalid struct tag "tail" for invalid.TailNotSlice.A (field type is not slice)`},
+		{"NilNotPointer", `rlp: invalid struct tag "nil" for invalid.NilNotPointer.A (field is not a pointer)`},
+		{"UnknownTag", `rlp: unknown struct tag "always" on invalid.UnknownTag.A`},
+		{"OptionalNotLast", `rlp: invalid struct tag "" for invalid.OptionalNotLast.C (must be optional because preceding field "A" is optional)`},
+		{"OptionalTail", `rlp: invalid struct tag "optional" for invalid.OptionalTail.A (also has "tail" tag)`},
+		{"Signed", "rlp: type int is not RLP-serializable (struct field invalid.Signed.A)"},
+		{"NestedSigned", "rlp: type int8 is not RLP-serializable (struct field struct{B []int8}.B) (struct field invalid.NestedSigned.Inner)"},
+		{"NamedBytes", "named element type is not supported"},
+		{"NotStruct", "NotStruct is not a struct type"},
+		{"Missing", "type Missing not found"},
+	}
+	for _, test := range tests {
+		cfg := Config{Dir: "testdata/invalid", Types: []string{test.typ}, Encoder: true, Decoder: true}
+		_, err := cfg.Process()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: have error %v, want %q", test.typ, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,1173 @@
+// Code generated by rlpgen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+	"github.com/pavelkrolevets/mpt/uint256"
+)
+
+// EncodeRLP implements rlp.Encoder.
+func (obj *Basics) EncodeRLP(_w io.Writer) error {
+	w := rlp.NewEncoderBuffer(_w)
+	_list0 := w.List()
+	w.WriteUint64(uint64(obj.U8))
+	w.WriteUint64(uint64(obj.U16))
+	w.WriteUint64(uint64(obj.U32))
+	w.WriteUint64(uint64(obj.U64))
+	w.WriteUint64(uint64(obj.U))
+	w.WriteBool(obj.Bool)
+	w.WriteString(obj.Str)
+	w.WriteBytes(obj.Bytes)
+	w.Write(rlp.EmptyString)
+	w.WriteBytes(obj.A1[:])
+	w.WriteBytes(obj.A20[:])
+	w.WriteBytes(obj.Hash[:])
+	if obj.Big == nil {
+		w.Write(rlp.EmptyString)
+	} else {
+		if obj.Big.Sign() == -1 {
+			return rlp.ErrNegativeBigInt
+		}
+		w.WriteBigInt(obj.Big)
+	}
+	if obj.BigV.Sign() == -1 {
+		return rlp.ErrNegativeBigInt
+	}
+	w.WriteBigInt(&obj.BigV)
+	if obj.U256 == nil {
+		w.Write(rlp.EmptyString)
+	} else {
+		w.WriteUint256(obj.U256)
+	}
+	w.WriteUint256(&obj.U256V)
+	w.Write(obj.Raw)
+	w.WriteUint64(uint64(obj.Level))
+	w.WriteString(string(obj.Name))
+	w.WriteBytes(obj.Blob)
+	w.ListEnd(_list0)
+	return w.Flush()
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (obj *Basics) DecodeRLP(dec *rlp.Stream) error {
+	var _tmp0 Basics
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_tmp1, err := dec.Uint8()
+	if err != nil {
+		return err
+	}
+	_tmp0.U8 = _tmp1
+	_tmp2, err := dec.Uint16()
+	if err != nil {
+		return err
+	}
+	_tmp0.U16 = _tmp2
+	_tmp3, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	_tmp0.U32 = _tmp3
+	_tmp4, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.U64 = _tmp4
+	_tmp5, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.U = uint(_tmp5)
+	_tmp6, err := dec.Bool()
+	if err != nil {
+		return err
+	}
+	_tmp0.Bool = _tmp6
+	_tmp7, err := dec.Bytes()
+	if err != nil {
+		return err
+	}
+	_tmp0.Str = string(_tmp7)
+	_tmp8, err := dec.Bytes()
+	if err != nil {
+		return err
+	}
+	_tmp0.Bytes = _tmp8
+	if err := dec.ReadBytes(_tmp0.A0[:]); err != nil {
+		return err
+	}
+	if err := dec.ReadBytes(_tmp0.A1[:]); err != nil {
+		return err
+	}
+	if err := dec.ReadBytes(_tmp0.A20[:]); err != nil {
+		return err
+	}
+	if err := dec.ReadBytes(_tmp0.Hash[:]); err != nil {
+		return err
+	}
+	_tmp9, err := dec.BigInt()
+	if err != nil {
+		return err
+	}
+	_tmp0.Big = _tmp9
+	_big10, err := dec.BigInt()
+	if err != nil {
+		return err
+	}
+	_tmp0.BigV = *_big10
+	_num11, err := dec.Uint256()
+	if err != nil {
+		return err
+	}
+	_tmp0.U256 = &_num11
+	_tmp12, err := dec.Uint256()
+	if err != nil {
+		return err
+	}
+	_tmp0.U256V = _tmp12
+	_tmp13, err := dec.Raw()
+	if err != nil {
+		return err
+	}
+	_tmp0.Raw = _tmp13
+	_tmp14, err := dec.Uint8()
+	if err != nil {
+		return err
+	}
+	_tmp0.Level = Level(_tmp14)
+	_tmp15, err := dec.Bytes()
+	if err != nil {
+		return err
+	}
+	_tmp0.Name = Name(_tmp15)
+	_tmp16, err := dec.Bytes()
+	if err != nil {
+		return err
+	}
+	_tmp0.Blob = _tmp16
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	*obj = _tmp0
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (obj *Tagged) EncodeRLP(_w io.Writer) error {
+	w := rlp.NewEncoderBuffer(_w)
+	_list0 := w.List()
+	if obj.NilUint == nil {
+		w.Write(rlp.EmptyString)
+	} else {
+		w.WriteUint64(uint64(*obj.NilUint))
+	}
+	if obj.NilInner == nil {
+		w.Write(rlp.EmptyList)
+	} else {
+		_list1 := w.List()
+		w.WriteUint64(uint64(obj.NilInner.X))
+		_list2 := w.List()
+		for _i3 := range obj.NilInner.Tags {
+			w.WriteString(obj.NilInner.Tags[_i3])
+		}
+		w.ListEnd(_list2)
+		if obj.NilInner.Next == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			if err := rlp.Encode(w, obj.NilInner.Next); err != nil {
+				return err
+			}
+		}
+		w.ListEnd(_list1)
+	}
+	if obj.NilStr == nil {
+		w.Write(rlp.EmptyString)
+	} else {
+		_list4 := w.List()
+		w.WriteUint64(uint64(obj.NilStr.X))
+		_list5 := w.List()
+		for _i6 := range obj.NilStr.Tags {
+			w.WriteString(obj.NilStr.Tags[_i6])
+		}
+		w.ListEnd(_list5)
+		if obj.NilStr.Next == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			if err := rlp.Encode(w, obj.NilStr.Next); err != nil {
+				return err
+			}
+		}
+		w.ListEnd(_list4)
+	}
+	if obj.NilList == nil {
+		w.Write(rlp.EmptyList)
+	} else {
+		w.WriteBytes((*obj.NilList)[:])
+	}
+	if obj.Ptr == nil {
+		w.Write(rlp.EmptyList)
+	} else {
+		_list7 := w.List()
+		w.WriteUint64(uint64(obj.Ptr.X))
+		_list8 := w.List()
+		for _i9 := range obj.Ptr.Tags {
+			w.WriteString(obj.Ptr.Tags[_i9])
+		}
+		w.ListEnd(_list8)
+		if obj.Ptr.Next == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			if err := rlp.Encode(w, obj.Ptr.Next); err != nil {
+				return err
+			}
+		}
+		w.ListEnd(_list7)
+	}
+	if obj.PtrUint == nil {
+		w.Write(rlp.EmptyString)
+	} else {
+		w.WriteUint64(uint64(*obj.PtrUint))
+	}
+	w.WriteUint64(uint64(int64(obj.I8)<<1) ^ uint64(int64(obj.I8)>>63))
+	w.WriteUint64(uint64(int64(obj.I64)<<1) ^ uint64(int64(obj.I64)>>63))
+	w.WriteUint64(uint64(int64(obj.Delta)<<1) ^ uint64(int64(obj.Delta)>>63))
+	for _i10 := range obj.Tail {
+		w.WriteUint64(uint64(obj.Tail[_i10]))
+	}
+	w.ListEnd(_list0)
+	return w.Flush()
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (obj *Tagged) DecodeRLP(dec *rlp.Stream) error {
+	var _tmp0 Tagged
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	if _kind2, _size3, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind2 != rlp.Byte && _size3 == 0 {
+		if _kind2 != rlp.String {
+			return rlp.ErrExpectedString
+		}
+		if _, err := dec.Bytes(); err != nil {
+			return err
+		}
+		_tmp0.NilUint = nil
+	} else {
+		_ptr1 := new(uint64)
+		_tmp4, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		*_ptr1 = _tmp4
+		_tmp0.NilUint = _ptr1
+	}
+	if _kind6, _size7, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind6 != rlp.Byte && _size7 == 0 {
+		if _kind6 != rlp.List {
+			return rlp.ErrExpectedList
+		}
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.NilInner = nil
+	} else {
+		_ptr5 := new(Inner)
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_tmp8, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		_ptr5.X = _tmp8
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_slice9 := []string{}
+		for dec.MoreDataInList() {
+			var _elem10 string
+			_tmp11, err := dec.Bytes()
+			if err != nil {
+				return err
+			}
+			_elem10 = string(_tmp11)
+			_slice9 = append(_slice9, _elem10)
+		}
+		_ptr5.Tags = _slice9
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		if _kind13, _size14, err := dec.Kind(); err != nil {
+			return err
+		} else if _kind13 != rlp.Byte && _size14 == 0 {
+			if _kind13 != rlp.List {
+				return rlp.ErrExpectedList
+			}
+			if _, err := dec.List(); err != nil {
+				return err
+			}
+			if err := dec.ListEnd(); err != nil {
+				return err
+			}
+			_ptr5.Next = nil
+		} else {
+			_ptr12 := new(Inner)
+			if err := dec.Decode(_ptr12); err != nil {
+				return err
+			}
+			_ptr5.Next = _ptr12
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.NilInner = _ptr5
+	}
+	if _kind16, _size17, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind16 != rlp.Byte && _size17 == 0 {
+		if _kind16 != rlp.String {
+			return rlp.ErrExpectedString
+		}
+		if _, err := dec.Bytes(); err != nil {
+			return err
+		}
+		_tmp0.NilStr = nil
+	} else {
+		_ptr15 := new(Inner)
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_tmp18, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		_ptr15.X = _tmp18
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_slice19 := []string{}
+		for dec.MoreDataInList() {
+			var _elem20 string
+			_tmp21, err := dec.Bytes()
+			if err != nil {
+				return err
+			}
+			_elem20 = string(_tmp21)
+			_slice19 = append(_slice19, _elem20)
+		}
+		_ptr15.Tags = _slice19
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		if _kind23, _size24, err := dec.Kind(); err != nil {
+			return err
+		} else if _kind23 != rlp.Byte && _size24 == 0 {
+			if _kind23 != rlp.List {
+				return rlp.ErrExpectedList
+			}
+			if _, err := dec.List(); err != nil {
+				return err
+			}
+			if err := dec.ListEnd(); err != nil {
+				return err
+			}
+			_ptr15.Next = nil
+		} else {
+			_ptr22 := new(Inner)
+			if err := dec.Decode(_ptr22); err != nil {
+				return err
+			}
+			_ptr15.Next = _ptr22
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.NilStr = _ptr15
+	}
+	if _kind26, _size27, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind26 != rlp.Byte && _size27 == 0 {
+		if _kind26 != rlp.List {
+			return rlp.ErrExpectedList
+		}
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.NilList = nil
+	} else {
+		_ptr25 := new([4]byte)
+		if err := dec.ReadBytes((*_ptr25)[:]); err != nil {
+			return err
+		}
+		_tmp0.NilList = _ptr25
+	}
+	_ptr28 := new(Inner)
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_tmp29, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_ptr28.X = _tmp29
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice30 := []string{}
+	for dec.MoreDataInList() {
+		var _elem31 string
+		_tmp32, err := dec.Bytes()
+		if err != nil {
+			return err
+		}
+		_elem31 = string(_tmp32)
+		_slice30 = append(_slice30, _elem31)
+	}
+	_ptr28.Tags = _slice30
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _kind34, _size35, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind34 != rlp.Byte && _size35 == 0 {
+		if _kind34 != rlp.List {
+			return rlp.ErrExpectedList
+		}
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_ptr28.Next = nil
+	} else {
+		_ptr33 := new(Inner)
+		if err := dec.Decode(_ptr33); err != nil {
+			return err
+		}
+		_ptr28.Next = _ptr33
+	}
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	_tmp0.Ptr = _ptr28
+	_ptr36 := new(uint32)
+	_tmp37, err := dec.Uint32()
+	if err != nil {
+		return err
+	}
+	*_ptr36 = _tmp37
+	_tmp0.PtrUint = _ptr36
+	_tmp38, err := dec.Uint8()
+	if err != nil {
+		return err
+	}
+	_tmp0.I8 = int8(int64(_tmp38>>1) ^ -int64(_tmp38&1))
+	_tmp39, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.I64 = int64(_tmp39>>1) ^ -int64(_tmp39&1)
+	_tmp40, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.Delta = Delta(int64(_tmp40>>1) ^ -int64(_tmp40&1))
+	_slice41 := []uint16{}
+	for dec.MoreDataInList() {
+		var _elem42 uint16
+		_tmp43, err := dec.Uint16()
+		if err != nil {
+			return err
+		}
+		_elem42 = _tmp43
+		_slice41 = append(_slice41, _elem42)
+	}
+	_tmp0.Tail = _slice41
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	*obj = _tmp0
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (obj *Nested) EncodeRLP(_w io.Writer) error {
+	w := rlp.NewEncoderBuffer(_w)
+	_list0 := w.List()
+	_list1 := w.List()
+	w.WriteUint64(uint64(obj.Inner.X))
+	_list2 := w.List()
+	for _i3 := range obj.Inner.Tags {
+		w.WriteString(obj.Inner.Tags[_i3])
+	}
+	w.ListEnd(_list2)
+	if obj.Inner.Next == nil {
+		w.Write(rlp.EmptyList)
+	} else {
+		if err := rlp.Encode(w, obj.Inner.Next); err != nil {
+			return err
+		}
+	}
+	w.ListEnd(_list1)
+	_list4 := w.List()
+	for _i5 := range obj.Inners {
+		_list6 := w.List()
+		w.WriteUint64(uint64(obj.Inners[_i5].X))
+		_list7 := w.List()
+		for _i8 := range obj.Inners[_i5].Tags {
+			w.WriteString(obj.Inners[_i5].Tags[_i8])
+		}
+		w.ListEnd(_list7)
+		if obj.Inners[_i5].Next == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			if err := rlp.Encode(w, obj.Inners[_i5].Next); err != nil {
+				return err
+			}
+		}
+		w.ListEnd(_list6)
+	}
+	w.ListEnd(_list4)
+	_list9 := w.List()
+	for _i10 := range obj.Ptrs {
+		if obj.Ptrs[_i10] == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			_list11 := w.List()
+			w.WriteUint64(uint64(obj.Ptrs[_i10].X))
+			_list12 := w.List()
+			for _i13 := range obj.Ptrs[_i10].Tags {
+				w.WriteString(obj.Ptrs[_i10].Tags[_i13])
+			}
+			w.ListEnd(_list12)
+			if obj.Ptrs[_i10].Next == nil {
+				w.Write(rlp.EmptyList)
+			} else {
+				if err := rlp.Encode(w, obj.Ptrs[_i10].Next); err != nil {
+					return err
+				}
+			}
+			w.ListEnd(_list11)
+		}
+	}
+	w.ListEnd(_list9)
+	_list14 := w.List()
+	for _i15 := range obj.Matrix {
+		w.WriteBytes(obj.Matrix[_i15])
+	}
+	w.ListEnd(_list14)
+	_list16 := w.List()
+	for _i17 := range obj.Arr {
+		w.WriteUint64(uint64(obj.Arr[_i17]))
+	}
+	w.ListEnd(_list16)
+	_list18 := w.List()
+	w.WriteUint64(uint64(obj.Anon.A))
+	w.WriteUint64(uint64(obj.Anon.B))
+	w.ListEnd(_list18)
+	if obj.Any == nil {
+		w.Write(rlp.EmptyList)
+	} else if err := rlp.Encode(w, obj.Any); err != nil {
+		return err
+	}
+	if err := rlp.Encode(w, &obj.Custom); err != nil {
+		return err
+	}
+	_list19 := w.List()
+	for _i20 := range obj.Customs {
+		if err := rlp.Encode(w, &obj.Customs[_i20]); err != nil {
+			return err
+		}
+	}
+	w.ListEnd(_list19)
+	_list21 := w.List()
+	for _i22 := range obj.Hashes {
+		w.WriteBytes(obj.Hashes[_i22][:])
+	}
+	w.ListEnd(_list21)
+	if err := rlp.Encode(w, obj.Attrs); err != nil {
+		return err
+	}
+	if err := rlp.Encode(w, obj.Set); err != nil {
+		return err
+	}
+	if obj.Self == nil {
+		w.Write(rlp.EmptyList)
+	} else {
+		if err := rlp.Encode(w, obj.Self); err != nil {
+			return err
+		}
+	}
+	w.ListEnd(_list0)
+	return w.Flush()
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (obj *Nested) DecodeRLP(dec *rlp.Stream) error {
+	var _tmp0 Nested
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_tmp1, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.Inner.X = _tmp1
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice2 := []string{}
+	for dec.MoreDataInList() {
+		var _elem3 string
+		_tmp4, err := dec.Bytes()
+		if err != nil {
+			return err
+		}
+		_elem3 = string(_tmp4)
+		_slice2 = append(_slice2, _elem3)
+	}
+	_tmp0.Inner.Tags = _slice2
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _kind6, _size7, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind6 != rlp.Byte && _size7 == 0 {
+		if _kind6 != rlp.List {
+			return rlp.ErrExpectedList
+		}
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.Inner.Next = nil
+	} else {
+		_ptr5 := new(Inner)
+		if err := dec.Decode(_ptr5); err != nil {
+			return err
+		}
+		_tmp0.Inner.Next = _ptr5
+	}
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice8 := []Inner{}
+	for dec.MoreDataInList() {
+		var _elem9 Inner
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_tmp10, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		_elem9.X = _tmp10
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_slice11 := []string{}
+		for dec.MoreDataInList() {
+			var _elem12 string
+			_tmp13, err := dec.Bytes()
+			if err != nil {
+				return err
+			}
+			_elem12 = string(_tmp13)
+			_slice11 = append(_slice11, _elem12)
+		}
+		_elem9.Tags = _slice11
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		if _kind15, _size16, err := dec.Kind(); err != nil {
+			return err
+		} else if _kind15 != rlp.Byte && _size16 == 0 {
+			if _kind15 != rlp.List {
+				return rlp.ErrExpectedList
+			}
+			if _, err := dec.List(); err != nil {
+				return err
+			}
+			if err := dec.ListEnd(); err != nil {
+				return err
+			}
+			_elem9.Next = nil
+		} else {
+			_ptr14 := new(Inner)
+			if err := dec.Decode(_ptr14); err != nil {
+				return err
+			}
+			_elem9.Next = _ptr14
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_slice8 = append(_slice8, _elem9)
+	}
+	_tmp0.Inners = _slice8
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice17 := []*Inner{}
+	for dec.MoreDataInList() {
+		var _elem18 *Inner
+		_ptr19 := new(Inner)
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_tmp20, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		_ptr19.X = _tmp20
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		_slice21 := []string{}
+		for dec.MoreDataInList() {
+			var _elem22 string
+			_tmp23, err := dec.Bytes()
+			if err != nil {
+				return err
+			}
+			_elem22 = string(_tmp23)
+			_slice21 = append(_slice21, _elem22)
+		}
+		_ptr19.Tags = _slice21
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		if _kind25, _size26, err := dec.Kind(); err != nil {
+			return err
+		} else if _kind25 != rlp.Byte && _size26 == 0 {
+			if _kind25 != rlp.List {
+				return rlp.ErrExpectedList
+			}
+			if _, err := dec.List(); err != nil {
+				return err
+			}
+			if err := dec.ListEnd(); err != nil {
+				return err
+			}
+			_ptr19.Next = nil
+		} else {
+			_ptr24 := new(Inner)
+			if err := dec.Decode(_ptr24); err != nil {
+				return err
+			}
+			_ptr19.Next = _ptr24
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_elem18 = _ptr19
+		_slice17 = append(_slice17, _elem18)
+	}
+	_tmp0.Ptrs = _slice17
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice27 := [][]byte{}
+	for dec.MoreDataInList() {
+		var _elem28 []byte
+		_tmp29, err := dec.Bytes()
+		if err != nil {
+			return err
+		}
+		_elem28 = _tmp29
+		_slice27 = append(_slice27, _elem28)
+	}
+	_tmp0.Matrix = _slice27
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	for _i30 := range _tmp0.Arr {
+		_tmp31, err := dec.Uint16()
+		if err != nil {
+			return err
+		}
+		_tmp0.Arr[_i30] = _tmp31
+	}
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_tmp32, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.Anon.A = uint(_tmp32)
+	_tmp33, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.Anon.B = uint(_tmp33)
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if err := dec.Decode(&_tmp0.Any); err != nil {
+		return err
+	}
+	if err := dec.Decode(&_tmp0.Custom); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice34 := []Custom{}
+	for dec.MoreDataInList() {
+		var _elem35 Custom
+		if err := dec.Decode(&_elem35); err != nil {
+			return err
+		}
+		_slice34 = append(_slice34, _elem35)
+	}
+	_tmp0.Customs = _slice34
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_slice36 := []common.Hash{}
+	for dec.MoreDataInList() {
+		var _elem37 common.Hash
+		if err := dec.ReadBytes(_elem37[:]); err != nil {
+			return err
+		}
+		_slice36 = append(_slice36, _elem37)
+	}
+	_tmp0.Hashes = _slice36
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	if err := dec.Decode(&_tmp0.Attrs); err != nil {
+		return err
+	}
+	if err := dec.Decode(&_tmp0.Set); err != nil {
+		return err
+	}
+	if _kind39, _size40, err := dec.Kind(); err != nil {
+		return err
+	} else if _kind39 != rlp.Byte && _size40 == 0 {
+		if _kind39 != rlp.List {
+			return rlp.ErrExpectedList
+		}
+		if _, err := dec.List(); err != nil {
+			return err
+		}
+		if err := dec.ListEnd(); err != nil {
+			return err
+		}
+		_tmp0.Self = nil
+	} else {
+		_ptr38 := new(Nested)
+		if err := dec.Decode(_ptr38); err != nil {
+			return err
+		}
+		_tmp0.Self = _ptr38
+	}
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	*obj = _tmp0
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (obj *Optional) EncodeRLP(_w io.Writer) error {
+	w := rlp.NewEncoderBuffer(_w)
+	_nonzero0 := obj.B != 0
+	_nonzero1 := obj.Hash != (common.Hash{})
+	_nonzero2 := obj.Big != nil
+	_nonzero3 := obj.BigV.Sign() != 0
+	_nonzero4 := (obj.Inner.X != 0) || (obj.Inner.Tags != nil) || (obj.Inner.Next != nil)
+	_nonzero5 := obj.Ptr != nil
+	_nonzero6 := obj.U256 != (uint256.Int{})
+	_nonzero7 := obj.Tail != nil
+	_list8 := w.List()
+	w.WriteUint64(uint64(obj.A))
+	if _nonzero0 || _nonzero1 || _nonzero2 || _nonzero3 || _nonzero4 || _nonzero5 || _nonzero6 || _nonzero7 {
+		w.WriteUint64(uint64(obj.B))
+	}
+	if _nonzero1 || _nonzero2 || _nonzero3 || _nonzero4 || _nonzero5 || _nonzero6 || _nonzero7 {
+		w.WriteBytes(obj.Hash[:])
+	}
+	if _nonzero2 || _nonzero3 || _nonzero4 || _nonzero5 || _nonzero6 || _nonzero7 {
+		if obj.Big == nil {
+			w.Write(rlp.EmptyString)
+		} else {
+			if obj.Big.Sign() == -1 {
+				return rlp.ErrNegativeBigInt
+			}
+			w.WriteBigInt(obj.Big)
+		}
+	}
+	if _nonzero3 || _nonzero4 || _nonzero5 || _nonzero6 || _nonzero7 {
+		if obj.BigV.Sign() == -1 {
+			return rlp.ErrNegativeBigInt
+		}
+		w.WriteBigInt(&obj.BigV)
+	}
+	if _nonzero4 || _nonzero5 || _nonzero6 || _nonzero7 {
+		_list9 := w.List()
+		w.WriteUint64(uint64(obj.Inner.X))
+		_list10 := w.List()
+		for _i11 := range obj.Inner.Tags {
+			w.WriteString(obj.Inner.Tags[_i11])
+		}
+		w.ListEnd(_list10)
+		if obj.Inner.Next == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			if err := rlp.Encode(w, obj.Inner.Next); err != nil {
+				return err
+			}
+		}
+		w.ListEnd(_list9)
+	}
+	if _nonzero5 || _nonzero6 || _nonzero7 {
+		if obj.Ptr == nil {
+			w.Write(rlp.EmptyList)
+		} else {
+			_list12 := w.List()
+			w.WriteUint64(uint64(obj.Ptr.X))
+			_list13 := w.List()
+			for _i14 := range obj.Ptr.Tags {
+				w.WriteString(obj.Ptr.Tags[_i14])
+			}
+			w.ListEnd(_list13)
+			if obj.Ptr.Next == nil {
+				w.Write(rlp.EmptyList)
+			} else {
+				if err := rlp.Encode(w, obj.Ptr.Next); err != nil {
+					return err
+				}
+			}
+			w.ListEnd(_list12)
+		}
+	}
+	if _nonzero6 || _nonzero7 {
+		w.WriteUint256(&obj.U256)
+	}
+	if _nonzero7 {
+		for _i15 := range obj.Tail {
+			w.WriteUint64(uint64(obj.Tail[_i15]))
+		}
+	}
+	w.ListEnd(_list8)
+	return w.Flush()
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (obj *Optional) DecodeRLP(dec *rlp.Stream) error {
+	var _tmp0 Optional
+	if _, err := dec.List(); err != nil {
+		return err
+	}
+	_tmp1, err := dec.Uint()
+	if err != nil {
+		return err
+	}
+	_tmp0.A = _tmp1
+	if dec.MoreDataInList() {
+		_tmp2, err := dec.Uint()
+		if err != nil {
+			return err
+		}
+		_tmp0.B = _tmp2
+		if dec.MoreDataInList() {
+			if err := dec.ReadBytes(_tmp0.Hash[:]); err != nil {
+				return err
+			}
+			if dec.MoreDataInList() {
+				_tmp3, err := dec.BigInt()
+				if err != nil {
+					return err
+				}
+				_tmp0.Big = _tmp3
+				if dec.MoreDataInList() {
+					_big4, err := dec.BigInt()
+					if err != nil {
+						return err
+					}
+					_tmp0.BigV = *_big4
+					if dec.MoreDataInList() {
+						if _, err := dec.List(); err != nil {
+							return err
+						}
+						_tmp5, err := dec.Uint()
+						if err != nil {
+							return err
+						}
+						_tmp0.Inner.X = _tmp5
+						if _, err := dec.List(); err != nil {
+							return err
+						}
+						_slice6 := []string{}
+						for dec.MoreDataInList() {
+							var _elem7 string
+							_tmp8, err := dec.Bytes()
+							if err != nil {
+								return err
+							}
+							_elem7 = string(_tmp8)
+							_slice6 = append(_slice6, _elem7)
+						}
+						_tmp0.Inner.Tags = _slice6
+						if err := dec.ListEnd(); err != nil {
+							return err
+						}
+						if _kind10, _size11, err := dec.Kind(); err != nil {
+							return err
+						} else if _kind10 != rlp.Byte && _size11 == 0 {
+							if _kind10 != rlp.List {
+								return rlp.ErrExpectedList
+							}
+							if _, err := dec.List(); err != nil {
+								return err
+							}
+							if err := dec.ListEnd(); err != nil {
+								return err
+							}
+							_tmp0.Inner.Next = nil
+						} else {
+							_ptr9 := new(Inner)
+							if err := dec.Decode(_ptr9); err != nil {
+								return err
+							}
+							_tmp0.Inner.Next = _ptr9
+						}
+						if err := dec.ListEnd(); err != nil {
+							return err
+						}
+						if dec.MoreDataInList() {
+							if _kind13, _size14, err := dec.Kind(); err != nil {
+								return err
+							} else if _kind13 != rlp.Byte && _size14 == 0 {
+								if _kind13 != rlp.List {
+									return rlp.ErrExpectedList
+								}
+								if _, err := dec.List(); err != nil {
+									return err
+								}
+								if err := dec.ListEnd(); err != nil {
+									return err
+								}
+								_tmp0.Ptr = nil
+							} else {
+								_ptr12 := new(Inner)
+								if _, err := dec.List(); err != nil {
+									return err
+								}
+								_tmp15, err := dec.Uint()
+								if err != nil {
+									return err
+								}
+								_ptr12.X = _tmp15
+								if _, err := dec.List(); err != nil {
+									return err
+								}
+								_slice16 := []string{}
+								for dec.MoreDataInList() {
+									var _elem17 string
+									_tmp18, err := dec.Bytes()
+									if err != nil {
+										return err
+									}
+									_elem17 = string(_tmp18)
+									_slice16 = append(_slice16, _elem17)
+								}
+								_ptr12.Tags = _slice16
+								if err := dec.ListEnd(); err != nil {
+									return err
+								}
+								if _kind20, _size21, err := dec.Kind(); err != nil {
+									return err
+								} else if _kind20 != rlp.Byte && _size21 == 0 {
+									if _kind20 != rlp.List {
+										return rlp.ErrExpectedList
+									}
+									if _, err := dec.List(); err != nil {
+										return err
+									}
+									if err := dec.ListEnd(); err != nil {
+										return err
+									}
+									_ptr12.Next = nil
+								} else {
+									_ptr19 := new(Inner)
+									if err := dec.Decode(_ptr19); err != nil {
+										return err
+									}
+									_ptr12.Next = _ptr19
+								}
+								if err := dec.ListEnd(); err != nil {
+									return err
+								}
+								_tmp0.Ptr = _ptr12
+							}
+							if dec.MoreDataInList() {
+								_tmp22, err := dec.Uint256()
+								if err != nil {
+									return err
+								}
+								_tmp0.U256 = _tmp22
+								_slice23 := []uint{}
+								for dec.MoreDataInList() {
+									var _elem24 uint
+									_tmp25, err := dec.Uint()
+									if err != nil {
+										return err
+									}
+									_elem24 = uint(_tmp25)
+									_slice23 = append(_slice23, _elem24)
+								}
+								_tmp0.Tail = _slice23
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := dec.ListEnd(); err != nil {
+		return err
+	}
+	*obj = _tmp0
+	return nil
+}
@@ -0,0 +1,167 @@
+package gentest
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+	"github.com/pavelkrolevets/mpt/uint256"
+)
+
+// The plain types have the layout of the generated ones but no methods, so
+// package rlp encodes and decodes them through reflection.
+type (
+	plainBasics   Basics
+	plainTagged   Tagged
+	plainNested   Nested
+	plainOptional Optional
+)
+
+var plainTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(Basics{}):   reflect.TypeOf(plainBasics{}),
+	reflect.TypeOf(Tagged{}):   reflect.TypeOf(plainTagged{}),
+	reflect.TypeOf(Nested{}):   reflect.TypeOf(plainNested{}),
+	reflect.TypeOf(Optional{}): reflect.TypeOf(plainOptional{}),
+}
+
+// plain returns v, a pointer to a generated type, as a pointer to its plain
+// counterpart.
+func plain(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	return rv.Convert(reflect.PtrTo(plainTypes[rv.Type().Elem()])).Interface()
+}
+
+func uint64p(i uint64) *uint64 { return &i }
+func uint32p(i uint32) *uint32 { return &i }
+
+func testValues() []interface{} {
+	big1 := new(big.Int).Lsh(big.NewInt(0xFF), 100)
+	inner := &Inner{X: 300, Tags: []string{"a", "", "a longer tag that needs more than fifty-five bytes of string"}}
+	return []interface{}{
+		&Basics{},
+		&Basics{
+			U8: 0x7F, U16: 0x80, U32: 0xFFFFFF, U64: 1 << 63, U: 1,
+			Bool:  true,
+			Str:   "x",
+			Bytes: []byte{0x00},
+			A1:    [1]byte{0x80},
+			A20:   [20]byte{1, 2, 3},
+			Hash:  common.HexToHash("0xfeed"),
+			Big:   big1,
+			BigV:  *big.NewInt(1000),
+			U256:  &uint256.Int{1, 2, 3, 4},
+			U256V: *uint256.NewInt(0x80),
+			Raw:   rlp.RawValue{0xC2, 0x01, 0x02},
+			Level: 200,
+			Name:  "name",
+			Blob:  bytes.Repeat([]byte{0xAB}, 100),
+		},
+		&Basics{A1: [1]byte{0x01}, Big: new(big.Int), U256: new(uint256.Int), Bytes: []byte{}, Raw: rlp.RawValue{0x80}},
+		&Tagged{},
+		&Tagged{Tail: []uint16{}},
+		&Tagged{
+			NilUint:  uint64p(0),
+			NilInner: inner,
+			NilStr:   &Inner{},
+			NilList:  &[4]byte{1, 2, 3, 4},
+			Ptr:      &Inner{Next: inner},
+			PtrUint:  uint32p(7),
+			I8:       -128,
+			I64:      -1 << 63,
+			Delta:    -300,
+			Tail:     []uint16{1, 2, 0xFFFF},
+		},
+		&Nested{Custom: Custom{Value: "v"}},
+		&Nested{
+			Inner:   *inner,
+			Inners:  []Inner{*inner, {}},
+			Ptrs:    []*Inner{inner, nil},
+			Matrix:  [][]byte{{}, {1}, bytes.Repeat([]byte{2}, 60)},
+			Arr:     [3]uint16{1, 0, 0x1000},
+			Any:     []interface{}{[]byte("any"), uint(5), []interface{}{}},
+			Custom:  Custom{Value: "c"},
+			Customs: []Custom{{Value: "1"}, {}},
+			Hashes:  []common.Hash{{1}, {}},
+			Attrs:   map[string][]byte{"b": {1}, "a": nil, "long": bytes.Repeat([]byte{3}, 60)},
+			Set:     map[uint16]struct{}{0: {}, 0x7F: {}, 0x100: {}},
+			Self:    &Nested{Any: "inner", Custom: Custom{Value: "self"}},
+		},
+		&Optional{},
+		&Optional{A: 1, B: 2},
+		&Optional{Hash: common.Hash{1}},
+		&Optional{Big: new(big.Int)},
+		&Optional{BigV: *big.NewInt(5)},
+		&Optional{Inner: Inner{Tags: []string{}}},
+		&Optional{Inner: Inner{Next: &Inner{}}},
+		&Optional{Ptr: &Inner{}},
+		&Optional{U256: *uint256.NewInt(1)},
+		&Optional{Tail: []uint{}},
+		&Optional{B: 3, Tail: []uint{1, 2}},
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for i, v := range testValues() {
+		want, err := rlp.EncodeToBytes(plain(v))
+		if err != nil {
+			t.Fatalf("%d: reflective encoding error: %v", i, err)
+		}
+		have, err := rlp.EncodeToBytes(v)
+		if err != nil {
+			t.Fatalf("%d: generated encoding error: %v", i, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%d: encoding mismatch\nhave %x\nwant %x", i, have, want)
+		}
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	v := &Basics{Big: big.NewInt(-1)}
+	if _, err := rlp.EncodeToBytes(v); err == nil {
+		t.Error("generated encoder accepted negative *big.Int")
+	}
+	v = &Basics{BigV: *big.NewInt(-1)}
+	if _, err := rlp.EncodeToBytes(v); err == nil {
+		t.Error("generated encoder accepted negative big.Int")
+	}
+}
+
+func TestDecoding(t *testing.T) {
+	for i, v := range testValues() {
+		enc, err := rlp.EncodeToBytes(plain(v))
+		if err != nil {
+			t.Fatalf("%d: encoding error: %v", i, err)
+		}
+		typ := reflect.TypeOf(v).Elem()
+		checkDecoding(t, typ, enc)
+		// Damaged inputs must fail or succeed for both decoders alike.
+		for pos := range enc {
+			for _, b := range []byte{0x00, 0x01, 0x7F, 0x80, 0x81, 0xB8, 0xC0, 0xF8, enc[pos] ^ 0x01} {
+				damaged := common.CopyBytes(enc)
+				damaged[pos] = b
+				checkDecoding(t, typ, damaged)
+			}
+			checkDecoding(t, typ, enc[:pos])
+		}
+	}
+}
+
+// checkDecoding decodes input into a value of the generated type typ, and its
+// plain counterpart, and compares the results.
+func checkDecoding(t *testing.T, typ reflect.Type, input []byte) {
+	t.Helper()
+	gen := reflect.New(typ)
+	ref := reflect.New(plainTypes[typ])
+	genErr := rlp.DecodeBytes(input, gen.Interface())
+	refErr := rlp.DecodeBytes(input, ref.Interface())
+	switch {
+	case (genErr == nil) != (refErr == nil):
+		t.Errorf("%v %x: generated decoder error %v, reflective decoder error %v", typ, input, genErr, refErr)
+	case genErr == nil && !reflect.DeepEqual(gen.Interface(), ref.Convert(gen.Type()).Interface()):
+		t.Errorf("%v %x: decoded values differ\ngenerated  %+v\nreflective %+v", typ, input, gen.Elem(), ref.Elem())
+	}
+}
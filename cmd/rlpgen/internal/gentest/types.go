@@ -0,0 +1,122 @@
+// Package gentest holds the types the rlpgen tests generate code for. The
+// generated methods in gen_rlp.go must encode and decode exactly like the
+// reflective codec of package rlp.
+package gentest
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+	"github.com/pavelkrolevets/mpt/uint256"
+)
+
+//go:generate go run github.com/pavelkrolevets/mpt/cmd/rlpgen -type Basics,Tagged,Nested,Optional -out gen_rlp.go
+
+// Basics has a field of every scalar and byte string type.
+type Basics struct {
+	U8    uint8
+	U16   uint16
+	U32   uint32
+	U64   uint64
+	U     uint
+	Bool  bool
+	Str   string
+	Bytes []byte
+	A0    [0]byte
+	A1    [1]byte
+	A20   [20]byte
+	Hash  common.Hash
+	Big   *big.Int
+	BigV  big.Int
+	U256  *uint256.Int
+	U256V uint256.Int
+	Raw   rlp.RawValue
+	Level Level
+	Name  Name
+	Blob  Blob
+
+	private uint64
+}
+
+// Tagged uses every struct tag.
+type Tagged struct {
+	Skipped  func()   `rlp:"-"`
+	NilUint  *uint64  `rlp:"nil"`
+	NilInner *Inner   `rlp:"nil"`
+	NilStr   *Inner   `rlp:"nilString"`
+	NilList  *[4]byte `rlp:"nilList"`
+	Ptr      *Inner
+	PtrUint  *uint32
+	I8       int8     `rlp:"signed"`
+	I64      int64    `rlp:"signed"`
+	Delta    Delta    `rlp:"signed"`
+	Tail     []uint16 `rlp:"tail"`
+}
+
+// Nested has lists, nested structs, encoders and a recursive field.
+type Nested struct {
+	Inner   Inner
+	Inners  []Inner
+	Ptrs    []*Inner
+	Matrix  [][]byte
+	Arr     [3]uint16
+	Anon    struct{ A, B uint }
+	Any     interface{}
+	Custom  Custom
+	Customs []Custom
+	Hashes  []common.Hash
+	Attrs   map[string][]byte
+	Set     map[uint16]struct{}
+	Self    *Nested `rlp:"nil"`
+}
+
+// Optional has trailing optional fields of several kinds and a tail.
+type Optional struct {
+	A     uint64
+	B     uint64      `rlp:"optional"`
+	Hash  common.Hash `rlp:"optional"`
+	Big   *big.Int    `rlp:"optional"`
+	BigV  big.Int     `rlp:"optional"`
+	Inner Inner       `rlp:"optional"`
+	Ptr   *Inner      `rlp:"optional,nil"`
+	U256  uint256.Int `rlp:"optional"`
+	Tail  []uint      `rlp:"tail"`
+}
+
+// Inner is a struct without RLP methods, encoded inline.
+type Inner struct {
+	X    uint64
+	Tags []string
+	Next *Inner `rlp:"nil"`
+}
+
+type (
+	Level uint8
+	Name  string
+	Blob  []byte
+	Delta int
+)
+
+// Custom implements rlp.Encoder and rlp.Decoder, encoding as a string
+// prefixed with a marker.
+type Custom struct {
+	Value string
+}
+
+func (c *Custom) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, "custom:"+c.Value)
+}
+
+func (c *Custom) DecodeRLP(s *rlp.Stream) error {
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(b) < 7 || string(b[:7]) != "custom:" {
+		return rlp.ErrExpectedString
+	}
+	c.Value = string(b[7:])
+	return nil
+}
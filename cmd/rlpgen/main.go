@@ -0,0 +1,54 @@
+// Command rlpgen generates reflection-free RLP encoders and decoders for Go
+// struct types. The generated EncodeRLP and DecodeRLP methods follow the same
+// rules as the reflective codec in package rlp, struct tags included, so the
+// encodings are byte-identical.
+//
+// Typical use is from a go:generate directive in the package of the types:
+//
+//	//go:generate go run github.com/pavelkrolevets/mpt/cmd/rlpgen -type Header,Body -out gen_rlp.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	var (
+		dir     = flag.String("dir", ".", "directory of the input package")
+		typ     = flag.String("type", "", "comma separated struct types to generate methods for")
+		out     = flag.String("out", "-", "output file, - for stdout")
+		encoder = flag.Bool("encoder", true, "generate EncodeRLP")
+		decoder = flag.Bool("decoder", true, "generate DecodeRLP")
+	)
+	flag.Parse()
+	if *typ == "" {
+		fmt.Fprintln(os.Stderr, "Usage: rlpgen -type <types> [flags]")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	cfg := Config{
+		Dir:     *dir,
+		Types:   strings.Split(*typ, ","),
+		Encoder: *encoder,
+		Decoder: *decoder,
+	}
+	if *out != "-" {
+		cfg.Output = *out
+	}
+	code, err := cfg.Process()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	if cfg.Output == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	if err := os.WriteFile(cfg.Output, code, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package invalid
+
+type TailNotLast struct {
+	A []uint `rlp:"tail"`
+	B uint
+}
+
+type TailNotSlice struct {
+	A uint `rlp:"tail"`
+}
+
+type NilNotPointer struct {
+	A uint `rlp:"nil"`
+}
+
+type UnknownTag struct {
+	A *uint `rlp:"always,nil"`
+}
+
+type OptionalNotLast struct {
+	A uint `rlp:"optional"`
+	B uint `rlp:"-"`
+	C uint
+}
+
+type OptionalTail struct {
+	A []uint `rlp:"tail,optional"`
+}
+
+type Signed struct {
+	A int
+}
+
+type NestedSigned struct {
+	Inner struct{ B []int8 }
+}
+
+type NamedBytes struct {
+	A []Byte
+}
+
+type Byte uint8
+
+type NotStruct []uint
@@ -0,0 +1,237 @@
+// Package gost3410 implements the GOST R 34.10-2012 digital signature scheme
+// (RFC 7091) over the standard elliptic curve parameter sets.
+//
+// The arithmetic is built on math/big and does not run in constant time.
+package gost3410
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Curve is an elliptic curve y^2 = x^3 + ax + b over the prime field P, with a
+// base point (X, Y) of prime order Q.
+type Curve struct {
+	Name string
+
+	P, Q, A, B, X, Y *big.Int
+
+	size int // Byte length of coordinates, scalars and signature halves
+}
+
+func mustBig(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("gost3410: invalid curve constant " + s)
+	}
+	return n
+}
+
+// NewCurve creates a curve from its parameters, checking that the base point
+// lies on it.
+func NewCurve(name string, p, q, a, b, x, y *big.Int) (*Curve, error) {
+	c := &Curve{Name: name, P: p, Q: q, A: a, B: b, X: x, Y: y}
+	switch p.BitLen() {
+	case 255, 256:
+		c.size = 32
+	case 511, 512:
+		c.size = 64
+	default:
+		return nil, errors.New("gost3410: unsupported curve field size")
+	}
+	if q.BitLen() > p.BitLen() {
+		return nil, errors.New("gost3410: curve order exceeds the field size")
+	}
+	if !c.IsOnCurve(x, y) {
+		return nil, errors.New("gost3410: base point is not on the curve")
+	}
+	return c, nil
+}
+
+func mustCurve(name, p, q, a, b, x, y string) *Curve {
+	c, err := NewCurve(name, mustBig(p), mustBig(q), mustBig(a), mustBig(b), mustBig(x), mustBig(y))
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// The parameter sets of the standard, named after their object identifiers.
+var (
+	// CurveTest256 is the 256-bit example curve of GOST R 34.10-2012,
+	// appendix A.1. It is meant for testing only.
+	CurveTest256 = mustCurve("id-GostR3410-2001-TestParamSet",
+		"8000000000000000000000000000000000000000000000000000000000000431",
+		"8000000000000000000000000000000150FE8A1892976154C59CFC193ACCF5B3",
+		"7",
+		"5FBFF498AA938CE739B8E022FBAFEF40563F6E6A3472FC2A514C0CE9DAE23B7E",
+		"2",
+		"08E2A8A0E65147D4BD6316030E16D19C85C97F0A9CA267122B96ABBCEA7E8FC8",
+	)
+
+	// CurveCryptoProA is the 256-bit id-GostR3410-2001-CryptoPro-A-ParamSet
+	// of RFC 4357, also known as id-tc26-gost-3410-12-256-paramSetB.
+	CurveCryptoProA = mustCurve("id-GostR3410-2001-CryptoPro-A-ParamSet",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD97",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF6C611070995AD10045841B09B761B893",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD94",
+		"A6",
+		"1",
+		"8D91E471E0989CDA27DF505A453F2B7635294F2DDF23E3B122ACC99C9E9F1E14",
+	)
+
+	// Curve256A is id-tc26-gost-3410-12-256-paramSetA, a twisted Edwards
+	// curve given in Weierstrass form. Its base point has cofactor 4.
+	Curve256A = mustCurve("id-tc26-gost-3410-12-256-paramSetA",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFD97",
+		"400000000000000000000000000000000FD8CDDFC87B6635C115AF556C360C67",
+		"C2173F1513981673AF4892C23035A27CE25E2013BF95AA33B22C656F277E7335",
+		"295F9BAE7428ED9CCC20E7C359A9D41A22FCCD9108E17BF7BA9337A6F8AE9513",
+		"91E38443A5E82C0D880923425712B2BB658B9196932E02C78B2582FE742DAA28",
+		"32879423AB1A0375895786C4BB46E9565FDE0B5344766740AF268ADB32322E5C",
+	)
+
+	// CurveCryptoProB is the 256-bit id-GostR3410-2001-CryptoPro-B-ParamSet
+	// of RFC 4357, also known as id-tc26-gost-3410-12-256-paramSetC.
+	CurveCryptoProB = mustCurve("id-GostR3410-2001-CryptoPro-B-ParamSet",
+		"8000000000000000000000000000000000000000000000000000000000000C99",
+		"800000000000000000000000000000015F700CFFF1A624E5E497161BCC8A198F",
+		"8000000000000000000000000000000000000000000000000000000000000C96",
+		"3E1AF419A269A5F866A7D3C25C3DF80AE979259373FF2B182F49D4CE7E1BBC8B",
+		"1",
+		"3FA8124359F96680B83D1C3EB2C070E5C545C9858D03ECFB744BF8D717717EFC",
+	)
+
+	// CurveCryptoProC is the 256-bit id-GostR3410-2001-CryptoPro-C-ParamSet
+	// of RFC 4357, also known as id-tc26-gost-3410-12-256-paramSetD.
+	CurveCryptoProC = mustCurve("id-GostR3410-2001-CryptoPro-C-ParamSet",
+		"9B9F605F5A858107AB1EC85E6B41C8AACF846E86789051D37998F7B9022D759B",
+		"9B9F605F5A858107AB1EC85E6B41C8AA582CA3511EDDFB74F02F3A6598980BB9",
+		"9B9F605F5A858107AB1EC85E6B41C8AACF846E86789051D37998F7B9022D7598",
+		"805A",
+		"0",
+		"41ECE55743711A8C3CBF3783CD08C0EE4D4DC440D4641A8F366E550DFDB3BB67",
+	)
+
+	// CurveTest512 is the 512-bit example curve of GOST R 34.10-2012,
+	// appendix A.2. It is meant for testing only.
+	CurveTest512 = mustCurve("id-tc26-gost-3410-12-512-paramSetTest",
+		"4531ACD1FE0023C7550D267B6B2FEE80922B14B2FFB90F04D4EB7C09B5D2D15DF1D852741AF4704A0458047E80E4546D35B8336FAC224DD81664BBF528BE6373",
+		"4531ACD1FE0023C7550D267B6B2FEE80922B14B2FFB90F04D4EB7C09B5D2D15DA82F2D7ECB1DBAC719905C5EECC423F1D86E25EDBE23C595D644AAF187E6E6DF",
+		"7",
+		"1CFF0806A31116DA29D8CFA54E57EB748BC5F377E49400FDD788B649ECA1AC4361834013B2AD7322480A89CA58E0CF74BC9E540C2ADD6897FAD0A3084F302ADC",
+		"24D19CC64572EE30F396BF6EBBFD7A6C5213B3B3D7057CC825F91093A68CD762FD60611262CD838DC6B60AA7EEE804E28BC849977FAC33B4B530F1B120248A9A",
+		"2BB312A43BD2CE6E0D020613C857ACDDCFBF061E91E5F2C3F32447C259F39B2C83AB156D77F1496BF7EB3351E1EE4E43DC1A18B91B24640B6DBB92CB1ADD371E",
+	)
+
+	// Curve512A is id-tc26-gost-3410-12-512-paramSetA.
+	Curve512A = mustCurve("id-tc26-gost-3410-12-512-paramSetA",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFDC7",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF27E69532F48D89116FF22B8D4E0560609B4B38ABFAD2B85DCACDB1411F10B275",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFDC4",
+		"E8C2505DEDFC86DDC1BD0B2B6667F1DA34B82574761CB0E879BD081CFD0B6265EE3CB090F30D27614CB4574010DA90DD862EF9D4EBEE4761503190785A71C760",
+		"3",
+		"7503CFE87A836AE3A61B8816E25450E6CE5E1C93ACF1ABC1778064FDCBEFA921DF1626BE4FD036E93D75E6A50E3A41E98028FE5FC235F5B889A589CB5215F2A4",
+	)
+
+	// Curve512B is id-tc26-gost-3410-12-512-paramSetB.
+	Curve512B = mustCurve("id-tc26-gost-3410-12-512-paramSetB",
+		"8000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000006F",
+		"800000000000000000000000000000000000000000000000000000000000000149A1EC142565A545ACFDB77BD9D40CFA8B996712101BEA0EC6346C54374F25BD",
+		"8000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000006C",
+		"687D1B459DC841457E3E06CF6F5E2517B97C7D614AF138BCBF85DC806C4B289F3E965D2DB1416D217F8B276FAD1AB69C50F78BEE1FA3106EFB8CCBC7C5140116",
+		"2",
+		"1A8F7EDA389B094C2C071E3647A8940F3C123B697578C213BE6DD9E6C8EC7335DCB228FD1EDF4A39152CBCAAF8C0398828041055F94CEEEC7E21340780FE41BD",
+	)
+
+	// Curve512C is id-tc26-gost-3410-12-512-paramSetC, a twisted Edwards
+	// curve given in Weierstrass form. Its base point has cofactor 4.
+	Curve512C = mustCurve("id-tc26-gost-3410-12-512-paramSetC",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFDC7",
+		"3FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFC98CDBA46506AB004C33A9FF5147502CC8EDA9E7A769A12694623CEF47F023ED",
+		"DC9203E514A721875485A529D2C722FB187BC8980EB866644DE41C68E143064546E861C0E2C9EDD92ADE71F46FCF50FF2AD97F951FDA9F2A2EB6546F39689BD3",
+		"B4C4EE28CEBC6C2C8AC12952CF37F16AC7EFB6A9F69F4B57FFDA2E4F0DE5ADE038CBC2FFF719D2C18DE0284B8BFEF3B52B8CC7A5F5BF0A3C8D2319A5312557E1",
+		"E2E31EDFC23DE7BDEBE241CE593EF5DE2295B7A9CBAEF021D385F7074CEA043AA27272A7AE602BF2A7B9033DB9ED3610C6FB85487EAE97AAC5BC7928C1950148",
+		"F5CE40D95B5EB899ABBCCFF5911CB8577939804D6527378B8C108C3D2090FF9BE18E2D33E3021ED2EF32D85822423B6304F726AA854BAE07D0396E9A9ADDC40F",
+	)
+)
+
+// PointSize returns the byte length of the curve's coordinates and scalars,
+// 32 or 64.
+func (c *Curve) PointSize() int {
+	return c.size
+}
+
+// IsOnCurve reports whether (x, y) is a point of the curve.
+func (c *Curve) IsOnCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || x.Cmp(c.P) >= 0 || y.Sign() < 0 || y.Cmp(c.P) >= 0 {
+		return false
+	}
+	lhs := new(big.Int).Mul(y, y)
+	lhs.Mod(lhs, c.P)
+
+	rhs := new(big.Int).Mul(x, x)
+	rhs.Add(rhs, c.A)
+	rhs.Mul(rhs, x)
+	rhs.Add(rhs, c.B)
+	rhs.Mod(rhs, c.P)
+	return lhs.Cmp(rhs) == 0
+}
+
+// add returns the sum of two points in affine coordinates. The point at
+// infinity is represented by a nil x.
+func (c *Curve) add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	if x1 == nil {
+		return x2, y2
+	}
+	if x2 == nil {
+		return x1, y1
+	}
+	var lambda *big.Int
+	if x1.Cmp(x2) == 0 {
+		sum := new(big.Int).Add(y1, y2)
+		if sum.Mod(sum, c.P).Sign() == 0 {
+			return nil, nil // P + (-P)
+		}
+		// Doubling: lambda = (3x^2 + a) / 2y
+		num := new(big.Int).Mul(x1, x1)
+		num.Mul(num, big.NewInt(3))
+		num.Add(num, c.A)
+		den := new(big.Int).Lsh(y1, 1)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.P), c.P))
+	} else {
+		// Addition: lambda = (y2 - y1) / (x2 - x1)
+		num := new(big.Int).Sub(y2, y1)
+		den := new(big.Int).Sub(x2, x1)
+		lambda = num.Mul(num, den.ModInverse(den.Mod(den, c.P), c.P))
+	}
+	lambda.Mod(lambda, c.P)
+
+	x3 := new(big.Int).Mul(lambda, lambda)
+	x3.Sub(x3, x1)
+	x3.Sub(x3, x2)
+	x3.Mod(x3, c.P)
+
+	y3 := new(big.Int).Sub(x1, x3)
+	y3.Mul(y3, lambda)
+	y3.Sub(y3, y1)
+	y3.Mod(y3, c.P)
+	return x3, y3
+}
+
+// ScalarMult returns k*(x, y). A nil x in the result is the point at infinity.
+func (c *Curve) ScalarMult(x, y, k *big.Int) (*big.Int, *big.Int) {
+	var rx, ry *big.Int
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		rx, ry = c.add(rx, ry, rx, ry)
+		if k.Bit(i) == 1 {
+			rx, ry = c.add(rx, ry, x, y)
+		}
+	}
+	return rx, ry
+}
+
+// ScalarBaseMult returns k times the base point.
+func (c *Curve) ScalarBaseMult(k *big.Int) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.X, c.Y, k)
+}
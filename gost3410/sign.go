@@ -0,0 +1,175 @@
+package gost3410
+
+import (
+	"errors"
+	"io"
+	"math/big"
+)
+
+// PrivateKey is a signing key, a scalar d in [1, Q-1].
+type PrivateKey struct {
+	Curve *Curve
+	D     *big.Int
+}
+
+// PublicKey is a verification key, the point Q = d*P of the curve.
+type PublicKey struct {
+	Curve *Curve
+	X, Y  *big.Int
+}
+
+// reverse returns a reversed copy of b, converting between the little-endian
+// GOST encodings and big.Int byte order.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// randScalar reads a uniformly random scalar in [1, Q-1] from rand.
+func randScalar(c *Curve, rand io.Reader) (*big.Int, error) {
+	buf := make([]byte, c.size)
+	for {
+		if _, err := io.ReadFull(rand, buf); err != nil {
+			return nil, err
+		}
+		k := new(big.Int).SetBytes(buf)
+		if k.Sign() > 0 && k.Cmp(c.Q) < 0 {
+			return k, nil
+		}
+	}
+}
+
+// GenerateKey creates a new private key on the curve from the randomness
+// source, usually crypto/rand.Reader.
+func GenerateKey(c *Curve, rand io.Reader) (*PrivateKey, error) {
+	d, err := randScalar(c, rand)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{Curve: c, D: d}, nil
+}
+
+// NewPrivateKey decodes a private key from its little-endian raw encoding of
+// PointSize bytes.
+func NewPrivateKey(c *Curve, raw []byte) (*PrivateKey, error) {
+	if len(raw) != c.size {
+		return nil, errors.New("gost3410: invalid private key length")
+	}
+	d := new(big.Int).SetBytes(reverse(raw))
+	if d.Sign() == 0 || d.Cmp(c.Q) >= 0 {
+		return nil, errors.New("gost3410: private key out of range")
+	}
+	return &PrivateKey{Curve: c, D: d}, nil
+}
+
+// Raw returns the little-endian raw encoding of the private key.
+func (prv *PrivateKey) Raw() []byte {
+	return reverse(prv.D.FillBytes(make([]byte, prv.Curve.size)))
+}
+
+// PublicKey derives the public key belonging to the private key.
+func (prv *PrivateKey) PublicKey() *PublicKey {
+	x, y := prv.Curve.ScalarBaseMult(prv.D)
+	return &PublicKey{Curve: prv.Curve, X: x, Y: y}
+}
+
+// NewPublicKey decodes a public key from its raw encoding, the little-endian
+// coordinates X || Y as used by RFC 4491.
+func NewPublicKey(c *Curve, raw []byte) (*PublicKey, error) {
+	if len(raw) != 2*c.size {
+		return nil, errors.New("gost3410: invalid public key length")
+	}
+	pub := &PublicKey{
+		Curve: c,
+		X:     new(big.Int).SetBytes(reverse(raw[:c.size])),
+		Y:     new(big.Int).SetBytes(reverse(raw[c.size:])),
+	}
+	if !c.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("gost3410: public key is not on the curve")
+	}
+	return pub, nil
+}
+
+// Raw returns the raw encoding of the public key, little-endian X || Y.
+func (pub *PublicKey) Raw() []byte {
+	raw := make([]byte, 2*pub.Curve.size)
+	copy(raw, reverse(pub.X.FillBytes(make([]byte, pub.Curve.size))))
+	copy(raw[pub.Curve.size:], reverse(pub.Y.FillBytes(make([]byte, pub.Curve.size))))
+	return raw
+}
+
+// digestScalar maps a digest onto the scalar e of the standard. Digests are
+// taken in the little-endian byte order produced by gost3411.
+func digestScalar(c *Curve, digest []byte) *big.Int {
+	e := new(big.Int).SetBytes(reverse(digest))
+	e.Mod(e, c.Q)
+	if e.Sign() == 0 {
+		e.SetInt64(1)
+	}
+	return e
+}
+
+// Sign signs a gost3411 digest, drawing the ephemeral key from rand. The
+// signature is the big-endian s || r, each PointSize bytes, as in RFC 4491.
+func (prv *PrivateKey) Sign(rand io.Reader, digest []byte) ([]byte, error) {
+	c := prv.Curve
+	e := digestScalar(c, digest)
+	for {
+		k, err := randScalar(c, rand)
+		if err != nil {
+			return nil, err
+		}
+		x, _ := c.ScalarBaseMult(k)
+		r := new(big.Int).Mod(x, c.Q)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = (r*d + k*e) mod q
+		s := new(big.Int).Mul(r, prv.D)
+		s.Add(s, k.Mul(k, e))
+		s.Mod(s, c.Q)
+		if s.Sign() == 0 {
+			continue
+		}
+		sig := make([]byte, 2*c.size)
+		s.FillBytes(sig[:c.size])
+		r.FillBytes(sig[c.size:])
+		return sig, nil
+	}
+}
+
+// Verify reports whether signature is a valid signature of digest by the
+// public key. Keys that do not lie on the curve never verify.
+func (pub *PublicKey) Verify(digest, signature []byte) bool {
+	c := pub.Curve
+	if len(signature) != 2*c.size {
+		return false
+	}
+	if pub.X == nil || pub.Y == nil || !c.IsOnCurve(pub.X, pub.Y) {
+		return false
+	}
+	s := new(big.Int).SetBytes(signature[:c.size])
+	r := new(big.Int).SetBytes(signature[c.size:])
+	if r.Sign() == 0 || r.Cmp(c.Q) >= 0 || s.Sign() == 0 || s.Cmp(c.Q) >= 0 {
+		return false
+	}
+	// C = (s/e)*P - (r/e)*Q, the signature holds if C.x = r (mod q)
+	v := digestScalar(c, digest)
+	v.ModInverse(v, c.Q)
+
+	z1 := new(big.Int).Mul(s, v)
+	z1.Mod(z1, c.Q)
+	z2 := new(big.Int).Mul(r, v)
+	z2.Sub(c.Q, z2.Mod(z2, c.Q))
+
+	x1, y1 := c.ScalarBaseMult(z1)
+	x2, y2 := c.ScalarMult(pub.X, pub.Y, z2)
+	x, _ := c.add(x1, y1, x2, y2)
+	if x == nil {
+		return false
+	}
+	return x.Mod(x, c.Q).Cmp(r) == 0
+}
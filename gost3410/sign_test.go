@@ -0,0 +1,144 @@
+package gost3410
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/gost3411"
+)
+
+var allCurves = []*Curve{
+	CurveTest256, Curve256A, CurveCryptoProA, CurveCryptoProB, CurveCryptoProC,
+	CurveTest512, Curve512A, Curve512B, Curve512C,
+}
+
+func TestCurves(t *testing.T) {
+	for _, c := range allCurves {
+		if !c.Q.ProbablyPrime(20) || !c.P.ProbablyPrime(20) {
+			t.Errorf("%s: composite modulus", c.Name)
+		}
+		if x, _ := c.ScalarBaseMult(c.Q); x != nil {
+			t.Errorf("%s: base point order mismatch", c.Name)
+		}
+	}
+}
+
+// Examples from GOST R 34.10-2012, appendix A. The digest is given as the
+// integer e, the ephemeral key k is fed through the randomness source.
+func TestVectors(t *testing.T) {
+	tests := []struct {
+		curve           *Curve
+		d, qx, qy, e, k string
+		r, s            string
+	}{
+		{
+			curve: CurveTest256,
+			d:     "7A929ADE789BB9BE10ED359DD39A72C11B60961F49397EEE1D19CE9891EC3B28",
+			qx:    "7F2B49E270DB6D90D8595BEC458B50C58585BA1D4E9B788F6689DBD8E56FD80B",
+			qy:    "26F1B489D6701DD185C8413A977B3CBBAF64D1C593D26627DFFB101A87FF77DA",
+			e:     "2DFBC1B372D89A1188C09C52E0EEC61FCE52032AB1022E8E67ECE6672B043EE5",
+			k:     "77105C9B20BCD3122823C8CF6FCC7B956DE33814E95B7FE64FED924594DCEAB3",
+			r:     "41AA28D2F1AB148280CD9ED56FEDA41974053554A42767B83AD043FD39DC0493",
+			s:     "01456C64BA4642A1653C235A98A60249BCD6D3F746B631DF928014F6C5BF9C40",
+		},
+		{
+			curve: CurveTest512,
+			d:     "0BA6048AADAE241BA40936D47756D7C93091A0E8514669700EE7508E508B102072E8123B2200A0563322DAD2827E2714A2636B7BFD18AADFC62967821FA18DD4",
+			qx:    "115DC5BC96760C7B48598D8AB9E740D4C4A85A65BE33C1815B5C320C854621DD5A515856D13314AF69BC5B924C8B4DDFF75C45415C1D9DD9DD33612CD530EFE1",
+			qy:    "37C7C90CD40B0F5621DC3AC1B751CFA0E2634FA0503B3D52639F5D7FB72AFD61EA199441D943FFE7F0C70A2759A3CDB84C114E1F9339FDF27F35ECA93677BEEC",
+			e:     "3754F3CFACC9E0615C4F4A7C4D8DAB531B09B6F9C170C533A71D147035B0C5917184EE536593F4414339976C647C5D5A407ADEDB1D560C4FC6777D2972075B8C",
+			k:     "0359E7F4B1410FEACC570456C6801496946312120B39D019D455986E364F365886748ED7A44B3E794434006011842286212273A6D14CF70EA3AF71BB1AE679F1",
+			r:     "2F86FA60A081091A23DD795E1E3C689EE512A3C82EE0DCC2643C78EEA8FCACD35492558486B20F1C9EC197C90699850260C93BCBCD9C5C3317E19344E173AE36",
+			s:     "1081B394696FFE8E6585E7A9362D26B6325F56778AADBC081C0BFBE933D52FF5823CE288E8C4F362526080DF7F70CE406A6EEB1F56919CB92A9853BDE73E5B4A",
+		},
+	}
+	for _, test := range tests {
+		c := test.curve
+		size := c.PointSize()
+		prv := &PrivateKey{Curve: c, D: mustBig(test.d)}
+		pub := prv.PublicKey()
+		if pub.X.Cmp(mustBig(test.qx)) != 0 || pub.Y.Cmp(mustBig(test.qy)) != 0 {
+			t.Errorf("%s: public key mismatch", c.Name)
+		}
+		digest := reverse(mustBig(test.e).FillBytes(make([]byte, size)))
+		k := mustBig(test.k).FillBytes(make([]byte, size))
+
+		sig, err := prv.Sign(bytes.NewReader(k), digest)
+		if err != nil {
+			t.Fatalf("%s: sign error: %v", c.Name, err)
+		}
+		want := append(mustBig(test.s).FillBytes(make([]byte, size)), mustBig(test.r).FillBytes(make([]byte, size))...)
+		if !bytes.Equal(sig, want) {
+			t.Errorf("%s: signature mismatch\nhave %x\nwant %x", c.Name, sig, want)
+		}
+		if !pub.Verify(digest, sig) {
+			t.Errorf("%s: standard signature rejected", c.Name)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	for _, c := range allCurves {
+		prv, err := GenerateKey(c, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keys survive their raw encodings.
+		if prv2, err := NewPrivateKey(c, prv.Raw()); err != nil || prv2.D.Cmp(prv.D) != 0 {
+			t.Fatalf("%s: private key round trip failed: %v", c.Name, err)
+		}
+		pub, err := NewPublicKey(c, prv.PublicKey().Raw())
+		if err != nil {
+			t.Fatalf("%s: public key round trip failed: %v", c.Name, err)
+		}
+		h := gost3411.New(c.PointSize())
+		h.Write([]byte("trie root"))
+		digest := h.Sum(nil)
+
+		sig, err := prv.Sign(rand.Reader, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.Verify(digest, sig) {
+			t.Errorf("%s: valid signature rejected", c.Name)
+		}
+		digest[0] ^= 1
+		if pub.Verify(digest, sig) {
+			t.Errorf("%s: signature of another digest accepted", c.Name)
+		}
+		digest[0] ^= 1
+		sig[len(sig)-1] ^= 1
+		if pub.Verify(digest, sig) {
+			t.Errorf("%s: tampered signature accepted", c.Name)
+		}
+		other, _ := GenerateKey(c, rand.Reader)
+		if other.PublicKey().Verify(digest, sig) {
+			t.Errorf("%s: signature accepted by another key", c.Name)
+		}
+	}
+	if _, err := NewPublicKey(CurveCryptoProA, make([]byte, 64)); err == nil {
+		t.Error("point off the curve accepted")
+	}
+	// Keys built as struct literals bypass NewPublicKey and are checked by Verify.
+	prv, _ := GenerateKey(CurveCryptoProA, rand.Reader)
+	digest := make([]byte, 32)
+	sig, err := prv.Sign(rand.Reader, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := prv.PublicKey()
+	for _, bad := range []*PublicKey{
+		{Curve: CurveCryptoProA, X: pub.X, Y: new(big.Int).Add(pub.Y, big.NewInt(1))},
+		{Curve: CurveCryptoProA, X: pub.X, Y: new(big.Int).Add(pub.Y, CurveCryptoProA.P)},
+		{Curve: CurveCryptoProA},
+	} {
+		if bad.Verify(digest, sig) {
+			t.Errorf("signature accepted by off-curve key (%v, %v)", bad.X, bad.Y)
+		}
+	}
+	if _, err := NewPrivateKey(CurveCryptoProA, make([]byte, 32)); err == nil {
+		t.Error("zero private key accepted")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"math/bits"
 )
 
 const (
@@ -66,16 +67,6 @@ var (
 		0x59, 0xa6, 0x74, 0xd2, 0xe6, 0xf4, 0xb4, 0xc0,
 		0xd1, 0x66, 0xaf, 0xc2, 0x39, 0x4b, 0x63, 0xb6,
 	}
-	tau [64]int = [64]int{
-		0x00, 0x08, 0x10, 0x18, 0x20, 0x28, 0x30, 0x38,
-		0x01, 0x09, 0x11, 0x19, 0x21, 0x29, 0x31, 0x39,
-		0x02, 0x0a, 0x12, 0x1a, 0x22, 0x2a, 0x32, 0x3a,
-		0x03, 0x0b, 0x13, 0x1b, 0x23, 0x2b, 0x33, 0x3b,
-		0x04, 0x0c, 0x14, 0x1c, 0x24, 0x2c, 0x34, 0x3c,
-		0x05, 0x0d, 0x15, 0x1d, 0x25, 0x2d, 0x35, 0x3d,
-		0x06, 0x0e, 0x16, 0x1e, 0x26, 0x2e, 0x36, 0x3e,
-		0x07, 0x0f, 0x17, 0x1f, 0x27, 0x2f, 0x37, 0x3f,
-	}
 	c [12][BlockSize]byte = [12][BlockSize]byte{
 		{
 			0x07, 0x45, 0xa6, 0xf2, 0x59, 0x65, 0x80, 0xdd,
@@ -200,7 +191,11 @@ var (
 	}
 	a [64]uint64 // It is filled in init()
 
-	cache [8][256]uint64
+	// lps combines the S-box, the byte transposition and the linear transform
+	// of a single byte position into one lookup per input byte.
+	lps [8][256]uint64
+
+	cw [12][8]uint64 // Round constants as little-endian words
 )
 
 func init() {
@@ -275,7 +270,7 @@ func init() {
 	}
 	for byteN := 0; byteN < 8; byteN++ {
 		for byteValN := 0; byteValN < 256; byteValN++ {
-			val := byte(byteValN)
+			val := pi[byteValN]
 			res64 := uint64(0)
 			for bitN := 0; bitN < 8; bitN++ {
 				if val&0x80 > 0 {
@@ -283,24 +278,21 @@ func init() {
 				}
 				val <<= 1
 			}
-			cache[byteN][byteValN] = res64
+			lps[byteN][byteValN] = res64
 		}
 	}
+	for i := range c {
+		load(&cw[i], c[i][:])
+	}
 }
 
 type Hash struct {
-	size    int
-	buf     []byte
-	n       uint64
-	hsh     []byte
-	chk     []byte
-	tmp     []byte
-	psBuf   []byte
-	eMsgBuf []byte
-	eKBuf   []byte
-	eXorBuf []byte
-	gBuf    []byte
-	addBuf  []byte
+	size int
+	buf  [BlockSize]byte // Pending input not filling a block yet
+	nbuf int             // Number of pending bytes in buf
+	n    uint64          // Number of processed bits
+	hsh  [8]uint64
+	chk  [8]uint64
 }
 
 func New512() hash.Hash {
@@ -316,32 +308,21 @@ func New(size int) *Hash {
 	if size != 32 && size != 64 {
 		panic("size must be either 32 or 64")
 	}
-	h := Hash{
-		size:    size,
-		hsh:     make([]byte, BlockSize),
-		chk:     make([]byte, BlockSize),
-		tmp:     make([]byte, BlockSize),
-		psBuf:   make([]byte, BlockSize),
-		eMsgBuf: make([]byte, BlockSize),
-		eKBuf:   make([]byte, BlockSize),
-		eXorBuf: make([]byte, BlockSize),
-		gBuf:    make([]byte, BlockSize),
-		addBuf:  make([]byte, BlockSize),
-	}
+	h := Hash{size: size}
 	h.Reset()
 	return &h
 }
 
 func (h *Hash) Reset() {
 	h.n = 0
-	h.buf = nil
-	for i := 0; i < BlockSize; i++ {
-		h.chk[i] = 0
-		if h.size == 32 {
-			h.hsh[i] = 1
-		} else {
-			h.hsh[i] = 0
-		}
+	h.nbuf = 0
+	h.chk = [8]uint64{}
+	iv := uint64(0)
+	if h.size == 32 {
+		iv = 0x0101010101010101
+	}
+	for i := range h.hsh {
+		h.hsh[i] = iv
 	}
 }
 
@@ -354,130 +335,142 @@ func (h *Hash) Size() int {
 }
 
 func (h *Hash) Write(data []byte) (int, error) {
-	h.buf = append(h.buf, data...)
-	for len(h.buf) >= BlockSize {
-		copy(h.tmp, h.buf[:BlockSize])
-		copy(h.hsh, h.g(h.n, h.hsh, h.tmp))
-		copy(h.chk, h.add512bit(h.chk, h.tmp))
-		h.n += BlockSize * 8
-		h.buf = h.buf[BlockSize:]
+	written := len(data)
+	if h.nbuf > 0 {
+		n := copy(h.buf[h.nbuf:], data)
+		h.nbuf += n
+		data = data[n:]
+		if h.nbuf < BlockSize {
+			return written, nil
+		}
+		h.block(h.buf[:])
+		h.nbuf = 0
+	}
+	for len(data) >= BlockSize {
+		h.block(data[:BlockSize])
+		data = data[BlockSize:]
+	}
+	h.nbuf = copy(h.buf[:], data)
+	return written, nil
+}
+
+// block compresses a full message block into the state.
+func (h *Hash) block(data []byte) {
+	var m [8]uint64
+	load(&m, data)
+	g(h.n, &h.hsh, &m)
+	add512bit(&h.chk, &m)
+	h.n += BlockSize * 8
+}
+
+// digest finalises a copy of the state into out, leaving h untouched.
+func (h *Hash) digest(out *[BlockSize]byte) {
+	var (
+		padded [BlockSize]byte
+		m, l   [8]uint64
+	)
+	copy(padded[:], h.buf[:h.nbuf])
+	padded[h.nbuf] = 1
+	load(&m, padded[:])
+
+	hsh, chk := h.hsh, h.chk
+	g(h.n, &hsh, &m)
+	l[0] = h.n + uint64(h.nbuf)*8
+	g(0, &hsh, &l)
+	add512bit(&chk, &m)
+	g(0, &hsh, &chk)
+
+	for i, w := range hsh {
+		binary.LittleEndian.PutUint64(out[i*8:], w)
 	}
-	return len(data), nil
 }
 
 func (h *Hash) Sum(in []byte) []byte {
-	buf := make([]byte, BlockSize)
-	hsh := make([]byte, BlockSize)
-	copy(h.tmp, buf)
-	copy(buf, h.buf)
-	buf[len(h.buf)] = 1
-	copy(hsh, h.g(h.n, h.hsh, buf))
-	binary.LittleEndian.PutUint64(h.tmp, h.n+uint64(len(h.buf))*8)
-	copy(hsh, h.g(0, hsh, h.tmp))
-	copy(hsh, h.g(0, hsh, h.add512bit(h.chk, buf)))
+	var out [BlockSize]byte
+	h.digest(&out)
 	if h.size == 32 {
-		return append(in, hsh[BlockSize/2:]...)
+		return append(in, out[BlockSize/2:]...)
 	}
-	return append(in, hsh...)
+	return append(in, out[:]...)
 }
+
 func (h *Hash) Read(out []byte) (int, error) {
-	buf := make([]byte, BlockSize)
-	hsh := make([]byte, BlockSize)
-	copy(h.tmp, buf)
-	copy(buf, h.buf)
-	buf[len(h.buf)] = 1
-	copy(hsh, h.g(h.n, h.hsh, buf))
-	binary.LittleEndian.PutUint64(h.tmp, h.n+uint64(len(h.buf))*8)
-	copy(hsh, h.g(0, hsh, h.tmp))
-	copy(hsh, h.g(0, hsh, h.add512bit(h.chk, buf)))
+	var hsh [BlockSize]byte
+	h.digest(&hsh)
 	if h.size == 32 {
-		copy(out[:], hsh[BlockSize/2:])
+		copy(out, hsh[BlockSize/2:])
 		return len(out), nil
 	}
-	copy(out[:], hsh[:])
+	copy(out, hsh[:])
 	return len(out), nil
 }
 
-func (h *Hash) add512bit(chk, data []byte) []byte {
-	var ss uint16
-	for i := 0; i < BlockSize; i++ {
-		ss = uint16(chk[i]) + uint16(data[i]) + (ss >> 8)
-		h.addBuf[i] = byte(0xFF & ss)
+// load reads a block as little-endian words.
+func load(dst *[8]uint64, data []byte) {
+	_ = data[BlockSize-1]
+	for i := range dst {
+		dst[i] = binary.LittleEndian.Uint64(data[i*8:])
 	}
-	return h.addBuf
-}
-
-func (h *Hash) g(n uint64, hsh, data []byte) []byte {
-	out := h.gBuf
-	copy(out, hsh)
-	out[0] ^= byte((n >> 0) & 0xFF)
-	out[1] ^= byte((n >> 8) & 0xFF)
-	out[2] ^= byte((n >> 16) & 0xFF)
-	out[3] ^= byte((n >> 24) & 0xFF)
-	out[4] ^= byte((n >> 32) & 0xFF)
-	out[5] ^= byte((n >> 40) & 0xFF)
-	out[6] ^= byte((n >> 48) & 0xFF)
-	out[7] ^= byte((n >> 56) & 0xFF)
-	return blockXor(out, blockXor(out, h.e(l(out, h.ps(out)), data), hsh), data)
 }
 
-func (h *Hash) e(k, msg []byte) []byte {
-	for i := 0; i < 12; i++ {
-		msg = l(h.eMsgBuf, h.ps(blockXor(h.eXorBuf, k, msg)))
-		k = l(h.eKBuf, h.ps(blockXor(h.eXorBuf, k, c[i][:])))
+// add512bit adds data to chk modulo 2^512.
+func add512bit(chk, data *[8]uint64) {
+	var carry uint64
+	for i := range chk {
+		chk[i], carry = bits.Add64(chk[i], data[i], carry)
 	}
-	return blockXor(h.eXorBuf, k, msg)
 }
 
-func blockXor(dst, x, y []byte) []byte {
-	for i := 0; i < BlockSize; i++ {
-		dst[i] = x[i] ^ y[i]
-	}
-	return dst
-}
+// g is the compression function, updating hsh with the block m at bit
+// position n.
+func g(n uint64, hsh, m *[8]uint64) {
+	var k [8]uint64
+	lpsx(&k, hsh, &[8]uint64{n})
 
-func (h *Hash) ps(data []byte) []byte {
-	for i := 0; i < BlockSize; i++ {
-		h.psBuf[tau[i]] = pi[int(data[i])]
+	// E transformation: 12 rounds of the message with an evolving key
+	s := *m
+	for i := range cw {
+		lpsx(&s, &k, &s)
+		lpsx(&k, &k, &cw[i])
+	}
+	for i := range hsh {
+		hsh[i] ^= k[i] ^ s[i] ^ m[i]
 	}
-	return h.psBuf
 }
 
-func l(out, data []byte) []byte {
-	for i := 0; i < 8; i++ {
-		res64 := uint64(0)
-		res64 ^= cache[0][data[8*i+0]]
-		res64 ^= cache[1][data[8*i+1]]
-		res64 ^= cache[2][data[8*i+2]]
-		res64 ^= cache[3][data[8*i+3]]
-		res64 ^= cache[4][data[8*i+4]]
-		res64 ^= cache[5][data[8*i+5]]
-		res64 ^= cache[6][data[8*i+6]]
-		res64 ^= cache[7][data[8*i+7]]
-		binary.LittleEndian.PutUint64(out[i*8:i*8+8], res64)
+// lpsx sets dst to LPS(x ^ y). dst may alias x or y.
+func lpsx(dst, x, y *[8]uint64) {
+	t0, t1, t2, t3 := x[0]^y[0], x[1]^y[1], x[2]^y[2], x[3]^y[3]
+	t4, t5, t6, t7 := x[4]^y[4], x[5]^y[5], x[6]^y[6], x[7]^y[7]
+	for i := uint(0); i < 8; i++ {
+		sh := 8 * i
+		dst[i] = lps[0][byte(t0>>sh)] ^ lps[1][byte(t1>>sh)] ^
+			lps[2][byte(t2>>sh)] ^ lps[3][byte(t3>>sh)] ^
+			lps[4][byte(t4>>sh)] ^ lps[5][byte(t5>>sh)] ^
+			lps[6][byte(t6>>sh)] ^ lps[7][byte(t7>>sh)]
 	}
-	return out
 }
 
 func (h *Hash) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, len(MarshaledName)+1+8+2*BlockSize+len(h.buf))
+	data = make([]byte, len(MarshaledName)+1+8+2*BlockSize+h.nbuf)
 	copy(data, []byte(MarshaledName))
 	idx := len(MarshaledName)
 	data[idx] = byte(h.size)
 	idx += 1
 	binary.BigEndian.PutUint64(data[idx:idx+8], h.n)
 	idx += 8
-	copy(data[idx:], h.hsh)
-	idx += BlockSize
-	copy(data[idx:], h.chk)
-	idx += BlockSize
-	copy(data[idx:], h.buf)
+	for i := range h.hsh {
+		binary.LittleEndian.PutUint64(data[idx+i*8:], h.hsh[i])
+		binary.LittleEndian.PutUint64(data[idx+BlockSize+i*8:], h.chk[i])
+	}
+	idx += 2 * BlockSize
+	copy(data[idx:], h.buf[:h.nbuf])
 	return
 }
 
 func (h *Hash) UnmarshalBinary(data []byte) error {
 	expectedLen := len(MarshaledName) + 1 + 8 + 2*BlockSize
-	if len(data) < expectedLen {
+	if len(data) < expectedLen || len(data) >= expectedLen+BlockSize {
 		return fmt.Errorf("gogost/internal/gost34112012: len(data) != %d", expectedLen)
 	}
 	if !bytes.HasPrefix(data, []byte(MarshaledName)) {
@@ -488,10 +481,10 @@ func (h *Hash) UnmarshalBinary(data []byte) error {
 	idx += 1
 	h.n = binary.BigEndian.Uint64(data[idx : idx+8])
 	idx += 8
-	copy(h.hsh, data[idx:])
+	load(&h.hsh, data[idx:])
 	idx += BlockSize
-	copy(h.chk, data[idx:])
+	load(&h.chk, data[idx:])
 	idx += BlockSize
-	h.buf = data[idx:]
+	h.nbuf = copy(h.buf[:], data[idx:])
 	return nil
 }
@@ -266,14 +266,32 @@ func TestRandom(t *testing.T) {
 	}
 }
 
+func TestSumAllocs(t *testing.T) {
+	h := New(32)
+	data := make([]byte, 3*BlockSize+5)
+	out := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		h.Reset()
+		h.Write(data[:7])
+		h.Write(data[7:])
+		h.Sum(out[:0])
+		h.Read(out[:32])
+	})
+	if allocs != 0 {
+		t.Errorf("hashing allocates %v times", allocs)
+	}
+}
+
 func BenchmarkHash(b *testing.B) {
 	h := New(64)
 	src := make([]byte, BlockSize+1)
 	rand.Read(src)
+	out := make([]byte, 0, BlockSize)
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		h.Write(src)
-		h.Sum(nil)
+		h.Sum(out[:0])
 	}
 }
 
@@ -0,0 +1,102 @@
+package gost3411
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math/bits"
+)
+
+// NewHMAC256 returns a HMAC_GOSTR3411_2012_256 hash keyed with key, as defined
+// in RFC 7836, section 4.1.1.
+func NewHMAC256(key []byte) hash.Hash {
+	return hmac.New(New256, key)
+}
+
+// NewHMAC512 returns a HMAC_GOSTR3411_2012_512 hash keyed with key, as defined
+// in RFC 7836, section 4.1.2.
+func NewHMAC512(key []byte) hash.Hash {
+	return hmac.New(New512, key)
+}
+
+// KDF256 derives a 32 byte key from key, label and seed with the
+// KDF_GOSTR3411_2012_256 function of RFC 7836, section 4.4.
+func KDF256(key, label, seed []byte) ([]byte, error) {
+	return KDFTree256(key, label, seed, 32, 1)
+}
+
+// KDFTree256 derives length bytes from key, label and seed with the
+// KDF_TREE_GOSTR3411_2012_256 function of RFC 7836, section 4.5. The 32 byte
+// output blocks are numbered with r byte counters, r being between 1 and 4.
+func KDFTree256(key, label, seed []byte, length int, r int) ([]byte, error) {
+	if r < 1 || r > 4 {
+		return nil, errors.New("gost3411: counter size must be between 1 and 4 bytes")
+	}
+	blocks := (length + 31) / 32
+	if length <= 0 || uint64(blocks) >= 1<<(8*uint(r)) {
+		return nil, errors.New("gost3411: invalid derived key length")
+	}
+	// The total output length L is encoded in bits, in as few bytes as possible
+	var lenb [8]byte
+	binary.BigEndian.PutUint64(lenb[:], uint64(length)*8)
+	encLen := lenb[bits.LeadingZeros64(uint64(length)*8)/8:]
+
+	var (
+		mac = NewHMAC256(key)
+		ctr [4]byte
+		out = make([]byte, 0, blocks*32)
+	)
+	for i := 1; i <= blocks; i++ {
+		binary.BigEndian.PutUint32(ctr[:], uint32(i))
+		mac.Reset()
+		mac.Write(ctr[4-r:])
+		mac.Write(label)
+		mac.Write([]byte{0})
+		mac.Write(seed)
+		mac.Write(encLen)
+		out = mac.Sum(out)
+	}
+	return out[:length], nil
+}
+
+// PBKDF2 derives a keyLen byte key from password and salt with PBKDF2 (RFC
+// 8018) over HMAC with the given hash, as profiled for Streebog in R 50.1.111-2016.
+// Use New512 for the standard PBKDF2-HMAC-Streebog-512.
+func PBKDF2(password, salt []byte, iter, keyLen int, h func() hash.Hash) ([]byte, error) {
+	if iter < 1 {
+		return nil, errors.New("gost3411: iteration count must be positive")
+	}
+	prf := hmac.New(h, password)
+	size := prf.Size()
+	// The block counter is 32 bits wide, limiting the output length
+	if keyLen <= 0 || uint64(keyLen) > (1<<32-1)*uint64(size) {
+		return nil, errors.New("gost3411: invalid derived key length")
+	}
+	var (
+		blocks = (keyLen + size - 1) / size
+		out    = make([]byte, 0, blocks*size)
+		ctr    [4]byte
+		u      []byte
+	)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(ctr[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(ctr[:])
+		u = prf.Sum(u[:0])
+
+		start := len(out)
+		out = append(out, u...)
+		t := out[start:]
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return out[:keyLen], nil
+}
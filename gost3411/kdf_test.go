@@ -0,0 +1,88 @@
+package gost3411
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 7836, appendix A.
+var (
+	rfcKey   = mustHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	rfcLabel = mustHex("26bdb878")
+	rfcSeed  = mustHex("af21434145656378")
+)
+
+func TestHMAC(t *testing.T) {
+	data := mustHex("0126bdb87800af214341456563780100")
+
+	mac := NewHMAC256(rfcKey)
+	mac.Write(data)
+	if have, want := mac.Sum(nil), mustHex("a1aa5f7de402d7b3d323f2991c8d4534013137010a83754fd0af6d7cd4922ed9"); !bytes.Equal(have, want) {
+		t.Errorf("HMAC-256 mismatch: have %x, want %x", have, want)
+	}
+	mac = NewHMAC512(rfcKey)
+	mac.Write(data)
+	if have, want := mac.Sum(nil), mustHex("a59bab22ecae19c65fbde6e5f4e9f5d8549d31f037f9df9b905500e171923a773d5f1530f2ed7e964cb2eedc29e9ad2f3afe93b2814f79f5000ffc0366c251e6"); !bytes.Equal(have, want) {
+		t.Errorf("HMAC-512 mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestKDF(t *testing.T) {
+	if have, err := KDF256(rfcKey, rfcLabel, rfcSeed); err != nil {
+		t.Fatal(err)
+	} else if want := mustHex("a1aa5f7de402d7b3d323f2991c8d4534013137010a83754fd0af6d7cd4922ed9"); !bytes.Equal(have, want) {
+		t.Errorf("KDF mismatch: have %x, want %x", have, want)
+	}
+	have, err := KDFTree256(rfcKey, rfcLabel, rfcSeed, 64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mustHex("22b6837845c6bef65ea71672b265831086d3c76aebe6dae91cad51d83f79d16b" +
+		"074c9330599d7f8d712fca54392f4ddde93751206b3584c8f43f9e6dc51531f9")
+	if !bytes.Equal(have, want) {
+		t.Errorf("KDF_TREE mismatch: have %x, want %x", have, want)
+	}
+	if _, err := KDFTree256(rfcKey, rfcLabel, rfcSeed, 256*32, 1); err == nil {
+		t.Error("expected error for counter overflow")
+	}
+	if _, err := KDFTree256(rfcKey, rfcLabel, rfcSeed, 32, 5); err == nil {
+		t.Error("expected error for invalid counter size")
+	}
+}
+
+// Test vectors from R 50.1.111-2016, appendix A.
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		{"password", "salt", 1, 64, "64770af7f748c3b1c9ac831dbcfd85c26111b30a8a657ddc3056b80ca73e040d2854fd36811f6d825cc4ab66ec0a68a490a9e5cf5156b3a2b7eecddbf9a16b47"},
+		{"password", "salt", 2, 64, "5a585bafdfbb6e8830d6d68aa3b43ac00d2e4aebce01c9b31c2caed56f0236d4d34b2b8fbd2c4e89d54d46f50e47d45bbac301571743119e8d3c42ba66d348de"},
+		{"password", "salt", 4096, 64, "e52deb9a2d2aaff4e2ac9d47a41f34c20376591c67807f0477e32549dc341bc7867c09841b6d58e29d0347c996301d55df0d34e47cf68f4e3c2cdaf1d9ab86c3"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 100, "b2d8f1245fc4d29274802057e4b54e0a0753aa22fc53760b301cf008679e58fe4bee9addcae99ba2b0b20f431a9c5e50f395c89387d0945aedeca6eb4015dfc2bd2421ee9bb71183ba882ceebfef259f33f9e27dc6178cb89dc37428cf9cc52a2baa2d3a"},
+	}
+	for _, test := range tests {
+		have, err := PBKDF2([]byte(test.password), []byte(test.salt), test.iter, test.keyLen, New512)
+		if err != nil {
+			t.Fatalf("%q/%q/%d: %v", test.password, test.salt, test.iter, err)
+		}
+		if want := mustHex(test.want); !bytes.Equal(have, want) {
+			t.Errorf("%q/%q/%d: have %x, want %x", test.password, test.salt, test.iter, have, want)
+		}
+	}
+	for _, test := range []struct{ iter, keyLen int }{{0, 64}, {-1, 64}, {1, 0}, {1, -1}} {
+		if _, err := PBKDF2([]byte("password"), []byte("salt"), test.iter, test.keyLen, New512); err == nil {
+			t.Errorf("iter %d, keyLen %d: expected error", test.iter, test.keyLen)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pavelkrolevets/mpt/rawdb"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// errArchiveDisabled is returned by the historical accessors if the database
+// runs without an archive.
+var errArchiveDisabled = errors.New("archive mode disabled")
+
+// KeyChange is a single entry in the history of a key: the value the key was
+// set to by the commit tagged with Version. An empty Value marks a deletion.
+type KeyChange struct {
+	Version uint64
+	Value   []byte
+}
+
+// archiveChange is a key modification as stored in an archived change set.
+type archiveChange struct {
+	Key   []byte
+	Value []byte
+}
+
+// archiveChangeSet is everything a single commit changed, stored as one
+// freezer item.
+type archiveChangeSet struct {
+	Root    NodeHash
+	Changes []archiveChange // Sorted by key
+}
+
+// archive tracks the trie versions recorded by an archive mode database.
+//
+// Change sets are appended to the archive freezer, one item per version, and
+// every changed key gets an entry in the per-key index of the disk database
+// pointing into the change set. Historical values can thus be looked up
+// without the old trie nodes being available. A lookup reads the whole change
+// set of the version from the freezer, but only decodes the entry of the key.
+//
+// The index is keyed by trie key alone, so the archive holds the history of a
+// single trie. Every archived commit must build on the root of the previous
+// one; commits of other tries sharing the database are rejected.
+type archive struct {
+	freezer *rawdb.ArchiveFreezer
+	version uint64   // Version of the latest archived commit
+	root    NodeHash // Root of the latest archived commit
+}
+
+// EnableArchive switches the database into archive mode, storing change sets
+// in the freezer at datadir. Every subsequent trie Commit changing the root is
+// tagged with the next version number; commits that leave the root unchanged
+// don't add a version. The archive records a single trie: a Commit of a trie
+// not opened at the latest archived root fails.
+func (db *Database) EnableArchive(datadir string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.archive != nil {
+		return errors.New("archive already enabled")
+	}
+	freezer, err := rawdb.NewArchiveFreezer(datadir, "")
+	if err != nil {
+		return err
+	}
+	// The index is only written once the change set is synced to the freezer,
+	// so the freezer can be ahead of the index after a crash but never behind.
+	version := rawdb.ReadArchiveVersion(db.diskdb)
+	if items := freezer.Items(); items < version {
+		freezer.Close()
+		return fmt.Errorf("archive freezer behind index: %d change sets, version %d", items, version)
+	} else if items > version {
+		log.Warn("Truncating unindexed archive change sets", "items", items, "version", version)
+		if err := freezer.Truncate(version); err != nil {
+			freezer.Close()
+			return err
+		}
+	}
+	a := &archive{freezer: freezer, version: version, root: emptyRootHash(db.hashSize)}
+	if version > 0 {
+		set, err := a.changeSet(version)
+		if err != nil {
+			freezer.Close()
+			return err
+		}
+		a.root = set.Root
+	}
+	db.archive = a
+	return nil
+}
+
+// ArchiveVersion returns the version of the latest archived commit, or zero if
+// nothing was committed in archive mode yet.
+func (db *Database) ArchiveVersion() uint64 {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.archive == nil {
+		return 0
+	}
+	return db.archive.version
+}
+
+// archiving reports whether the database runs in archive mode.
+func (db *Database) archiving() bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.archive != nil
+}
+
+// recordChange remembers the latest value of key in changes, allocating the
+// map on first use. It is a no-op unless the database runs in archive mode.
+func (db *Database) recordChange(changes *map[string][]byte, key, value []byte) {
+	if !db.archiving() {
+		return
+	}
+	if *changes == nil {
+		*changes = make(map[string][]byte)
+	}
+	(*changes)[string(key)] = common.CopyBytes(value)
+}
+
+// checkArchiveBase returns an error if the archive can't record a commit of a
+// trie that was opened at, or last committed, the root base.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) checkArchiveBase(base NodeHash) error {
+	if db.archive == nil || base == db.archive.root || (isEmptyRoot(base, db.hashSize) && isEmptyRoot(db.archive.root, db.hashSize)) {
+		return nil
+	}
+	return fmt.Errorf("archive tracks a single trie: trie based on root %x, latest archived root %x", base, db.archive.root)
+}
+
+// archiveBase is the locked version of checkArchiveBase, used to reject a
+// commit before any node is inserted.
+func (db *Database) archiveBase(base NodeHash) error {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.checkArchiveBase(base)
+}
+
+// archiveCommit records the changes of a trie commit from the root base to
+// the given root as the next archive version. A commit keeping the root has
+// no effective changes and is not recorded.
+func (db *Database) archiveCommit(base, root NodeHash, changes map[string][]byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.archive == nil {
+		return nil
+	}
+	if err := db.checkArchiveBase(base); err != nil {
+		return err
+	}
+	if root == db.archive.root || (isEmptyRoot(root, db.hashSize) && isEmptyRoot(db.archive.root, db.hashSize)) {
+		return nil
+	}
+	set := archiveChangeSet{Root: root, Changes: make([]archiveChange, 0, len(changes))}
+	for key, value := range changes {
+		set.Changes = append(set.Changes, archiveChange{Key: []byte(key), Value: value})
+	}
+	sort.Slice(set.Changes, func(i, j int) bool {
+		return string(set.Changes[i].Key) < string(set.Changes[j].Key)
+	})
+	blob, err := rlp.EncodeToBytes(&set)
+	if err != nil {
+		return err
+	}
+	version := db.archive.version + 1
+	if err := db.archive.freezer.Append(version-1, blob); err != nil {
+		return err
+	}
+	if err := db.archive.freezer.Sync(); err != nil {
+		return err
+	}
+	batch := db.diskdb.NewBatch()
+	for i, change := range set.Changes {
+		rawdb.WriteArchiveIndex(batch, archiveKeyHash(change.Key), version, uint32(i))
+	}
+	rawdb.WriteArchiveVersion(batch, version)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.archive.version, db.archive.root = version, root
+	return nil
+}
+
+// archiveKeyHash returns the fixed-size index key of a trie key. The index is
+// keyed by 256-bit hashes whatever the width of the node hashes.
+func archiveKeyHash(key []byte) common.Hash {
+	return common.BytesToHash(hashData(HashSize256, key))
+}
+
+// changeSet loads the change set of an archived version.
+func (a *archive) changeSet(version uint64) (*archiveChangeSet, error) {
+	blob, err := a.freezer.Retrieve(version - 1)
+	if err != nil {
+		return nil, fmt.Errorf("archive version %d: %v", version, err)
+	}
+	set := new(archiveChangeSet)
+	if err := rlp.DecodeBytes(blob, set); err != nil {
+		return nil, fmt.Errorf("archive version %d: %v", version, err)
+	}
+	return set, nil
+}
+
+// lookup resolves the value of an index entry from its change set. Only the
+// entry's change is decoded, the others are skipped over.
+func (a *archive) lookup(key []byte, entry rawdb.ArchiveIndexEntry) ([]byte, error) {
+	blob, err := a.freezer.Retrieve(entry.Version - 1)
+	if err != nil {
+		return nil, fmt.Errorf("archive version %d: %v", entry.Version, err)
+	}
+	change, err := changeAt(blob, entry.Position)
+	if err != nil {
+		return nil, fmt.Errorf("archive version %d: %v", entry.Version, err)
+	}
+	if string(change.Key) != string(key) {
+		return nil, fmt.Errorf("archive version %d: index entry %d mismatch for key %x", entry.Version, entry.Position, key)
+	}
+	if len(change.Value) > 0 {
+		return change.Value, nil
+	}
+	return nil, nil
+}
+
+// changeAt decodes the change at position pos of an encoded change set.
+func changeAt(blob []byte, pos uint32) (*archiveChange, error) {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the root, then the changes before pos
+	_, _, changes, err := rlp.Split(elems)
+	if err != nil {
+		return nil, err
+	}
+	if changes, _, err = rlp.SplitList(changes); err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < pos; i++ {
+		if _, _, changes, err = rlp.Split(changes); err != nil {
+			return nil, err
+		}
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("no change at position %d", pos)
+	}
+	_, _, rest, err := rlp.Split(changes)
+	if err != nil {
+		return nil, err
+	}
+	change := new(archiveChange)
+	if err := rlp.DecodeBytes(changes[:len(changes)-len(rest)], change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// checkVersion returns the archive if version is readable from it.
+func (db *Database) checkVersion(version uint64) (*archive, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.archive == nil {
+		return nil, errArchiveDisabled
+	}
+	if version > db.archive.version {
+		return nil, fmt.Errorf("archive version %d not yet committed (latest %d)", version, db.archive.version)
+	}
+	return db.archive, nil
+}
+
+// GetAt returns the value key had right after the commit tagged with version,
+// or nil if it was not set at that point.
+func (db *Database) GetAt(key []byte, version uint64) ([]byte, error) {
+	a, err := db.checkVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	entries := rawdb.ReadArchiveIndex(db.diskdb, archiveKeyHash(key), version, 1)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return a.lookup(key, entries[0])
+}
+
+// History returns all changes made to key by the commits tagged with versions
+// from..to (inclusive), oldest first. History(key, 0, db.ArchiveVersion())
+// returns the full change history of the key.
+func (db *Database) History(key []byte, from, to uint64) ([]KeyChange, error) {
+	a, err := db.checkVersion(to)
+	if err != nil {
+		return nil, err
+	}
+	entries := rawdb.ReadArchiveIndex(db.diskdb, archiveKeyHash(key), to, 0)
+
+	var changes []KeyChange
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Version < from {
+			continue
+		}
+		value, err := a.lookup(key, entries[i])
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, KeyChange{Version: entries[i].Version, Value: value})
+	}
+	return changes, nil
+}
+
+// RootAt returns the trie root committed with the given archive version.
+func (db *Database) RootAt(version uint64) (NodeHash, error) {
+	a, err := db.checkVersion(version)
+	if err != nil {
+		return NodeHash{}, err
+	}
+	if version == 0 {
+		return emptyRootHash(db.hashSize), nil
+	}
+	set, err := a.changeSet(version)
+	if err != nil {
+		return NodeHash{}, err
+	}
+	return set.Root, nil
+}
@@ -0,0 +1,237 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+func TestArchiveGetAt(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		diskdb = memorydb.New()
+		db     = NewDatabase(diskdb)
+	)
+	if err := db.EnableArchive(dir); err != nil {
+		t.Fatalf("can't enable archive: %v", err)
+	}
+	trie, _ := New(NodeHash{}, db)
+
+	// Version n sets key-i to "n" for every i < n and deletes key-0 at the end.
+	var roots []NodeHash
+	for n := 1; n <= 5; n++ {
+		for i := 0; i < n; i++ {
+			trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("%d", n)))
+		}
+		if n == 5 {
+			trie.Del([]byte("key-0"))
+		}
+		root, err := trie.Commit(nil)
+		if err != nil {
+			t.Fatalf("commit %d: %v", n, err)
+		}
+		roots = append(roots, root)
+		if v := db.ArchiveVersion(); v != uint64(n) {
+			t.Fatalf("version mismatch: have %d, want %d", v, n)
+		}
+	}
+	// Drop all the nodes, history must be answered from the archive alone.
+	for _, root := range roots {
+		db.Dereference(root)
+	}
+	check := func(db *Database) {
+		for n := uint64(0); n <= 5; n++ {
+			for i := 0; i < 5; i++ {
+				var want []byte
+				if uint64(i) < n {
+					want = []byte(fmt.Sprintf("%d", n))
+				}
+				if i == 0 && n == 5 {
+					want = nil
+				}
+				have, err := db.GetAt([]byte(fmt.Sprintf("key-%d", i)), n)
+				if err != nil {
+					t.Fatalf("GetAt(key-%d, %d): %v", i, n, err)
+				}
+				if !bytes.Equal(have, want) {
+					t.Errorf("GetAt(key-%d, %d): have %q, want %q", i, n, have, want)
+				}
+			}
+			if n > 0 {
+				if root, err := db.RootAt(n); err != nil || root != roots[n-1] {
+					t.Errorf("RootAt(%d): have %x (%v), want %x", n, root, err, roots[n-1])
+				}
+			}
+		}
+		if _, err := db.GetAt([]byte("key-0"), 6); err == nil {
+			t.Error("expected error reading uncommitted version")
+		}
+	}
+	check(db)
+
+	history, err := db.History([]byte("key-0"), 0, db.ArchiveVersion())
+	if err != nil {
+		t.Fatalf("history error: %v", err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("history length mismatch: have %d, want 5", len(history))
+	}
+	for i, change := range history[:4] {
+		if change.Version != uint64(i+1) || string(change.Value) != fmt.Sprintf("%d", i+1) {
+			t.Errorf("history %d: have %d/%q", i, change.Version, change.Value)
+		}
+	}
+	if history[4].Version != 5 || history[4].Value != nil {
+		t.Errorf("expected deletion at version 5, have %d/%q", history[4].Version, history[4].Value)
+	}
+	if ranged, _ := db.History([]byte("key-0"), 2, 3); len(ranged) != 2 || ranged[0].Version != 2 {
+		t.Errorf("ranged history mismatch: %v", ranged)
+	}
+
+	// Reopen the archive and make sure nothing was lost.
+	if err := db.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	db = NewDatabase(diskdb)
+	if err := db.EnableArchive(dir); err != nil {
+		t.Fatalf("can't reopen archive: %v", err)
+	}
+	defer db.Close()
+	if v := db.ArchiveVersion(); v != 5 {
+		t.Fatalf("reopened version mismatch: have %d, want 5", v)
+	}
+	check(db)
+}
+
+func TestArchiveDisabled(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	trie, _ := New(NodeHash{}, db)
+	trie.Put([]byte("key"), []byte("value"))
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if trie.changes != nil {
+		t.Error("changes tracked without archive")
+	}
+	if _, err := db.GetAt([]byte("key"), 0); err != errArchiveDisabled {
+		t.Errorf("expected %v, have %v", errArchiveDisabled, err)
+	}
+}
+
+func TestArchiveFailedMutation(t *testing.T) {
+	var (
+		diskdb = memorydb.New()
+		db     = NewDatabase(diskdb)
+	)
+	if err := db.EnableArchive(t.TempDir()); err != nil {
+		t.Fatalf("can't enable archive: %v", err)
+	}
+	defer db.Close()
+
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 16; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte{byte(i)}, 32))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("flush error: %v", err)
+	}
+	// Drop every node below the root, so mutations fail resolving them.
+	it := diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		if len(it.Key()) == root.Len() && !bytes.Equal(it.Key(), root.Bytes()) {
+			diskdb.Delete(it.Key())
+		}
+	}
+	it.Release()
+
+	trie, err = New(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	if err := trie.TryInsert([]byte("key-0"), []byte("new")); err == nil {
+		t.Fatal("expected update of missing node to fail")
+	}
+	if err := trie.TryDelete([]byte("key-1")); err == nil {
+		t.Fatal("expected delete of missing node to fail")
+	}
+	if len(trie.changes) != 0 {
+		t.Errorf("failed mutations recorded: %v", trie.changes)
+	}
+}
+
+func TestArchiveForkedCommit(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	if err := db.EnableArchive(t.TempDir()); err != nil {
+		t.Fatalf("can't enable archive: %v", err)
+	}
+	defer db.Close()
+
+	a, _ := New(NodeHash{}, db)
+	b, _ := New(NodeHash{}, db)
+	a.Put([]byte("key"), []byte("a"))
+	b.Put([]byte("key"), []byte("b"))
+	root, err := a.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if _, err := b.Commit(nil); err == nil {
+		t.Fatal("expected commit of a second trie to be rejected")
+	}
+	if v := db.ArchiveVersion(); v != 1 {
+		t.Fatalf("version mismatch: have %d, want 1", v)
+	}
+	if value, _ := db.GetAt([]byte("key"), 1); string(value) != "a" {
+		t.Errorf("history overwritten: have %q, want %q", value, "a")
+	}
+	// A trie opened at the latest archived root continues the history.
+	c, _ := New(root, db)
+	c.Put([]byte("key"), []byte("c"))
+	if _, err := c.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if value, _ := db.GetAt([]byte("key"), 2); string(value) != "c" {
+		t.Errorf("value mismatch: have %q, want %q", value, "c")
+	}
+}
+
+func TestArchiveUnchangedRoot(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	if err := db.EnableArchive(t.TempDir()); err != nil {
+		t.Fatalf("can't enable archive: %v", err)
+	}
+	defer db.Close()
+
+	trie, _ := New(NodeHash{}, db)
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	trie.Put([]byte("key"), []byte("value"))
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	// Neither a commit without changes nor one reverting its own changes
+	// adds a version.
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	trie.Put([]byte("other"), []byte("value"))
+	trie.Del([]byte("other"))
+	if _, err := trie.Commit(nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if v := db.ArchiveVersion(); v != 1 {
+		t.Fatalf("version mismatch: have %d, want 1", v)
+	}
+	if history, _ := db.History([]byte("other"), 0, 1); len(history) != 0 {
+		t.Errorf("reverted key has history: %v", history)
+	}
+	if value, _ := db.GetAt([]byte("key"), 1); string(value) != "value" {
+		t.Errorf("value mismatch: have %q, want %q", value, "value")
+	}
+}
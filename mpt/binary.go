@@ -0,0 +1,643 @@
+package mpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// BinaryBranchNode is the radix-2 counterpart of BranchNode. Children 0 and 1
+// hold the subtries for the next key bit, child 2 the value terminating at
+// this node.
+type BinaryBranchNode struct {
+	Children [3]Node
+	flags    NodeFlag
+}
+
+// BinaryShortNode is the radix-2 counterpart of ShortNode. Its key is a
+// sequence of bits, stored in compact form with the binaryFlag marker.
+type BinaryShortNode struct {
+	Key   []byte
+	Val   Node
+	flags NodeFlag
+}
+
+func (n *BinaryBranchNode) copy() *BinaryBranchNode { copy := *n; return &copy }
+func (n *BinaryShortNode) copy() *BinaryShortNode   { copy := *n; return &copy }
+
+func (n *BinaryBranchNode) EncodeRLP(w io.Writer) error { return writeNode(w, n) }
+func (n *BinaryShortNode) EncodeRLP(w io.Writer) error  { return writeNode(w, n) }
+
+func (n *BinaryBranchNode) fstring(ind string) string {
+	resp := fmt.Sprintf("[\n%s  ", ind)
+	for i, node := range &n.Children {
+		if node == nil {
+			resp += fmt.Sprintf("%s: <nil> ", binaryIndices[i])
+		} else {
+			resp += fmt.Sprintf("%s: %v", binaryIndices[i], node.fstring(ind+"  "))
+		}
+	}
+	return resp + fmt.Sprintf("\n%s] ", ind)
+}
+func (n *BinaryShortNode) fstring(ind string) string {
+	return fmt.Sprintf("{%x: %v} ", n.Key, n.Val.fstring(ind+"  "))
+}
+
+func (n *BinaryBranchNode) cache() (HashNode, bool) { return n.flags.hash, n.flags.dirty }
+func (n *BinaryShortNode) cache() (HashNode, bool)  { return n.flags.hash, n.flags.dirty }
+
+var binaryIndices = []string{"0", "1", "[3]"}
+
+// binaryChild maps a key element (0, 1 or the terminator) onto the index of
+// the matching BinaryBranchNode child.
+func binaryChild(b byte) int {
+	if b == 16 {
+		return 2
+	}
+	return int(b)
+}
+
+// binaryKey is the inverse of binaryChild.
+func binaryKey(pos int) byte {
+	if pos == 2 {
+		return 16
+	}
+	return byte(pos)
+}
+
+func decodeBinaryBranch(size int, hash, elems []byte) (*BinaryBranchNode, error) {
+	n := &BinaryBranchNode{flags: NodeFlag{hash: hash}}
+	for i := 0; i < 2; i++ {
+		cld, rest, err := decodeRef(size, elems)
+		if err != nil {
+			return n, wrapError(err, fmt.Sprintf("[%d]", i))
+		}
+		n.Children[i], elems = cld, rest
+	}
+	val, _, err := rlp.SplitString(elems)
+	if err != nil {
+		return n, err
+	}
+	if len(val) > 0 {
+		n.Children[2] = append(ValueNode{}, val...)
+	}
+	return n, nil
+}
+
+// rawBinaryBranchNode is the stripped storage form of a BinaryBranchNode.
+type rawBinaryBranchNode [3]Node
+
+func (n rawBinaryBranchNode) cache() (HashNode, bool) {
+	panic("this should never end up in a live trie")
+}
+func (n rawBinaryBranchNode) fstring(ind string) string {
+	panic("this should never end up in a live trie")
+}
+
+func (n rawBinaryBranchNode) EncodeRLP(w io.Writer) error { return writeNode(w, n) }
+
+// hashBinaryShortNode is the binary counterpart of hasher.hashShortNode.
+func (h *hasher) hashBinaryShortNode(n *BinaryShortNode, force bool) (Node, *BinaryShortNode) {
+	cached := n.copy()
+	val := n.Val
+	switch n.Val.(type) {
+	case *BinaryBranchNode, *BinaryShortNode:
+		val, cached.Val = h.hash(n.Val, false)
+	}
+	h.key = appendBinaryToCompact(h.key[:0], n.Key)
+	h.tmp = appendShort(h.tmp[:0], h.key, val)
+	if len(h.tmp) < h.size && !force {
+		return rawNode(common.CopyBytes(h.tmp)), cached
+	}
+	return h.hashData(h.tmp), cached
+}
+
+// hashBinaryBranchNode is the binary counterpart of hasher.hashBranchNode.
+func (h *hasher) hashBinaryBranchNode(n *BinaryBranchNode, force bool) (Node, *BinaryBranchNode) {
+	cached := n.copy()
+	var collapsed [3]Node
+	for i := 0; i < 2; i++ {
+		if child := n.Children[i]; child != nil {
+			collapsed[i], cached.Children[i] = h.hash(child, false)
+		}
+	}
+	collapsed[2] = n.Children[2]
+	h.tmp = appendBranch(h.tmp[:0], collapsed[:])
+	if len(h.tmp) < h.size && !force {
+		return rawNode(common.CopyBytes(h.tmp)), cached
+	}
+	return h.hashData(h.tmp), cached
+}
+
+// BinaryPatriciaTrie is a radix-2 Merkle Patricia trie. Each branch has two
+// children instead of sixteen, so a proof carries a single sibling per level.
+// It shares the node Database, the commit machinery and the hashing with
+// MerklePatriciaTrie and exposes the same Trie surface.
+type BinaryPatriciaTrie struct {
+	db       *Database
+	root     Node
+	unhashed int
+	tracer   tracer            // Stored nodes resolved since the last commit
+	ctx      context.Context   // Context of resolver fetches, background if nil
+	changes  map[string][]byte // Keys modified since the last commit, only tracked in archive mode
+	base     NodeHash          // Root the trie was opened at or last committed, the parent of archived commits
+}
+
+func (t *BinaryPatriciaTrie) newFlag() NodeFlag {
+	return NodeFlag{dirty: true}
+}
+
+// NewBinary opens the binary trie with the given root from db. An empty root
+// creates an empty trie.
+func NewBinary(root NodeHash, db *Database) (*BinaryPatriciaTrie, error) {
+	if db == nil {
+		panic("trie.NewBinary called without a database")
+	}
+	trie := &BinaryPatriciaTrie{
+		db:   db,
+		base: root,
+	}
+	if !isEmptyRoot(root, db.hashSize) {
+		if root.Len() != db.hashSize {
+			return nil, fmt.Errorf("root %x is %d bytes, database uses %d-byte hashes", root, root.Len(), db.hashSize)
+		}
+		rootnode, err := trie.resolveHash(root.Bytes(), nil)
+		if err != nil {
+			return nil, err
+		}
+		trie.root = rootnode
+	}
+	return trie, nil
+}
+
+func (t *BinaryPatriciaTrie) resolve(n Node, prefix []byte) (Node, error) {
+	if n, ok := n.(HashNode); ok {
+		return t.resolveHash(n, prefix)
+	}
+	return n, nil
+}
+
+func (t *BinaryPatriciaTrie) resolveHash(n HashNode, prefix []byte) (Node, error) {
+	hash := BytesToNodeHash(n)
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	node, err := t.db.resolve(ctx, hash)
+	if err != nil {
+		if cerr, ok := err.(*CorruptNodeError); ok {
+			cerr.Path = common.CopyBytes(prefix)
+			return nil, err
+		}
+		return nil, &MissingNodeError{NodeHash: hash, Path: prefix, Err: err}
+	}
+	if node != nil {
+		t.tracer.onResolve(prefix, hash)
+		return node, nil
+	}
+	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+}
+
+// hashSize returns the node hash width of the trie's database, 256 bits for a
+// trie without one.
+func (t *BinaryPatriciaTrie) hashSize() int {
+	if t.db == nil {
+		return HashSize256
+	}
+	return t.db.hashSize
+}
+
+// SetContext sets the context bounding node fetches from the database's node
+// resolver. Fetches are not cancelled unless a context is set.
+func (t *BinaryPatriciaTrie) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
+// Hash returns the root hash of the trie. It does not write to the
+// database and can be used even if the trie doesn't have one.
+func (t *BinaryPatriciaTrie) Hash() NodeHash {
+	if t.root == nil {
+		return emptyRootHash(t.hashSize())
+	}
+	h := newHasher(t.hashSize())
+	defer returnHasherToPool(h)
+	hashed, cached := h.hash(t.root, true)
+	t.root = cached
+	t.unhashed = 0
+	return BytesToNodeHash(hashed.(HashNode))
+}
+
+// Put associates key with value in the trie. Errors, e.g. a missing or
+// corrupt node, are only logged; use TryInsert to handle them.
+func (t *BinaryPatriciaTrie) Put(key, value []byte) {
+	if err := t.TryInsert(key, value); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryInsert associates key with value in the trie. An empty value deletes the
+// key. If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryPatriciaTrie) TryInsert(key, value []byte) error {
+	t.unhashed++
+	k := keybytesToBinary(key)
+	if len(value) != 0 {
+		_, n, err := t.insert(t.root, nil, k, ValueNode(value))
+		if err != nil {
+			return err
+		}
+		t.root = n
+	} else {
+		_, n, err := t.delete(t.root, nil, k)
+		if err != nil {
+			return err
+		}
+		t.root = n
+	}
+	t.db.recordChange(&t.changes, key, value)
+	return nil
+}
+
+func (t *BinaryPatriciaTrie) insert(n Node, prefix, key []byte, value Node) (bool, Node, error) {
+	if len(key) == 0 {
+		if v, ok := n.(ValueNode); ok {
+			return !bytes.Equal(v, value.(ValueNode)), value, nil
+		}
+		return true, value, nil
+	}
+	switch n := n.(type) {
+	case *BinaryShortNode:
+		matchlen := prefixLen(key, n.Key)
+		// If the whole key matches, keep this short node as is
+		// and only update the value.
+		if matchlen == len(n.Key) {
+			dirty, nn, err := t.insert(n.Val, append(prefix, key[:matchlen]...), key[matchlen:], value)
+			if !dirty || err != nil {
+				return false, n, err
+			}
+			return true, &BinaryShortNode{n.Key, nn, t.newFlag()}, nil
+		}
+		// Otherwise branch out at the index where they differ.
+		branch := &BinaryBranchNode{flags: t.newFlag()}
+		var err error
+		_, branch.Children[binaryChild(n.Key[matchlen])], err = t.insert(nil, append(prefix, n.Key[:matchlen+1]...), n.Key[matchlen+1:], n.Val)
+		if err != nil {
+			return false, nil, err
+		}
+		_, branch.Children[binaryChild(key[matchlen])], err = t.insert(nil, append(prefix, key[:matchlen+1]...), key[matchlen+1:], value)
+		if err != nil {
+			return false, nil, err
+		}
+		// Replace this shortNode with the branch if it occurs at index 0.
+		if matchlen == 0 {
+			return true, branch, nil
+		}
+		// Otherwise, replace it with a short node leading up to the branch.
+		return true, &BinaryShortNode{key[:matchlen], branch, t.newFlag()}, nil
+
+	case *BinaryBranchNode:
+		idx := binaryChild(key[0])
+		dirty, nn, err := t.insert(n.Children[idx], append(prefix, key[0]), key[1:], value)
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		n = n.copy()
+		n.flags = t.newFlag()
+		n.Children[idx] = nn
+		return true, n, nil
+
+	case nil:
+		return true, &BinaryShortNode{key, value, t.newFlag()}, nil
+
+	case HashNode:
+		// We've hit a part of the trie that isn't loaded yet. Load
+		// the node and insert into it. This leaves all child nodes on
+		// the path to the value in the trie.
+		rn, err := t.resolveHash(n, prefix)
+		if err != nil {
+			return false, nil, err
+		}
+		dirty, nn, err := t.insert(rn, prefix, key, value)
+		if !dirty || err != nil {
+			return false, rn, err
+		}
+		return true, nn, nil
+
+	default:
+		return false, nil, invalidNodeError(n, prefix)
+	}
+}
+
+// Del removes any existing value for key from the trie. Errors are only
+// logged; use TryDelete to handle them.
+func (t *BinaryPatriciaTrie) Del(key []byte) {
+	if err := t.TryDelete(key); err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryDelete removes any existing value for key from the trie.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryPatriciaTrie) TryDelete(key []byte) error {
+	t.unhashed++
+	k := keybytesToBinary(key)
+	_, n, err := t.delete(t.root, nil, k)
+	if err != nil {
+		return err
+	}
+	t.root = n
+	t.db.recordChange(&t.changes, key, nil)
+	return nil
+}
+
+// delete returns the new root of the trie with key deleted, reducing the
+// trie to minimal form on the way up.
+func (t *BinaryPatriciaTrie) delete(n Node, prefix, key []byte) (bool, Node, error) {
+	switch n := n.(type) {
+	case *BinaryShortNode:
+		matchlen := prefixLen(key, n.Key)
+		if matchlen < len(n.Key) {
+			return false, n, nil // don't replace n on mismatch
+		}
+		if matchlen == len(key) {
+			return true, nil, nil // remove n entirely for whole matches
+		}
+		dirty, child, err := t.delete(n.Val, append(prefix, key[:len(n.Key)]...), key[len(n.Key):])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		switch child := child.(type) {
+		case *BinaryShortNode:
+			// Merge the nodes to avoid a short node directly under
+			// another one.
+			return true, &BinaryShortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
+		default:
+			return true, &BinaryShortNode{n.Key, child, t.newFlag()}, nil
+		}
+
+	case *BinaryBranchNode:
+		idx := binaryChild(key[0])
+		dirty, nn, err := t.delete(n.Children[idx], append(prefix, key[0]), key[1:])
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		n = n.copy()
+		n.flags = t.newFlag()
+		n.Children[idx] = nn
+
+		// A branch always holds at least two entries, so if only one
+		// is left after the deletion, n is reduced to a short node.
+		pos := -1
+		for i, cld := range &n.Children {
+			if cld != nil {
+				if pos == -1 {
+					pos = i
+				} else {
+					pos = -2
+					break
+				}
+			}
+		}
+		if pos >= 0 {
+			if pos != 2 {
+				// If the remaining entry is a short node, it replaces
+				// n and its key gets the missing bit tacked to the
+				// front.
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
+				if err != nil {
+					return false, nil, err
+				}
+				if cnode, ok := cnode.(*BinaryShortNode); ok {
+					k := append([]byte{binaryKey(pos)}, cnode.Key...)
+					return true, &BinaryShortNode{k, cnode.Val, t.newFlag()}, nil
+				}
+			}
+			return true, &BinaryShortNode{[]byte{binaryKey(pos)}, n.Children[pos], t.newFlag()}, nil
+		}
+		// n still contains at least two values and cannot be reduced.
+		return true, n, nil
+
+	case ValueNode:
+		return true, nil, nil
+
+	case nil:
+		return false, nil, nil
+
+	case HashNode:
+		rn, err := t.resolveHash(n, prefix)
+		if err != nil {
+			return false, nil, err
+		}
+		dirty, nn, err := t.delete(rn, prefix, key)
+		if !dirty || err != nil {
+			return false, rn, err
+		}
+		return true, nn, nil
+
+	default:
+		return false, nil, invalidNodeError(n, prefix)
+	}
+}
+
+// Get returns the value for key stored in the trie. Errors are only logged
+// and yield a nil value; use TryGet to handle them.
+func (t *BinaryPatriciaTrie) Get(key []byte) []byte {
+	res, err := t.TryGet(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+	return res
+}
+
+// TryGet returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *BinaryPatriciaTrie) TryGet(key []byte) ([]byte, error) {
+	value, newroot, didResolve, err := t.tryGet(t.root, keybytesToBinary(key), 0)
+	if err == nil && didResolve {
+		t.root = newroot
+	}
+	return value, err
+}
+
+func (t *BinaryPatriciaTrie) tryGet(origNode Node, key []byte, pos int) (value []byte, newnode Node, didResolve bool, err error) {
+	switch n := (origNode).(type) {
+	case nil:
+		return nil, nil, false, nil
+	case ValueNode:
+		return n, n, false, nil
+	case *BinaryShortNode:
+		if len(key)-pos < len(n.Key) || !bytes.Equal(n.Key, key[pos:pos+len(n.Key)]) {
+			// key not found in trie
+			return nil, n, false, nil
+		}
+		value, newnode, didResolve, err = t.tryGet(n.Val, key, pos+len(n.Key))
+		if err == nil && didResolve {
+			n = n.copy()
+			n.Val = newnode
+		}
+		return value, n, didResolve, err
+	case *BinaryBranchNode:
+		idx := binaryChild(key[pos])
+		value, newnode, didResolve, err = t.tryGet(n.Children[idx], key, pos+1)
+		if err == nil && didResolve {
+			n = n.copy()
+			n.Children[idx] = newnode
+		}
+		return value, n, didResolve, err
+	case HashNode:
+		child, err := t.resolveHash(n, key[:pos])
+		if err != nil {
+			return nil, n, true, err
+		}
+		value, newnode, _, err := t.tryGet(child, key, pos)
+		return value, newnode, true, err
+	default:
+		return nil, origNode, false, invalidNodeError(origNode, key[:pos])
+	}
+}
+
+// Commit writes all dirty nodes of the trie into the node database and
+// returns the root hash. In archive mode the commit is also tagged with the
+// next archive version.
+func (t *BinaryPatriciaTrie) Commit(onleaf LeafCallback) (NodeHash, error) {
+	if err := t.db.archiveBase(t.base); err != nil {
+		return NodeHash{}, err
+	}
+	root, set, err := t.CommitSet()
+	if err != nil {
+		return NodeHash{}, err
+	}
+	if err := t.db.Update(set); err != nil {
+		return NodeHash{}, err
+	}
+	if onleaf != nil {
+		if err := set.reportLeaves(onleaf); err != nil {
+			return NodeHash{}, err
+		}
+	}
+	if err := t.db.archiveCommit(t.base, root, t.changes); err != nil {
+		return NodeHash{}, err
+	}
+	t.changes, t.base = nil, root
+	return root, nil
+}
+
+// CommitSet collapses the trie and returns its root hash along with the nodes
+// the commit added and the previously stored nodes it made obsolete. The node
+// database is left untouched, the set can be applied with Database.Update.
+func (t *BinaryPatriciaTrie) CommitSet() (NodeHash, *NodeSet, error) {
+	if t.db == nil {
+		panic("commit called on trie with nil database")
+	}
+	defer t.tracer.reset()
+
+	set := NewNodeSet()
+	if t.root == nil {
+		set.Deleted = t.tracer.deleted(set, nil)
+		return emptyRootHash(t.hashSize()), set, nil
+	}
+	// Derive the hash for all dirty nodes first. We hold the assumption
+	// in the following procedure that all nodes are hashed.
+	rootHash := t.Hash()
+
+	// Do a quick check if we really need to commit. This can happen e.g. if
+	// we load a trie for reading storage values, but don't write to it.
+	if _, dirty := t.root.cache(); !dirty {
+		return rootHash, set, nil
+	}
+	h := newCommitter()
+	defer returnCommitterToPool(h)
+
+	newRoot, err := h.Commit(t.root)
+	if err != nil {
+		return NodeHash{}, nil, err
+	}
+	set = h.nodes
+	set.Deleted = t.tracer.deleted(set, h.retained)
+	t.root = newRoot
+	return rootHash, set, nil
+}
+
+// Proof returns the hashes of the nodes on the path to key, root first.
+func (t *BinaryPatriciaTrie) Proof(key []byte) (res [][]byte, err error) {
+	nodes, err := t.ProofNodes(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+		return nil, err
+	}
+	for _, enc := range nodes {
+		res = append(res, hashData(t.hashSize(), enc))
+	}
+	return res, nil
+}
+
+// ProofNodes returns the encodings of the stored nodes on the path to key, root
+// first. Every branch node holds the hash of the sibling subtree at its level,
+// so the proof can be checked with VerifyBinaryProof.
+func (t *BinaryPatriciaTrie) ProofNodes(key []byte) ([][]byte, error) {
+	// Collect all nodes on the path to key.
+	key = keybytesToBinary(key)
+	path := key
+	var nodes []Node
+	tn := t.root
+	for len(key) > 0 && tn != nil {
+		switch n := tn.(type) {
+		case *BinaryShortNode:
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				// The trie doesn't contain the key.
+				tn = nil
+			} else {
+				tn = n.Val
+				key = key[len(n.Key):]
+			}
+			nodes = append(nodes, n)
+		case *BinaryBranchNode:
+			tn = n.Children[binaryChild(key[0])]
+			key = key[1:]
+			nodes = append(nodes, n)
+		case HashNode:
+			var err error
+			tn, err = t.resolveHash(n, path[:len(path)-len(key)])
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, invalidNodeError(tn, path[:len(path)-len(key)])
+		}
+	}
+	hasher := newHasher(t.hashSize())
+	defer returnHasherToPool(hasher)
+
+	var res [][]byte
+	for i, n := range nodes {
+		enc, hn := hasher.proofHash(n)
+		if _, ok := hn.(HashNode); ok || i == 0 {
+			// If the node's database encoding is a hash (or is the
+			// root node), it becomes a proof element.
+			res = append(res, enc)
+		}
+	}
+	return res, nil
+}
+
+func decodeBinaryShort(size int, flag NodeFlag, kbuf, rest []byte) (Node, error) {
+	key := compactToBinary(kbuf)
+	if hasTerm(key) {
+		// value node
+		val, _, err := rlp.SplitString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value node: %v", err)
+		}
+		return &BinaryShortNode{key, append(ValueNode{}, val...), flag}, nil
+	}
+	r, _, err := decodeRef(size, rest)
+	if err != nil {
+		return nil, wrapError(err, "val")
+	}
+	return &BinaryShortNode{key, r, flag}, nil
+}
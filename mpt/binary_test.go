@@ -0,0 +1,135 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+func newEmptyBinary() *BinaryPatriciaTrie {
+	trie, _ := NewBinary(NodeHash{}, NewDatabase(memorydb.New()))
+	return trie
+}
+
+func TestBinaryCompactKeys(t *testing.T) {
+	tests := [][]byte{
+		{},
+		{16},
+		{1},
+		{0, 1, 1, 0, 1, 0, 1, 0},
+		{1, 0, 1, 1, 0, 0, 1, 0, 1, 16},
+		keybytesToBinary([]byte("dogglesworth")),
+	}
+	for _, bits := range tests {
+		compact := binaryToCompact(bits)
+		if !isBinaryCompact(compact) {
+			t.Errorf("%v: compact key %x not flagged as binary", bits, compact)
+		}
+		if dec := compactToBinary(compact); !bytes.Equal(dec, bits) {
+			t.Errorf("%v: round trip gave %v", bits, dec)
+		}
+	}
+	if isBinaryCompact(hexToCompact([]byte{1, 2, 3, 16})) {
+		t.Error("hex compact key flagged as binary")
+	}
+}
+
+func TestBinaryGetPutDel(t *testing.T) {
+	trie := newEmptyBinary()
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"dog", "puppy"},
+	}
+	for _, val := range vals {
+		trie.Put([]byte(val.k), []byte(val.v))
+	}
+	for _, val := range vals {
+		if res := trie.Get([]byte(val.k)); !bytes.Equal(res, []byte(val.v)) {
+			t.Errorf("get %q: have %q, want %q", val.k, res, val.v)
+		}
+	}
+	if res := trie.Get([]byte("unknown")); res != nil {
+		t.Errorf("expected nil got %x", res)
+	}
+	// Removing keys must leave the same trie as never inserting them.
+	trie.Del([]byte("ether"))
+	trie.Del([]byte("shaman"))
+	exp := newEmptyBinary()
+	for _, val := range vals {
+		if val.k != "ether" && val.k != "shaman" {
+			exp.Put([]byte(val.k), []byte(val.v))
+		}
+	}
+	if trie.Hash() != exp.Hash() {
+		t.Errorf("deletion left non-canonical trie: %x != %x", trie.Hash(), exp.Hash())
+	}
+	for _, val := range vals {
+		trie.Del([]byte(val.k))
+	}
+	if trie.Hash() != emptyRoot {
+		t.Errorf("expected empty root got %x", trie.Hash())
+	}
+}
+
+func TestBinaryCommitReopen(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := NewBinary(NodeHash{}, db)
+	for i := 0; i < 300; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("database commit error: %v", err)
+	}
+	// Reopen from disk only, so every node is decoded from its blob.
+	trie, err = NewBinary(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	for i := 0; i < 300; i++ {
+		key, want := fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i)
+		if res, err := trie.TryGet([]byte(key)); err != nil || string(res) != want {
+			t.Fatalf("get %q: have %q (%v), want %q", key, res, err, want)
+		}
+	}
+	trie.Put([]byte("key-7"), []byte("changed"))
+	if trie.Hash() == root {
+		t.Error("root unchanged after update")
+	}
+	trie.Put([]byte("key-7"), []byte("val-7"))
+	if trie.Hash() != root {
+		t.Error("root differs after restoring value")
+	}
+}
+
+func TestBinaryProof(t *testing.T) {
+	var (
+		hex = newEmpty()
+		bin = newEmptyBinary()
+	)
+	for i := 0; i < 1000; i++ {
+		key, val := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i))
+		hex.Put(key, val)
+		bin.Put(key, val)
+	}
+	for _, trie := range []Trie{hex, bin} {
+		trie.Hash()
+		proof, err := trie.Proof([]byte("key-500"))
+		if err != nil {
+			t.Fatalf("%T: proof error: %v", trie, err)
+		}
+		if len(proof) == 0 {
+			t.Fatalf("%T: empty proof", trie)
+		}
+	}
+}
@@ -17,88 +17,56 @@
 package mpt
 
 import (
-	"errors"
 	"fmt"
-	"hash"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/pavelkrolevets/mpt/gost3411"
 )
 
-type sliceBuffer []byte
-
-func (b *sliceBuffer) Write(data []byte) (n int, err error) {
-	*b = append(*b, data...)
-	return len(data), nil
-}
-
-func (b *sliceBuffer) Reset() {
-	*b = (*b)[:0]
-}
-
-// leafChanSize is the size of the leafCh. It's a pretty arbitrary number, to allow
-// some parallelism but not incur too much memory overhead.
-const leafChanSize = 200
-
-// leaf represents a trie leaf value
-type leaf struct {
-	size int         // size of the rlp data (estimate)
-	hash common.Hash // hash of rlp data
-	node Node        // the node to commit
-}
-
-// committer is a type used for the trie Commit operation. A committer has some
-// internal preallocated temp space, and also a callback that is invoked when
-// leaves are committed. The leafs are passed through the `leafCh`,  to allow
-// some level of parallelism.
-// By 'some level' of parallelism, it's still the case that all leaves will be
-// processed sequentially - onleaf will never be called in parallel or out of order.
+// committer is a type used for the trie Commit operation. A committer collects the committed nodes into a
+// NodeSet together with the paths of the subtrees that were left untouched.
 type committer struct {
-	tmp sliceBuffer
-	sha hash.Hash
-	onleaf LeafCallback
-	leafCh chan *leaf
+	nodes    *NodeSet            // Nodes collapsed by the commit, children first
+	retained map[string]struct{} // Paths of the clean subtrees kept by the commit
 }
 
 // committers live in a global sync.Pool
 var committerPool = sync.Pool{
 	New: func() interface{} {
-		return &committer{
-			tmp: make(sliceBuffer, 0, 550), // cap is as large as a full fullNode.
-			sha: gost3411.New256(),
-		}
+		return &committer{}
 	},
 }
 
 // newCommitter creates a new committer or picks one from the pool.
 func newCommitter() *committer {
-	return committerPool.Get().(*committer)
+	c := committerPool.Get().(*committer)
+	c.nodes = NewNodeSet()
+	c.retained = make(map[string]struct{})
+	return c
 }
 
 func returnCommitterToPool(h *committer) {
-	h.onleaf = nil
-	h.leafCh = nil
+	h.nodes = nil
+	h.retained = nil
 	committerPool.Put(h)
 }
 
-// commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) Commit(n Node, db *Database) (HashNode, error) {
-	if db == nil {
-		return nil, errors.New("no db provided")
-	}
-	h, err := c.commit(n, db)
+// Commit collapses a node down into a hash node, collecting every dirty node
+// into the committer's node set.
+func (c *committer) Commit(n Node) (HashNode, error) {
+	h, err := c.commit(nil, n)
 	if err != nil {
 		return nil, err
 	}
 	return h.(HashNode), nil
 }
 
-// commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) commit(n Node, db *Database) (Node, error) {
+// commit collapses a node down into a hash node and adds it to the node set
+func (c *committer) commit(path []byte, n Node) (Node, error) {
 	// if this path is clean, use available cached data
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
+		c.retained[string(path)] = struct{}{}
 		return hash, nil
 	}
 	// Commit children, then parent, and remove remove the dirty flag.
@@ -109,60 +77,103 @@ func (c *committer) commit(n Node, db *Database) (Node, error) {
 
 		// If the child is fullnode, recursively commit.
 		// Otherwise it can only be hashNode or valueNode.
-		if _, ok := cn.Val.(*BranchNode); ok {
-			childV, err := c.commit(cn.Val, db)
+		switch cn.Val.(type) {
+		case *BranchNode:
+			childV, err := c.commit(append(path, cn.Key...), cn.Val)
 			if err != nil {
 				return nil, err
 			}
 			collapsed.Val = childV
+		case HashNode:
+			c.retained[string(append(path, cn.Key...))] = struct{}{}
 		}
 		// The key needs to be copied, since we're delivering it to database
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, db)
+		hashedNode, err := c.store(path, collapsed)
+		if err != nil {
+			return nil, err
+		}
 		if hn, ok := hashedNode.(HashNode); ok {
 			return hn, nil
 		}
 		return collapsed, nil
 	case *BranchNode:
-		hashedKids, err := c.commitChildren(cn, db)
+		hashedKids, err := c.commitChildren(path, cn)
 		if err != nil {
 			return nil, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, db)
+		hashedNode, err := c.store(path, collapsed)
+		if err != nil {
+			return nil, err
+		}
+		if hn, ok := hashedNode.(HashNode); ok {
+			return hn, nil
+		}
+		return collapsed, nil
+	case *BinaryShortNode:
+		collapsed := cn.copy()
+		switch cn.Val.(type) {
+		case *BinaryBranchNode:
+			childV, err := c.commit(append(path, cn.Key...), cn.Val)
+			if err != nil {
+				return nil, err
+			}
+			collapsed.Val = childV
+		case HashNode:
+			c.retained[string(append(path, cn.Key...))] = struct{}{}
+		}
+		collapsed.Key = binaryToCompact(cn.Key)
+		hashedNode, err := c.store(path, collapsed)
+		if err != nil {
+			return nil, err
+		}
+		if hn, ok := hashedNode.(HashNode); ok {
+			return hn, nil
+		}
+		return collapsed, nil
+	case *BinaryBranchNode:
+		hashedKids, err := c.commitBinaryChildren(path, cn)
+		if err != nil {
+			return nil, err
+		}
+		collapsed := cn.copy()
+		collapsed.Children = hashedKids
+
+		hashedNode, err := c.store(path, collapsed)
+		if err != nil {
+			return nil, err
+		}
 		if hn, ok := hashedNode.(HashNode); ok {
 			return hn, nil
 		}
 		return collapsed, nil
 	case HashNode:
+		c.retained[string(path)] = struct{}{}
 		return cn, nil
 	default:
 		// nil, valuenode shouldn't be committed
-		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		return nil, invalidNodeError(n, path)
 	}
 }
 
 // commitChildren commits the children of the given fullnode
-func (c *committer) commitChildren(n *BranchNode, db *Database) ([17]Node, error) {
+func (c *committer) commitChildren(path []byte, n *BranchNode) ([17]Node, error) {
 	var children [17]Node
 	for i := 0; i < 16; i++ {
 		child := n.Children[i]
 		if child == nil {
 			continue
 		}
-		// If it's the hashed child, save the hash value directly.
-		// Note: it's impossible that the child in range [0, 15]
-		// is a valuenode.
-		if hn, ok := child.(HashNode); ok {
-			children[i] = hn
-			continue
-		}
 		// Commit the child recursively and store the "hashed" value.
 		// Note the returned node can be some embedded nodes, so it's
-		// possible the type is not hashnode.
-		hashed, err := c.commit(child, db)
+		// possible the type is not hashnode. Hashed children are
+		// returned as is and only marked as retained.
+		// Note: it's impossible that the child in range [0, 15]
+		// is a valuenode.
+		hashed, err := c.commit(append(path, byte(i)), child)
 		if err != nil {
 			return children, err
 		}
@@ -175,105 +186,89 @@ func (c *committer) commitChildren(n *BranchNode, db *Database) ([17]Node, error
 	return children, nil
 }
 
-// store hashes the node n and if we have a storage layer specified, it writes
-// the key/value pair to it and tracks any node->child references as well as any
-// node->external trie references.
-func (c *committer) store(n Node, db *Database) Node {
+// commitBinaryChildren commits the children of the given binary branch node
+func (c *committer) commitBinaryChildren(path []byte, n *BinaryBranchNode) ([3]Node, error) {
+	var children [3]Node
+	for i := 0; i < 2; i++ {
+		child := n.Children[i]
+		if child == nil {
+			continue
+		}
+		hashed, err := c.commit(append(path, byte(i)), child)
+		if err != nil {
+			return children, err
+		}
+		children[i] = hashed
+	}
+	if n.Children[2] != nil {
+		children[2] = n.Children[2]
+	}
+	return children, nil
+}
+
+// store hashes the node n and, if it is large enough to be stored on its own,
+// adds it to the node set under the given path.
+func (c *committer) store(path []byte, n Node) (Node, error) {
 	// Larger nodes are replaced by their hash and stored in the database.
-	var (
-		hash, _ = n.cache()
-		size    int
-	)
+	hash, _ := n.cache()
 	if hash == nil {
 		// This was not generated - must be a small node stored in the parent.
-		// In theory we should apply the leafCall here if it's not nil(embedded
-		// node usually contains value). But small value(less than 32bytes) is
-		// not our target.
-		return n
-	} else {
-		// We have the hash already, estimate the RLP encoding-size of the node.
-		// The size is used for mem tracking, does not need to be exact
-		size = estimateSize(n)
+		return n, nil
 	}
-	// If we're using channel-based leaf-reporting, send to channel.
-	// The leaf channel will be active only when there an active leaf-callback
-	if c.leafCh != nil {
-		c.leafCh <- &leaf{
-			size: size,
-			hash: common.BytesToHash(hash),
-			node: n,
-		}
-	} else if db != nil {
-		// No leaf-callback used, but there's still a database. Do serial
-		// insertion
-		db.lock.Lock()
-		db.insert(common.BytesToHash(hash), size, n)
-		db.lock.Unlock()
+	// We have the hash already, estimate the RLP encoding-size of the node.
+	// The size is used for mem tracking, does not need to be exact
+	size, err := estimateSize(n)
+	if err != nil {
+		return nil, &CorruptNodeError{NodeHash: BytesToNodeHash(hash), Path: common.CopyBytes(path), Err: err}
 	}
-	return hash
-}
-
-// commitLoop does the actual insert + leaf callback for nodes.
-func (c *committer) commitLoop(db *Database) {
-	for item := range c.leafCh {
-		var (
-			hash = item.hash
-			size = item.size
-			n    = item.node
-		)
-		// We are pooling the trie nodes into an intermediate memory cache
-		db.lock.Lock()
-		db.insert(hash, size, n)
-		db.lock.Unlock()
-
-		if c.onleaf != nil {
-			switch n := n.(type) {
-			case *ShortNode:
-				if child, ok := n.Val.(ValueNode); ok {
-					c.onleaf(nil, child, hash)
-				}
-			case *BranchNode:
-				// For children in range [0, 15], it's impossible
-				// to contain valuenode. Only check the 17th child.
-				if n.Children[16] != nil {
-					c.onleaf(nil, n.Children[16].(ValueNode), hash)
-				}
-			}
-		}
+	if err := c.nodes.add(path, BytesToNodeHash(hash), size, n); err != nil {
+		return nil, err
 	}
-}
-
-func (c *committer) makeHashNode(data []byte) HashNode {
-	c.sha.Reset()
-	c.sha.Write(data)
-	return c.sha.Sum(nil)
+	return hash, nil
 }
 
 // estimateSize estimates the size of an rlp-encoded node, without actually
 // rlp-encoding it (zero allocs). This method has been experimentally tried, and with a trie
 // with 1000 leafs, the only errors above 1% are on small shortnodes, where this
-// method overestimates by 2 or 3 bytes (e.g. 37 instead of 35)
-func estimateSize(n Node) int {
+// method overestimates by 2 or 3 bytes (e.g. 37 instead of 35). An error is
+// returned if the node contains a node type that can't be stored.
+func estimateSize(n Node) (int, error) {
 	switch n := n.(type) {
 	case *ShortNode:
 		// A short node contains a compacted key, and a value.
-		return 3 + len(n.Key) + estimateSize(n.Val)
+		s, err := estimateSize(n.Val)
+		return 3 + len(n.Key) + s, err
 	case *BranchNode:
 		// A full node contains up to 16 hashes (some nils), and a key
-		s := 3
-		for i := 0; i < 16; i++ {
-			if child := n.Children[i]; child != nil {
-				s += estimateSize(child)
-			} else {
-				s++
-			}
-		}
-		return s
+		return estimateChildren(n.Children[:16])
+	case *BinaryShortNode:
+		s, err := estimateSize(n.Val)
+		return 3 + len(n.Key) + s, err
+	case *BinaryBranchNode:
+		return estimateChildren(n.Children[:2])
 	case ValueNode:
-		return 1 + len(n)
+		return 1 + len(n), nil
 	case HashNode:
-		return 1 + len(n)
+		return 1 + len(n), nil
 	default:
-		panic(fmt.Sprintf("node type %T", n))
+		return 0, fmt.Errorf("invalid node type %T", n)
+	}
+}
+
+// estimateChildren estimates the size of a branch node with the given
+// children, counting one byte for every empty child.
+func estimateChildren(children []Node) (int, error) {
+	s := 3
+	for _, child := range children {
+		if child == nil {
+			s++
+			continue
+		}
+		cs, err := estimateSize(child)
+		if err != nil {
+			return 0, err
+		}
+		s += cs
 	}
+	return s, nil
 }
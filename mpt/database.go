@@ -37,17 +37,16 @@ import (
 // the disk database. The aim is to accumulate trie writes in-memory and only
 // periodically flush a couple tries to disk, garbage collecting the remainder.
 //
-// Note, the trie Database is **not** thread safe in its mutations, but it **is**
-// thread safe in providing individual, independent node access. The rationale
-// behind this split design is to provide read access to RPC handlers and sync
-// servers even while the trie is executing expensive garbage collection.
+// The trie Database is thread safe, both in providing individual, independent
+// node access and in its mutations.
 type Database struct {
-	diskdb ethdb.KeyValueStore // Persistent storage for matured trie nodes
+	diskdb   ethdb.KeyValueStore // Persistent storage for matured trie nodes
+	hashSize int                 // Width of the node hashes, HashSize256 or HashSize512
 
-	cleans  *fastcache.Cache            // GC friendly memory cache of clean node RLPs
-	dirties map[common.Hash]*cachedNode // Data and references relationships of dirty trie nodes
-	oldest  common.Hash                 // Oldest tracked node, flush-list head
-	newest  common.Hash                 // Newest tracked node, flush-list tail
+	cleans  *fastcache.Cache         // GC friendly memory cache of clean node RLPs
+	dirties map[NodeHash]*cachedNode // Data and references relationships of dirty trie nodes
+	oldest  NodeHash                 // Oldest tracked node, flush-list head
+	newest  NodeHash                 // Newest tracked node, flush-list tail
 
 	preimages map[common.Hash][]byte // Preimages of nodes from the secure trie
 
@@ -63,7 +62,19 @@ type Database struct {
 	childrenSize  common.StorageSize // Storage size of the external children tracking
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
-	lock sync.RWMutex
+	archive *archive // Historical change sets, nil unless in archive mode
+
+	dirtyLimit common.StorageSize // Dirty cache size triggering a background flush, zero if disabled
+	flushReq   chan struct{}      // Wakes the background flusher up
+	flushQuit  chan chan error    // Stops the background flusher, returning the final flush error
+
+	resolver       NodeResolver            // Source of nodes missing locally, nil if none
+	resolveTimeout time.Duration           // Time allowed for a single resolver fetch
+	fetches        map[NodeHash]*nodeFetch // In-flight resolver fetches, by node hash
+	fetchLock      sync.Mutex              // Protects the in-flight fetches
+
+	lock      sync.RWMutex
+	flushLock sync.Mutex // Serializes flushes to disk, held while writing batches
 }
 
 // rawNode is a simple binary blob used to differentiate between collapsed trie
@@ -84,18 +95,7 @@ type rawBranchNode [17]Node
 func (n rawBranchNode) cache() (HashNode, bool)   { panic("this should never end up in a live trie") }
 func (n rawBranchNode) fstring(ind string) string { panic("this should never end up in a live trie") }
 
-func (n rawBranchNode) EncodeRLP(w io.Writer) error {
-	var nodes [17]Node
-
-	for i, child := range n {
-		if child != nil {
-			nodes[i] = child
-		} else {
-			nodes[i] = NilValueNode
-		}
-	}
-	return rlp.Encode(w, nodes)
-}
+func (n rawBranchNode) EncodeRLP(w io.Writer) error { return writeNode(w, n) }
 
 // rawShortNode represents only the useful data content of a short node, with the
 // caches and flags stripped out to minimize its data storage. This type honors
@@ -108,17 +108,19 @@ type rawShortNode struct {
 func (n rawShortNode) cache() (HashNode, bool)   { panic("this should never end up in a live trie") }
 func (n rawShortNode) fstring(ind string) string { panic("this should never end up in a live trie") }
 
+func (n rawShortNode) EncodeRLP(w io.Writer) error { return writeNode(w, n) }
+
 // cachedNode is all the information we know about a single cached trie node
 // in the memory database write layer.
 type cachedNode struct {
 	node Node   // Cached collapsed trie node, or raw rlp data
 	size uint16 // Byte size of the useful cached data
 
-	parents  uint32                 // Number of live nodes referencing this one
-	children map[common.Hash]uint16 // External children referenced by this node
+	parents  uint32              // Number of live nodes referencing this one
+	children map[NodeHash]uint16 // External children referenced by this node
 
-	flushPrev common.Hash // Previous node in the flush-list
-	flushNext common.Hash // Next node in the flush-list
+	flushPrev NodeHash // Previous node in the flush-list
+	flushNext NodeHash // Next node in the flush-list
 }
 
 // cachedNodeSize is the raw size of a cachedNode data structure without any
@@ -145,17 +147,17 @@ func (n *cachedNode) rlp() []byte {
 
 // obj returns the decoded and expanded trie node, either directly from the cache,
 // or by regenerating it from the rlp encoded blob.
-func (n *cachedNode) obj(hash common.Hash) Node {
+func (n *cachedNode) obj(hash NodeHash) (Node, error) {
 	if node, ok := n.node.(rawNode); ok {
-		return mustDecodeNode(hash[:], node)
+		return decodeStoredNode(hash, node)
 	}
-	return expandNode(hash[:], n.node)
+	return expandNode(hash.Bytes(), n.node), nil
 }
 
 // forChilds invokes the callback for all the tracked children of this node,
 // both the implicit ones from inside the node as well as the explicit ones
 // from outside the node.
-func (n *cachedNode) forChilds(onChild func(hash common.Hash)) {
+func (n *cachedNode) forChilds(onChild func(hash NodeHash)) {
 	for child := range n.children {
 		onChild(child)
 	}
@@ -166,7 +168,7 @@ func (n *cachedNode) forChilds(onChild func(hash common.Hash)) {
 
 // forGatherChildren traverses the node hierarchy of a collapsed storage node and
 // invokes the callback for all the hashnode children.
-func forGatherChildren(n Node, onChild func(hash common.Hash)) {
+func forGatherChildren(n Node, onChild func(hash NodeHash)) {
 	switch n := n.(type) {
 	case *rawShortNode:
 		forGatherChildren(n.Val, onChild)
@@ -174,8 +176,12 @@ func forGatherChildren(n Node, onChild func(hash common.Hash)) {
 		for i := 0; i < 16; i++ {
 			forGatherChildren(n[i], onChild)
 		}
+	case rawBinaryBranchNode:
+		for i := 0; i < 2; i++ {
+			forGatherChildren(n[i], onChild)
+		}
 	case HashNode:
-		onChild(common.Hash(n))
+		onChild(BytesToNodeHash(n))
 	case ValueNode, nil, rawNode:
 	default:
 		panic(fmt.Sprintf("unknown node type: %T", n))
@@ -200,6 +206,18 @@ func simplifyNode(n Node) Node {
 		}
 		return node
 
+	case *BinaryShortNode:
+		return &rawShortNode{Key: n.Key, Val: simplifyNode(n.Val)}
+
+	case *BinaryBranchNode:
+		node := rawBinaryBranchNode(n.Children)
+		for i := 0; i < len(node); i++ {
+			if node[i] != nil {
+				node[i] = simplifyNode(node[i])
+			}
+		}
+		return node
+
 	case ValueNode, HashNode, rawNode:
 		return n
 
@@ -213,6 +231,16 @@ func simplifyNode(n Node) Node {
 func expandNode(hash HashNode, n Node) Node {
 	switch n := n.(type) {
 	case *rawShortNode:
+		// Binary short nodes are told apart by their compact key flag
+		if isBinaryCompact(n.Key) {
+			return &BinaryShortNode{
+				Key: compactToBinary(n.Key),
+				Val: expandNode(nil, n.Val),
+				flags: NodeFlag{
+					hash: hash,
+				},
+			}
+		}
 		// Short nodes need key and child expansion
 		return &ShortNode{
 			Key: compactToHex(n.Key),
@@ -236,6 +264,19 @@ func expandNode(hash HashNode, n Node) Node {
 		}
 		return node
 
+	case rawBinaryBranchNode:
+		node := &BinaryBranchNode{
+			flags: NodeFlag{
+				hash: hash,
+			},
+		}
+		for i := 0; i < len(node.Children); i++ {
+			if n[i] != nil {
+				node.Children[i] = expandNode(nil, n[i])
+			}
+		}
+		return node
+
 	case ValueNode, HashNode:
 		return n
 
@@ -246,9 +287,13 @@ func expandNode(hash HashNode, n Node) Node {
 
 // Config defines all necessary options for database.
 type Config struct {
-	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
-	Journal   string // Journal of clean cache to survive node restarts
-	Preimages bool   // Flag whether the preimage of trie key is recorded
+	Cache          int           // Memory allowance (MB) to use for caching trie nodes in memory
+	Journal        string        // Journal of clean cache to survive node restarts
+	Preimages      bool          // Flag whether the preimage of trie key is recorded
+	Dirty          int           // Memory allowance (MB) of dirty nodes before a background flush, zero disables it
+	Resolver       NodeResolver  // Source of nodes missing locally, nil to report them as missing
+	ResolveTimeout time.Duration // Time allowed for a single resolver fetch, defaults to 10s
+	HashSize       int           // Node hash width, HashSize256 (default) or HashSize512 for Streebog-512
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -270,19 +315,87 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 			cleans = fastcache.LoadFromFileOrNew(config.Journal, config.Cache*1024*1024)
 		}
 	}
+	hashSize := HashSize256
+	if config != nil && config.HashSize != 0 {
+		if !validHashSize(config.HashSize) {
+			panic(fmt.Sprintf("unsupported trie hash size %d", config.HashSize))
+		}
+		hashSize = config.HashSize
+	}
 	db := &Database{
-		diskdb: diskdb,
-		cleans: cleans,
-		dirties: map[common.Hash]*cachedNode{{}: {
-			children: make(map[common.Hash]uint16),
+		diskdb:   diskdb,
+		hashSize: hashSize,
+		cleans:   cleans,
+		dirties: map[NodeHash]*cachedNode{{}: {
+			children: make(map[NodeHash]uint16),
 		}},
 	}
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	if config != nil && config.Resolver != nil {
+		db.resolver = config.Resolver
+		db.resolveTimeout = config.ResolveTimeout
+		if db.resolveTimeout == 0 {
+			db.resolveTimeout = defaultResolveTimeout
+		}
+		db.fetches = make(map[NodeHash]*nodeFetch)
+	}
+	if config != nil && config.Dirty > 0 {
+		db.dirtyLimit = common.StorageSize(config.Dirty * 1024 * 1024)
+		db.flushReq = make(chan struct{}, 1)
+		db.flushQuit = make(chan chan error)
+		go db.flushLoop(db.flushQuit)
+	}
 	return db
 }
 
+// flushLoop is the background flusher, capping the dirty cache whenever it
+// grows beyond the configured allowance. On shutdown all remaining dirty nodes
+// are written out.
+func (db *Database) flushLoop(quit chan chan error) {
+	for {
+		select {
+		case <-db.flushReq:
+			// Flush a bit below the limit to avoid a flush on every insertion
+			if err := db.Cap(db.dirtyLimit - db.dirtyLimit/10); err != nil {
+				log.Error("Failed to flush dirty trie nodes", "err", err)
+			}
+		case errc := <-quit:
+			errc <- db.Cap(0)
+			return
+		}
+	}
+}
+
+// requestFlush wakes the background flusher up if the dirty cache exceeds its
+// allowance. It never blocks, a pending request covers any later ones.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) requestFlush() {
+	if db.flushReq == nil || db.dirtySize() <= db.dirtyLimit {
+		return
+	}
+	select {
+	case db.flushReq <- struct{}{}:
+	default:
+	}
+}
+
+// dirtySize returns the memory used by the dirty cache, including the
+// maintenance metadata.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) dirtySize() common.StorageSize {
+	size := db.dirtiesSize + db.childrenSize + common.StorageSize((len(db.dirties)-1)*cachedNodeSize)
+	return size - common.StorageSize(len(db.dirties[NodeHash{}].children)*(db.hashSize+2))
+}
+
+// HashSize returns the width of the node hashes of the tries in the database.
+func (db *Database) HashSize() int {
+	return db.hashSize
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
@@ -292,7 +405,7 @@ func (db *Database) DiskDB() ethdb.KeyValueStore {
 // The blob size must be specified to allow proper size tracking.
 // All nodes inserted by this function will be reference tracked
 // and in theory should only used for **trie nodes** insertion.
-func (db *Database) insert(hash common.Hash, size int, node Node) {
+func (db *Database) insert(hash NodeHash, size int, node Node) {
 	// If the node's already cached, skip
 	if _, ok := db.dirties[hash]; ok {
 		return
@@ -304,7 +417,7 @@ func (db *Database) insert(hash common.Hash, size int, node Node) {
 		size:      uint16(size),
 		flushPrev: db.newest,
 	}
-	entry.forChilds(func(child common.Hash) {
+	entry.forChilds(func(child NodeHash) {
 		if c := db.dirties[child]; c != nil {
 			c.parents++
 		}
@@ -312,12 +425,12 @@ func (db *Database) insert(hash common.Hash, size int, node Node) {
 	db.dirties[hash] = entry
 
 	// Update the flush-list endpoints
-	if db.oldest == (common.Hash{}) {
+	if db.oldest == (NodeHash{}) {
 		db.oldest, db.newest = hash, hash
 	} else {
 		db.dirties[db.newest].flushNext, db.newest = hash, hash
 	}
-	db.dirtiesSize += common.StorageSize(32 + entry.size)
+	db.dirtiesSize += common.StorageSize(db.hashSize + int(entry.size))
 }
 
 // insertPreimage writes a new trie node pre-image to the memory database if it's
@@ -339,12 +452,13 @@ func (db *Database) insertPreimage(hash common.Hash, preimage []byte) {
 }
 
 // node retrieves a cached trie node from memory, or returns nil if none can be
-// found in the memory cache.
-func (db *Database) node(hash common.Hash) Node {
+// found in the memory cache. A node that fails to decode is reported as a
+// CorruptNodeError.
+func (db *Database) node(hash NodeHash) (Node, error) {
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
-		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
-			return mustDecodeNode(hash[:], enc)
+		if enc := db.cleans.Get(nil, hash.Bytes()); enc != nil {
+			return decodeStoredNode(hash, enc)
 		}
 	}
 	// Retrieve the node from the dirty cache if available
@@ -357,26 +471,31 @@ func (db *Database) node(hash common.Hash) Node {
 	}
 
 	// Content unavailable in memory, attempt to retrieve from disk
-	enc, err := db.diskdb.Get(hash[:])
+	enc, err := db.diskdb.Get(hash.Bytes())
 	if err != nil || enc == nil {
-		return nil
+		return nil, nil
+	}
+	n, err := decodeStoredNode(hash, enc)
+	if err != nil {
+		return nil, err
 	}
+	// Only cache nodes that decode, a corrupt blob is reloaded on each access
 	if db.cleans != nil {
-		db.cleans.Set(hash[:], enc)
+		db.cleans.Set(hash.Bytes(), enc)
 	}
-	return mustDecodeNode(hash[:], enc)
+	return n, nil
 }
 
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
-func (db *Database) Node(hash common.Hash) ([]byte, error) {
+func (db *Database) Node(hash NodeHash) ([]byte, error) {
 	// It doesn't make sense to retrieve the metaroot
-	if hash == (common.Hash{}) {
+	if hash == (NodeHash{}) {
 		return nil, errors.New("not found")
 	}
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
-		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+		if enc := db.cleans.Get(nil, hash.Bytes()); enc != nil {
 			return enc, nil
 		}
 	}
@@ -390,10 +509,10 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	}
 
 	// Content unavailable in memory, attempt to retrieve from disk
-	enc := rawdb.ReadTrieNode(db.diskdb, hash)
+	enc := rawdb.ReadTrieNode(db.diskdb, hash.Bytes())
 	if len(enc) != 0 {
 		if db.cleans != nil {
-			db.cleans.Set(hash[:], enc)
+			db.cleans.Set(hash.Bytes(), enc)
 		}
 		return enc, nil
 	}
@@ -421,13 +540,13 @@ func (db *Database) preimage(hash common.Hash) []byte {
 // Nodes retrieves the hashes of all the nodes cached within the memory database.
 // This method is extremely expensive and should only be used to validate internal
 // states in test code.
-func (db *Database) Nodes() []common.Hash {
+func (db *Database) Nodes() []NodeHash {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
-	var hashes = make([]common.Hash, 0, len(db.dirties))
+	var hashes = make([]NodeHash, 0, len(db.dirties))
 	for hash := range db.dirties {
-		if hash != (common.Hash{}) { // Special case for "root" references/nodes
+		if hash != (NodeHash{}) { // Special case for "root" references/nodes
 			hashes = append(hashes, hash)
 		}
 	}
@@ -438,7 +557,7 @@ func (db *Database) Nodes() []common.Hash {
 // This function is used to add reference between internal trie node
 // and external node(e.g. storage trie root), all internal trie nodes
 // are referenced together by database itself.
-func (db *Database) Reference(child common.Hash, parent common.Hash) {
+func (db *Database) Reference(child NodeHash, parent NodeHash) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -446,7 +565,7 @@ func (db *Database) Reference(child common.Hash, parent common.Hash) {
 }
 
 // reference is the private locked version of Reference.
-func (db *Database) reference(child common.Hash, parent common.Hash) {
+func (db *Database) reference(child NodeHash, parent NodeHash) {
 	// If the node does not exist, it's a node pulled from disk, skip
 	node, ok := db.dirties[child]
 	if !ok {
@@ -454,22 +573,22 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 	}
 	// If the reference already exists, only duplicate for roots
 	if db.dirties[parent].children == nil {
-		db.dirties[parent].children = make(map[common.Hash]uint16)
+		db.dirties[parent].children = make(map[NodeHash]uint16)
 		db.childrenSize += cachedNodeChildrenSize
-	} else if _, ok = db.dirties[parent].children[child]; ok && parent != (common.Hash{}) {
+	} else if _, ok = db.dirties[parent].children[child]; ok && parent != (NodeHash{}) {
 		return
 	}
 	node.parents++
 	db.dirties[parent].children[child]++
 	if db.dirties[parent].children[child] == 1 {
-		db.childrenSize += common.HashLength + 2 // uint16 counter
+		db.childrenSize += common.StorageSize(db.hashSize + 2) // uint16 counter
 	}
 }
 
 // Dereference removes an existing reference from a root node.
-func (db *Database) Dereference(root common.Hash) {
+func (db *Database) Dereference(root NodeHash) {
 	// Sanity check to ensure that the meta-root is not removed
-	if root == (common.Hash{}) {
+	if root == (NodeHash{}) {
 		log.Error("Attempted to dereference the trie cache meta root")
 		return
 	}
@@ -477,7 +596,7 @@ func (db *Database) Dereference(root common.Hash) {
 	defer db.lock.Unlock()
 
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
-	db.dereference(root, common.Hash{})
+	db.dereference(root, NodeHash{})
 
 	db.gcnodes += uint64(nodes - len(db.dirties))
 	db.gcsize += storage - db.dirtiesSize
@@ -488,7 +607,7 @@ func (db *Database) Dereference(root common.Hash) {
 }
 
 // dereference is the private locked version of Dereference.
-func (db *Database) dereference(child common.Hash, parent common.Hash) {
+func (db *Database) dereference(child NodeHash, parent NodeHash) {
 	// Dereference the parent-child
 	node := db.dirties[parent]
 
@@ -496,7 +615,7 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 		node.children[child]--
 		if node.children[child] == 0 {
 			delete(node.children, child)
-			db.childrenSize -= (common.HashLength + 2) // uint16 counter
+			db.childrenSize -= common.StorageSize(db.hashSize + 2) // uint16 counter
 		}
 	}
 	// If the child does not exist, it's a previously committed node.
@@ -517,20 +636,20 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 		switch child {
 		case db.oldest:
 			db.oldest = node.flushNext
-			db.dirties[node.flushNext].flushPrev = common.Hash{}
+			db.dirties[node.flushNext].flushPrev = NodeHash{}
 		case db.newest:
 			db.newest = node.flushPrev
-			db.dirties[node.flushPrev].flushNext = common.Hash{}
+			db.dirties[node.flushPrev].flushNext = NodeHash{}
 		default:
 			db.dirties[node.flushPrev].flushNext = node.flushNext
 			db.dirties[node.flushNext].flushPrev = node.flushPrev
 		}
 		// Dereference all children and delete the node
-		node.forChilds(func(hash common.Hash) {
+		node.forChilds(func(hash NodeHash) {
 			db.dereference(hash, child)
 		})
 		delete(db.dirties, child)
-		db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
+		db.dirtiesSize -= common.StorageSize(db.hashSize + int(node.size))
 		if node.children != nil {
 			db.childrenSize -= cachedNodeChildrenSize
 		}
@@ -539,47 +658,54 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 
 // Cap iteratively flushes old but still referenced trie nodes until the total
 // memory usage goes below the given threshold.
-//
-// Note, this method is a non-synchronized mutator. It is unsafe to call this
-// concurrently with other mutators.
 func (db *Database) Cap(limit common.StorageSize) error {
+	db.flushLock.Lock()
+	defer db.flushLock.Unlock()
+
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
 	// by only uncaching existing data when the database write finalizes.
-	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
+	start := time.Now()
 	batch := db.diskdb.NewBatch()
 
+	db.lock.RLock()
+	nodes, storage := len(db.dirties), db.dirtiesSize
+
 	// db.dirtiesSize only contains the useful data in the cache, but when reporting
 	// the total memory consumption, the maintenance metadata is also needed to be
 	// counted.
-	size := db.dirtiesSize + common.StorageSize((len(db.dirties)-1)*cachedNodeSize)
-	size += db.childrenSize - common.StorageSize(len(db.dirties[common.Hash{}].children)*(common.HashLength+2))
+	size := db.dirtySize()
 
 	// If the preimage cache got large enough, push to disk. If it's still small
 	// leave for later to deduplicate writes.
-	flushPreimages := db.preimagesSize > 4*1024*1024
-	if flushPreimages {
+	var preimages []common.Hash
+	if db.preimagesSize > 4*1024*1024 {
 		if db.preimages == nil {
 			log.Error("Attempted to write preimages whilst disabled")
 		} else {
-			rawdb.WritePreimages(batch, db.preimages)
-			if batch.ValueSize() > ethdb.IdealBatchSize {
-				if err := batch.Write(); err != nil {
-					return err
-				}
-				batch.Reset()
-			}
+			preimages = db.writePreimages(batch)
 		}
 	}
-	// Keep committing nodes from the flush-list until we're below allowance
-	oldest := db.oldest
-	for size > limit && oldest != (common.Hash{}) {
-		// Fetch the oldest referenced node and push into the batch
+	// Pick nodes from the flush-list until we're below allowance. Size is the total
+	// size, including the useful cached data (hash -> blob), the cache item metadata,
+	// as well as external children mappings.
+	var flush []dirtyNode
+	for oldest := db.oldest; size > limit && oldest != (NodeHash{}); {
 		node := db.dirties[oldest]
-		rawdb.WriteTrieNode(batch, oldest, node.rlp())
+		flush = append(flush, dirtyNode{oldest, node.rlp()})
+
+		size -= common.StorageSize(db.hashSize + int(node.size) + cachedNodeSize)
+		if node.children != nil {
+			size -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(db.hashSize+2))
+		}
+		oldest = node.flushNext
+	}
+	db.lock.RUnlock()
 
-		// If we exceeded the ideal batch size, commit and reset
+	// Write the picked nodes out without holding the lock, committing the batch
+	// whenever it exceeds the ideal size
+	for _, n := range flush {
 		if batch.ValueSize() >= ethdb.IdealBatchSize {
 			if err := batch.Write(); err != nil {
 				log.Error("Failed to write flush list to disk", "err", err)
@@ -587,43 +713,21 @@ func (db *Database) Cap(limit common.StorageSize) error {
 			}
 			batch.Reset()
 		}
-		// Iterate to the next flush item, or abort if the size cap was achieved. Size
-		// is the total size, including the useful cached data (hash -> blob), the
-		// cache item metadata, as well as external children mappings.
-		size -= common.StorageSize(common.HashLength + int(node.size) + cachedNodeSize)
-		if node.children != nil {
-			size -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
-		}
-		oldest = node.flushNext
+		rawdb.WriteTrieNode(batch, n.hash.Bytes(), n.blob)
 	}
 	// Flush out any remainder data from the last batch
 	if err := batch.Write(); err != nil {
 		log.Error("Failed to write flush list to disk", "err", err)
 		return err
 	}
-	// Write successful, clear out the flushed data
+	// Write successful, clear out the flushed data. Nodes garbage collected in the
+	// meantime are already gone.
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
-	if flushPreimages {
-		if db.preimages == nil {
-			log.Error("Attempted to reset preimage cache whilst disabled")
-		} else {
-			db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
-		}
-	}
-	for db.oldest != oldest {
-		node := db.dirties[db.oldest]
-		delete(db.dirties, db.oldest)
-		db.oldest = node.flushNext
-
-		db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
-		if node.children != nil {
-			db.childrenSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
-		}
-	}
-	if db.oldest != (common.Hash{}) {
-		db.dirties[db.oldest].flushPrev = common.Hash{}
+	db.dropPreimages(preimages)
+	for _, n := range flush {
+		db.uncache(n.hash)
 	}
 	db.flushnodes += uint64(nodes - len(db.dirties))
 	db.flushsize += storage - db.dirtiesSize
@@ -639,9 +743,12 @@ func (db *Database) Cap(limit common.StorageSize) error {
 // to disk, forcefully tearing down all references in both directions. As a side
 // effect, all pre-images accumulated up to this point are also written.
 //
-// Note, this method is a non-synchronized mutator. It is unsafe to call this
-// concurrently with other mutators.
-func (db *Database) Commit(node common.Hash, report bool, callback func(common.Hash)) error {
+// The nodes are written out without holding the database lock, so node access
+// continues during the commit and callback may read from the database.
+func (db *Database) Commit(node NodeHash, report bool, callback func(NodeHash)) error {
+	db.flushLock.Lock()
+	defer db.flushLock.Unlock()
+
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -649,29 +756,39 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	start := time.Now()
 	batch := db.diskdb.NewBatch()
 
-	// Move all of the accumulated preimages into a write batch
+	db.lock.RLock()
+	var preimages []common.Hash
 	if db.preimages != nil {
-		rawdb.WritePreimages(batch, db.preimages)
-		if batch.ValueSize() > ethdb.IdealBatchSize {
+		preimages = db.writePreimages(batch)
+	}
+	nodes, storage := len(db.dirties), db.dirtiesSize
+	flush := db.gather(node, make(map[NodeHash]struct{}), nil)
+	db.lock.RUnlock()
+
+	// Since we're going to replay trie node writes into the clean cache, flush out
+	// any batched pre-images before continuing.
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	// Move the trie itself into the batch, flushing if enough data is accumulated
+	uncacher := &cleaner{db}
+	for _, n := range flush {
+		rawdb.WriteTrieNode(batch, n.hash.Bytes(), n.blob)
+		if callback != nil {
+			callback(n.hash)
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
 			if err := batch.Write(); err != nil {
+				log.Error("Failed to commit trie from trie database", "err", err)
 				return err
 			}
+			db.lock.Lock()
+			batch.Replay(uncacher)
+			db.lock.Unlock()
 			batch.Reset()
 		}
-		// Since we're going to replay trie node writes into the clean cache, flush out
-		// any batched pre-images before continuing.
-		if err := batch.Write(); err != nil {
-			return err
-		}
-		batch.Reset()
-	}
-	// Move the trie itself into the batch, flushing if enough data is accumulated
-	nodes, storage := len(db.dirties), db.dirtiesSize
-
-	uncacher := &cleaner{db}
-	if err := db.commit(node, batch, uncacher, callback); err != nil {
-		log.Error("Failed to commit trie from trie database", "err", err)
-		return err
 	}
 	// Trie mostly committed to disk, flush any batch leftovers
 	if err := batch.Write(); err != nil {
@@ -686,9 +803,7 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	batch.Reset()
 
 	// Reset the storage counters and bumpd metrics
-	if db.preimages != nil {
-		db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
-	}
+	db.dropPreimages(preimages)
 
 	logger := log.Info
 	if !report {
@@ -704,37 +819,148 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 	return nil
 }
 
-// commit is the private locked version of Commit.
-func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner, callback func(common.Hash)) error {
+// dirtyNode is a dirty trie node picked for flushing, along with its encoding.
+type dirtyNode struct {
+	hash NodeHash
+	blob []byte
+}
+
+// gather appends a dirty node and all its dirty children to nodes, children
+// first.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) gather(hash NodeHash, seen map[NodeHash]struct{}, nodes []dirtyNode) []dirtyNode {
 	// If the node does not exist, it's a previously committed node
 	node, ok := db.dirties[hash]
 	if !ok {
-		return nil
+		return nodes
 	}
-	var err error
-	node.forChilds(func(child common.Hash) {
-		if err == nil {
-			err = db.commit(child, batch, uncacher, callback)
-		}
+	if _, ok := seen[hash]; ok {
+		return nodes
+	}
+	seen[hash] = struct{}{}
+
+	node.forChilds(func(child NodeHash) {
+		nodes = db.gather(child, seen, nodes)
 	})
-	if err != nil {
-		return err
+	return append(nodes, dirtyNode{hash, node.rlp()})
+}
+
+// uncache removes a flushed node from the dirty cache and the flush-list. It is
+// a no-op if the node was garbage collected in the meantime.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) uncache(hash NodeHash) {
+	node, ok := db.dirties[hash]
+	if !ok {
+		return
 	}
-	// If we've reached an optimal batch size, commit and start over
-	rawdb.WriteTrieNode(batch, hash, node.rlp())
-	if callback != nil {
-		callback(hash)
+	switch hash {
+	case db.oldest:
+		db.oldest = node.flushNext
+		db.dirties[node.flushNext].flushPrev = NodeHash{}
+	case db.newest:
+		db.newest = node.flushPrev
+		db.dirties[node.flushPrev].flushNext = NodeHash{}
+	default:
+		db.dirties[node.flushPrev].flushNext = node.flushNext
+		db.dirties[node.flushNext].flushPrev = node.flushPrev
 	}
-	if batch.ValueSize() >= ethdb.IdealBatchSize {
-		if err := batch.Write(); err != nil {
-			return err
+	delete(db.dirties, hash)
+
+	db.dirtiesSize -= common.StorageSize(db.hashSize + int(node.size))
+	if node.children != nil {
+		db.childrenSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(db.hashSize+2))
+	}
+}
+
+// writePreimages writes all cached preimages into the batch and returns their
+// hashes, to be dropped once the batch is persisted.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) writePreimages(batch ethdb.Batch) []common.Hash {
+	rawdb.WritePreimages(batch, db.preimages)
+	hashes := make([]common.Hash, 0, len(db.preimages))
+	for hash := range db.preimages {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// dropPreimages removes persisted preimages from the cache. Preimages added
+// since they were written out are kept.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) dropPreimages(hashes []common.Hash) {
+	for _, hash := range hashes {
+		if preimage, ok := db.preimages[hash]; ok {
+			delete(db.preimages, hash)
+			db.preimagesSize -= common.StorageSize(common.HashLength + len(preimage))
 		}
-		db.lock.Lock()
-		batch.Replay(uncacher)
-		batch.Reset()
-		db.lock.Unlock()
 	}
-	return nil
+}
+
+// BatchCommit is a trie commit staged into a caller supplied batch. The trie
+// nodes stay in the dirty cache until Finalize is called, so the commit has no
+// effect on the database until the batch is written.
+type BatchCommit struct {
+	db        *Database
+	nodes     []NodeHash    // Trie nodes written into the batch, children first
+	preimages []common.Hash // Preimages written into the batch
+}
+
+// CommitBatch writes the trie rooted at node, together with all pre-images
+// accumulated up to this point, into the given batch. Unlike Commit, the batch
+// is never flushed, so the caller can add its own data and persist everything
+// with a single atomic Write.
+//
+// The nodes are written into the batch without holding the database lock, so
+// callback may read from the database.
+//
+// Once the batch is written, Finalize must be called on the returned commit to
+// move the persisted nodes out of the dirty cache. If the write fails, the
+// commit can simply be dropped and the database is left unchanged.
+func (db *Database) CommitBatch(node NodeHash, batch ethdb.Batch, callback func(NodeHash)) (*BatchCommit, error) {
+	db.flushLock.Lock()
+	defer db.flushLock.Unlock()
+
+	commit := &BatchCommit{db: db}
+
+	db.lock.RLock()
+	if db.preimages != nil {
+		commit.preimages = db.writePreimages(batch)
+	}
+	flush := db.gather(node, make(map[NodeHash]struct{}), nil)
+	db.lock.RUnlock()
+
+	commit.nodes = make([]NodeHash, 0, len(flush))
+	for _, n := range flush {
+		rawdb.WriteTrieNode(batch, n.hash.Bytes(), n.blob)
+		commit.nodes = append(commit.nodes, n.hash)
+		if callback != nil {
+			callback(n.hash)
+		}
+	}
+	return commit, nil
+}
+
+// Finalize uncaches the nodes and pre-images of a batch commit after the batch
+// was successfully written, moving the nodes into the clean cache. Nodes that
+// were already flushed or garbage collected in the meantime are skipped.
+func (c *BatchCommit) Finalize() {
+	db := c.db
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	uncacher := &cleaner{db}
+	for _, hash := range c.nodes {
+		if node, ok := db.dirties[hash]; ok {
+			uncacher.Put(hash.Bytes(), node.rlp())
+		}
+	}
+	db.dropPreimages(c.preimages)
+	c.nodes, c.preimages = nil, nil
 }
 
 // cleaner is a database batch replayer that takes a batch of write operations
@@ -749,7 +975,11 @@ type cleaner struct {
 // the two-phase commit is to ensure ensure data availability while moving from
 // memory to disk.
 func (c *cleaner) Put(key []byte, rlp []byte) error {
-	hash := common.BytesToHash(key)
+	// Preimages share the batch, skip anything not keyed by a node hash
+	if len(key) != c.db.hashSize {
+		return nil
+	}
+	hash := BytesToNodeHash(key)
 
 	// If the node does not exist, we're done on this path
 	node, ok := c.db.dirties[hash]
@@ -760,23 +990,23 @@ func (c *cleaner) Put(key []byte, rlp []byte) error {
 	switch hash {
 	case c.db.oldest:
 		c.db.oldest = node.flushNext
-		c.db.dirties[node.flushNext].flushPrev = common.Hash{}
+		c.db.dirties[node.flushNext].flushPrev = NodeHash{}
 	case c.db.newest:
 		c.db.newest = node.flushPrev
-		c.db.dirties[node.flushPrev].flushNext = common.Hash{}
+		c.db.dirties[node.flushPrev].flushNext = NodeHash{}
 	default:
 		c.db.dirties[node.flushPrev].flushNext = node.flushNext
 		c.db.dirties[node.flushNext].flushPrev = node.flushPrev
 	}
 	// Remove the node from the dirty cache
 	delete(c.db.dirties, hash)
-	c.db.dirtiesSize -= common.StorageSize(common.HashLength + int(node.size))
+	c.db.dirtiesSize -= common.StorageSize(c.db.hashSize + int(node.size))
 	if node.children != nil {
-		c.db.dirtiesSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(common.HashLength+2))
+		c.db.dirtiesSize -= common.StorageSize(cachedNodeChildrenSize + len(node.children)*(c.db.hashSize+2))
 	}
 	// Move the flushed node into the clean cache to prevent insta-reloads
 	if c.db.cleans != nil {
-		c.db.cleans.Set(hash[:], rlp)
+		c.db.cleans.Set(hash.Bytes(), rlp)
 	}
 	return nil
 }
@@ -794,9 +1024,34 @@ func (db *Database) Size() (common.StorageSize, common.StorageSize) {
 	// db.dirtiesSize only contains the useful data in the cache, but when reporting
 	// the total memory consumption, the maintenance metadata is also needed to be
 	// counted.
-	var metadataSize = common.StorageSize((len(db.dirties) - 1) * cachedNodeSize)
-	var metarootRefs = common.StorageSize(len(db.dirties[common.Hash{}].children) * (common.HashLength + 2))
-	return db.dirtiesSize + db.childrenSize + metadataSize - metarootRefs, db.preimagesSize
+	return db.dirtySize(), db.preimagesSize
+}
+
+// Close stops the background flusher, writing out all remaining dirty nodes,
+// and closes the archive if archive mode is enabled. Without a background
+// flusher dirty nodes are not flushed.
+func (db *Database) Close() error {
+	db.lock.Lock()
+	quit := db.flushQuit
+	db.flushQuit = nil
+	db.lock.Unlock()
+
+	var err error
+	if quit != nil {
+		errc := make(chan error)
+		quit <- errc
+		err = <-errc
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.archive != nil {
+		if cerr := db.archive.freezer.Close(); err == nil {
+			err = cerr
+		}
+		db.archive = nil
+	}
+	return err
 }
 
 // saveCache saves clean state cache to given directory path
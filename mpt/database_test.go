@@ -0,0 +1,288 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pavelkrolevets/mpt/ethdb"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+// failingBatch is a batch whose Write always fails, simulating a crash before
+// the data reached the disk.
+type failingBatch struct {
+	ethdb.Batch
+}
+
+func (b failingBatch) Write() error { return errors.New("write failed") }
+
+func TestCommitBatch(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 10000; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+	dirties := len(db.Nodes())
+
+	// A failed write must leave both the disk and the dirty cache untouched.
+	batch := failingBatch{diskdb.NewBatch()}
+	if _, err := db.CommitBatch(root, batch, nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	batch.Put([]byte("LatestRoot"), root.Bytes())
+	if err := batch.Write(); err == nil {
+		t.Fatal("expected write failure")
+	}
+	if n := len(db.Nodes()); n != dirties {
+		t.Fatalf("dirty nodes changed by failed commit: have %d, want %d", n, dirties)
+	}
+	if diskdb.Len() != 0 {
+		t.Fatalf("disk written by failed commit: %d entries", diskdb.Len())
+	}
+	// A successful write persists the trie and the metadata together, however
+	// large the batch gets.
+	var (
+		committed int
+		batch2    = diskdb.NewBatch()
+	)
+	commit, err := db.CommitBatch(root, batch2, func(NodeHash) { committed++ })
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	batch2.Put([]byte("LatestRoot"), root.Bytes())
+	if batch2.ValueSize() < ethdb.IdealBatchSize {
+		t.Fatalf("batch too small to exercise flushing: %d", batch2.ValueSize())
+	}
+	if diskdb.Len() != 0 {
+		t.Fatal("batch flushed before the caller's write")
+	}
+	if err := batch2.Write(); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	commit.Finalize()
+	if n := len(db.Nodes()); n != 0 || committed != dirties {
+		t.Fatalf("dirty nodes left after finalize: %d, committed %d of %d", n, committed, dirties)
+	}
+	if blob, _ := diskdb.Get([]byte("LatestRoot")); BytesToNodeHash(blob) != root {
+		t.Fatalf("metadata mismatch: %x", blob)
+	}
+	trie, err = New(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	for i := 0; i < 10000; i++ {
+		key, want := fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i)
+		if have, err := trie.TryGet([]byte(key)); err != nil || string(have) != want {
+			t.Fatalf("get %q: have %q (%v), want %q", key, have, err, want)
+		}
+	}
+}
+
+func TestConcurrentMutators(t *testing.T) {
+	var (
+		diskdb = memorydb.New()
+		db     = NewDatabase(diskdb)
+		roots  = make(chan NodeHash, 400)
+		wg     sync.WaitGroup
+	)
+	// Several writers committing and releasing tries while others flush.
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				trie, _ := New(NodeHash{}, db)
+				for i := 0; i < 20; i++ {
+					trie.Put([]byte(fmt.Sprintf("key-%d-%d-%d", w, n, i)), []byte("value"))
+				}
+				root, err := trie.Commit(nil)
+				if err != nil {
+					t.Errorf("commit error: %v", err)
+					return
+				}
+				db.Reference(root, NodeHash{})
+				if n%2 == 0 {
+					db.Dereference(root)
+				} else {
+					roots <- root
+				}
+			}
+		}(w)
+	}
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := db.Cap(4 * 1024); err != nil {
+					t.Errorf("cap error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(roots)
+
+	for root := range roots {
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("commit error: %v", err)
+		}
+		if _, err := New(root, NewDatabase(diskdb)); err != nil {
+			t.Fatalf("root %x not persisted: %v", root, err)
+		}
+	}
+}
+
+// blockingDB is a disk database whose batch writes wait for a release, to
+// observe the trie database while a flush is in progress.
+type blockingDB struct {
+	ethdb.KeyValueStore
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (db *blockingDB) NewBatch() ethdb.Batch {
+	return blockingBatch{db.KeyValueStore.NewBatch(), db}
+}
+
+type blockingBatch struct {
+	ethdb.Batch
+	db *blockingDB
+}
+
+func (b blockingBatch) Write() error {
+	b.db.writing <- struct{}{}
+	<-b.db.release
+	return b.Batch.Write()
+}
+
+func TestReadsDuringFlush(t *testing.T) {
+	diskdb := &blockingDB{memorydb.New(), make(chan struct{}), make(chan struct{})}
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 100; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+
+	// The commit callback reads from the database while holding up the flush.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- db.Commit(root, false, func(hash NodeHash) {
+			if _, err := db.Node(hash); err != nil {
+				t.Errorf("callback can't read node %x: %v", hash, err)
+			}
+		})
+	}()
+	for writes := 0; ; writes++ {
+		select {
+		case <-diskdb.writing:
+		case err := <-errc:
+			if err != nil {
+				t.Fatalf("commit error: %v", err)
+			}
+			if writes == 0 {
+				t.Fatal("commit finished without writing")
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("commit blocked")
+		}
+		// Reads must not wait for the blocked batch write.
+		read := make(chan error, 1)
+		go func() {
+			_, err := db.Node(root)
+			read <- err
+		}()
+		select {
+		case err := <-read:
+			if err != nil {
+				t.Fatalf("read during flush: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("read blocked by flush")
+		}
+		diskdb.release <- struct{}{}
+	}
+}
+
+func TestCommitBatchCallbackReads(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 100; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+
+	// The callback reads from the database while a writer is waiting for the
+	// lock, which deadlocks if the lock is held across the callback.
+	errc := make(chan error, 1)
+	go func() {
+		var once sync.Once
+		_, err := db.CommitBatch(root, memorydb.New().NewBatch(), func(hash NodeHash) {
+			once.Do(func() {
+				go db.Reference(root, NodeHash{})
+				time.Sleep(10 * time.Millisecond)
+			})
+			if _, err := db.Node(hash); err != nil {
+				t.Errorf("callback can't read node %x: %v", hash, err)
+			}
+		})
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("commit error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("commit callback blocked")
+	}
+}
+
+func TestBackgroundFlusher(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Dirty: 1})
+
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 20000; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	db.Reference(root, NodeHash{})
+
+	// The flusher runs asynchronously, wait for it to cap the dirty cache.
+	for i := 0; ; i++ {
+		if size, _ := db.Size(); size <= 1024*1024 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("dirty cache not flushed in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+	if size, _ := db.Size(); size != 0 {
+		t.Errorf("dirty nodes left after close: %v", size)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second close error: %v", err)
+	}
+	trie, err = New(root, NewDatabase(diskdb))
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	if have := trie.Get([]byte("key-12345")); string(have) != "val-12345" {
+		t.Errorf("get: have %q", have)
+	}
+}
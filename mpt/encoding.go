@@ -1,19 +1,32 @@
 package mpt
 
+import (
+	"errors"
+	"fmt"
+)
+
 func hexToCompact(hex []byte) []byte {
+	return appendHexToCompact(make([]byte, 0, len(hex)/2+1), hex)
+}
+
+// appendHexToCompact appends the compact form of hex to buf, without
+// allocating if buf has room for it.
+func appendHexToCompact(buf, hex []byte) []byte {
 	terminator := byte(0)
 	if hasTerm(hex) {
 		terminator = 1
 		hex = hex[:len(hex)-1]
 	}
-	buf := make([]byte, len(hex)/2+1)
-	buf[0] = terminator << 5 // the flag byte
+	flag := terminator << 5 // the flag byte
 	if len(hex)&1 == 1 {
-		buf[0] |= 1 << 4 // odd flag
-		buf[0] |= hex[0] // first nibble is contained in the first byte
+		flag |= 1 << 4 // odd flag
+		flag |= hex[0] // first nibble is contained in the first byte
 		hex = hex[1:]
 	}
-	decodeNibbles(hex, buf[1:])
+	buf = append(buf, flag)
+	for ni := 0; ni < len(hex); ni += 2 {
+		buf = append(buf, hex[ni]<<4|hex[ni+1])
+	}
 	return buf
 }
 
@@ -109,3 +122,97 @@ func prefixLen(a, b []byte) int {
 func hasTerm(s []byte) bool {
 	return len(s) > 0 && s[len(s)-1] == 16
 }
+
+// binaryFlag marks the compact encoding of a binary trie key. Hex compact keys
+// only ever use the flag values 0x0-0x3 in the high nibble of the first byte,
+// so both key kinds can be told apart when decoding stored nodes.
+const binaryFlag = 0x40
+
+// keybytesToBinary expands a key into one byte per bit, most significant bit
+// first, followed by the terminator.
+func keybytesToBinary(str []byte) []byte {
+	l := len(str)*8 + 1
+	var bits = make([]byte, l)
+	for i, b := range str {
+		for j := 0; j < 8; j++ {
+			bits[i*8+j] = (b >> (7 - uint(j))) & 1
+		}
+	}
+	bits[l-1] = 16
+	return bits
+}
+
+// binaryToCompact packs a bit key into its compact form. The flag byte holds
+// the binary marker, the terminator flag and the number of padding bits in the
+// last byte.
+func binaryToCompact(bits []byte) []byte {
+	return appendBinaryToCompact(make([]byte, 0, 1+(len(bits)+7)/8), bits)
+}
+
+// appendBinaryToCompact appends the compact form of bits to buf, without
+// allocating if buf has room for it.
+func appendBinaryToCompact(buf, bits []byte) []byte {
+	terminator := byte(0)
+	if hasTerm(bits) {
+		terminator = 1
+		bits = bits[:len(bits)-1]
+	}
+	buf = append(buf, binaryFlag|terminator<<3|byte((8-len(bits)%8)%8))
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := i; j < i+8 && j < len(bits); j++ {
+			b |= bits[j] << (7 - uint(j-i))
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+func compactToBinary(compact []byte) []byte {
+	if len(compact) == 0 {
+		return compact
+	}
+	l := (len(compact)-1)*8 - int(compact[0]&7)
+	if l < 0 {
+		l = 0
+	}
+	bits := make([]byte, l, l+1)
+	for i := range bits {
+		bits[i] = (compact[1+i/8] >> (7 - uint(i%8))) & 1
+	}
+	if compact[0]&(1<<3) != 0 {
+		bits = append(bits, 16)
+	}
+	return bits
+}
+
+// isBinaryCompact reports whether a compact key belongs to a binary trie.
+func isBinaryCompact(compact []byte) bool {
+	return len(compact) > 0 && compact[0]&0xf0 == binaryFlag
+}
+
+// checkCompact validates the flag byte of a compact encoded short node key,
+// hex or binary, as produced by hexToCompact and binaryToCompact.
+func checkCompact(compact []byte) error {
+	if len(compact) == 0 {
+		return errors.New("empty compact key")
+	}
+	flag := compact[0]
+	if isBinaryCompact(compact) {
+		pad := int(flag & 7)
+		if len(compact) == 1 && pad != 0 {
+			return fmt.Errorf("binary compact key padded without key bytes (flag %#x)", flag)
+		}
+		if pad > 0 && compact[len(compact)-1]&(1<<uint(pad)-1) != 0 {
+			return fmt.Errorf("binary compact key with non-zero padding (flag %#x)", flag)
+		}
+		return nil
+	}
+	if flag>>4 > 3 {
+		return fmt.Errorf("invalid compact key flag %#x", flag)
+	}
+	if flag&(1<<4) == 0 && flag&0x0f != 0 {
+		return fmt.Errorf("even compact key with non-zero padding nibble (flag %#x)", flag)
+	}
+	return nil
+}
@@ -1,37 +1,102 @@
 package mpt
 
 import (
-	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/pavelkrolevets/mpt/gost3411"
-	"github.com/pavelkrolevets/mpt/rlp"
 )
 
+type sliceBuffer []byte
 
+func (b *sliceBuffer) Write(data []byte) (n int, err error) {
+	*b = append(*b, data...)
+	return len(data), nil
+}
+
+func (b *sliceBuffer) Reset() {
+	*b = (*b)[:0]
+}
+
+// hasher is a type used for the trie Hash operation. A hasher has some
+// internal preallocated temp space, and a reusable Streebog state of the
+// trie's hash width.
+type hasher struct {
+	sha  *gost3411.Hash
+	size int         // Hash width, also the size below which nodes are embedded
+	tmp  sliceBuffer // Encoding of the last collapsed node
+	key  sliceBuffer // Compact key of the last short node
+}
+
+// hashers live in global sync.Pools, one per hash width
+var hasherPools = map[int]*sync.Pool{
+	HashSize256: newHasherPool(HashSize256),
+	HashSize512: newHasherPool(HashSize512),
+}
+
+func newHasherPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return &hasher{
+				tmp:  make(sliceBuffer, 0, 17*(size+1)+3), // cap is as large as a full fullNode.
+				key:  make(sliceBuffer, 0, 64),
+				sha:  gost3411.New(size),
+				size: size,
+			}
+		},
+	}
+}
+
+func newHasher(size int) *hasher {
+	return hasherPools[size].Get().(*hasher)
+}
+
+func returnHasherToPool(h *hasher) {
+	hasherPools[h.size].Put(h)
+}
+
+// Hash collapses a node down into a 256-bit hash node, also returning a copy of
+// the original node initialized with the computed hash to replace the original
+// one. A node too small to be hashed is returned collapsed, with compact keys
+// and hashed children. Tries hash with the width of their database instead.
 func Hash(n Node, force bool) (hashed Node, cached Node) {
-	// Trie not processed yet, walk the children
+	h := newHasher(HashSize256)
+	defer returnHasherToPool(h)
+
+	hashed, cached = h.hash(n, force)
+	if raw, ok := hashed.(rawNode); ok {
+		// The hasher keeps embedded nodes as their encoding, which must not
+		// leak out as a Node.
+		dec, err := decodeNode(HashSize256, nil, raw)
+		if err != nil {
+			panic(fmt.Sprintf("can't decode embedded node: %v", err))
+		}
+		hashed = collapseNode(dec)
+	}
+	return hashed, cached
+}
+
+func (h *hasher) hash(n Node, force bool) (hashed Node, cached Node) {
+	// Trie not processed yet, walk the children. We need to retain the
+	// possibly _not_ hashed node, in case it was too small to be hashed.
 	switch n := n.(type) {
 	case *ShortNode:
-		collapsed, cached := hashShortNodeChildren(n)
-		hashed := shortnodeToHash(collapsed, force)
-		// We need to retain the possibly _not_ hashed node, in case it was too
-		// small to be hashed
-		if hn, ok := hashed.(HashNode); ok {
-			cached.flags.hash = hn
-		} else {
-			cached.flags.hash = nil
-		}
+		hashed, cached := h.hashShortNode(n, force)
+		cached.flags.hash, _ = hashed.(HashNode)
 		return hashed, cached
 	case *BranchNode:
-		collapsed, cached := hashBranchNodeChildren(n)
-		hashed = branchNodeToHash(collapsed, force)
-		if hn, ok := hashed.(HashNode); ok {
-			cached.flags.hash = hn
-		} else {
-			cached.flags.hash = nil
-		}
+		hashed, cached := h.hashBranchNode(n, force)
+		cached.flags.hash, _ = hashed.(HashNode)
+		return hashed, cached
+	case *BinaryShortNode:
+		hashed, cached := h.hashBinaryShortNode(n, force)
+		cached.flags.hash, _ = hashed.(HashNode)
+		return hashed, cached
+	case *BinaryBranchNode:
+		hashed, cached := h.hashBinaryBranchNode(n, force)
+		cached.flags.hash, _ = hashed.(HashNode)
 		return hashed, cached
 	default:
 		// Value and hash nodes don't have children so they're left as were
@@ -39,88 +104,116 @@ func Hash(n Node, force bool) (hashed Node, cached Node) {
 	}
 }
 
-func branchNodeToHash(n *BranchNode, force bool) Node {
-	buf := new(bytes.Buffer)
-	defer buf.Reset()
-	if err := n.EncodeRLP(buf); err != nil {
-		panic("encode error: " + err.Error())
-	}
-
-	if len(buf.Bytes()) < 32 && !force {
-		return n // Nodes smaller than 32 bytes are stored inside their parent
-	}
-
-	return hashData(buf.Bytes())
-}
-
-func shortnodeToHash(n *ShortNode, force bool) Node {
-	buf := new(bytes.Buffer)
-	defer buf.Reset()
-	if err := rlp.Encode(buf, n); err != nil {
-		panic("encode error: " + err.Error())
+// hashShortNode hashes the child of a short node, then encodes the collapsed
+// node straight into the temp buffer. Nodes small enough to be embedded into
+// their parent are returned as their raw encoding instead of a hash.
+func (h *hasher) hashShortNode(n *ShortNode, force bool) (Node, *ShortNode) {
+	cached := n.copy()
+	val := n.Val
+	// Unless the child is a valuenode or hashnode, hash it
+	switch n.Val.(type) {
+	case *BranchNode, *ShortNode:
+		val, cached.Val = h.hash(n.Val, false)
 	}
-
-	if len(buf.Bytes()) < 32 && !force {
-		return n // Nodes smaller than 32 bytes are stored inside their parent
+	h.key = appendHexToCompact(h.key[:0], n.Key)
+	h.tmp = appendShort(h.tmp[:0], h.key, val)
+	if len(h.tmp) < h.size && !force {
+		// Nodes smaller than a hash are stored inside their parent
+		return rawNode(common.CopyBytes(h.tmp)), cached
 	}
-	return hashData(buf.Bytes())
+	return h.hashData(h.tmp), cached
 }
 
-func hashBranchNodeChildren(n *BranchNode) (collapsed *BranchNode, cached *BranchNode) {
-	// Hash the full node's children, caching the newly hashed subtrees
-	cached = n.copy()
-	collapsed = n.copy()
+// hashBranchNode hashes the children of a branch node, then encodes the
+// collapsed node straight into the temp buffer.
+func (h *hasher) hashBranchNode(n *BranchNode, force bool) (Node, *BranchNode) {
+	cached := n.copy()
+	var collapsed [17]Node
 	for i := 0; i < 16; i++ {
 		if child := n.Children[i]; child != nil {
-			collapsed.Children[i], cached.Children[i] = Hash(child, false)
-		} else {
-			collapsed.Children[i] = NilValueNode
+			collapsed[i], cached.Children[i] = h.hash(child, false)
 		}
 	}
-	return collapsed, cached
+	collapsed[16] = n.Children[16]
+	h.tmp = appendBranch(h.tmp[:0], collapsed[:])
+	if len(h.tmp) < h.size && !force {
+		return rawNode(common.CopyBytes(h.tmp)), cached
+	}
+	return h.hashData(h.tmp), cached
 }
 
-func hashShortNodeChildren(n *ShortNode) (collapsed, cached *ShortNode) {
-	// Hash the short node's child, caching the newly hashed subtree
-	collapsed, cached = n.copy(), n.copy()
-	// Previously, we did copy this one. We don't seem to need to actually
-	// do that, since we don't overwrite/reuse keys
-	//cached.Key = common.CopyBytes(n.Key)
-	collapsed.Key = hexToCompact(n.Key)
-	// Unless the child is a valuenode or hashnode, hash it
-	switch n.Val.(type) {
-	case *BranchNode, *ShortNode:
-		collapsed.Val, cached.Val = Hash(n.Val, false)
-	}
-	return collapsed, cached
+// hashData hashes data with the hasher's Streebog state. Only the returned
+// hash node is allocated.
+func (h *hasher) hashData(data []byte) HashNode {
+	n := make(HashNode, h.size)
+	h.sha.Reset()
+	h.sha.Write(data)
+	h.sha.Read(n)
+	return n
 }
 
-func hashData(data []byte) HashNode {
-	hash := gost3411.New256()
-	hash.Reset()
-	hash.Write(data)
-	return hash.Sum(nil)
+// hashData hashes data into a hash node of the given width.
+func hashData(size int, data []byte) HashNode {
+	h := newHasher(size)
+	defer returnHasherToPool(h)
+	return h.hashData(data)
 }
 
 type MissingNodeError struct {
-	NodeHash common.Hash // hash of the missing node
-	Path     []byte      // hex-encoded path to the missing node
+	NodeHash NodeHash // hash of the missing node
+	Path     []byte   // hex-encoded path to the missing node
+	Err      error    // failure of the node resolver, if one was asked
 }
 
 func (err *MissingNodeError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("missing trie node %x (path %x): %v", err.NodeHash, err.Path, err.Err)
+	}
 	return fmt.Sprintf("missing trie node %x (path %x)", err.NodeHash, err.Path)
 }
 
-func proofHash(original Node) (collapsed, hashed Node) {
-	switch n := original.(type) {
-	case *ShortNode:
-		sn, _ := hashShortNodeChildren(n)
-		return sn, shortnodeToHash(sn, false)
-	case *BranchNode:
-		fn, _ := hashBranchNodeChildren(n)
-		return fn, branchNodeToHash(fn, false)
-	default:
-		// Value and hash nodes don't have children so they're left as were
-		return n, n
+func (err *MissingNodeError) Unwrap() error {
+	return err.Err
+}
+
+// CorruptNodeError is returned by trie functions (TryGet, TryInsert, TryDelete,
+// Proof) when a node loaded from the database can't be decoded, or if the trie
+// holds a node of an unexpected type.
+type CorruptNodeError struct {
+	NodeHash NodeHash // hash of the corrupt node
+	Path     []byte   // hex-encoded path to the corrupt node
+	Stack    []string // decode path to the failure within the node, innermost first
+	Err      error    // underlying decode error
+}
+
+// newCorruptNodeError wraps a decode failure of the node with the given hash,
+// unpacking the decode stack built by wrapError.
+func newCorruptNodeError(hash NodeHash, err error) *CorruptNodeError {
+	if decErr, ok := err.(*decodeError); ok {
+		return &CorruptNodeError{NodeHash: hash, Stack: decErr.stack, Err: decErr.what}
+	}
+	return &CorruptNodeError{NodeHash: hash, Err: err}
+}
+
+// invalidNodeError reports a node of unexpected type found in a live trie.
+func invalidNodeError(n Node, path []byte) *CorruptNodeError {
+	return &CorruptNodeError{Path: common.CopyBytes(path), Err: fmt.Errorf("invalid node type %T", n)}
+}
+
+func (err *CorruptNodeError) Error() string {
+	if len(err.Stack) == 0 {
+		return fmt.Sprintf("corrupt trie node %x (path %x): %v", err.NodeHash, err.Path, err.Err)
 	}
-}
\ No newline at end of file
+	return fmt.Sprintf("corrupt trie node %x (path %x): %v (decode path: %s)", err.NodeHash, err.Path, err.Err, strings.Join(err.Stack, "<-"))
+}
+
+func (err *CorruptNodeError) Unwrap() error {
+	return err.Err
+}
+
+// proofHash hashes a node on a proof path, returning its encoding along with
+// its hash, or its raw encoding if it is embedded into its parent.
+func (h *hasher) proofHash(n Node) (enc []byte, hashed Node) {
+	hashed, _ = h.hash(n, false)
+	return common.CopyBytes(h.tmp), hashed
+}
@@ -0,0 +1,113 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+func TestNodeEncoding(t *testing.T) {
+	long := []byte(strings.Repeat("v", 100))
+	hash := HashNode(common.Hash{1}.Bytes())
+	embedded := &ShortNode{Key: []byte{0x20, 0x01}, Val: ValueNode("x")}
+
+	// The expected encodings use plain values, so they don't go through the
+	// EncodeRLP methods of the node types.
+	tests := []struct {
+		node Node
+		want interface{}
+	}{
+		{&ShortNode{Key: []byte{0x20, 0x01}, Val: ValueNode("x")}, []interface{}{[]byte{0x20, 0x01}, []byte("x")}},
+		{&ShortNode{Key: []byte{0x31}, Val: ValueNode(long)}, []interface{}{[]byte{0x31}, long}},
+		{&ShortNode{Key: []byte{0x00, 0x12}, Val: hash}, []interface{}{[]byte{0x00, 0x12}, []byte(hash)}},
+		{&BranchNode{Children: [17]Node{1: hash, 5: embedded, 16: ValueNode(long)}}, []interface{}{
+			[]byte{}, []byte(hash), []byte{}, []byte{}, []byte{},
+			[]interface{}{[]byte{0x20, 0x01}, []byte("x")},
+			[]byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+			long,
+		}},
+		{&BinaryBranchNode{Children: [3]Node{0: hash, 1: NilValueNode}}, []interface{}{[]byte(hash), []byte{}, []byte{}}},
+		{rawBranchNode{3: hash}, []interface{}{
+			[]byte{}, []byte{}, []byte{}, []byte(hash), []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+			[]byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{}, []byte{},
+		}},
+		{&rawShortNode{Key: []byte{0x20}, Val: rawNode{0xc2, 0x20, 0x01}}, []interface{}{[]byte{0x20}, []interface{}{[]byte{0x20}, []byte{0x01}}}},
+	}
+	for i, test := range tests {
+		want, err := rlp.EncodeToBytes(test.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := appendNode([]byte{0xff}, test.node); !bytes.Equal(have[1:], want) || have[0] != 0xff {
+			t.Errorf("test %d: encoding mismatch\nhave %x\nwant %x", i, have, want)
+		}
+		if have, _ := rlp.EncodeToBytes(test.node); !bytes.Equal(have, want) {
+			t.Errorf("test %d: EncodeRLP mismatch\nhave %x\nwant %x", i, have, want)
+		}
+	}
+}
+
+func TestHashAllocs(t *testing.T) {
+	trie, _ := New(NodeHash{}, NewDatabase(nil))
+	for i := 0; i < 1000; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	stored := 0
+	_, cached := Hash(trie.root, true)
+	countStored(cached, &stored)
+
+	// Every node still needs its cached copy and the bytes of its hash or
+	// embedded encoding, which are kept by the trie. Returning those bytes as
+	// a Node boxes the slice header, the third allocation. Encoding buffers
+	// and the Streebog state are reused, so nothing else is allocated.
+	allocs := testing.AllocsPerRun(10, func() { Hash(trie.root, true) })
+	if perNode := allocs / float64(stored); perNode > 3 {
+		t.Errorf("%v allocations per node hashed", perNode)
+	}
+}
+
+// countStored counts the nodes of a hashed trie.
+func countStored(n Node, count *int) {
+	switch n := n.(type) {
+	case *ShortNode:
+		*count++
+		countStored(n.Val, count)
+	case *BranchNode:
+		*count++
+		for _, child := range &n.Children {
+			countStored(child, count)
+		}
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	trie, _ := New(NodeHash{}, NewDatabase(nil))
+	for i := 0; i < 10000; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root := trie.root
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Hash(root, true)
+	}
+}
+
+func TestHashEmbedded(t *testing.T) {
+	n := &ShortNode{Key: []byte{1, 2, 16}, Val: ValueNode("v")}
+	hashed, cached := Hash(n, false)
+	collapsed, ok := hashed.(*ShortNode)
+	if !ok {
+		t.Fatalf("embedded node hashed to %T, want *ShortNode", hashed)
+	}
+	if !bytes.Equal(collapsed.Key, hexToCompact(n.Key)) || !bytes.Equal(collapsed.Val.(ValueNode), n.Val.(ValueNode)) {
+		t.Errorf("collapsed node mismatch: %v", collapsed.fstring(""))
+	}
+	if hash, _ := cached.cache(); hash != nil {
+		t.Errorf("embedded node cached with hash %x", hash)
+	}
+}
@@ -0,0 +1,67 @@
+package mpt
+
+import "bytes"
+
+// Iterate calls fn for every key-value pair of the trie with a key not below
+// start, in ascending key order, until fn returns false. Missing or corrupt
+// nodes abort the iteration with an error.
+func (t *MerklePatriciaTrie) Iterate(start []byte, fn func(key, value []byte) bool) error {
+	hex := keybytesToHex(start)
+	_, err := t.iterate(t.root, nil, hex[:len(hex)-1], fn)
+	return err
+}
+
+// iterate walks the subtree n at the given path (nibbles, no terminator),
+// reporting false once fn asked to stop.
+func (t *MerklePatriciaTrie) iterate(n Node, path, start []byte, fn func(key, value []byte) bool) (bool, error) {
+	switch n := n.(type) {
+	case nil:
+		return true, nil
+	case ValueNode:
+		if bytes.Compare(path, start) < 0 {
+			return true, nil
+		}
+		return fn(hexToKeybytes(path), n), nil
+	case *ShortNode:
+		key := n.Key
+		if hasTerm(key) {
+			key = key[:len(key)-1]
+		}
+		child := concat(path, key...)
+		if !reachable(child, start) {
+			return true, nil
+		}
+		return t.iterate(n.Val, child, start, fn)
+	case *BranchNode:
+		// The value of the branch sorts before all its children
+		if cont, err := t.iterate(n.Children[16], path, start, fn); !cont || err != nil {
+			return cont, err
+		}
+		for i := 0; i < 16; i++ {
+			child := concat(path, byte(i))
+			if n.Children[i] == nil || !reachable(child, start) {
+				continue
+			}
+			if cont, err := t.iterate(n.Children[i], child, start, fn); !cont || err != nil {
+				return cont, err
+			}
+		}
+		return true, nil
+	case HashNode:
+		rn, err := t.resolveHash(n, path)
+		if err != nil {
+			return false, err
+		}
+		return t.iterate(rn, path, start, fn)
+	default:
+		return false, invalidNodeError(n, path)
+	}
+}
+
+// reachable reports whether the subtree at path can hold keys not below start.
+func reachable(path, start []byte) bool {
+	if len(start) > len(path) {
+		start = start[:len(path)]
+	}
+	return bytes.Compare(path, start) >= 0
+}
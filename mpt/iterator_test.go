@@ -0,0 +1,58 @@
+package mpt
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+func TestIterate(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	trie, _ := New(NodeHash{}, db)
+
+	var keys []string
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		trie.Put([]byte(key), []byte("val-"+key))
+		keys = append(keys, key)
+	}
+	// Keys being prefixes of others end up as branch values.
+	for _, key := range []string{"k", "ke", "key"} {
+		trie.Put([]byte(key), []byte("val-"+key))
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Iterate a committed trie so nodes get resolved on the way.
+	root, _ := trie.Commit(nil)
+	trie, _ = New(root, db)
+
+	for _, start := range []string{"", "key-1", "key-15x", "kez", "j"} {
+		var have []string
+		err := trie.Iterate([]byte(start), func(key, value []byte) bool {
+			if string(value) != "val-"+string(key) {
+				t.Errorf("value mismatch for %q: %q", key, value)
+			}
+			have = append(have, string(key))
+			return true
+		})
+		if err != nil {
+			t.Fatalf("start %q: iteration error: %v", start, err)
+		}
+		want := keys[sort.SearchStrings(keys, start):]
+		if fmt.Sprint(have) != fmt.Sprint(want) {
+			t.Errorf("start %q: have %d keys %v, want %d keys", start, len(have), have, len(want))
+		}
+	}
+	// Stopping early.
+	var count int
+	trie.Iterate(nil, func(key, value []byte) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Errorf("iteration didn't stop: %d keys visited", count)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"io"
 	"strings"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/pavelkrolevets/mpt/rlp"
 )
 
@@ -41,18 +40,8 @@ type ValueNode []byte
 
 var NilValueNode = ValueNode(nil)
 
-func (n *BranchNode) EncodeRLP(w io.Writer) error {
-	var nodes [17]Node
-
-	for i, child := range &n.Children {
-		if child != nil {
-			nodes[i] = child
-		} else {
-			nodes[i] = NilValueNode
-		}
-	}
-	return rlp.Encode(w, nodes)
-}
+func (n *BranchNode) EncodeRLP(w io.Writer) error { return writeNode(w, n) }
+func (n *ShortNode) EncodeRLP(w io.Writer) error  { return writeNode(w, n) }
 
 func (n *BranchNode) fstring(ind string) string {
 	resp := fmt.Sprintf("[\n%s  ", ind)
@@ -81,15 +70,19 @@ func (n *ShortNode) cache() (HashNode, bool) { return n.flags.hash, n.flags.dirt
 func (n HashNode) cache() (HashNode, bool)   { return nil, true }
 func (n ValueNode) cache() (HashNode, bool)  { return nil, true }
 
-func mustDecodeNode(hash, buf []byte) Node {
-	n, err := decodeNode(hash, buf)
+// decodeStoredNode decodes a node loaded from the database, reporting any
+// failure as a CorruptNodeError.
+func decodeStoredNode(hash NodeHash, buf []byte) (Node, error) {
+	n, err := decodeNode(hash.Len(), hash.Bytes(), buf)
 	if err != nil {
-		panic(fmt.Sprintf("node %x: %v", hash, err))
+		return nil, newCorruptNodeError(hash, err)
 	}
-	return n
+	return n, nil
 }
 
-func decodeNode(hash, buf []byte) (Node, error) {
+// decodeNode decodes a node whose children are referenced by hashes of the
+// given size.
+func decodeNode(size int, hash, buf []byte) (Node, error) {
 	if len(buf) == 0 {
 		return nil, io.ErrUnexpectedEOF
 	}
@@ -99,22 +92,31 @@ func decodeNode(hash, buf []byte) (Node, error) {
 	}
 	switch c, _ := rlp.CountValues(elems); c {
 	case 2:
-		n, err := decodeShort(hash, elems)
+		n, err := decodeShort(size, hash, elems)
 		return n, wrapError(err, "short")
 	case 17:
-		n, err := decodeFull(hash, elems)
+		n, err := decodeFull(size, hash, elems)
 		return n, wrapError(err, "full")
+	case 3:
+		n, err := decodeBinaryBranch(size, hash, elems)
+		return n, wrapError(err, "binary")
 	default:
 		return nil, fmt.Errorf("invalid number of list elements: %v", c)
 	}
 }
 
-func decodeShort(hash, elems []byte) (Node, error) {
+func decodeShort(size int, hash, elems []byte) (Node, error) {
 	kbuf, rest, err := rlp.SplitString(elems)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkCompact(kbuf); err != nil {
+		return nil, err
+	}
 	flag := NodeFlag{hash: hash}
+	if isBinaryCompact(kbuf) {
+		return decodeBinaryShort(size, flag, kbuf, rest)
+	}
 	key := compactToHex(kbuf)
 	if hasTerm(key) {
 		// value node
@@ -124,17 +126,17 @@ func decodeShort(hash, elems []byte) (Node, error) {
 		}
 		return &ShortNode{key, append(ValueNode{}, val...), flag}, nil
 	}
-	r, _, err := decodeRef(rest)
+	r, _, err := decodeRef(size, rest)
 	if err != nil {
 		return nil, wrapError(err, "val")
 	}
 	return &ShortNode{key, r, flag}, nil
 }
 
-func decodeFull(hash, elems []byte) (*BranchNode, error) {
+func decodeFull(size int, hash, elems []byte) (*BranchNode, error) {
 	n := &BranchNode{flags: NodeFlag{hash: hash}}
 	for i := 0; i < 16; i++ {
-		cld, rest, err := decodeRef(elems)
+		cld, rest, err := decodeRef(size, elems)
 		if err != nil {
 			return n, wrapError(err, fmt.Sprintf("[%d]", i))
 		}
@@ -150,9 +152,9 @@ func decodeFull(hash, elems []byte) (*BranchNode, error) {
 	return n, nil
 }
 
-const hashLen = len(common.Hash{})
-
-func decodeRef(buf []byte) (Node, []byte, error) {
+// decodeRef decodes a child reference, either a hash of the given size or a
+// node embedded because its encoding is smaller than that.
+func decodeRef(size int, buf []byte) (Node, []byte, error) {
 	kind, val, rest, err := rlp.Split(buf)
 	if err != nil {
 		return nil, buf, err
@@ -161,19 +163,19 @@ func decodeRef(buf []byte) (Node, []byte, error) {
 	case kind == rlp.List:
 		// 'embedded' node reference. The encoding must be smaller
 		// than a hash in order to be valid.
-		if size := len(buf) - len(rest); size > hashLen {
-			err := fmt.Errorf("oversized embedded node (size is %d bytes, want size < %d)", size, hashLen)
+		if embedded := len(buf) - len(rest); embedded > size {
+			err := fmt.Errorf("oversized embedded node (size is %d bytes, want size < %d)", embedded, size)
 			return nil, buf, err
 		}
-		n, err := decodeNode(nil, buf)
+		n, err := decodeNode(size, nil, buf)
 		return n, rest, err
 	case kind == rlp.String && len(val) == 0:
 		// empty node
 		return nil, rest, nil
-	case kind == rlp.String && len(val) == 32:
+	case kind == rlp.String && len(val) == size:
 		return append(HashNode{}, val...), rest, nil
 	default:
-		return nil, nil, fmt.Errorf("invalid RLP string size %d (want 0 or 32)", len(val))
+		return nil, nil, fmt.Errorf("invalid RLP string size %d (want 0 or %d)", len(val), size)
 	}
 }
 
@@ -0,0 +1,104 @@
+package mpt
+
+import (
+	"fmt"
+	"io"
+)
+
+// appendNode appends the RLP encoding of a collapsed or stored node to buf. It
+// is the reflection-free equivalent of rlp.Encode for every node type that can
+// occur in a collapsed trie, nil children encoding as empty strings.
+func appendNode(buf []byte, n Node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return append(buf, 0x80)
+	case ValueNode:
+		return appendString(buf, n)
+	case HashNode:
+		return appendString(buf, n)
+	case rawNode:
+		return append(buf, n...)
+	case *ShortNode:
+		return appendShort(buf, n.Key, n.Val)
+	case *BinaryShortNode:
+		return appendShort(buf, n.Key, n.Val)
+	case rawShortNode:
+		return appendShort(buf, n.Key, n.Val)
+	case *rawShortNode:
+		return appendShort(buf, n.Key, n.Val)
+	case *BranchNode:
+		return appendBranch(buf, n.Children[:])
+	case *BinaryBranchNode:
+		return appendBranch(buf, n.Children[:])
+	case rawBranchNode:
+		return appendBranch(buf, n[:])
+	case rawBinaryBranchNode:
+		return appendBranch(buf, n[:])
+	default:
+		panic(fmt.Sprintf("can't encode node type %T", n))
+	}
+}
+
+func appendShort(buf []byte, key []byte, val Node) []byte {
+	offset := len(buf)
+	buf = appendString(buf, key)
+	buf = appendNode(buf, val)
+	return wrapList(buf, offset)
+}
+
+func appendBranch(buf []byte, children []Node) []byte {
+	offset := len(buf)
+	for _, child := range children {
+		buf = appendNode(buf, child)
+	}
+	return wrapList(buf, offset)
+}
+
+// appendString appends b as an RLP string.
+func appendString(buf []byte, b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return append(buf, b[0])
+	}
+	buf = appendHead(buf, 0x80, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// wrapList turns the items encoded at buf[offset:] into an RLP list, moving
+// them behind the list header.
+func wrapList(buf []byte, offset int) []byte {
+	var head [9]byte
+	size := len(buf) - offset
+	hlen := len(appendHead(head[:0], 0xc0, uint64(size)))
+
+	buf = append(buf, head[:hlen]...)
+	copy(buf[offset+hlen:], buf[offset:offset+size])
+	copy(buf[offset:], head[:hlen])
+	return buf
+}
+
+// appendHead appends an RLP string (tag 0x80) or list (tag 0xc0) header for
+// a payload of the given size.
+func appendHead(buf []byte, tag byte, size uint64) []byte {
+	if size < 56 {
+		return append(buf, tag+byte(size))
+	}
+	var (
+		enc [8]byte
+		n   = 0
+	)
+	for s := size; s > 0; s >>= 8 {
+		n++
+	}
+	for i := 0; i < n; i++ {
+		enc[i] = byte(size >> (8 * uint(n-1-i)))
+	}
+	buf = append(buf, tag+55+byte(n))
+	return append(buf, enc[:n]...)
+}
+
+// writeNode writes the RLP encoding of n to w, serving the EncodeRLP methods
+// of the node types.
+func writeNode(w io.Writer, n Node) error {
+	_, err := w.Write(appendNode(nil, n))
+	return err
+}
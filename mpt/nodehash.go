@@ -0,0 +1,160 @@
+package mpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// Node hash widths supported by the trie, the digest sizes of Streebog-256 and
+// Streebog-512. The width is chosen per database, see Config.HashSize.
+const (
+	HashSize256 = 32
+	HashSize512 = 64
+)
+
+// NodeHash is the hash of a trie node, which is also the key it is stored
+// under. It is either 32 or 64 bytes wide, depending on the database the trie
+// lives in; the zero value is the empty hash of no width. NodeHash values are
+// comparable and can be used as map keys.
+type NodeHash struct {
+	b [HashSize512]byte
+	n uint8
+}
+
+// BytesToNodeHash converts a 32 or 64 byte slice into a node hash. It panics
+// on any other length.
+func BytesToNodeHash(b []byte) NodeHash {
+	if !validHashSize(len(b)) {
+		panic(fmt.Sprintf("invalid node hash length %d", len(b)))
+	}
+	var h NodeHash
+	h.n = uint8(copy(h.b[:], b))
+	return h
+}
+
+// HexToNodeHash converts a hex string of 32 or 64 bytes into a node hash,
+// panicking on any other length.
+func HexToNodeHash(s string) NodeHash { return BytesToNodeHash(common.FromHex(s)) }
+
+// CommonToNodeHash converts a 256-bit hash into a node hash.
+func CommonToNodeHash(h common.Hash) NodeHash { return BytesToNodeHash(h[:]) }
+
+func validHashSize(size int) bool {
+	return size == HashSize256 || size == HashSize512
+}
+
+// Len returns the width of the hash in bytes, zero for the empty hash.
+func (h NodeHash) Len() int { return int(h.n) }
+
+// Bytes returns the hash as a byte slice.
+func (h NodeHash) Bytes() []byte { return h.b[:h.n] }
+
+// Hex returns the 0x prefixed hex encoding of the hash.
+func (h NodeHash) Hex() string { return hexutil.Encode(h.b[:h.n]) }
+
+// TerminalString implements log.TerminalStringer, formatting a string for
+// console output during logging.
+func (h NodeHash) TerminalString() string {
+	if h.n == 0 {
+		return "<empty>"
+	}
+	return fmt.Sprintf("%x…%x", h.b[:3], h.b[h.n-3:h.n])
+}
+
+// String implements the stringer interface and is used also by the logger when
+// doing full logging into a file.
+func (h NodeHash) String() string { return h.Hex() }
+
+// Format implements fmt.Formatter, printing the hash in hex the same way
+// common.Hash does.
+func (h NodeHash) Format(s fmt.State, c rune) {
+	hexb := make([]byte, 2+2*h.n)
+	copy(hexb, "0x")
+	hex.Encode(hexb[2:], h.b[:h.n])
+
+	switch c {
+	case 'x', 'X':
+		if !s.Flag('#') {
+			hexb = hexb[2:]
+		}
+		if c == 'X' {
+			hexb = bytes.ToUpper(hexb)
+		}
+		fallthrough
+	case 'v', 's':
+		s.Write(hexb)
+	case 'q':
+		q := []byte{'"'}
+		s.Write(q)
+		s.Write(hexb)
+		s.Write(q)
+	default:
+		fmt.Fprintf(s, "%%!%c(hash=%x)", c, h.b[:h.n])
+	}
+}
+
+// MarshalText returns the hex representation of h.
+func (h NodeHash) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(h.b[:h.n]).MarshalText()
+}
+
+// UnmarshalText parses a 32 or 64 byte hash in hex syntax.
+func (h *NodeHash) UnmarshalText(input []byte) error {
+	var b hexutil.Bytes
+	if err := b.UnmarshalText(input); err != nil {
+		return err
+	}
+	if !validHashSize(len(b)) {
+		return fmt.Errorf("node hash has invalid length %d, want %d or %d", len(b), HashSize256, HashSize512)
+	}
+	*h = BytesToNodeHash(b)
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, encoding the hash as a byte string. 256-bit
+// hashes encode the same as a common.Hash.
+func (h NodeHash) EncodeRLP(w io.Writer) error {
+	buf := rlp.NewEncoderBuffer(w)
+	buf.WriteBytes(h.b[:h.n])
+	return buf.Flush()
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (h *NodeHash) DecodeRLP(s *rlp.Stream) error {
+	b, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if !validHashSize(len(b)) {
+		return fmt.Errorf("node hash has invalid length %d", len(b))
+	}
+	*h = BytesToNodeHash(b)
+	return nil
+}
+
+// emptyRoot512 is the root hash of an empty trie with 512-bit hashes, the
+// Streebog-512 digest of the empty RLP string. Empty 256-bit tries keep the
+// emptyRoot value inherited from Ethereum, so existing databases stay valid.
+var emptyRoot512 = BytesToNodeHash(hashData(HashSize512, []byte{0x80}))
+
+// emptyRootHash returns the root hash of an empty trie with hashes of the given
+// width.
+func emptyRootHash(size int) NodeHash {
+	if size == HashSize512 {
+		return emptyRoot512
+	}
+	return emptyRoot
+}
+
+// isEmptyRoot reports whether root denotes an empty trie with hashes of the
+// given width. The empty root of the other width is not empty, it is rejected
+// like any other root of the wrong width.
+func isEmptyRoot(root NodeHash, size int) bool {
+	return root == (NodeHash{}) || root == emptyRootHash(size)
+}
@@ -0,0 +1,175 @@
+package mpt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+func TestNodeHashEncoding(t *testing.T) {
+	for _, size := range []int{HashSize256, HashSize512} {
+		hash := BytesToNodeHash(hashData(size, []byte("node")))
+
+		enc, err := json.Marshal(hash)
+		if err != nil {
+			t.Fatalf("%d: json marshal error: %v", size, err)
+		}
+		var dec NodeHash
+		if err := json.Unmarshal(enc, &dec); err != nil || dec != hash {
+			t.Errorf("%d: json round trip: have %x (%v), want %x", size, dec, err, hash)
+		}
+		blob, err := rlp.EncodeToBytes(hash)
+		if err != nil {
+			t.Fatalf("%d: rlp encode error: %v", size, err)
+		}
+		dec = NodeHash{}
+		if err := rlp.DecodeBytes(blob, &dec); err != nil || dec != hash {
+			t.Errorf("%d: rlp round trip: have %x (%v), want %x", size, dec, err, hash)
+		}
+		if have, want := fmt.Sprintf("%x", hash), fmt.Sprintf("%x", hash.Bytes()); have != want {
+			t.Errorf("%d: formatted as %s, want %s", size, have, want)
+		}
+	}
+	// 256-bit hashes encode exactly like common.Hash.
+	hash := BytesToNodeHash(hashData(HashSize256, []byte("node")))
+	have, _ := rlp.EncodeToBytes(hash)
+	want, _ := rlp.EncodeToBytes(hashData(HashSize256, []byte("node")))
+	if !bytes.Equal(have, want) {
+		t.Errorf("rlp encoding mismatch: have %x, want %x", have, want)
+	}
+	var dec NodeHash
+	if err := json.Unmarshal([]byte(`"0x0102"`), &dec); err == nil {
+		t.Error("short hash accepted")
+	}
+}
+
+func TestTrie512(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{HashSize: HashSize512})
+	trie, _ := New(NodeHash{}, db)
+	if root := trie.Hash(); root != emptyRoot512 {
+		t.Fatalf("empty root mismatch: %x", root)
+	}
+	for i := 0; i < 500; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if root.Len() != HashSize512 {
+		t.Fatalf("root is %d bytes, want %d", root.Len(), HashSize512)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("database commit error: %v", err)
+	}
+	it := diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		if len(it.Key()) != HashSize512 {
+			t.Errorf("node stored under %d byte key", len(it.Key()))
+		}
+	}
+	it.Release()
+
+	// Reopen from disk and read everything back.
+	db = NewDatabaseWithConfig(diskdb, &Config{HashSize: HashSize512})
+	trie, err = New(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	for i := 0; i < 500; i++ {
+		key, want := fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i)
+		if have := trie.Get([]byte(key)); string(have) != want {
+			t.Fatalf("%s: have %q, want %q", key, have, want)
+		}
+	}
+	if res := Verify(db, root); len(res.Problems) != 0 {
+		t.Fatalf("stored trie problems: %v", res.Problems)
+	}
+	if stats, err := Stats(db, root); err != nil || stats.Values != 500 {
+		t.Fatalf("stats: %+v (%v)", stats, err)
+	}
+	proof, err := trie.ProofNodes([]byte("key-42"))
+	if err != nil {
+		t.Fatalf("proof error: %v", err)
+	}
+	if have, err := VerifyProof(root, []byte("key-42"), proof); err != nil || string(have) != "val-42" {
+		t.Fatalf("proof verification: have %q (%v)", have, err)
+	}
+	// The root doesn't open a trie of another width.
+	if _, err := New(root, NewDatabase(diskdb)); err == nil {
+		t.Error("512-bit root opened with 256-bit database")
+	}
+}
+
+func TestEmptyRootWidth(t *testing.T) {
+	db256 := NewDatabase(memorydb.New())
+	db512 := NewDatabaseWithConfig(memorydb.New(), &Config{HashSize: HashSize512})
+
+	for _, db := range []*Database{db256, db512} {
+		for _, root := range []NodeHash{{}, emptyRootHash(db.hashSize)} {
+			if _, err := New(root, db); err != nil {
+				t.Errorf("%d-byte database: can't open empty root %x: %v", db.hashSize, root, err)
+			}
+			if _, err := NewBinary(root, db); err != nil {
+				t.Errorf("%d-byte database: can't open empty binary root %x: %v", db.hashSize, root, err)
+			}
+		}
+	}
+	if res := Verify(db512, emptyRoot512); len(res.Problems) != 0 || res.Nodes != 0 {
+		t.Errorf("empty 512-bit root verified as %+v", res)
+	}
+	// The empty root of the other width is rejected like any other root.
+	if _, err := New(emptyRoot512, db256); err == nil {
+		t.Error("512-bit empty root opened with 256-bit database")
+	}
+	if _, err := New(emptyRoot, db512); err == nil {
+		t.Error("256-bit empty root opened with 512-bit database")
+	}
+	if _, err := NewBinary(emptyRoot, db512); err == nil {
+		t.Error("256-bit empty root opened with 512-bit binary database")
+	}
+}
+
+func TestEmbeddingThreshold512(t *testing.T) {
+	// A leaf whose encoding is between 32 and 64 bytes is hashed in a 256-bit
+	// trie but embedded into its parent in a 512-bit one.
+	leaf := &ShortNode{Key: keybytesToHex([]byte("key")), Val: ValueNode(bytes.Repeat([]byte{'v'}, 30))}
+	for _, test := range []struct {
+		size     int
+		embedded bool
+	}{
+		{HashSize256, false},
+		{HashSize512, true},
+	} {
+		h := newHasher(test.size)
+		hashed, _ := h.hash(leaf, false)
+		returnHasherToPool(h)
+
+		switch hashed := hashed.(type) {
+		case rawNode:
+			if !test.embedded {
+				t.Errorf("%d: %d byte node embedded", test.size, len(hashed))
+			}
+		case HashNode:
+			if test.embedded || len(hashed) != test.size {
+				t.Errorf("%d: node hashed to %d bytes", test.size, len(hashed))
+			}
+		}
+	}
+	// Decoding enforces the width of the references.
+	var branch rawBranchNode
+	branch[0] = HashNode(hashData(HashSize512, []byte("child")))
+	branch[1] = HashNode(hashData(HashSize512, []byte("other")))
+	blob, _ := rlp.EncodeToBytes(branch)
+	if _, err := decodeNode(HashSize512, nil, blob); err != nil {
+		t.Errorf("512-bit references rejected: %v", err)
+	}
+	if _, err := decodeNode(HashSize256, nil, blob); err == nil {
+		t.Error("512-bit references accepted by 256-bit decoder")
+	}
+}
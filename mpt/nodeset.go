@@ -0,0 +1,224 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// TrackedNode is a trie node created by a commit.
+type TrackedNode struct {
+	Path []byte   // Path of the node from the trie root (nibbles or bits)
+	Hash NodeHash // Hash of the node, the key it is stored under
+	Blob []byte   // RLP encoding of the node
+
+	node Node // Collapsed node, used to insert into the Database with references
+	size int  // Estimated size, used for memory tracking
+}
+
+// DeletedNode is a previously stored trie node that a commit made obsolete.
+type DeletedNode struct {
+	Path []byte   // Path the node was reachable at (nibbles or bits)
+	Hash NodeHash // Hash of the obsolete node
+}
+
+// NodeSet is the explicit result of a trie commit: every node added to the
+// trie, children before their parents, and every stored node that is no longer
+// part of it. Sets of several tries can be merged and applied together with
+// Database.Update.
+type NodeSet struct {
+	Added   []*TrackedNode
+	Deleted []*DeletedNode
+}
+
+// NewNodeSet creates an empty node set.
+func NewNodeSet() *NodeSet {
+	return new(NodeSet)
+}
+
+func (set *NodeSet) add(path []byte, hash NodeHash, size int, n Node) error {
+	blob, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		return err
+	}
+	set.Added = append(set.Added, &TrackedNode{
+		Path: common.CopyBytes(path),
+		Hash: hash,
+		Blob: blob,
+		node: n,
+		size: size,
+	})
+	return nil
+}
+
+// Merge appends the nodes of other to set. The order of both sets is kept, so
+// the children-first ordering of the additions still holds.
+func (set *NodeSet) Merge(other *NodeSet) {
+	if other == nil {
+		return
+	}
+	set.Added = append(set.Added, other.Added...)
+	set.Deleted = append(set.Deleted, other.Deleted...)
+}
+
+// Len returns the number of added and deleted nodes in the set.
+func (set *NodeSet) Len() (added int, deleted int) {
+	return len(set.Added), len(set.Deleted)
+}
+
+// String returns a human readable summary of the set.
+func (set *NodeSet) String() string {
+	return fmt.Sprintf("nodeset{added: %d, deleted: %d}", len(set.Added), len(set.Deleted))
+}
+
+// Update inserts all nodes added in set into the dirty cache, tracking their
+// references the same way a trie commit does.
+//
+// Deleted nodes are not removed. The database is keyed by hash, so an
+// obsolete node may still be shared by other tries or older roots; memory is
+// reclaimed through Dereference and persisted nodes are left to the caller to
+// prune using the reported paths and hashes.
+func (db *Database) Update(set *NodeSet) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, n := range set.Added {
+		if n.Hash.Len() != db.hashSize {
+			return fmt.Errorf("node %x at path %x: hash is %d bytes, want %d", n.Hash, n.Path, n.Hash.Len(), db.hashSize)
+		}
+		if n.node == nil {
+			// Node set constructed outside of a trie commit (e.g. received
+			// from a replica), decode the verified blob so that the children
+			// are reference tracked like those of committed nodes.
+			if hash := BytesToNodeHash(hashData(db.hashSize, n.Blob)); hash != n.Hash {
+				return fmt.Errorf("node %x at path %x: blob hashes to %x", n.Hash, n.Path, hash)
+			}
+			decoded, err := decodeStoredNode(n.Hash, n.Blob)
+			if err != nil {
+				return err
+			}
+			collapsed := collapseNode(decoded)
+			if enc, err := rlp.EncodeToBytes(simplifyNode(collapsed)); err != nil || !bytes.Equal(enc, n.Blob) {
+				return fmt.Errorf("node %x at path %x: non-canonical encoding", n.Hash, n.Path)
+			}
+			db.insert(n.Hash, len(n.Blob), collapsed)
+			continue
+		}
+		db.insert(n.Hash, n.size, n.node)
+	}
+	db.requestFlush()
+	return nil
+}
+
+// collapseNode converts a decoded node into the collapsed form a trie commit
+// inserts into the database, with keys in compact encoding.
+func collapseNode(n Node) Node {
+	switch n := n.(type) {
+	case *ShortNode:
+		collapsed := n.copy()
+		collapsed.Key = hexToCompact(n.Key)
+		collapsed.Val = collapseNode(n.Val)
+		return collapsed
+	case *BranchNode:
+		collapsed := n.copy()
+		for i, child := range n.Children[:16] {
+			if child != nil {
+				collapsed.Children[i] = collapseNode(child)
+			}
+		}
+		return collapsed
+	case *BinaryShortNode:
+		collapsed := n.copy()
+		collapsed.Key = binaryToCompact(n.Key)
+		collapsed.Val = collapseNode(n.Val)
+		return collapsed
+	case *BinaryBranchNode:
+		collapsed := n.copy()
+		for i, child := range n.Children[:2] {
+			if child != nil {
+				collapsed.Children[i] = collapseNode(child)
+			}
+		}
+		return collapsed
+	default:
+		return n
+	}
+}
+
+// reportLeaves invokes onleaf for every value embedded in the added nodes, in
+// the order the nodes were committed. The nodes must already be inserted into
+// the database, as the callback usually references them.
+func (set *NodeSet) reportLeaves(onleaf LeafCallback) error {
+	for _, n := range set.Added {
+		var value Node
+		switch n := n.node.(type) {
+		case *ShortNode:
+			value = n.Val
+		case *BranchNode:
+			// For children in range [0, 15], it's impossible
+			// to contain valuenode. Only check the 17th child.
+			value = n.Children[16]
+		case *BinaryShortNode:
+			value = n.Val
+		case *BinaryBranchNode:
+			value = n.Children[2]
+		}
+		if leaf, ok := value.(ValueNode); ok {
+			if err := onleaf(nil, leaf, n.Hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tracer records the stored nodes resolved by trie mutations, so that a commit
+// can tell which of them were replaced.
+type tracer struct {
+	accessed map[string]NodeHash // Path -> hash of the nodes resolved from the database
+}
+
+// onResolve records a node loaded from the database at path. Only the first
+// resolution is kept, as it reflects the last committed state.
+func (t *tracer) onResolve(path []byte, hash NodeHash) {
+	if t.accessed == nil {
+		t.accessed = make(map[string]NodeHash)
+	}
+	if _, ok := t.accessed[string(path)]; !ok {
+		t.accessed[string(path)] = hash
+	}
+}
+
+// deleted computes the resolved nodes that are not part of the trie after a
+// commit. A resolved node survives if it was re-added with the same hash at the
+// same path, or if it lies inside a subtree the commit found unmodified.
+func (t *tracer) deleted(set *NodeSet, retained map[string]struct{}) []*DeletedNode {
+	added := make(map[string]NodeHash, len(set.Added))
+	for _, n := range set.Added {
+		added[string(n.Path)] = n.Hash
+	}
+	var deleted []*DeletedNode
+	for path, hash := range t.accessed {
+		if added[path] == hash {
+			continue
+		}
+		kept := false
+		for i := 0; i <= len(path) && !kept; i++ {
+			_, kept = retained[path[:i]]
+		}
+		if !kept {
+			deleted = append(deleted, &DeletedNode{Path: []byte(path), Hash: hash})
+		}
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return string(deleted[i].Path) < string(deleted[j].Path)
+	})
+	return deleted
+}
+
+func (t *tracer) reset() {
+	t.accessed = nil
+}
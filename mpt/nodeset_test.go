@@ -0,0 +1,236 @@
+package mpt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+func TestCommitSetAdded(t *testing.T) {
+	for _, trie := range []Trie{newEmpty(), newEmptyBinary()} {
+		for i := 0; i < 100; i++ {
+			trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+		}
+		root, set, err := trie.CommitSet()
+		if err != nil {
+			t.Fatalf("%T: commit error: %v", trie, err)
+		}
+		if len(set.Added) == 0 || len(set.Deleted) != 0 {
+			t.Fatalf("%T: unexpected set %v", trie, set)
+		}
+		for _, n := range set.Added {
+			if hash := BytesToNodeHash(hashData(HashSize256, n.Blob)); hash != n.Hash {
+				t.Errorf("%T: node at %x: blob hashes to %x, want %x", trie, n.Path, hash, n.Hash)
+			}
+		}
+		// The root comes last, after all of its children.
+		if last := set.Added[len(set.Added)-1]; last.Hash != root || len(last.Path) != 0 {
+			t.Errorf("%T: last added node %x at %x, want root %x", trie, last.Hash, last.Path, root)
+		}
+		// A second commit has nothing to do.
+		if _, set, _ := trie.CommitSet(); len(set.Added) != 0 || len(set.Deleted) != 0 {
+			t.Errorf("%T: unexpected set on clean trie: %v", trie, set)
+		}
+	}
+}
+
+// storedHashes commits a fresh trie with the given contents and returns the
+// hashes of all nodes written to disk.
+func storedHashes(t *testing.T, contents map[string]string) map[NodeHash]bool {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for k, v := range contents {
+		trie.Put([]byte(k), []byte(v))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("database commit error: %v", err)
+	}
+	hashes := make(map[NodeHash]bool)
+	it := diskdb.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		hashes[BytesToNodeHash(it.Key())] = true
+	}
+	return hashes
+}
+
+func TestCommitSetDeleted(t *testing.T) {
+	contents := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		contents[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("val-%d", i)
+	}
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for k, v := range contents {
+		trie.Put([]byte(k), []byte(v))
+	}
+	root, _ := trie.Commit(nil)
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("database commit error: %v", err)
+	}
+	before := storedHashes(t, contents)
+
+	// Reopen from disk, read some keys and modify others.
+	trie, _ = New(root, NewDatabase(diskdb))
+	trie.Get([]byte("key-50"))
+	trie.Put([]byte("key-1"), []byte("changed"))
+	trie.Del([]byte("key-2"))
+	trie.Put([]byte("key-3"), []byte("changed"))
+	trie.Put([]byte("key-3"), []byte("val-3"))
+	trie.Put([]byte("key-100"), []byte("new"))
+
+	contents["key-1"] = "changed"
+	delete(contents, "key-2")
+	contents["key-100"] = "new"
+	after := storedHashes(t, contents)
+
+	newRoot, set, err := trie.CommitSet()
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	// Exactly the nodes of the old trie missing from the new one are deleted.
+	deleted := make(map[NodeHash]bool)
+	for _, n := range set.Deleted {
+		deleted[n.Hash] = true
+	}
+	for hash := range before {
+		if want := !after[hash]; deleted[hash] != want {
+			t.Errorf("node %x: deleted %v, want %v", hash, deleted[hash], want)
+		}
+	}
+	if len(deleted) != len(set.Deleted) {
+		t.Errorf("duplicate deletions reported: %d unique of %d", len(deleted), len(set.Deleted))
+	}
+	// Applying the set makes the new root readable.
+	db = NewDatabase(diskdb)
+	if err := db.Update(set); err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+	trie, err = New(newRoot, db)
+	if err != nil {
+		t.Fatalf("can't open new root: %v", err)
+	}
+	for k, v := range contents {
+		if have := trie.Get([]byte(k)); string(have) != v {
+			t.Errorf("get %q: have %q, want %q", k, have, v)
+		}
+	}
+	// Deleting everything reports every node of the trie.
+	for k := range contents {
+		trie.Del([]byte(k))
+	}
+	emptied, set, _ := trie.CommitSet()
+	if emptied != emptyRoot || len(set.Deleted) != len(after) {
+		t.Errorf("emptied trie: root %x, %d deleted, want %d", emptied, len(set.Deleted), len(after))
+	}
+}
+
+func TestNodeSetMerge(t *testing.T) {
+	var (
+		hex  = newEmpty()
+		bin  = newEmptyBinary()
+		sets = NewNodeSet()
+	)
+	for i := 0; i < 50; i++ {
+		key, val := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i))
+		hex.Put(key, val)
+		bin.Put(key, val)
+	}
+	hexRoot, hexSet, _ := hex.CommitSet()
+	binRoot, binSet, _ := bin.CommitSet()
+	sets.Merge(hexSet)
+	sets.Merge(binSet)
+	if added, _ := sets.Len(); added != len(hexSet.Added)+len(binSet.Added) {
+		t.Fatalf("merged set size mismatch: %d", added)
+	}
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	if err := db.Update(sets); err != nil {
+		t.Fatalf("update error: %v", err)
+	}
+	// Both roots can be flushed from the single update.
+	for _, root := range []NodeHash{hexRoot, binRoot} {
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("database commit error: %v", err)
+		}
+	}
+	hexTrie, _ := New(hexRoot, NewDatabase(diskdb))
+	binTrie, _ := NewBinary(binRoot, NewDatabase(diskdb))
+	for i := 0; i < 50; i++ {
+		key, want := []byte(fmt.Sprintf("key-%d", i)), fmt.Sprintf("val-%d", i)
+		for _, trie := range []Trie{hexTrie, binTrie} {
+			if have, err := trie.TryGet(key); err != nil || string(have) != want {
+				t.Errorf("%T: get %q: have %q (%v), want %q", trie, key, have, err, want)
+			}
+		}
+	}
+}
+
+func TestNodeSetUpdateRaw(t *testing.T) {
+	set := NewNodeSet()
+	set.Added = append(set.Added, &TrackedNode{Hash: CommonToNodeHash(common.HexToHash("0x01")), Blob: []byte{0xc0}})
+	if err := NewDatabase(memorydb.New()).Update(set); err == nil {
+		t.Error("expected error for node with mismatching hash")
+	}
+}
+
+func TestNodeSetUpdateRawCommit(t *testing.T) {
+	tests := []struct {
+		trie Trie
+		open func(NodeHash, *Database) (Trie, error)
+	}{
+		{newEmpty(), func(root NodeHash, db *Database) (Trie, error) { return New(root, db) }},
+		{newEmptyBinary(), func(root NodeHash, db *Database) (Trie, error) { return NewBinary(root, db) }},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			test.trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+		}
+		root, set, err := test.trie.CommitSet()
+		if err != nil {
+			t.Fatalf("%T: commit error: %v", test.trie, err)
+		}
+		// Strip the decoded nodes, as if the set was received over the wire.
+		raw := NewNodeSet()
+		for _, n := range set.Added {
+			raw.Added = append(raw.Added, &TrackedNode{Path: n.Path, Hash: n.Hash, Blob: n.Blob})
+		}
+		// Dereferencing the root must release all the nodes.
+		db := NewDatabase(memorydb.New())
+		if err := db.Update(raw); err != nil {
+			t.Fatalf("%T: update error: %v", test.trie, err)
+		}
+		db.Reference(root, NodeHash{})
+		db.Dereference(root)
+		if nodes := db.Nodes(); len(nodes) != 0 {
+			t.Errorf("%T: %d dirty nodes left after dereference", test.trie, len(nodes))
+		}
+		// Committing the root must persist all the nodes.
+		diskdb := memorydb.New()
+		db = NewDatabase(diskdb)
+		if err := db.Update(raw); err != nil {
+			t.Fatalf("%T: update error: %v", test.trie, err)
+		}
+		if err := db.Commit(root, false, nil); err != nil {
+			t.Fatalf("%T: database commit error: %v", test.trie, err)
+		}
+		trie, err := test.open(root, NewDatabase(diskdb))
+		if err != nil {
+			t.Fatalf("%T: can't reopen trie: %v", test.trie, err)
+		}
+		for i := 0; i < 100; i++ {
+			want := fmt.Sprintf("val-%d", i)
+			if have, err := trie.TryGet([]byte(fmt.Sprintf("key-%d", i))); err != nil || string(have) != want {
+				t.Fatalf("%T: get %d: have %q (%v), want %q", test.trie, i, have, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// VerifyProof checks a proof produced by ProofNodes against the trie root and
+// returns the value of key. A valid proof of a missing key yields a nil value
+// and no error. The proof nodes are hashed with the width of the root hash.
+func VerifyProof(rootHash NodeHash, key []byte, proof [][]byte) ([]byte, error) {
+	return verifyProof(rootHash, keybytesToHex(key), proof, false)
+}
+
+// VerifyBinaryProof is like VerifyProof, but checks a proof produced by the
+// ProofNodes method of a binary trie. Every branch node of the proof carries
+// the hash of the sibling subtree next to the one on the path to key.
+func VerifyBinaryProof(rootHash NodeHash, key []byte, proof [][]byte) ([]byte, error) {
+	return verifyProof(rootHash, keybytesToBinary(key), proof, true)
+}
+
+// verifyProof walks the proof along the hex or binary key path.
+func verifyProof(rootHash NodeHash, key []byte, proof [][]byte, binary bool) ([]byte, error) {
+	size := rootHash.Len()
+	if !validHashSize(size) {
+		return nil, fmt.Errorf("invalid root hash length %d", size)
+	}
+	nodes := make(map[NodeHash][]byte, len(proof))
+	for _, enc := range proof {
+		nodes[BytesToNodeHash(hashData(size, enc))] = enc
+	}
+	wantHash := rootHash
+	for i := 0; ; i++ {
+		buf := nodes[wantHash]
+		if buf == nil {
+			return nil, fmt.Errorf("proof node %d (hash %x) missing", i, wantHash)
+		}
+		n, err := decodeNode(size, wantHash.Bytes(), buf)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		rest, child, err := proofGet(n, key, binary)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		switch child := child.(type) {
+		case nil:
+			// The trie doesn't contain the key.
+			return nil, nil
+		case HashNode:
+			key = rest
+			wantHash = BytesToNodeHash(child)
+		case ValueNode:
+			return child, nil
+		}
+	}
+}
+
+// proofGet descends from a proof node towards key, through any embedded nodes,
+// and returns the remaining key with the value or hash reference reached. Only
+// nodes of the hexary or binary trie, as selected by binary, are accepted.
+func proofGet(tn Node, key []byte, binary bool) ([]byte, Node, error) {
+	for {
+		switch n := tn.(type) {
+		case *ShortNode:
+			if binary {
+				return nil, nil, fmt.Errorf("hexary node in binary proof")
+			}
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				return nil, nil, nil
+			}
+			tn = n.Val
+			key = key[len(n.Key):]
+		case *BranchNode:
+			if binary {
+				return nil, nil, fmt.Errorf("hexary node in binary proof")
+			}
+			if len(key) == 0 {
+				return nil, nil, fmt.Errorf("branch node below the key")
+			}
+			tn = n.Children[key[0]]
+			key = key[1:]
+		case *BinaryShortNode:
+			if !binary {
+				return nil, nil, fmt.Errorf("binary node in hexary proof")
+			}
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				return nil, nil, nil
+			}
+			tn = n.Val
+			key = key[len(n.Key):]
+		case *BinaryBranchNode:
+			if !binary {
+				return nil, nil, fmt.Errorf("binary node in hexary proof")
+			}
+			if len(key) == 0 {
+				return nil, nil, fmt.Errorf("branch node below the key")
+			}
+			tn = n.Children[binaryChild(key[0])]
+			key = key[1:]
+		case HashNode:
+			return key, n, nil
+		case ValueNode:
+			return nil, n, nil
+		case nil:
+			return key, nil, nil
+		default:
+			return nil, nil, fmt.Errorf("invalid node type %T", tn)
+		}
+	}
+}
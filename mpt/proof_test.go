@@ -0,0 +1,101 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestVerifyProof(t *testing.T) {
+	trie := newEmpty()
+	for i := 0; i < 500; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	// Small values get embedded, make sure those are proven as well.
+	trie.Put([]byte("a"), []byte("b"))
+	trie.Put([]byte("ab"), []byte("c"))
+	root := trie.Hash()
+
+	for _, key := range []string{"key-0", "key-250", "key-499", "a", "ab"} {
+		proof, err := trie.ProofNodes([]byte(key))
+		if err != nil {
+			t.Fatalf("%q: proof error: %v", key, err)
+		}
+		want := trie.Get([]byte(key))
+		if have, err := VerifyProof(root, []byte(key), proof); err != nil || !bytes.Equal(have, want) {
+			t.Errorf("%q: have %q (%v), want %q", key, have, err, want)
+		}
+		// Proof must match the hashes returned by Proof.
+		hashes, _ := trie.Proof([]byte(key))
+		for i := range proof {
+			if !bytes.Equal(hashData(HashSize256, proof[i]), hashes[i]) {
+				t.Errorf("%q: proof node %d hash mismatch", key, i)
+			}
+		}
+		// Any missing node invalidates the proof.
+		if _, err := VerifyProof(root, []byte(key), proof[:len(proof)-1]); err == nil {
+			t.Errorf("%q: truncated proof accepted", key)
+		}
+	}
+	// Absence of a key is provable.
+	proof, _ := trie.ProofNodes([]byte("missing"))
+	if have, err := VerifyProof(root, []byte("missing"), proof); err != nil || have != nil {
+		t.Errorf("absence proof: have %q (%v)", have, err)
+	}
+	// A proof doesn't verify against another root.
+	proof, _ = trie.ProofNodes([]byte("key-1"))
+	trie.Put([]byte("key-1"), []byte("changed"))
+	if _, err := VerifyProof(trie.Hash(), []byte("key-1"), proof); err == nil {
+		t.Error("proof verified against wrong root")
+	}
+}
+
+func TestVerifyBinaryProof(t *testing.T) {
+	trie := newEmptyBinary()
+	for i := 0; i < 500; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	trie.Put([]byte("a"), []byte("b"))
+	trie.Put([]byte("ab"), []byte("c"))
+	root := trie.Hash()
+
+	for _, key := range []string{"key-0", "key-250", "key-499", "a", "ab"} {
+		proof, err := trie.ProofNodes([]byte(key))
+		if err != nil {
+			t.Fatalf("%q: proof error: %v", key, err)
+		}
+		want := trie.Get([]byte(key))
+		if have, err := VerifyBinaryProof(root, []byte(key), proof); err != nil || !bytes.Equal(have, want) {
+			t.Errorf("%q: have %q (%v), want %q", key, have, err, want)
+		}
+		hashes, _ := trie.Proof([]byte(key))
+		for i := range proof {
+			if !bytes.Equal(hashData(HashSize256, proof[i]), hashes[i]) {
+				t.Errorf("%q: proof node %d hash mismatch", key, i)
+			}
+		}
+		if _, err := VerifyBinaryProof(root, []byte(key), proof[:len(proof)-1]); err == nil {
+			t.Errorf("%q: truncated proof accepted", key)
+		}
+		// Tampering with any node breaks the hash chain.
+		for i := range proof {
+			tampered := make([][]byte, len(proof))
+			copy(tampered, proof)
+			tampered[i] = common.CopyBytes(proof[i])
+			tampered[i][len(tampered[i])-1] ^= 0x01
+			if have, err := VerifyBinaryProof(root, []byte(key), tampered); err == nil && bytes.Equal(have, want) {
+				t.Errorf("%q: proof with tampered node %d accepted", key, i)
+			}
+		}
+		// Binary proofs don't verify as hexary ones.
+		if _, err := VerifyProof(root, []byte(key), proof); err == nil {
+			t.Errorf("%q: binary proof accepted by VerifyProof", key)
+		}
+	}
+	proof, _ := trie.ProofNodes([]byte("missing"))
+	if have, err := VerifyBinaryProof(root, []byte("missing"), proof); err != nil || have != nil {
+		t.Errorf("absence proof: have %q (%v)", have, err)
+	}
+}
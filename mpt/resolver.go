@@ -0,0 +1,93 @@
+package mpt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// defaultResolveTimeout is the time allowed for a single remote node fetch if
+// the database config doesn't specify one.
+const defaultResolveTimeout = 10 * time.Second
+
+// NodeResolver fetches trie nodes missing from the local database from another
+// source, e.g. an HTTP node service backing a thin client that only holds a
+// root. Implementations must be safe for concurrent use.
+type NodeResolver interface {
+	// Resolve returns the encoded node with the given hash. The returned blob
+	// is verified against the hash before it is used.
+	Resolve(ctx context.Context, hash NodeHash) ([]byte, error)
+}
+
+// nodeFetch is an in-flight remote node request, shared by all callers missing
+// the same node.
+type nodeFetch struct {
+	done chan struct{} // Closed when the fetch finished
+	blob []byte        // Verified node blob, set before done is closed
+	err  error         // Fetch failure, set before done is closed
+}
+
+// resolve retrieves a trie node from memory or disk, falling back to the node
+// resolver on a local miss. It returns nil if the node is missing and there is
+// no resolver to ask.
+func (db *Database) resolve(ctx context.Context, hash NodeHash) (Node, error) {
+	n, err := db.node(hash)
+	if n != nil || err != nil || db.resolver == nil {
+		return n, err
+	}
+	blob, err := db.fetch(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return decodeStoredNode(hash, blob)
+}
+
+// fetch retrieves a node blob from the node resolver. Concurrent requests for
+// the same hash are batched into a single fetch, which runs with its own
+// timeout so a caller giving up through ctx doesn't fail the others.
+func (db *Database) fetch(ctx context.Context, hash NodeHash) ([]byte, error) {
+	db.fetchLock.Lock()
+	fetch, ok := db.fetches[hash]
+	if !ok {
+		fetch = &nodeFetch{done: make(chan struct{})}
+		db.fetches[hash] = fetch
+		go db.runFetch(hash, fetch)
+	}
+	db.fetchLock.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.blob, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runFetch asks the node resolver for a node, verifies the answer and persists
+// it to the disk database so it is only ever fetched once.
+func (db *Database) runFetch(hash NodeHash, fetch *nodeFetch) {
+	defer func() {
+		db.fetchLock.Lock()
+		delete(db.fetches, hash)
+		db.fetchLock.Unlock()
+		close(fetch.done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), db.resolveTimeout)
+	defer cancel()
+
+	blob, err := db.resolver.Resolve(ctx, hash)
+	if err != nil {
+		fetch.err = err
+		return
+	}
+	if have := BytesToNodeHash(hashData(hash.Len(), blob)); have != hash {
+		fetch.err = fmt.Errorf("resolved node hashes to %x", have)
+		return
+	}
+	if err := db.diskdb.Put(hash.Bytes(), blob); err != nil {
+		log.Warn("Failed to store resolved trie node", "hash", hash, "err", err)
+	}
+	fetch.blob = blob
+}
@@ -0,0 +1,135 @@
+package mpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pavelkrolevets/mpt/ethdb"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+// testResolver is an in-process stand-in for a remote node service.
+type testResolver struct {
+	db      ethdb.KeyValueReader
+	fetches int32         // Number of Resolve calls
+	block   chan struct{} // If non-nil, Resolve waits for it to be closed
+	corrupt bool          // Whether to answer with a wrong blob
+}
+
+func (r *testResolver) Resolve(ctx context.Context, hash NodeHash) ([]byte, error) {
+	atomic.AddInt32(&r.fetches, 1)
+	if r.block != nil {
+		select {
+		case <-r.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if r.corrupt {
+		return []byte{0xc0}, nil
+	}
+	return r.db.Get(hash.Bytes())
+}
+
+// newRemoteTrie commits a trie with n keys into a fresh disk database, acting
+// as the remote side of a thin client.
+func newRemoteTrie(t *testing.T, n int) (NodeHash, *memorydb.Database) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < n; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	return root, diskdb
+}
+
+func TestResolverThinClient(t *testing.T) {
+	root, remote := newRemoteTrie(t, 200)
+	resolver := &testResolver{db: remote}
+	local := memorydb.New()
+
+	trie, err := New(root, NewDatabaseWithConfig(local, &Config{Resolver: resolver}))
+	if err != nil {
+		t.Fatalf("can't open thin trie: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		key, want := fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i)
+		if have, err := trie.TryGet([]byte(key)); err != nil || string(have) != want {
+			t.Fatalf("get %q: have %q (%v), want %q", key, have, err, want)
+		}
+	}
+	if fetches := atomic.LoadInt32(&resolver.fetches); int(fetches) != remote.Len() {
+		t.Errorf("fetch count mismatch: have %d, want %d", fetches, remote.Len())
+	}
+	// Resolved nodes are persisted, a fresh client doesn't need the resolver.
+	trie, err = New(root, NewDatabase(local))
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	if have, err := trie.TryGet([]byte("key-7")); err != nil || string(have) != "val-7" {
+		t.Errorf("get from persisted nodes: have %q (%v)", have, err)
+	}
+}
+
+func TestResolverBatchesMisses(t *testing.T) {
+	root, remote := newRemoteTrie(t, 10)
+	resolver := &testResolver{db: remote, block: make(chan struct{})}
+	db := NewDatabaseWithConfig(memorydb.New(), &Config{Resolver: resolver})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := New(root, db); err != nil {
+				t.Errorf("can't open trie: %v", err)
+			}
+		}()
+	}
+	// Let all openers queue up on the root before answering.
+	time.Sleep(50 * time.Millisecond)
+	close(resolver.block)
+	wg.Wait()
+
+	if fetches := atomic.LoadInt32(&resolver.fetches); fetches != 1 {
+		t.Errorf("concurrent misses fetched %d times, want 1", fetches)
+	}
+}
+
+func TestResolverFailures(t *testing.T) {
+	root, remote := newRemoteTrie(t, 10)
+
+	// A blob not matching the hash is rejected.
+	resolver := &testResolver{db: remote, corrupt: true}
+	_, err := New(root, NewDatabaseWithConfig(memorydb.New(), &Config{Resolver: resolver}))
+	if merr, ok := err.(*MissingNodeError); !ok || merr.Err == nil {
+		t.Errorf("expected missing node error with cause, have %v", err)
+	}
+	// A stuck resolver is timed out.
+	resolver = &testResolver{db: remote, block: make(chan struct{})}
+	config := &Config{Resolver: resolver, ResolveTimeout: 10 * time.Millisecond}
+	if _, err = New(root, NewDatabaseWithConfig(memorydb.New(), config)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, have %v", err)
+	}
+	// A cancelled trie context stops waiting for the fetch.
+	db := NewDatabaseWithConfig(memorydb.New(), &Config{Resolver: resolver})
+	trie, _ := New(NodeHash{}, db)
+	trie.root = HashNode(root.Bytes())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	trie.SetContext(ctx)
+	if _, err := trie.TryGet([]byte("key-1")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, have %v", err)
+	}
+	close(resolver.block)
+}
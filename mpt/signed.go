@@ -0,0 +1,68 @@
+package mpt
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/pavelkrolevets/mpt/gost3410"
+	"github.com/pavelkrolevets/mpt/gost3411"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+// signedRootDomain separates root signatures from any other data signed with
+// the same key.
+const signedRootDomain = "mpt signed root"
+
+// errRootSignature is returned by SignedRoot.Verify for a signature not made
+// by the given key.
+var errRootSignature = errors.New("invalid root signature")
+
+// SignedRoot is a published trie root, attributable to its signer through a
+// GOST R 34.10-2012 signature over the root, its version and its timestamp.
+// It is RLP encodable for distribution.
+type SignedRoot struct {
+	Root      NodeHash
+	Version   uint64
+	Timestamp uint64 // Unix time in seconds
+	Signature []byte // Signature of SigningHash, as produced by gost3410
+}
+
+// SignRoot creates a signed commitment to root with the given key.
+func SignRoot(prv *gost3410.PrivateKey, root NodeHash, version uint64, timestamp time.Time) (*SignedRoot, error) {
+	s := &SignedRoot{Root: root, Version: version, Timestamp: uint64(timestamp.Unix())}
+	sig, err := prv.Sign(rand.Reader, s.SigningHash(prv.Curve.PointSize()))
+	if err != nil {
+		return nil, err
+	}
+	s.Signature = sig
+	return s, nil
+}
+
+// SigningHash returns the Streebog digest of the signed fields, with the
+// digest size (32 or 64 bytes) matching the signing curve.
+func (s *SignedRoot) SigningHash(size int) []byte {
+	h := gost3411.New(size)
+	w := rlp.NewEncoderBuffer(h)
+	l := w.List()
+	w.WriteString(signedRootDomain)
+	w.WriteBytes(s.Root.Bytes())
+	w.WriteUint64(s.Version)
+	w.WriteUint64(s.Timestamp)
+	w.ListEnd(l)
+	w.Flush()
+	return h.Sum(nil)
+}
+
+// Time returns the timestamp of the commitment.
+func (s *SignedRoot) Time() time.Time {
+	return time.Unix(int64(s.Timestamp), 0)
+}
+
+// Verify checks that the commitment was signed by the given key.
+func (s *SignedRoot) Verify(pub *gost3410.PublicKey) error {
+	if !pub.Verify(s.SigningHash(pub.Curve.PointSize()), s.Signature) {
+		return errRootSignature
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package mpt
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/gost3410"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+func TestSignedRoot(t *testing.T) {
+	trie := newEmpty()
+	trie.Put([]byte("key"), []byte("value"))
+	root := trie.Hash()
+	now := time.Unix(1700000000, 0)
+
+	for _, curve := range []*gost3410.Curve{gost3410.CurveCryptoProA, gost3410.Curve512A} {
+		prv, _ := gost3410.GenerateKey(curve, rand.Reader)
+		pub := prv.PublicKey()
+
+		signed, err := SignRoot(prv, root, 7, now)
+		if err != nil {
+			t.Fatalf("%s: sign error: %v", curve.Name, err)
+		}
+		// Commitments are published RLP encoded.
+		blob, err := rlp.EncodeToBytes(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded SignedRoot
+		if err := rlp.DecodeBytes(blob, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := decoded.Verify(pub); err != nil {
+			t.Errorf("%s: valid commitment rejected: %v", curve.Name, err)
+		}
+		if decoded.Root != root || decoded.Version != 7 || !decoded.Time().Equal(now) {
+			t.Errorf("%s: commitment fields mismatch: %+v", curve.Name, decoded)
+		}
+		// Any change of the signed fields invalidates the signature.
+		for _, tamper := range []func(s *SignedRoot){
+			func(s *SignedRoot) { s.Root = CommonToNodeHash(common.Hash{1}) },
+			func(s *SignedRoot) { s.Version++ },
+			func(s *SignedRoot) { s.Timestamp++ },
+		} {
+			forged := *signed
+			tamper(&forged)
+			if forged.Verify(pub) == nil {
+				t.Errorf("%s: tampered commitment accepted: %+v", curve.Name, forged)
+			}
+		}
+		other, _ := gost3410.GenerateKey(curve, rand.Reader)
+		if signed.Verify(other.PublicKey()) == nil {
+			t.Errorf("%s: commitment accepted by another key", curve.Name)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package mpt
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TrieStats summarises the shape of a trie, hexary or binary.
+type TrieStats struct {
+	Nodes    int                // Number of stored nodes
+	Size     common.StorageSize // Total size of the stored node encodings
+	Shorts   int                // Number of short nodes, stored or embedded
+	Branches int                // Number of branch nodes, stored or embedded
+	Values   int                // Number of key-value pairs
+	Depth    int                // Number of nodes on the longest path from the root
+}
+
+// ErrStatsLimit is returned by StatsContext when the walk reaches more stored
+// nodes than allowed.
+var ErrStatsLimit = errors.New("trie stats node limit exceeded")
+
+// Stats walks every node reachable from root and collects its statistics.
+// Missing or corrupt nodes abort the walk with an error.
+func Stats(db *Database, root NodeHash) (*TrieStats, error) {
+	return StatsContext(context.Background(), db, root, 0)
+}
+
+// StatsContext is like Stats, but bounds the cost of the walk. It aborts with
+// the context's error once ctx is done, and with ErrStatsLimit when more than
+// maxNodes stored nodes are reachable. A maxNodes of zero means no limit.
+func StatsContext(ctx context.Context, db *Database, root NodeHash, maxNodes int) (*TrieStats, error) {
+	w := &statsWalker{ctx: ctx, db: db, maxNodes: maxNodes, stats: new(TrieStats)}
+	if isEmptyRoot(root, db.hashSize) {
+		return w.stats, nil
+	}
+	if err := w.walkHash(HashNode(root.Bytes()), nil, 1); err != nil {
+		return nil, err
+	}
+	return w.stats, nil
+}
+
+// statsWalker collects the statistics of a trie within the bounds of a
+// StatsContext call.
+type statsWalker struct {
+	ctx      context.Context
+	db       *Database
+	maxNodes int
+	stats    *TrieStats
+}
+
+func (w *statsWalker) walkHash(n HashNode, path []byte, depth int) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if w.maxNodes > 0 && w.stats.Nodes >= w.maxNodes {
+		return ErrStatsLimit
+	}
+	hash := BytesToNodeHash(n)
+	blob, err := w.db.Node(hash)
+	if err != nil {
+		return &MissingNodeError{NodeHash: hash, Path: common.CopyBytes(path)}
+	}
+	node, err := decodeStoredNode(hash, blob)
+	if err != nil {
+		err.(*CorruptNodeError).Path = common.CopyBytes(path)
+		return err
+	}
+	w.stats.Nodes++
+	w.stats.Size += common.StorageSize(len(blob))
+	return w.walk(node, path, depth)
+}
+
+func (w *statsWalker) walk(n Node, path []byte, depth int) error {
+	s := w.stats
+	if _, ok := n.(ValueNode); !ok && depth > s.Depth {
+		s.Depth = depth
+	}
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case ValueNode:
+		s.Values++
+		return nil
+	case HashNode:
+		return w.walkHash(n, path, depth)
+	case *ShortNode:
+		s.Shorts++
+		return w.walk(n.Val, append(path, n.Key...), depth+1)
+	case *BinaryShortNode:
+		s.Shorts++
+		return w.walk(n.Val, append(path, n.Key...), depth+1)
+	case *BranchNode:
+		s.Branches++
+		for i, child := range &n.Children {
+			if err := w.walk(child, append(path, byte(i)), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *BinaryBranchNode:
+		s.Branches++
+		for i, child := range &n.Children {
+			if err := w.walk(child, append(path, byte(i)), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return invalidNodeError(n, path)
+	}
+}
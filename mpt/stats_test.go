@@ -0,0 +1,56 @@
+package mpt
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+)
+
+func TestStats(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+	trie, _ := New(NodeHash{}, db)
+	for i := 0; i < 1000; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, _ := trie.Commit(nil)
+	db.Commit(root, false, nil)
+
+	stats, err := Stats(NewDatabase(diskdb), root)
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	var size int
+	it := diskdb.NewIterator(nil, nil)
+	for it.Next() {
+		size += len(it.Value())
+	}
+	it.Release()
+
+	if stats.Values != 1000 || stats.Nodes != diskdb.Len() || int(stats.Size) != size {
+		t.Errorf("stats mismatch: %+v, want %d nodes of %d bytes", stats, diskdb.Len(), size)
+	}
+	if stats.Branches == 0 || stats.Shorts == 0 || stats.Depth < 3 {
+		t.Errorf("implausible shape: %+v", stats)
+	}
+	if _, err := StatsContext(context.Background(), db, root, stats.Nodes); err != nil {
+		t.Errorf("stats error with node limit: %v", err)
+	}
+	if _, err := StatsContext(context.Background(), db, root, stats.Nodes-1); err != ErrStatsLimit {
+		t.Errorf("stats error %v, want ErrStatsLimit", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := StatsContext(ctx, db, root, 0); err != context.Canceled {
+		t.Errorf("stats error %v, want context.Canceled", err)
+	}
+	if stats, _ := Stats(db, emptyRoot); *stats != (TrieStats{}) {
+		t.Errorf("empty trie stats: %+v", stats)
+	}
+	diskdb.Delete(root.Bytes())
+	if _, err := Stats(NewDatabase(diskdb), root); err == nil {
+		t.Error("expected missing root error")
+	}
+}
@@ -2,59 +2,87 @@ package mpt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/pavelkrolevets/mpt/rlp"
 )
 
 
 var (
 
-	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	emptyRoot = HexToNodeHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
 	emptyState = crypto.Keccak256Hash(nil)
 )
 
 
-type iTrie interface {
-	// Get returns the value associate with the key
-	// error is returned if the key is not found.
-	Get(key []byte) ([]byte, error)
-	// Put inserts the [key,value] node in the trie
+// Trie is the surface shared by MerklePatriciaTrie and BinaryPatriciaTrie,
+// so callers can switch between the two.
+type Trie interface {
+	// Get returns the value associated with the key, logging any error.
+	Get(key []byte) []byte
+	// TryGet returns the value associated with the key. A damaged trie
+	// yields a MissingNodeError or CorruptNodeError, as do TryInsert and
+	// TryDelete.
+	TryGet(key []byte) ([]byte, error)
+	// Put inserts the [key,value] node in the trie, logging any error.
 	Put(key []byte, value []byte)
-	// Del removes a node from the trie
-	// returns an error if not found.
-	Del(key []byte) error
-	// Commit saves the trie in persistent storage
+	// TryInsert inserts the [key,value] node in the trie.
+	TryInsert(key []byte, value []byte) error
+	// Del removes a node from the trie, logging any error.
+	Del(key []byte)
+	// TryDelete removes a node from the trie.
+	TryDelete(key []byte) error
+	// Hash returns the root hash without writing to the database.
+	Hash() NodeHash
+	// Commit saves the trie in the node database
 	// and returns the trie root key.
-	Commit() []byte
+	Commit(onleaf LeafCallback) (NodeHash, error)
+	// CommitSet collapses the trie without writing to the node database and
+	// returns the root key along with the added and deleted nodes.
+	CommitSet() (NodeHash, *NodeSet, error)
 	// Proof returns the Merkle-proof associated with
 	// a node. An error is returned if the node is not found.
 	Proof(key []byte) ([][]byte, error)
+	// ProofNodes returns the encodings of the nodes proving the value of
+	// key, to be checked with VerifyProof or VerifyBinaryProof.
+	ProofNodes(key []byte) ([][]byte, error)
 }
 
+var (
+	_ Trie = (*MerklePatriciaTrie)(nil)
+	_ Trie = (*BinaryPatriciaTrie)(nil)
+)
+
 type MerklePatriciaTrie struct {
 	db   *Database
 	root Node
 	unhashed int
+	tracer  tracer            // Stored nodes resolved since the last commit
+	ctx     context.Context   // Context of resolver fetches, background if nil
+	changes map[string][]byte // Keys modified since the last commit, only tracked in archive mode
+	base    NodeHash          // Root the trie was opened at or last committed, the parent of archived commits
 }
 
 func (t *MerklePatriciaTrie) newFlag() NodeFlag {
 	return NodeFlag{dirty: true}
 }
 
-func New(root common.Hash, db *Database) (*MerklePatriciaTrie, error) {
+func New(root NodeHash, db *Database) (*MerklePatriciaTrie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &MerklePatriciaTrie{
-		db: db,
+		db:   db,
+		base: root,
 	}
-	if root != (common.Hash{}) && root != common.Hash(emptyRoot) {
-		rootnode, err := trie.resolveHash(root[:], nil)
+	if !isEmptyRoot(root, db.hashSize) {
+		if root.Len() != db.hashSize {
+			return nil, fmt.Errorf("root %x is %d bytes, database uses %d-byte hashes", root, root.Len(), db.hashSize)
+		}
+		rootnode, err := trie.resolveHash(root.Bytes(), nil)
 		if err != nil {
 			return nil, err
 		}
@@ -72,31 +100,63 @@ func (t *MerklePatriciaTrie) resolve(n Node, prefix []byte) (Node, error) {
 }
 
 func (t *MerklePatriciaTrie) resolveHash(n HashNode, prefix []byte) (Node, error) {
-	hash := common.BytesToHash(n)
-	if node := t.db.node(hash); node != nil {
+	hash := BytesToNodeHash(n)
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	node, err := t.db.resolve(ctx, hash)
+	if err != nil {
+		if cerr, ok := err.(*CorruptNodeError); ok {
+			cerr.Path = common.CopyBytes(prefix)
+			return nil, err
+		}
+		return nil, &MissingNodeError{NodeHash: hash, Path: prefix, Err: err}
+	}
+	if node != nil {
+		t.tracer.onResolve(prefix, hash)
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
 }
 
+// hashSize returns the node hash width of the trie's database, 256 bits for a
+// trie without one.
+func (t *MerklePatriciaTrie) hashSize() int {
+	if t.db == nil {
+		return HashSize256
+	}
+	return t.db.hashSize
+}
+
+// SetContext sets the context bounding node fetches from the database's node
+// resolver. Fetches are not cancelled unless a context is set.
+func (t *MerklePatriciaTrie) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
 // Hash returns the root hash of the trie. It does not write to the
 // database and can be used even if the trie doesn't have one.
-func (t *MerklePatriciaTrie) Hash() common.Hash {
+func (t *MerklePatriciaTrie) Hash() NodeHash {
 	hash, cached, _ := t.hashRoot(nil)
 	t.root = cached
-	return common.BytesToHash(hash.(HashNode))
+	return BytesToNodeHash(hash.(HashNode))
 }
 
 func (t *MerklePatriciaTrie) hashRoot(db *Database) (Node, Node, error) {
 	if t.root == nil {
-		return HashNode(emptyRoot.Bytes()), nil, nil
+		return HashNode(emptyRootHash(t.hashSize()).Bytes()), nil, nil
 	}
+	h := newHasher(t.hashSize())
+	defer returnHasherToPool(h)
 
-	hashed, cached := Hash(t.root, true)
+	hashed, cached := h.hash(t.root, true)
 	t.unhashed = 0
 	return hashed, cached, nil
 }
 
+// Put associates key with value in the trie. Errors, e.g. a missing or
+// corrupt node, are only logged; use TryInsert to handle them.
 func (t *MerklePatriciaTrie) Put(key, value []byte) {
 	if err := t.TryInsert(key, value); err != nil {
 		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
@@ -119,6 +179,7 @@ func (t *MerklePatriciaTrie) TryInsert(key, value []byte) error {
 		}
 		t.root = n
 	}
+	t.db.recordChange(&t.changes, key, value)
 	return nil
 }
 
@@ -187,56 +248,74 @@ func (t *MerklePatriciaTrie) insert(n Node, prefix, key []byte, value Node) (boo
 		return true, nn, nil
 
 	default:
-		panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		return false, nil, invalidNodeError(n, prefix)
+	}
+}
+
+// Commit writes all dirty nodes of the trie into the node database and
+// returns the root hash. In archive mode the commit is also tagged with the
+// next archive version.
+func (t *MerklePatriciaTrie) Commit(onleaf LeafCallback) (NodeHash, error) {
+	if err := t.db.archiveBase(t.base); err != nil {
+		return NodeHash{}, err
+	}
+	root, set, err := t.CommitSet()
+	if err != nil {
+		return NodeHash{}, err
+	}
+	if err := t.db.Update(set); err != nil {
+		return NodeHash{}, err
 	}
+	if onleaf != nil {
+		if err := set.reportLeaves(onleaf); err != nil {
+			return NodeHash{}, err
+		}
+	}
+	if err := t.db.archiveCommit(t.base, root, t.changes); err != nil {
+		return NodeHash{}, err
+	}
+	t.changes, t.base = nil, root
+	return root, nil
 }
 
-func (t *MerklePatriciaTrie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
+// CommitSet collapses the trie and returns its root hash along with the nodes
+// the commit added and the previously stored nodes it made obsolete. The node
+// database is left untouched, the set can be applied with Database.Update.
+func (t *MerklePatriciaTrie) CommitSet() (NodeHash, *NodeSet, error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	defer t.tracer.reset()
+
+	set := NewNodeSet()
 	if t.root == nil {
-		return emptyRoot, nil
+		set.Deleted = t.tracer.deleted(set, nil)
+		return emptyRootHash(t.hashSize()), set, nil
 	}
 	// Derive the hash for all dirty nodes first. We hold the assumption
 	// in the following procedure that all nodes are hashed.
 	rootHash := t.Hash()
-	h := newCommitter()
-	defer returnCommitterToPool(h)
 
-	// Do a quick check if we really need to commit, before we spin
-	// up goroutines. This can happen e.g. if we load a trie for reading storage
-	// values, but don't write to it.
+	// Do a quick check if we really need to commit. This can happen e.g. if
+	// we load a trie for reading storage values, but don't write to it.
 	if _, dirty := t.root.cache(); !dirty {
-		return rootHash, nil
-	}
-	var wg sync.WaitGroup
-	if onleaf != nil {
-		h.onleaf = onleaf
-		h.leafCh = make(chan *leaf, leafChanSize)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			h.commitLoop(t.db)
-		}()
-	}
-	var newRoot HashNode
-	newRoot, err = h.Commit(t.root, t.db)
-	if onleaf != nil {
-		// The leafch is created in newCommitter if there was an onleaf callback
-		// provided. The commitLoop only _reads_ from it, and the commit
-		// operation was the sole writer. Therefore, it's safe to close this
-		// channel here.
-		close(h.leafCh)
-		wg.Wait()
+		return rootHash, set, nil
 	}
+	h := newCommitter()
+	defer returnCommitterToPool(h)
+
+	newRoot, err := h.Commit(t.root)
 	if err != nil {
-		return common.Hash{}, err
+		return NodeHash{}, nil, err
 	}
+	set = h.nodes
+	set.Deleted = t.tracer.deleted(set, h.retained)
 	t.root = newRoot
-	return rootHash, nil
+	return rootHash, set, nil
 }
 
+// Del removes any existing value for key from the trie. Errors are only
+// logged; use TryDelete to handle them.
 func (t *MerklePatriciaTrie) Del(key []byte) {
 	if err := t.TryDelete(key); err != nil {
 		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
@@ -253,6 +332,7 @@ func (t *MerklePatriciaTrie) TryDelete(key []byte) error {
 		return err
 	}
 	t.root = n
+	t.db.recordChange(&t.changes, key, nil)
 	return nil
 }
 
@@ -327,7 +407,7 @@ func (t *MerklePatriciaTrie) delete(n Node, prefix, key []byte) (bool, Node, err
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
@@ -364,10 +444,12 @@ func (t *MerklePatriciaTrie) delete(n Node, prefix, key []byte) (bool, Node, err
 		return true, nn, nil
 
 	default:
-		panic(fmt.Sprintf("%T: invalid node: %v (%v)", n, n, key))
+		return false, nil, invalidNodeError(n, prefix)
 	}
 }
 
+// Get returns the value for key stored in the trie. Errors are only logged
+// and yield a nil value; use TryGet to handle them.
 func (t *MerklePatriciaTrie) Get(key []byte) []byte {
 	res, err := t.TryGet(key)
 	if err != nil {
@@ -419,13 +501,30 @@ func (t *MerklePatriciaTrie) tryGet(origNode Node, key []byte, pos int) (value [
 		value, newnode, _, err := t.tryGet(child, key, pos)
 		return value, newnode, true, err
 	default:
-		panic(fmt.Sprintf("%T: invalid node: %v", origNode, origNode))
+		return nil, origNode, false, invalidNodeError(origNode, key[:pos])
+	}
+}
+
+// Proof returns the hashes of the nodes on the path to key, root first.
+func (t *MerklePatriciaTrie) Proof(key []byte) (res [][]byte, err error) {
+	nodes, err := t.ProofNodes(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+		return nil, err
+	}
+	for _, enc := range nodes {
+		res = append(res, hashData(t.hashSize(), enc))
 	}
+	return res, nil
 }
 
-func (t *MerklePatriciaTrie) Proof (key []byte) (res [][]byte, err error) {
+// ProofNodes returns the encoded nodes on the path to key, root first, as used
+// by VerifyProof. Nodes embedded into their parent are not listed separately.
+// The proof of a missing key ends with the node showing its absence.
+func (t *MerklePatriciaTrie) ProofNodes(key []byte) ([][]byte, error) {
 	// Collect all nodes on the path to key.
 	key = keybytesToHex(key)
+	path := key
 	var nodes []Node
 	tn := t.root
 	for len(key) > 0 && tn != nil {
@@ -445,33 +544,29 @@ func (t *MerklePatriciaTrie) Proof (key []byte) (res [][]byte, err error) {
 			nodes = append(nodes, n)
 		case HashNode:
 			var err error
-			tn, err = t.resolveHash(n, nil)
+			tn, err = t.resolveHash(n, path[:len(path)-len(key)])
 			if err != nil {
-				log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
 				return nil, err
 			}
 		default:
-			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+			return nil, invalidNodeError(tn, path[:len(path)-len(key)])
 		}
 	}
+	hasher := newHasher(t.hashSize())
+	defer returnHasherToPool(hasher)
 
+	var res [][]byte
 	for i, n := range nodes {
-		var hn Node
-		n, hn = proofHash(n)
-		if hash, ok := hn.(HashNode); ok || i == 0 {
+		enc, hn := hasher.proofHash(n)
+		if _, ok := hn.(HashNode); ok || i == 0 {
 			// If the node's database encoding is a hash (or is the
 			// root node), it becomes a proof element.
-			enc, _ := rlp.EncodeToBytes(n)
-			if !ok {
-				hash = hashData(enc)
-			}
-			res = append(res, hash)
+			res = append(res, enc)
 		}
 	}
-	return res, err
+	return res, nil
 }
 
-
 func concat(s1 []byte, s2 ...byte) []byte {
 	r := make([]byte, len(s1)+len(s2))
 	copy(r, s1)
@@ -479,4 +574,4 @@ func concat(s1 []byte, s2 ...byte) []byte {
 	return r
 }
 
-type LeafCallback func(path []byte, leaf []byte, parent common.Hash) error
\ No newline at end of file
+type LeafCallback func(path []byte, leaf []byte, parent NodeHash) error
\ No newline at end of file
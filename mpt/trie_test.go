@@ -2,16 +2,16 @@ package mpt
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
 )
 
 // Used for testing
 func newEmpty() *MerklePatriciaTrie {
-	trie, _ := New(common.Hash{}, NewDatabase(memorydb.New()))
+	trie, _ := New(NodeHash{}, NewDatabase(memorydb.New()))
 	return trie
 }
 
@@ -31,7 +31,7 @@ func TestPut(t *testing.T) {
 	putString(trie, "dog", "puppy")
 	putString(trie, "dogglesworth", "cat")
 
-	exp := common.HexToHash("919b9ccfeefcaf9660884cf991fe6daddd66ad32e49ddee5a2a65ea4cb3fbceb")
+	exp := HexToNodeHash("919b9ccfeefcaf9660884cf991fe6daddd66ad32e49ddee5a2a65ea4cb3fbceb")
 	root := trie.Hash()
 	if root != exp {
 		t.Errorf("case 1: exp %x got %x", exp, root)
@@ -40,7 +40,7 @@ func TestPut(t *testing.T) {
 	trie = newEmpty()
 	putString(trie, "A", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 
-	exp = common.HexToHash("c5dd2643cdc69c74763d3f938da62aa8ac4be23420f0e0c8c0f0593368266153")
+	exp = HexToNodeHash("c5dd2643cdc69c74763d3f938da62aa8ac4be23420f0e0c8c0f0593368266153")
 	root, err := trie.Commit(nil)
 	if err != nil {
 		t.Fatalf("commit error: %v", err)
@@ -71,7 +71,7 @@ func TestDel(t *testing.T) {
 	}
 
 	hash := trie.Hash()
-	exp := common.HexToHash("3fd4e9bfe98bd6f58430e469c7a821d9bb5f89fd8aa65267735217325fa2026e")
+	exp := HexToNodeHash("3fd4e9bfe98bd6f58430e469c7a821d9bb5f89fd8aa65267735217325fa2026e")
 	if hash != exp {
 		t.Errorf("expected %x got %x", exp, hash)
 	}
@@ -162,4 +162,87 @@ func deleteString(trie *MerklePatriciaTrie, k string) {
 
 func getString(trie *MerklePatriciaTrie, k string) []byte {
 	return trie.Get([]byte(k))
-}
\ No newline at end of file
+}
+
+func TestCorruptNode(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		open := func(root NodeHash, db *Database) (Trie, error) {
+			if binary {
+				return NewBinary(root, db)
+			}
+			return New(root, db)
+		}
+		diskdb := memorydb.New()
+		db := NewDatabase(diskdb)
+		trie, _ := open(NodeHash{}, db)
+		for i := 0; i < 100; i++ {
+			trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+		}
+		root, _ := trie.Commit(nil)
+		db.Commit(root, false, nil)
+
+		// Overwrite every node below the root with a blob that doesn't decode.
+		it := diskdb.NewIterator(nil, nil)
+		for it.Next() {
+			if !bytes.Equal(it.Key(), root.Bytes()) {
+				diskdb.Put(it.Key(), []byte{0xc3, 0x01, 0x02, 0x03})
+			}
+		}
+		it.Release()
+
+		cdb := NewDatabaseWithConfig(diskdb, &Config{Cache: 1})
+		trie, err := open(root, cdb)
+		if err != nil {
+			t.Fatalf("binary %v: can't open trie: %v", binary, err)
+		}
+		check := func(op string, err error) {
+			var cerr *CorruptNodeError
+			if !errors.As(err, &cerr) {
+				t.Errorf("binary %v: %s: expected corrupt node error, have %v", binary, op, err)
+				return
+			}
+			if cerr.NodeHash == (NodeHash{}) || len(cerr.Path) == 0 || len(cerr.Stack) == 0 {
+				t.Errorf("binary %v: %s: incomplete error %+v", binary, op, cerr)
+			}
+		}
+		_, err = trie.TryGet([]byte("key-5"))
+		check("get", err)
+
+		// Reads never cache corrupt blobs, seed the clean cache with them to
+		// check that path as well.
+		it = diskdb.NewIterator(nil, nil)
+		for it.Next() {
+			if !bytes.Equal(it.Key(), root.Bytes()) {
+				cdb.cleans.Set(it.Key(), it.Value())
+			}
+		}
+		it.Release()
+		_, err = trie.TryGet([]byte("key-5"))
+		check("cached get", err)
+		check("insert", trie.TryInsert([]byte("key-5"), []byte("value")))
+		check("delete", trie.TryDelete([]byte("key-5")))
+		_, err = trie.Proof([]byte("key-5"))
+		check("proof", err)
+		if val := trie.Get([]byte("key-5")); val != nil {
+			t.Errorf("binary %v: get returned %q from corrupt trie", binary, val)
+		}
+		// A corrupt root is reported when opening the trie.
+		diskdb.Put(root.Bytes(), []byte{0xc0})
+		if _, err := open(root, NewDatabase(diskdb)); err == nil {
+			t.Errorf("binary %v: opened trie with corrupt root", binary)
+		}
+	}
+}
+
+func TestCommitInvalidNode(t *testing.T) {
+	c := newCommitter()
+	defer returnCommitterToPool(c)
+
+	var cerr *CorruptNodeError
+	if _, err := c.Commit(ValueNode("value")); !errors.As(err, &cerr) {
+		t.Fatalf("expected corrupt node error, have %v", err)
+	}
+	if _, err := estimateSize(&ShortNode{Key: []byte{1}}); err == nil {
+		t.Fatal("expected size estimate of short node without value to fail")
+	}
+}
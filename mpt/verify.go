@@ -0,0 +1,163 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+var errShortBelowShort = errors.New("short node below short node")
+
+// IntegrityError is a single problem found by Verify.
+type IntegrityError struct {
+	Path []byte   // Path of the damaged node from the root (nibbles or bits)
+	Hash NodeHash // Hash of the stored node containing the damage
+	Err  error
+}
+
+func (err *IntegrityError) Error() string {
+	return fmt.Sprintf("node %x (path %x): %v", err.Hash, err.Path, err.Err)
+}
+
+// VerifyResult is the outcome of a trie integrity check.
+type VerifyResult struct {
+	Nodes    int               // Number of stored nodes checked
+	Problems []*IntegrityError // Damage found, in the order it was encountered
+}
+
+// Verify walks every node reachable from root, hexary or binary, and checks
+// it for damage instead of panicking on it:
+//
+//   - every stored node must be present and hash to the key it is stored under
+//   - every node must decode, with valid compact key flags
+//   - a short node may not have another short node as its child
+//   - a branch node must hold at least two children, counting the value
+//   - embedded nodes must encode to less than the hash width
+//
+// Subtrees below a missing or undecodable node are skipped.
+func Verify(db *Database, root NodeHash) *VerifyResult {
+	v := &verifier{
+		db:      db,
+		visited: make(map[NodeHash]bool),
+		result:  new(VerifyResult),
+	}
+	if !isEmptyRoot(root, db.hashSize) {
+		v.verifyHash(nil, root, false)
+	}
+	return v.result
+}
+
+type verifier struct {
+	db      *Database
+	visited map[NodeHash]bool // Stored nodes already checked, true for short nodes; shared subtrees are walked once
+	result  *VerifyResult
+}
+
+func (v *verifier) report(path []byte, hash NodeHash, err error) {
+	v.result.Problems = append(v.result.Problems, &IntegrityError{
+		Path: common.CopyBytes(path),
+		Hash: hash,
+		Err:  err,
+	})
+}
+
+// verifyHash loads and checks the stored node with the given hash.
+func (v *verifier) verifyHash(path []byte, hash NodeHash, parentShort bool) {
+	if short, ok := v.visited[hash]; ok {
+		// The subtree was checked already, but maybe below another parent.
+		if parentShort && short {
+			v.report(path, hash, errShortBelowShort)
+		}
+		return
+	}
+	v.visited[hash] = false
+	v.result.Nodes++
+
+	blob, err := v.db.Node(hash)
+	if err != nil {
+		v.report(path, hash, &MissingNodeError{NodeHash: hash, Path: common.CopyBytes(path)})
+		return
+	}
+	if have := BytesToNodeHash(hashData(hash.Len(), blob)); have != hash {
+		v.report(path, hash, fmt.Errorf("blob hashes to %x", have))
+		return
+	}
+	v.visited[hash] = v.verifyBlob(path, hash, blob, parentShort)
+}
+
+// verifyBlob checks a node encoding, stored or embedded into the stored node
+// with the given hash, and descends into its children. It reports whether the
+// blob is a short node.
+func (v *verifier) verifyBlob(path []byte, hash NodeHash, blob []byte, parentShort bool) bool {
+	n, err := decodeNode(v.db.hashSize, nil, blob)
+	if err != nil {
+		v.report(path, hash, err)
+		return false
+	}
+	elems, _, _ := rlp.SplitList(blob)
+
+	switch n := n.(type) {
+	case *ShortNode, *BinaryShortNode:
+		// Compact key flags are already validated by decodeNode
+		_, rest, _ := rlp.SplitString(elems)
+		if parentShort {
+			v.report(path, hash, errShortBelowShort)
+		}
+		var key []byte
+		switch n := n.(type) {
+		case *ShortNode:
+			key = n.Key
+		case *BinaryShortNode:
+			key = n.Key
+		}
+		if !hasTerm(key) {
+			v.verifyRef(append(path, key...), hash, rest, true)
+		}
+		return true
+	case *BranchNode:
+		v.verifyBranch(path, hash, elems, n.Children[:16], n.Children[16])
+	case *BinaryBranchNode:
+		v.verifyBranch(path, hash, elems, n.Children[:2], n.Children[2])
+	}
+	return false
+}
+
+// verifyBranch checks the child count of a branch node and descends into the
+// children encoded in elems.
+func (v *verifier) verifyBranch(path []byte, hash NodeHash, elems []byte, children []Node, value Node) {
+	count := 0
+	if value != nil {
+		count++
+	}
+	for _, child := range children {
+		if child != nil {
+			count++
+		}
+	}
+	if count < 2 {
+		v.report(path, hash, fmt.Errorf("branch node with %d children", count))
+	}
+	for i := range children {
+		_, _, rest, _ := rlp.Split(elems)
+		if children[i] != nil {
+			v.verifyRef(append(path, byte(i)), hash, elems[:len(elems)-len(rest)], false)
+		}
+		elems = rest
+	}
+}
+
+// verifyRef checks a child reference, either a hash of a stored node or an
+// embedded node, in the stored node with the given hash.
+func (v *verifier) verifyRef(path []byte, hash NodeHash, ref []byte, parentShort bool) {
+	kind, val, rest, _ := rlp.Split(ref)
+	if kind == rlp.String {
+		v.verifyHash(path, BytesToNodeHash(val), parentShort)
+		return
+	}
+	if size := len(ref) - len(rest); size >= v.db.hashSize {
+		v.report(path, hash, fmt.Errorf("oversized embedded node (size is %d bytes, want size < %d)", size, v.db.hashSize))
+	}
+	v.verifyBlob(path, hash, ref[:len(ref)-len(rest)], parentShort)
+}
@@ -0,0 +1,144 @@
+package mpt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+	"github.com/pavelkrolevets/mpt/rawdb"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+func TestVerify(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		diskdb := memorydb.New()
+		db := NewDatabase(diskdb)
+
+		var trie Trie
+		if binary {
+			trie, _ = NewBinary(NodeHash{}, db)
+		} else {
+			trie, _ = New(NodeHash{}, db)
+		}
+		for i := 0; i < 500; i++ {
+			trie.Put([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+		}
+		root, _ := trie.Commit(nil)
+		if res := Verify(db, root); len(res.Problems) != 0 || res.Nodes == 0 {
+			t.Fatalf("binary %v: dirty trie: %d nodes, problems %v", binary, res.Nodes, res.Problems)
+		}
+		db.Commit(root, false, nil)
+		if res := Verify(NewDatabase(diskdb), root); len(res.Problems) != 0 {
+			t.Fatalf("binary %v: stored trie problems: %v", binary, res.Problems)
+		}
+		// Damage two nodes: drop one and swap the content of another.
+		var keys [][]byte
+		it := diskdb.NewIterator(nil, nil)
+		for it.Next() {
+			if BytesToNodeHash(it.Key()) != root {
+				keys = append(keys, common.CopyBytes(it.Key()))
+			}
+		}
+		it.Release()
+		diskdb.Delete(keys[0])
+		diskdb.Put(keys[1], []byte{0xc0})
+
+		res := Verify(NewDatabase(diskdb), root)
+		if len(res.Problems) != 2 {
+			t.Fatalf("binary %v: have %d problems, want 2: %v", binary, len(res.Problems), res.Problems)
+		}
+		for _, problem := range res.Problems {
+			switch problem.Hash {
+			case BytesToNodeHash(keys[0]):
+				if _, ok := problem.Err.(*MissingNodeError); !ok || len(problem.Path) == 0 {
+					t.Errorf("binary %v: expected missing node with path, have %v", binary, problem)
+				}
+			case BytesToNodeHash(keys[1]):
+				if !strings.Contains(problem.Error(), "blob hashes to") {
+					t.Errorf("binary %v: expected hash mismatch, have %v", binary, problem)
+				}
+			default:
+				t.Errorf("binary %v: unexpected problem %v", binary, problem)
+			}
+		}
+	}
+}
+
+// storeBlob writes the encoding of n to db, returning its hash.
+func storeBlob(db ethdb.KeyValueWriter, n interface{}) NodeHash {
+	blob, err := rlp.EncodeToBytes(n)
+	if err != nil {
+		panic(err)
+	}
+	hash := BytesToNodeHash(hashData(HashSize256, blob))
+	rawdb.WriteTrieNode(db, hash.Bytes(), blob)
+	return hash
+}
+
+func TestVerifyStructure(t *testing.T) {
+	value := ValueNode(strings.Repeat("v", 40))
+	tests := []struct {
+		name  string
+		build func(db ethdb.KeyValueWriter) NodeHash
+		want  string
+	}{
+		{
+			name: "short below short",
+			build: func(db ethdb.KeyValueWriter) NodeHash {
+				child := storeBlob(db, rawShortNode{Key: hexToCompact([]byte{1, 2, 16}), Val: value})
+				return storeBlob(db, rawShortNode{Key: hexToCompact([]byte{3}), Val: HashNode(child.Bytes())})
+			},
+			want: "short node below short node",
+		},
+		{
+			name: "shared short below short",
+			build: func(db ethdb.KeyValueWriter) NodeHash {
+				// The child is checked below the branch first, then reached again
+				// below the short node.
+				child := HashNode(storeBlob(db, rawShortNode{Key: hexToCompact([]byte{1, 2, 16}), Val: value}).Bytes())
+				var branch rawBranchNode
+				branch[1] = child
+				branch[2] = HashNode(storeBlob(db, rawShortNode{Key: hexToCompact([]byte{3}), Val: child}).Bytes())
+				return storeBlob(db, branch)
+			},
+			want: "short node below short node",
+		},
+		{
+			name: "lone branch child",
+			build: func(db ethdb.KeyValueWriter) NodeHash {
+				var branch rawBranchNode
+				branch[5] = HashNode(storeBlob(db, rawShortNode{Key: hexToCompact([]byte{1, 16}), Val: value}).Bytes())
+				return storeBlob(db, branch)
+			},
+			want: "branch node with 1 children",
+		},
+		{
+			name: "invalid compact flag",
+			build: func(db ethdb.KeyValueWriter) NodeHash {
+				return storeBlob(db, rawShortNode{Key: []byte{0x25, 0x12}, Val: value})
+			},
+			want: "padding nibble",
+		},
+		{
+			name: "oversized embedded node",
+			build: func(db ethdb.KeyValueWriter) NodeHash {
+				var branch rawBranchNode
+				branch[1] = rawShortNode{Key: hexToCompact([]byte{1, 16}), Val: ValueNode(strings.Repeat("x", 29))}
+				branch[2] = rawShortNode{Key: hexToCompact([]byte{1, 16}), Val: ValueNode("x")}
+				return storeBlob(db, branch)
+			},
+			want: "oversized embedded node",
+		},
+	}
+	for _, test := range tests {
+		diskdb := memorydb.New()
+		root := test.build(diskdb)
+		res := Verify(NewDatabase(diskdb), root)
+		if len(res.Problems) != 1 || !strings.Contains(res.Problems[0].Error(), test.want) {
+			t.Errorf("%s: have %v, want %q", test.name, res.Problems, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pavelkrolevets/mpt/ethdb"
+)
+
+// ArchiveIndexEntry is a single change of an archived key: the version it was
+// changed in and its position inside that version's change set.
+type ArchiveIndexEntry struct {
+	Version  uint64
+	Position uint32
+}
+
+// ReadArchiveVersion retrieves the latest trie version indexed by the archive,
+// or zero if nothing was archived yet.
+func ReadArchiveVersion(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(archiveVersionKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteArchiveVersion stores the latest trie version indexed by the archive.
+func WriteArchiveVersion(db ethdb.KeyValueWriter, version uint64) {
+	if err := db.Put(archiveVersionKey, encodeBlockNumber(version)); err != nil {
+		log.Crit("Failed to store archive version", "err", err)
+	}
+}
+
+// WriteArchiveIndex records that the key with the given hash was changed in
+// version, at position pos of that version's change set.
+func WriteArchiveIndex(db ethdb.KeyValueWriter, keyHash common.Hash, version uint64, pos uint32) {
+	var enc [4]byte
+	binary.BigEndian.PutUint32(enc[:], pos)
+	if err := db.Put(archiveIndexKey(keyHash, version), enc[:]); err != nil {
+		log.Crit("Failed to store archive index", "err", err)
+	}
+}
+
+// DeleteArchiveIndex removes a single archive index entry.
+func DeleteArchiveIndex(db ethdb.KeyValueWriter, keyHash common.Hash, version uint64) {
+	if err := db.Delete(archiveIndexKey(keyHash, version)); err != nil {
+		log.Crit("Failed to delete archive index", "err", err)
+	}
+}
+
+// ReadArchiveIndex returns the changes of the key with the given hash made at
+// or before version, newest first. At most limit entries are returned, a zero
+// limit returns all of them.
+func ReadArchiveIndex(db ethdb.Iteratee, keyHash common.Hash, version uint64, limit int) []ArchiveIndexEntry {
+	prefix := make([]byte, 0, len(archiveIndexPrefix)+common.HashLength)
+	prefix = append(append(prefix, archiveIndexPrefix...), keyHash.Bytes()...)
+
+	it := db.NewIterator(prefix, encodeBlockNumber(^version))
+	defer it.Release()
+
+	var entries []ArchiveIndexEntry
+	for it.Next() {
+		key, val := it.Key(), it.Value()
+		if len(key) != len(prefix)+8 || len(val) != 4 {
+			continue
+		}
+		entries = append(entries, ArchiveIndexEntry{
+			Version:  ^binary.BigEndian.Uint64(key[len(prefix):]),
+			Position: binary.BigEndian.Uint32(val),
+		})
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+	}
+	return entries
+}
@@ -75,22 +75,23 @@ func DeleteCode(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
-// ReadTrieNode retrieves the trie node of the provided hash.
-func ReadTrieNode(db ethdb.KeyValueReader, hash common.Hash) []byte {
-	data, _ := db.Get(hash.Bytes())
+// ReadTrieNode retrieves the trie node of the provided hash. Trie nodes are
+// keyed by their raw hash, which is 32 or 64 bytes wide.
+func ReadTrieNode(db ethdb.KeyValueReader, hash []byte) []byte {
+	data, _ := db.Get(hash)
 	return data
 }
 
 // WriteTrieNode writes the provided trie node database.
-func WriteTrieNode(db ethdb.KeyValueWriter, hash common.Hash, node []byte) {
-	if err := db.Put(hash.Bytes(), node); err != nil {
+func WriteTrieNode(db ethdb.KeyValueWriter, hash []byte, node []byte) {
+	if err := db.Put(hash, node); err != nil {
 		log.Crit("Failed to store trie node", "err", err)
 	}
 }
 
 // DeleteTrieNode deletes the specified trie node from the database.
-func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
-	if err := db.Delete(hash.Bytes()); err != nil {
+func DeleteTrieNode(db ethdb.KeyValueWriter, hash []byte) {
+	if err := db.Delete(hash); err != nil {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
@@ -0,0 +1,96 @@
+package rawdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// ArchiveFreezer is an append-only flat file store of trie change sets. Unlike
+// the chain freezer it holds a single table, with one item per archived trie
+// version, and is written directly by the trie database instead of being fed
+// from the key-value store in the background.
+type ArchiveFreezer struct {
+	table        *freezerTable     // Change set table, item N holds version N+1
+	instanceLock fileutil.Releaser // File-system lock to prevent double opens
+	closeOnce    sync.Once
+}
+
+// NewArchiveFreezer opens (or creates) the trie archive in datadir.
+func NewArchiveFreezer(datadir string, namespace string) (*ArchiveFreezer, error) {
+	var (
+		readMeter  = metrics.NewRegisteredMeter(namespace+"archive/read", nil)
+		writeMeter = metrics.NewRegisteredMeter(namespace+"archive/write", nil)
+		sizeGauge  = metrics.NewRegisteredGauge(namespace+"archive/size", nil)
+	)
+	// Ensure the datadir is not a symbolic link if it exists.
+	if info, err := os.Lstat(datadir); !os.IsNotExist(err) {
+		if info.Mode()&os.ModeSymlink != 0 {
+			log.Warn("Symbolic link archive database is not supported", "path", datadir)
+			return nil, errSymlinkDatadir
+		}
+	}
+	if err := os.MkdirAll(datadir, 0755); err != nil {
+		return nil, err
+	}
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return nil, err
+	}
+	table, err := newTable(datadir, freezerTrieChangesTable, readMeter, writeMeter, sizeGauge, false)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+	log.Info("Opened trie archive", "database", datadir, "items", atomic.LoadUint64(&table.items))
+	return &ArchiveFreezer{table: table, instanceLock: lock}, nil
+}
+
+// Items returns the number of change sets stored in the archive.
+func (f *ArchiveFreezer) Items() uint64 {
+	return atomic.LoadUint64(&f.table.items)
+}
+
+// Append adds the change set blob with the given item number to the end of the
+// archive. Only the next item number is accepted.
+func (f *ArchiveFreezer) Append(item uint64, blob []byte) error {
+	return f.table.Append(item, blob)
+}
+
+// Retrieve returns the change set blob with the given item number.
+func (f *ArchiveFreezer) Retrieve(item uint64) ([]byte, error) {
+	return f.table.Retrieve(item)
+}
+
+// Truncate discards all but the first items change sets.
+func (f *ArchiveFreezer) Truncate(items uint64) error {
+	return f.table.truncate(items)
+}
+
+// Sync flushes all appended change sets to disk.
+func (f *ArchiveFreezer) Sync() error {
+	return f.table.Sync()
+}
+
+// Close flushes and closes the archive table and releases the directory lock.
+func (f *ArchiveFreezer) Close() error {
+	var errs []error
+	f.closeOnce.Do(func() {
+		if err := f.table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.instanceLock.Release(); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
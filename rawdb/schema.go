@@ -63,6 +63,9 @@ var (
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// archiveVersionKey tracks the latest trie version indexed by the archive.
+	archiveVersionKey = []byte("LastArchiveVersion")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -77,6 +80,7 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	codePrefix            = []byte("c") // codePrefix + code hash -> account code
+	archiveIndexPrefix    = []byte("v") // archiveIndexPrefix + key hash + ^version (uint64 big endian) -> change set position
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
@@ -103,6 +107,9 @@ const (
 
 	// freezerDifficultyTable indicates the name of the freezer total difficulty table.
 	freezerDifficultyTable = "diffs"
+
+	// freezerTrieChangesTable indicates the name of the archive trie change set table.
+	freezerTrieChangesTable = "changes"
 )
 
 // freezerNoSnappy configures whether compression is disabled for the ancient-tables.
@@ -200,6 +207,15 @@ func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
 }
 
+// archiveIndexKey = archiveIndexPrefix + key hash + ^version (uint64 big endian)
+func archiveIndexKey(keyHash common.Hash, version uint64) []byte {
+	key := make([]byte, len(archiveIndexPrefix)+common.HashLength+8)
+	copy(key, archiveIndexPrefix)
+	copy(key[len(archiveIndexPrefix):], keyHash.Bytes())
+	binary.BigEndian.PutUint64(key[len(archiveIndexPrefix)+common.HashLength:], ^version)
+	return key
+}
+
 // codeKey = codePrefix + hash
 func codeKey(hash common.Hash) []byte {
 	return append(codePrefix, hash.Bytes()...)
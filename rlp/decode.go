@@ -27,6 +27,8 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 //lint:ignore ST1012 EOL is not an error.
@@ -75,23 +77,51 @@ type Decoder interface {
 // panics cause by huge value sizes. If you need an input limit, use
 //
 //     NewStream(r, limit).Decode(val)
+//
+// To limit the memory used for decoding untrusted input, use DecodeOptions.
 func Decode(r io.Reader, val interface{}) error {
+	return decode(r, val, DecodeOptions{})
+}
+
+// DecodeBytes parses RLP data from b into val. Please see package-level documentation for
+// the decoding rules. The input must contain exactly one value and no trailing data.
+func DecodeBytes(b []byte, val interface{}) error {
+	return decodeBytes(b, val, DecodeOptions{}, false)
+}
+
+// DecodeBytesNoCopy is like DecodeBytes, but byte slices in the decoded value
+// share memory with b instead of being copied from it. This applies to []byte
+// and RawValue values, and to the results of Stream.Bytes and Stream.Raw
+// called by DecodeRLP methods.
+//
+// The caller must not modify b while the decoded value is in use, and must not
+// write to the decoded byte slices unless b may change along with them. The
+// capacity of the slices is limited to their length, so appending to them
+// doesn't overwrite b.
+func DecodeBytesNoCopy(b []byte, val interface{}) error {
+	return decodeBytes(b, val, DecodeOptions{}, true)
+}
+
+func decode(r io.Reader, val interface{}, opts DecodeOptions) error {
 	stream := streamPool.Get().(*Stream)
-	defer streamPool.Put(stream)
+	defer putStream(stream)
 
 	stream.Reset(r, 0)
+	stream.SetOptions(opts)
 	return stream.Decode(val)
 }
 
-// DecodeBytes parses RLP data from b into val. Please see package-level documentation for
-// the decoding rules. The input must contain exactly one value and no trailing data.
-func DecodeBytes(b []byte, val interface{}) error {
+func decodeBytes(b []byte, val interface{}, opts DecodeOptions, noCopy bool) error {
 	r := bytes.NewReader(b)
 
 	stream := streamPool.Get().(*Stream)
-	defer streamPool.Put(stream)
+	defer putStream(stream)
 
 	stream.Reset(r, uint64(len(b)))
+	stream.SetOptions(opts)
+	if noCopy {
+		stream.input = b
+	}
 	if err := stream.Decode(val); err != nil {
 		return err
 	}
@@ -101,10 +131,18 @@ func DecodeBytes(b []byte, val interface{}) error {
 	return nil
 }
 
+// putStream returns s to the stream pool. It drops the references to the
+// input first, so the pool doesn't keep the caller's buffer alive.
+func putStream(s *Stream) {
+	s.r, s.input = nil, nil
+	streamPool.Put(s)
+}
+
 type decodeError struct {
-	msg string
-	typ reflect.Type
-	ctx []string
+	msg    string
+	typ    reflect.Type
+	ctx    []string
+	offset uint64 // input position of the bad value
 }
 
 func (err *decodeError) Error() string {
@@ -115,23 +153,55 @@ func (err *decodeError) Error() string {
 			ctx += err.ctx[i]
 		}
 	}
-	return fmt.Sprintf("rlp: %s for %v%s", err.msg, err.typ, ctx)
+	return fmt.Sprintf("rlp: %s at offset %d for %v%s", err.msg, err.offset, err.typ, ctx)
+}
+
+// StreamError is returned by Stream methods for invalid input, e.g. a value
+// in non-canonical encoding. It tells where in the input the value starts.
+// Unlike Validate, Stream doesn't track the list indices leading to the value.
+type StreamError struct {
+	Offset uint64 // input position of the invalid value
+	Err    error  // what is wrong with the value, e.g. ErrCanonSize
+}
+
+func (err *StreamError) Error() string {
+	return fmt.Sprintf("%v at offset %d", err.Err, err.Offset)
+}
+
+// Unwrap returns the underlying error, e.g. ErrCanonSize.
+func (err *StreamError) Unwrap() error {
+	return err.Err
+}
+
+// annotate wraps an input error returned by a Stream method into a
+// *StreamError holding the offset of the value being read. Control flow
+// errors like EOL and io.EOF are left as they are.
+func (s *Stream) annotate(err *error) {
+	switch *err {
+	case ErrExpectedString, ErrExpectedList, ErrCanonInt, ErrCanonSize, ErrElemTooLarge, ErrValueTooLarge, errUintOverflow:
+		*err = &StreamError{Offset: s.valpos, Err: *err}
+	}
 }
 
-func wrapStreamError(err error, typ reflect.Type) error {
-	switch err {
+func wrapStreamError(s *Stream, err error, typ reflect.Type) error {
+	cause, offset := err, s.valpos
+	if serr, ok := err.(*StreamError); ok {
+		cause, offset = serr.Err, serr.Offset
+	}
+	switch cause {
 	case ErrCanonInt:
-		return &decodeError{msg: "non-canonical integer (leading zero bytes)", typ: typ}
+		return &decodeError{msg: "non-canonical integer (leading zero bytes)", typ: typ, offset: offset}
 	case ErrCanonSize:
-		return &decodeError{msg: "non-canonical size information", typ: typ}
+		return &decodeError{msg: "non-canonical size information", typ: typ, offset: offset}
 	case ErrExpectedList:
-		return &decodeError{msg: "expected input list", typ: typ}
+		return &decodeError{msg: "expected input list", typ: typ, offset: offset}
 	case ErrExpectedString:
-		return &decodeError{msg: "expected input string or byte", typ: typ}
+		return &decodeError{msg: "expected input string or byte", typ: typ, offset: offset}
 	case errUintOverflow:
-		return &decodeError{msg: "input string too long", typ: typ}
+		return &decodeError{msg: "input string too long", typ: typ, offset: offset}
 	case errNotAtEOL:
-		return &decodeError{msg: "input list has too many elements", typ: typ}
+		// The first surplus element starts at the current position.
+		return &decodeError{msg: "input list has too many elements", typ: typ, offset: s.pos}
 	}
 	return err
 }
@@ -146,6 +216,7 @@ func addErrorContext(err error, ctx string) error {
 var (
 	decoderInterface = reflect.TypeOf(new(Decoder)).Elem()
 	bigInt           = reflect.TypeOf(big.Int{})
+	uint256Int       = reflect.TypeOf(uint256.Int{})
 )
 
 func makeDecoder(typ reflect.Type, tags tags) (dec decoder, err error) {
@@ -157,12 +228,18 @@ func makeDecoder(typ reflect.Type, tags tags) (dec decoder, err error) {
 		return decodeBigInt, nil
 	case typ.AssignableTo(bigInt):
 		return decodeBigIntNoPtr, nil
+	case typ == reflect.PtrTo(uint256Int):
+		return decodeUint256Ptr, nil
+	case typ == uint256Int:
+		return decodeUint256, nil
 	case kind == reflect.Ptr:
 		return makePtrDecoder(typ, tags)
 	case reflect.PtrTo(typ).Implements(decoderInterface):
 		return decodeDecoder, nil
 	case isUint(kind):
 		return decodeUint, nil
+	case tags.signed:
+		return decodeSigned, nil
 	case kind == reflect.Bool:
 		return decodeBool, nil
 	case kind == reflect.String:
@@ -173,6 +250,8 @@ func makeDecoder(typ reflect.Type, tags tags) (dec decoder, err error) {
 		return makeStructDecoder(typ)
 	case kind == reflect.Interface:
 		return decodeInterface, nil
+	case kind == reflect.Map:
+		return makeMapDecoder(typ)
 	default:
 		return nil, fmt.Errorf("rlp: type %v is not RLP-serializable", typ)
 	}
@@ -191,16 +270,26 @@ func decodeUint(s *Stream, val reflect.Value) error {
 	typ := val.Type()
 	num, err := s.uint(typ.Bits())
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	val.SetUint(num)
 	return nil
 }
 
+func decodeSigned(s *Stream, val reflect.Value) error {
+	typ := val.Type()
+	num, err := s.uint(typ.Bits())
+	if err != nil {
+		return wrapStreamError(s, err, val.Type())
+	}
+	val.SetInt(int64(num>>1) ^ -int64(num&1))
+	return nil
+}
+
 func decodeBool(s *Stream, val reflect.Value) error {
 	b, err := s.Bool()
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	val.SetBool(b)
 	return nil
@@ -209,12 +298,33 @@ func decodeBool(s *Stream, val reflect.Value) error {
 func decodeString(s *Stream, val reflect.Value) error {
 	b, err := s.Bytes()
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
+	}
+	if err := s.alloc(uint64(len(b)), s.valpos); err != nil {
+		return err
 	}
 	val.SetString(string(b))
 	return nil
 }
 
+func decodeUint256(s *Stream, val reflect.Value) error {
+	return decodeUint256Ptr(s, val.Addr())
+}
+
+func decodeUint256Ptr(s *Stream, val reflect.Value) error {
+	i, err := s.Uint256()
+	if err != nil {
+		return wrapStreamError(s, err, val.Type())
+	}
+	ptr := val.Interface().(*uint256.Int)
+	if ptr == nil {
+		ptr = new(uint256.Int)
+		val.Set(reflect.ValueOf(ptr))
+	}
+	*ptr = i
+	return nil
+}
+
 func decodeBigIntNoPtr(s *Stream, val reflect.Value) error {
 	return decodeBigInt(s, val.Addr())
 }
@@ -222,7 +332,7 @@ func decodeBigIntNoPtr(s *Stream, val reflect.Value) error {
 func decodeBigInt(s *Stream, val reflect.Value) error {
 	b, err := s.Bytes()
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	i := val.Interface().(*big.Int)
 	if i == nil {
@@ -231,7 +341,7 @@ func decodeBigInt(s *Stream, val reflect.Value) error {
 	}
 	// Reject leading zero bytes
 	if len(b) > 0 && b[0] == 0 {
-		return wrapStreamError(ErrCanonInt, val.Type())
+		return wrapStreamError(s, ErrCanonInt, val.Type())
 	}
 	i.SetBytes(b)
 	return nil
@@ -274,7 +384,7 @@ func makeListDecoder(typ reflect.Type, tag tags) (decoder, error) {
 func decodeListSlice(s *Stream, val reflect.Value, elemdec decoder) error {
 	size, err := s.List()
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	if size == 0 {
 		val.Set(reflect.MakeSlice(val.Type(), 0, 0))
@@ -295,6 +405,9 @@ func decodeSliceElems(s *Stream, val reflect.Value, elemdec decoder) error {
 			if newcap < 4 {
 				newcap = 4
 			}
+			if err := s.alloc(uint64(newcap)*uint64(val.Type().Elem().Size()), s.pos); err != nil {
+				return err
+			}
 			newv := reflect.MakeSlice(val.Type(), val.Len(), newcap)
 			reflect.Copy(newv, val)
 			val.Set(newv)
@@ -317,7 +430,7 @@ func decodeSliceElems(s *Stream, val reflect.Value, elemdec decoder) error {
 
 func decodeListArray(s *Stream, val reflect.Value, elemdec decoder) error {
 	if _, err := s.List(); err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	vlen := val.Len()
 	i := 0
@@ -329,15 +442,15 @@ func decodeListArray(s *Stream, val reflect.Value, elemdec decoder) error {
 		}
 	}
 	if i < vlen {
-		return &decodeError{msg: "input list has too few elements", typ: val.Type()}
+		return &decodeError{msg: "input list has too few elements", typ: val.Type(), offset: s.pos}
 	}
-	return wrapStreamError(s.ListEnd(), val.Type())
+	return wrapStreamError(s, s.ListEnd(), val.Type())
 }
 
 func decodeByteSlice(s *Stream, val reflect.Value) error {
 	b, err := s.Bytes()
 	if err != nil {
-		return wrapStreamError(err, val.Type())
+		return wrapStreamError(s, err, val.Type())
 	}
 	val.SetBytes(b)
 	return nil
@@ -352,19 +465,19 @@ func decodeByteArray(s *Stream, val reflect.Value) error {
 	switch kind {
 	case Byte:
 		if vlen == 0 {
-			return &decodeError{msg: "input string too long", typ: val.Type()}
+			return &decodeError{msg: "input string too long", typ: val.Type(), offset: s.valpos}
 		}
 		if vlen > 1 {
-			return &decodeError{msg: "input string too short", typ: val.Type()}
+			return &decodeError{msg: "input string too short", typ: val.Type(), offset: s.valpos}
 		}
-		bv, _ := s.Uint()
-		val.Index(0).SetUint(bv)
+		val.Index(0).SetUint(uint64(s.byteval))
+		s.kind = -1 // rearm Kind
 	case String:
 		if uint64(vlen) < size {
-			return &decodeError{msg: "input string too long", typ: val.Type()}
+			return &decodeError{msg: "input string too long", typ: val.Type(), offset: s.valpos}
 		}
 		if uint64(vlen) > size {
-			return &decodeError{msg: "input string too short", typ: val.Type()}
+			return &decodeError{msg: "input string too short", typ: val.Type(), offset: s.valpos}
 		}
 		slice := val.Slice(0, vlen).Interface().([]byte)
 		if err := s.readFull(slice); err != nil {
@@ -372,10 +485,10 @@ func decodeByteArray(s *Stream, val reflect.Value) error {
 		}
 		// Reject cases where single byte encoding should have been used.
 		if size == 1 && slice[0] < 128 {
-			return wrapStreamError(ErrCanonSize, val.Type())
+			return wrapStreamError(s, ErrCanonSize, val.Type())
 		}
 	case List:
-		return wrapStreamError(ErrExpectedString, val.Type())
+		return wrapStreamError(s, ErrExpectedString, val.Type())
 	}
 	return nil
 }
@@ -392,21 +505,156 @@ func makeStructDecoder(typ reflect.Type) (decoder, error) {
 	}
 	dec := func(s *Stream, val reflect.Value) (err error) {
 		if _, err := s.List(); err != nil {
-			return wrapStreamError(err, typ)
+			return wrapStreamError(s, err, typ)
 		}
-		for _, f := range fields {
+		for i, f := range fields {
 			err := f.info.decoder(s, val.Field(f.index))
 			if err == EOL {
-				return &decodeError{msg: "too few elements", typ: typ}
+				if f.optional {
+					// The list may end before an optional field. The
+					// fields left out of the input are zeroed.
+					for _, f := range fields[i:] {
+						fv := val.Field(f.index)
+						fv.Set(reflect.Zero(fv.Type()))
+					}
+					break
+				}
+				return &decodeError{msg: "too few elements", typ: typ, offset: s.pos}
 			} else if err != nil {
 				return addErrorContext(err, "."+typ.Field(f.index).Name)
 			}
 		}
-		return wrapStreamError(s.ListEnd(), typ)
+		return wrapStreamError(s, s.ListEnd(), typ)
 	}
 	return dec, nil
 }
 
+// makeMapDecoder creates a decoder for maps, see makeMapWriter for the
+// encoding. The keys must be in strictly ascending order of their encodings,
+// so that every map has exactly one valid encoding.
+func makeMapDecoder(typ reflect.Type) (decoder, error) {
+	if hasInterface(typ.Key()) {
+		// Interface values decode as slices, which can't be map keys.
+		return nil, fmt.Errorf("rlp: map key type %v is not decodable", typ.Key())
+	}
+	kinfo := cachedTypeInfo1(typ.Key(), tags{})
+	if kinfo.decoderErr != nil {
+		return nil, kinfo.decoderErr
+	}
+	vinfo := cachedTypeInfo1(typ.Elem(), tags{})
+	if vinfo.decoderErr != nil {
+		return nil, vinfo.decoderErr
+	}
+	set := typ.Elem() == emptyStruct
+	entrySize := uint64(typ.Key().Size() + typ.Elem().Size())
+	dec := func(s *Stream, val reflect.Value) error {
+		if _, err := s.List(); err != nil {
+			return wrapStreamError(s, err, typ)
+		}
+		m := reflect.MakeMap(typ)
+		var prev []byte
+		for i := 0; ; i++ {
+			ctx := fmt.Sprint("[", i, "]")
+			key := reflect.New(typ.Key()).Elem()
+			if set {
+				var err error
+				if prev, err = decodeMapKey(s, kinfo.decoder, key, prev); err == EOL {
+					break
+				} else if err != nil {
+					return addErrorContext(err, ctx)
+				}
+				if err := s.alloc(entrySize, s.valpos); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, reflect.Zero(typ.Elem()))
+				continue
+			}
+			if _, err := s.List(); err == EOL {
+				break
+			} else if err != nil {
+				return addErrorContext(wrapStreamError(s, err, typ), ctx)
+			}
+			offset := s.valpos
+			var err error
+			if prev, err = decodeMapKey(s, kinfo.decoder, key, prev); err == EOL {
+				return addErrorContext(&decodeError{msg: "too few elements", typ: typ, offset: s.pos}, ctx)
+			} else if err != nil {
+				return addErrorContext(err, ctx+"[0]")
+			}
+			elem := reflect.New(typ.Elem()).Elem()
+			if err := vinfo.decoder(s, elem); err == EOL {
+				return addErrorContext(&decodeError{msg: "too few elements", typ: typ, offset: s.pos}, ctx)
+			} else if err != nil {
+				return addErrorContext(err, ctx+"[1]")
+			}
+			if err := s.ListEnd(); err != nil {
+				return addErrorContext(wrapStreamError(s, err, typ), ctx)
+			}
+			if err := s.alloc(entrySize, offset); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		val.Set(m)
+		return wrapStreamError(s, s.ListEnd(), typ)
+	}
+	return dec, nil
+}
+
+// decodeMapKey decodes the next value into key. Its encoding is returned and
+// must sort after prev, the encoding of the previous key.
+func decodeMapKey(s *Stream, kdec decoder, key reflect.Value, prev []byte) ([]byte, error) {
+	enc, err := s.Raw()
+	if err != nil {
+		return nil, wrapStreamError(s, err, key.Type())
+	}
+	offset := s.valpos
+	if prev != nil {
+		switch bytes.Compare(enc, prev) {
+		case 0:
+			return nil, &decodeError{msg: "duplicate map key", typ: key.Type(), offset: offset}
+		case -1:
+			return nil, &decodeError{msg: "map keys not in ascending order", typ: key.Type(), offset: offset}
+		}
+	}
+	// The key is decoded from its encoding, adjusting error offsets.
+	ks := streamPool.Get().(*Stream)
+	defer putStream(ks)
+	ks.Reset(bytes.NewReader(enc), uint64(len(enc)))
+	ks.SetOptions(s.opts)
+	ks.depth = s.depth + len(s.stack)
+	ks.allocated = s.allocated
+	err = kdec(ks, key)
+	s.allocated = ks.allocated
+	switch err := err.(type) {
+	case nil:
+		return enc, nil
+	case *decodeError:
+		err.offset += offset
+	case *LimitError:
+		err.Offset += offset
+	}
+	return nil, err
+}
+
+// hasInterface reports whether values of typ contain interface values
+// without indirection.
+func hasInterface(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Array:
+		return hasInterface(typ.Elem())
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if hasInterface(typ.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // makePtrDecoder creates a decoder that decodes into the pointer's element type.
 func makePtrDecoder(typ reflect.Type, tag tags) (decoder, error) {
 	etype := typ.Elem()
@@ -425,6 +673,9 @@ func makeSimplePtrDecoder(etype reflect.Type, etypeinfo *typeinfo) decoder {
 	return func(s *Stream, val reflect.Value) (err error) {
 		newval := val
 		if val.IsNil() {
+			if err := s.alloc(uint64(etype.Size()), s.valpos); err != nil {
+				return err
+			}
 			newval = reflect.New(etype)
 		}
 		if err = etypeinfo.decoder(s, newval.Elem()); err == nil {
@@ -445,14 +696,15 @@ func makeNilPtrDecoder(etype reflect.Type, etypeinfo *typeinfo, nilKind Kind) de
 		kind, size, err := s.Kind()
 		if err != nil {
 			val.Set(nilPtr)
-			return wrapStreamError(err, typ)
+			return wrapStreamError(s, err, typ)
 		}
 		// Handle empty values as a nil pointer.
 		if kind != Byte && size == 0 {
 			if kind != nilKind {
 				return &decodeError{
-					msg: fmt.Sprintf("wrong kind of empty value (got %v, want %v)", kind, nilKind),
-					typ: typ,
+					msg:    fmt.Sprintf("wrong kind of empty value (got %v, want %v)", kind, nilKind),
+					typ:    typ,
+					offset: s.valpos,
 				}
 			}
 			// rearm s.Kind. This is important because the input
@@ -464,6 +716,9 @@ func makeNilPtrDecoder(etype reflect.Type, etypeinfo *typeinfo, nilKind Kind) de
 		}
 		newval := val
 		if val.IsNil() {
+			if err := s.alloc(uint64(etype.Size()), s.valpos); err != nil {
+				return err
+			}
 			newval = reflect.New(etype)
 		}
 		if err = etypeinfo.decoder(s, newval.Elem()); err == nil {
@@ -559,9 +814,23 @@ type Stream struct {
 	byteval byte   // value of single byte in type tag
 	kinderr error  // error from last readKind
 	stack   []listpos
+
+	pos    uint64 // number of bytes read since Reset
+	valpos uint64 // input position of the value ahead
+
+	// input is set by DecodeBytesNoCopy. Values are then sliced from it
+	// rather than copied.
+	input []byte
+
+	opts      DecodeOptions
+	allocated uint64 // bytes allocated since Reset, see DecodeOptions.MaxAlloc
+	depth     int    // number of lists enclosing the input, for map key streams
 }
 
-type listpos struct{ pos, size uint64 }
+type listpos struct {
+	pos, size uint64
+	elems     int // number of elements read so far
+}
 
 // NewStream creates a new decoding stream reading from r.
 //
@@ -599,7 +868,8 @@ func NewListStream(r io.Reader, len uint64) *Stream {
 // Bytes reads an RLP string and returns its contents as a byte slice.
 // If the input does not contain an RLP string, the returned
 // error will be ErrExpectedString.
-func (s *Stream) Bytes() ([]byte, error) {
+func (s *Stream) Bytes() (_ []byte, err error) {
+	defer s.annotate(&err)
 	kind, size, err := s.Kind()
 	if err != nil {
 		return nil, err
@@ -607,10 +877,13 @@ func (s *Stream) Bytes() ([]byte, error) {
 	switch kind {
 	case Byte:
 		s.kind = -1 // rearm Kind
+		if s.input != nil {
+			return s.input[s.valpos : s.valpos+1 : s.valpos+1], nil
+		}
 		return []byte{s.byteval}, nil
 	case String:
-		b := make([]byte, size)
-		if err = s.readFull(b); err != nil {
+		b, err := s.readBytes(size)
+		if err != nil {
 			return nil, err
 		}
 		if size == 1 && b[0] < 128 {
@@ -623,18 +896,32 @@ func (s *Stream) Bytes() ([]byte, error) {
 }
 
 // Raw reads a raw encoded value including RLP type information.
-func (s *Stream) Raw() ([]byte, error) {
+func (s *Stream) Raw() (_ []byte, err error) {
+	defer s.annotate(&err)
 	kind, size, err := s.Kind()
 	if err != nil {
 		return nil, err
 	}
 	if kind == Byte {
 		s.kind = -1 // rearm Kind
+		if s.input != nil {
+			return s.input[s.valpos : s.valpos+1 : s.valpos+1], nil
+		}
 		return []byte{s.byteval}, nil
 	}
+	if s.input != nil {
+		// The header is still there in front of the content.
+		if _, err := s.readBytes(size); err != nil {
+			return nil, err
+		}
+		return s.input[s.valpos:s.pos:s.pos], nil
+	}
 	// the original header has already been read and is no longer
 	// available. read content and put a new header in front of it.
 	start := headsize(size)
+	if err := s.alloc(uint64(start)+size, s.valpos); err != nil {
+		return nil, err
+	}
 	buf := make([]byte, uint64(start)+size)
 	if err := s.readFull(buf[start:]); err != nil {
 		return nil, err
@@ -650,10 +937,122 @@ func (s *Stream) Raw() ([]byte, error) {
 // Uint reads an RLP string of up to 8 bytes and returns its contents
 // as an unsigned integer. If the input does not contain an RLP string, the
 // returned error will be ErrExpectedString.
-func (s *Stream) Uint() (uint64, error) {
+func (s *Stream) Uint() (_ uint64, err error) {
+	defer s.annotate(&err)
 	return s.uint(64)
 }
 
+// Uint8 reads an RLP string of up to 1 byte and returns its contents
+// as an unsigned integer.
+func (s *Stream) Uint8() (_ uint8, err error) {
+	defer s.annotate(&err)
+	i, err := s.uint(8)
+	return uint8(i), err
+}
+
+// Uint16 reads an RLP string of up to 2 bytes and returns its contents
+// as an unsigned integer.
+func (s *Stream) Uint16() (_ uint16, err error) {
+	defer s.annotate(&err)
+	i, err := s.uint(16)
+	return uint16(i), err
+}
+
+// Uint32 reads an RLP string of up to 4 bytes and returns its contents
+// as an unsigned integer.
+func (s *Stream) Uint32() (_ uint32, err error) {
+	defer s.annotate(&err)
+	i, err := s.uint(32)
+	return uint32(i), err
+}
+
+// BigInt reads an RLP string and returns its contents as a non-negative
+// big integer. Leading zero bytes are rejected with ErrCanonInt.
+func (s *Stream) BigInt() (_ *big.Int, err error) {
+	defer s.annotate(&err)
+	b, err := s.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 0 && b[0] == 0 {
+		return nil, ErrCanonInt
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Uint256 reads an RLP string of up to 32 bytes and returns its contents as
+// a 256-bit unsigned integer. Leading zero bytes are rejected with
+// ErrCanonInt. Unlike BigInt, it doesn't allocate.
+func (s *Stream) Uint256() (_ uint256.Int, err error) {
+	defer s.annotate(&err)
+	var i uint256.Int
+	kind, size, err := s.Kind()
+	if err != nil {
+		return i, err
+	}
+	switch kind {
+	case Byte:
+		if s.byteval == 0 {
+			return i, ErrCanonInt
+		}
+		s.kind = -1 // rearm Kind
+		i.SetUint64(uint64(s.byteval))
+		return i, nil
+	case String:
+		if size > 32 {
+			return i, errUintOverflow
+		}
+		buf := s.uintbuf[:size]
+		if err := s.readFull(buf); err != nil {
+			return i, err
+		}
+		switch {
+		case size > 0 && buf[0] == 0:
+			return i, ErrCanonInt
+		case size == 1 && buf[0] < 128:
+			return i, ErrCanonSize
+		}
+		i.SetBytes(buf)
+		return i, nil
+	default:
+		return i, ErrExpectedString
+	}
+}
+
+// ReadBytes decodes the next RLP value and stores the result in b. The value
+// must be a string of exactly len(b) bytes, as when decoding into a byte
+// array.
+func (s *Stream) ReadBytes(b []byte) (err error) {
+	defer s.annotate(&err)
+	kind, size, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case Byte:
+		if len(b) != 1 {
+			return fmt.Errorf("rlp: input value has wrong size 1, want %d", len(b))
+		}
+		b[0] = s.byteval
+		s.kind = -1 // rearm Kind
+		return nil
+	case String:
+		if uint64(len(b)) != size {
+			return fmt.Errorf("rlp: input value has wrong size %d, want %d", size, len(b))
+		}
+		if err = s.readFull(b); err != nil {
+			return err
+		}
+		// Reject cases where single byte encoding should have been used.
+		if size == 1 && b[0] < 128 {
+			return ErrCanonSize
+		}
+		return nil
+	default:
+		return ErrExpectedString
+	}
+}
+
 func (s *Stream) uint(maxbits int) (uint64, error) {
 	kind, size, err := s.Kind()
 	if err != nil {
@@ -690,7 +1089,8 @@ func (s *Stream) uint(maxbits int) (uint64, error) {
 // Bool reads an RLP string of up to 1 byte and returns its contents
 // as a boolean. If the input does not contain an RLP string, the
 // returned error will be ErrExpectedString.
-func (s *Stream) Bool() (bool, error) {
+func (s *Stream) Bool() (_ bool, err error) {
+	defer s.annotate(&err)
 	num, err := s.uint(8)
 	if err != nil {
 		return false, err
@@ -709,6 +1109,7 @@ func (s *Stream) Bool() (bool, error) {
 // list, the returned error will be ErrExpectedList. When the list's
 // end has been reached, any Stream operation will return EOL.
 func (s *Stream) List() (size uint64, err error) {
+	defer s.annotate(&err)
 	kind, size, err := s.Kind()
 	if err != nil {
 		return 0, err
@@ -716,7 +1117,10 @@ func (s *Stream) List() (size uint64, err error) {
 	if kind != List {
 		return 0, ErrExpectedList
 	}
-	s.stack = append(s.stack, listpos{0, size})
+	if max := s.opts.MaxDepth; max > 0 && s.depth+len(s.stack) >= max {
+		return 0, &LimitError{Offset: s.valpos, Max: uint64(max), Err: ErrDepthLimit}
+	}
+	s.stack = append(s.stack, listpos{size: size})
 	s.kind = -1
 	s.size = 0
 	return size, nil
@@ -741,10 +1145,21 @@ func (s *Stream) ListEnd() error {
 	return nil
 }
 
+// MoreDataInList reports whether the innermost list entered with List has
+// values left to decode. It returns false at toplevel.
+func (s *Stream) MoreDataInList() bool {
+	if len(s.stack) == 0 {
+		return false
+	}
+	tos := s.stack[len(s.stack)-1]
+	return s.kind >= 0 || tos.pos < tos.size
+}
+
 // Decode decodes a value and stores the result in the value pointed
 // to by val. Please see the documentation for the Decode function
 // to learn about the decoding rules.
-func (s *Stream) Decode(val interface{}) error {
+func (s *Stream) Decode(val interface{}) (err error) {
+	defer s.annotate(&err)
 	if val == nil {
 		return errDecodeIntoNil
 	}
@@ -804,8 +1219,13 @@ func (s *Stream) Reset(r io.Reader, inputLimit uint64) {
 	s.size = 0
 	s.kind = -1
 	s.kinderr = nil
+	s.pos = 0
+	s.valpos = 0
+	s.input = nil
+	s.allocated = 0
+	s.depth = 0
 	if s.uintbuf == nil {
-		s.uintbuf = make([]byte, 8)
+		s.uintbuf = make([]byte, 32)
 	}
 	s.byteval = 0
 }
@@ -822,6 +1242,7 @@ func (s *Stream) Reset(r io.Reader, inputLimit uint64) {
 // the value. Subsequent calls to Kind (until the value is decoded)
 // will not advance the input reader and return cached information.
 func (s *Stream) Kind() (kind Kind, size uint64, err error) {
+	defer s.annotate(&err)
 	var tos *listpos
 	if len(s.stack) > 0 {
 		tos = &s.stack[len(s.stack)-1]
@@ -833,6 +1254,7 @@ func (s *Stream) Kind() (kind Kind, size uint64, err error) {
 		if tos != nil && tos.pos == tos.size {
 			return 0, 0, EOL
 		}
+		s.valpos = s.pos
 		s.kind, s.size, s.kinderr = s.readKind()
 		if s.kinderr == nil {
 			if tos == nil {
@@ -848,12 +1270,30 @@ func (s *Stream) Kind() (kind Kind, size uint64, err error) {
 				}
 			}
 		}
+		if s.kinderr == nil {
+			s.kinderr = s.checkLimits(tos)
+		}
 	}
 	// Note: this might return a sticky error generated
 	// by an earlier call to readKind.
 	return s.kind, s.size, s.kinderr
 }
 
+// checkLimits checks the value ahead, an element of tos if that isn't nil,
+// against the limits set by SetOptions.
+func (s *Stream) checkLimits(tos *listpos) error {
+	if max := s.opts.MaxStringSize; max > 0 && s.kind == String && s.size > max {
+		return &LimitError{Offset: s.valpos, Max: max, Err: ErrStringLimit}
+	}
+	if tos != nil {
+		tos.elems++
+		if max := s.opts.MaxListElems; max > 0 && tos.elems > max {
+			return &LimitError{Offset: s.valpos, Max: uint64(max), Err: ErrListElemLimit}
+		}
+	}
+	return nil
+}
+
 func (s *Stream) readKind() (kind Kind, size uint64, err error) {
 	b, err := s.readByte()
 	if err != nil {
@@ -929,7 +1369,7 @@ func (s *Stream) readUint(size byte) (uint64, error) {
 		for i := 0; i < start; i++ {
 			s.uintbuf[i] = 0
 		}
-		if err := s.readFull(s.uintbuf[start:]); err != nil {
+		if err := s.readFull(s.uintbuf[start:8]); err != nil {
 			return 0, err
 		}
 		if s.uintbuf[start] == 0 {
@@ -938,7 +1378,7 @@ func (s *Stream) readUint(size byte) (uint64, error) {
 			// ErrCanonInt in this case.
 			return 0, ErrCanonSize
 		}
-		return binary.BigEndian.Uint64(s.uintbuf), nil
+		return binary.BigEndian.Uint64(s.uintbuf[:8]), nil
 	}
 }
 
@@ -957,6 +1397,30 @@ func (s *Stream) readFull(buf []byte) (err error) {
 	return err
 }
 
+// readBytes reads n bytes. If the stream decodes without copying, the result is
+// a slice of the input.
+func (s *Stream) readBytes(n uint64) ([]byte, error) {
+	if s.input == nil {
+		if err := s.alloc(n, s.valpos); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		return b, s.readFull(b)
+	}
+	start := s.pos
+	if err := s.willRead(n); err != nil {
+		return nil, err
+	}
+	if start > uint64(len(s.input)) || n > uint64(len(s.input))-start {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// Skip the bytes in the reader.
+	if _, err := s.r.(*bytes.Reader).Seek(int64(n), io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	return s.input[start : start+n : start+n], nil
+}
+
 func (s *Stream) readByte() (byte, error) {
 	if err := s.willRead(1); err != nil {
 		return 0, err
@@ -985,5 +1449,6 @@ func (s *Stream) willRead(n uint64) error {
 		}
 		s.remaining -= n
 	}
+	s.pos += n
 	return nil
 }
@@ -45,5 +45,5 @@ func ExampleDecode_structTagTail() {
 	// Output:
 	// with 4 elements: err=<nil> val={1 2 [3 4]}
 	// with 6 elements: err=<nil> val={1 2 [3 4 5 6]}
-	// with 1 element: err="rlp: too few elements for rlp.structWithTail"
+	// with 1 element: err="rlp: too few elements at offset 2 for rlp.structWithTail"
 }
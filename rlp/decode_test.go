@@ -25,7 +25,10 @@ import (
 	"math/big"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 func TestStreamKind(t *testing.T) {
@@ -204,15 +207,18 @@ testfor:
 			fval := rs.MethodByName(call)
 			ret := fval.Call(nil)
 			err := "<nil>"
+			var errv error
 			if lastret := ret[len(ret)-1].Interface(); lastret != nil {
-				err = lastret.(error).Error()
+				errv = lastret.(error)
+				err = errv.Error()
 			}
 			if j == len(test.calls)-1 {
-				want := "<nil>"
-				if test.error != nil {
-					want = test.error.Error()
+				// Stream errors carry the offset, so compare causes.
+				match := errv == test.error
+				if errv != nil && test.error != nil {
+					match = errors.Is(errv, test.error) || err == test.error.Error()
 				}
-				if err != want {
+				if !match {
 					t.Log(test)
 					t.Errorf("test %d: last call (%s) error mismatch\ngot:  %s\nwant: %s",
 						i, call, err, test.error)
@@ -255,6 +261,116 @@ func TestStreamList(t *testing.T) {
 	}
 }
 
+func TestStreamTypedReads(t *testing.T) {
+	s := NewStream(bytes.NewReader(unhex("D5 81FF 82FFFF 83FFFFFF 8A01000000000000000000 C0")), 0)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if v, err := s.Uint8(); err != nil || v != 0xFF {
+		t.Errorf("Uint8: got %d (%v)", v, err)
+	}
+	if v, err := s.Uint16(); err != nil || v != 0xFFFF {
+		t.Errorf("Uint16: got %d (%v)", v, err)
+	}
+	if v, err := s.Uint32(); err != nil || v != 0xFFFFFF {
+		t.Errorf("Uint32: got %d (%v)", v, err)
+	}
+	if v, err := s.BigInt(); err != nil || v.Cmp(new(big.Int).Lsh(big.NewInt(1), 72)) != 0 {
+		t.Errorf("BigInt: got %v (%v)", v, err)
+	}
+	if !s.MoreDataInList() {
+		t.Error("MoreDataInList false before the last element")
+	}
+	if _, err := s.List(); err != nil {
+		t.Fatalf("inner List error: %v", err)
+	}
+	if s.MoreDataInList() {
+		t.Error("MoreDataInList true in empty list")
+	}
+	s.ListEnd()
+	if s.MoreDataInList() {
+		t.Error("MoreDataInList true at end of list")
+	}
+	s.ListEnd()
+
+	if _, err := NewStream(bytes.NewReader(unhex("83FFFFFF")), 0).Uint16(); !errors.Is(err, errUintOverflow) {
+		t.Errorf("Uint16 of 3 bytes: got error %v", err)
+	}
+	if _, err := NewStream(bytes.NewReader(unhex("820001")), 0).BigInt(); !errors.Is(err, ErrCanonInt) {
+		t.Errorf("BigInt with leading zero: got error %v", err)
+	}
+	if _, err := NewStream(bytes.NewReader(unhex("820001")), 0).Uint256(); !errors.Is(err, ErrCanonInt) {
+		t.Errorf("Uint256 with leading zero: got error %v", err)
+	}
+	long := unhex("A1010000000000000000000000000000000000000000000000000000000000000000")
+	if _, err := NewStream(bytes.NewReader(long), 0).Uint256(); !errors.Is(err, errUintOverflow) {
+		t.Errorf("Uint256 of 33 bytes: got error %v", err)
+	}
+}
+
+func TestStreamErrorOffset(t *testing.T) {
+	s := NewStream(bytes.NewReader(unhex("C401028100")), 0)
+	s.List()
+	s.Uint()
+	s.Uint()
+	_, err := s.Bytes()
+	var serr *StreamError
+	if !errors.As(err, &serr) || serr.Offset != 3 || serr.Err != ErrCanonSize {
+		t.Fatalf("got error %v, want ErrCanonSize at offset 3", err)
+	}
+	// Decode reports the offset of errors passed on by DecodeRLP methods.
+	var v struct {
+		A, B uint
+		C    testDecoderBytes
+	}
+	err = DecodeBytes(unhex("C401028100"), &v)
+	if err == nil || !strings.Contains(err.Error(), "at offset 3") {
+		t.Fatalf("got error %v, want offset 3", err)
+	}
+}
+
+type testDecoderBytes struct{}
+
+func (testDecoderBytes) DecodeRLP(s *Stream) error {
+	_, err := s.Bytes()
+	return err
+}
+
+func TestStreamReadBytes(t *testing.T) {
+	tests := []struct {
+		input string
+		size  int
+		err   string
+	}{
+		{input: "01", size: 1},
+		{input: "8180", size: 1},
+		{input: "83010203", size: 3},
+		{input: "80", size: 0},
+		{input: "8101", size: 1, err: "rlp: non-canonical size information at offset 0"},
+		{input: "01", size: 2, err: "rlp: input value has wrong size 1, want 2"},
+		{input: "83010203", size: 4, err: "rlp: input value has wrong size 3, want 4"},
+		{input: "C0", size: 0, err: "rlp: expected String or Byte at offset 0"},
+	}
+	for _, test := range tests {
+		input := unhex(test.input)
+		b := make([]byte, test.size)
+		err := NewStream(bytes.NewReader(input), 0).ReadBytes(b)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want %q", test.input, err, test.err)
+			}
+			continue
+		}
+		var want []byte
+		if err := DecodeBytes(input, &want); err != nil {
+			t.Fatal(err)
+		}
+		if err != nil || !bytes.Equal(b, want) {
+			t.Errorf("%s: got %x (%v), want %x", test.input, b, err, want)
+		}
+	}
+}
+
 func TestStreamRaw(t *testing.T) {
 	tests := []struct {
 		input  string
@@ -357,6 +473,42 @@ type tailPrivateFields struct {
 	x, y bool   //lint:ignore U1000 unused fields required for testing purposes.
 }
 
+type optionalFields struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint `rlp:"optional"`
+}
+
+type optionalAndTailField struct {
+	A    uint
+	B    uint   `rlp:"optional"`
+	Tail []uint `rlp:"tail"`
+}
+
+type optionalBigIntField struct {
+	A uint
+	B *big.Int `rlp:"optional"`
+}
+
+type optionalPtrField struct {
+	A uint
+	B *[3]byte `rlp:"optional"`
+}
+
+type optionalPtrFieldNil struct {
+	A uint
+	B *[3]byte `rlp:"optional,nil"`
+}
+
+type invalidOptional1 struct {
+	A uint `rlp:"optional"`
+	B uint
+}
+
+type invalidOptional2 struct {
+	A []uint `rlp:"optional,tail"`
+}
+
 type nilListUint struct {
 	X *uint `rlp:"nilList"`
 }
@@ -369,6 +521,21 @@ type intField struct {
 	X int
 }
 
+type signedFields struct {
+	A int8  `rlp:"signed"`
+	B int64 `rlp:"signed"`
+	C int   `rlp:"signed"`
+}
+
+type invalidSigned struct {
+	A uint `rlp:"signed"`
+}
+
+type uint256Fields struct {
+	A uint256.Int
+	B *uint256.Int
+}
+
 var (
 	veryBigInt = big.NewInt(0).Add(
 		big.NewInt(0).Lsh(big.NewInt(0xFFFFFFFFFFFFFF), 16),
@@ -394,68 +561,98 @@ var decodeTests = []decodeTest{
 	{input: "820505", ptr: new(uint32), value: uint32(0x0505)},
 	{input: "83050505", ptr: new(uint32), value: uint32(0x050505)},
 	{input: "8405050505", ptr: new(uint32), value: uint32(0x05050505)},
-	{input: "850505050505", ptr: new(uint32), error: "rlp: input string too long for uint32"},
-	{input: "C0", ptr: new(uint32), error: "rlp: expected input string or byte for uint32"},
-	{input: "00", ptr: new(uint32), error: "rlp: non-canonical integer (leading zero bytes) for uint32"},
-	{input: "8105", ptr: new(uint32), error: "rlp: non-canonical size information for uint32"},
-	{input: "820004", ptr: new(uint32), error: "rlp: non-canonical integer (leading zero bytes) for uint32"},
-	{input: "B8020004", ptr: new(uint32), error: "rlp: non-canonical size information for uint32"},
+	{input: "850505050505", ptr: new(uint32), error: "rlp: input string too long at offset 0 for uint32"},
+	{input: "C0", ptr: new(uint32), error: "rlp: expected input string or byte at offset 0 for uint32"},
+	{input: "00", ptr: new(uint32), error: "rlp: non-canonical integer (leading zero bytes) at offset 0 for uint32"},
+	{input: "8105", ptr: new(uint32), error: "rlp: non-canonical size information at offset 0 for uint32"},
+	{input: "820004", ptr: new(uint32), error: "rlp: non-canonical integer (leading zero bytes) at offset 0 for uint32"},
+	{input: "B8020004", ptr: new(uint32), error: "rlp: non-canonical size information at offset 0 for uint32"},
 
 	// slices
 	{input: "C0", ptr: new([]uint), value: []uint{}},
 	{input: "C80102030405060708", ptr: new([]uint), value: []uint{1, 2, 3, 4, 5, 6, 7, 8}},
-	{input: "F8020004", ptr: new([]uint), error: "rlp: non-canonical size information for []uint"},
+	{input: "F8020004", ptr: new([]uint), error: "rlp: non-canonical size information at offset 0 for []uint"},
 
 	// arrays
 	{input: "C50102030405", ptr: new([5]uint), value: [5]uint{1, 2, 3, 4, 5}},
-	{input: "C0", ptr: new([5]uint), error: "rlp: input list has too few elements for [5]uint"},
-	{input: "C102", ptr: new([5]uint), error: "rlp: input list has too few elements for [5]uint"},
-	{input: "C6010203040506", ptr: new([5]uint), error: "rlp: input list has too many elements for [5]uint"},
-	{input: "F8020004", ptr: new([5]uint), error: "rlp: non-canonical size information for [5]uint"},
+	{input: "C0", ptr: new([5]uint), error: "rlp: input list has too few elements at offset 1 for [5]uint"},
+	{input: "C102", ptr: new([5]uint), error: "rlp: input list has too few elements at offset 2 for [5]uint"},
+	{input: "C6010203040506", ptr: new([5]uint), error: "rlp: input list has too many elements at offset 6 for [5]uint"},
+	{input: "F8020004", ptr: new([5]uint), error: "rlp: non-canonical size information at offset 0 for [5]uint"},
 
 	// zero sized arrays
 	{input: "C0", ptr: new([0]uint), value: [0]uint{}},
-	{input: "C101", ptr: new([0]uint), error: "rlp: input list has too many elements for [0]uint"},
+	{input: "C101", ptr: new([0]uint), error: "rlp: input list has too many elements at offset 1 for [0]uint"},
 
 	// byte slices
 	{input: "01", ptr: new([]byte), value: []byte{1}},
 	{input: "80", ptr: new([]byte), value: []byte{}},
 	{input: "8D6162636465666768696A6B6C6D", ptr: new([]byte), value: []byte("abcdefghijklm")},
-	{input: "C0", ptr: new([]byte), error: "rlp: expected input string or byte for []uint8"},
-	{input: "8105", ptr: new([]byte), error: "rlp: non-canonical size information for []uint8"},
+	{input: "C0", ptr: new([]byte), error: "rlp: expected input string or byte at offset 0 for []uint8"},
+	{input: "8105", ptr: new([]byte), error: "rlp: non-canonical size information at offset 0 for []uint8"},
 
 	// byte arrays
 	{input: "02", ptr: new([1]byte), value: [1]byte{2}},
 	{input: "8180", ptr: new([1]byte), value: [1]byte{128}},
+	{input: "C20001", ptr: new([][1]byte), value: [][1]byte{{0}, {1}}},
 	{input: "850102030405", ptr: new([5]byte), value: [5]byte{1, 2, 3, 4, 5}},
 
 	// byte array errors
-	{input: "02", ptr: new([5]byte), error: "rlp: input string too short for [5]uint8"},
-	{input: "80", ptr: new([5]byte), error: "rlp: input string too short for [5]uint8"},
-	{input: "820000", ptr: new([5]byte), error: "rlp: input string too short for [5]uint8"},
-	{input: "C0", ptr: new([5]byte), error: "rlp: expected input string or byte for [5]uint8"},
-	{input: "C3010203", ptr: new([5]byte), error: "rlp: expected input string or byte for [5]uint8"},
-	{input: "86010203040506", ptr: new([5]byte), error: "rlp: input string too long for [5]uint8"},
-	{input: "8105", ptr: new([1]byte), error: "rlp: non-canonical size information for [1]uint8"},
-	{input: "817F", ptr: new([1]byte), error: "rlp: non-canonical size information for [1]uint8"},
+	{input: "02", ptr: new([5]byte), error: "rlp: input string too short at offset 0 for [5]uint8"},
+	{input: "80", ptr: new([5]byte), error: "rlp: input string too short at offset 0 for [5]uint8"},
+	{input: "820000", ptr: new([5]byte), error: "rlp: input string too short at offset 0 for [5]uint8"},
+	{input: "C0", ptr: new([5]byte), error: "rlp: expected input string or byte at offset 0 for [5]uint8"},
+	{input: "C3010203", ptr: new([5]byte), error: "rlp: expected input string or byte at offset 0 for [5]uint8"},
+	{input: "86010203040506", ptr: new([5]byte), error: "rlp: input string too long at offset 0 for [5]uint8"},
+	{input: "8105", ptr: new([1]byte), error: "rlp: non-canonical size information at offset 0 for [1]uint8"},
+	{input: "817F", ptr: new([1]byte), error: "rlp: non-canonical size information at offset 0 for [1]uint8"},
 
 	// zero sized byte arrays
 	{input: "80", ptr: new([0]byte), value: [0]byte{}},
-	{input: "01", ptr: new([0]byte), error: "rlp: input string too long for [0]uint8"},
-	{input: "8101", ptr: new([0]byte), error: "rlp: input string too long for [0]uint8"},
+	{input: "01", ptr: new([0]byte), error: "rlp: input string too long at offset 0 for [0]uint8"},
+	{input: "8101", ptr: new([0]byte), error: "rlp: input string too long at offset 0 for [0]uint8"},
 
 	// strings
 	{input: "00", ptr: new(string), value: "\000"},
 	{input: "8D6162636465666768696A6B6C6D", ptr: new(string), value: "abcdefghijklm"},
-	{input: "C0", ptr: new(string), error: "rlp: expected input string or byte for string"},
+	{input: "C0", ptr: new(string), error: "rlp: expected input string or byte at offset 0 for string"},
 
 	// big ints
 	{input: "01", ptr: new(*big.Int), value: big.NewInt(1)},
 	{input: "89FFFFFFFFFFFFFFFFFF", ptr: new(*big.Int), value: veryBigInt},
 	{input: "10", ptr: new(big.Int), value: *big.NewInt(16)}, // non-pointer also works
-	{input: "C0", ptr: new(*big.Int), error: "rlp: expected input string or byte for *big.Int"},
-	{input: "820001", ptr: new(big.Int), error: "rlp: non-canonical integer (leading zero bytes) for *big.Int"},
-	{input: "8105", ptr: new(big.Int), error: "rlp: non-canonical size information for *big.Int"},
+	{input: "C0", ptr: new(*big.Int), error: "rlp: expected input string or byte at offset 0 for *big.Int"},
+	{input: "820001", ptr: new(big.Int), error: "rlp: non-canonical integer (leading zero bytes) at offset 0 for *big.Int"},
+	{input: "8105", ptr: new(big.Int), error: "rlp: non-canonical size information at offset 0 for *big.Int"},
+
+	// uint256
+	{input: "01", ptr: new(*uint256.Int), value: uint256.NewInt(1)},
+	{input: "8180", ptr: new(*uint256.Int), value: uint256.NewInt(128)},
+	{input: "10", ptr: new(uint256.Int), value: *uint256.NewInt(16)}, // non-pointer also works
+	{
+		input: "A0FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		ptr:   new(uint256.Int),
+		value: uint256.Int{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)},
+	},
+	{
+		input: "A1010000000000000000000000000000000000000000000000000000000000000000",
+		ptr:   new(*uint256.Int),
+		error: "rlp: input string too long at offset 0 for *uint256.Int",
+	},
+	{input: "C0", ptr: new(*uint256.Int), error: "rlp: expected input string or byte at offset 0 for *uint256.Int"},
+	{input: "00", ptr: new(uint256.Int), error: "rlp: non-canonical integer (leading zero bytes) at offset 0 for *uint256.Int"},
+	{input: "820001", ptr: new(uint256.Int), error: "rlp: non-canonical integer (leading zero bytes) at offset 0 for *uint256.Int"},
+	{input: "8105", ptr: new(uint256.Int), error: "rlp: non-canonical size information at offset 0 for *uint256.Int"},
+	{
+		input: "C7820100830AFFFF",
+		ptr:   new(uint256Fields),
+		value: uint256Fields{A: *uint256.NewInt(256), B: uint256.NewInt(0xAFFFF)},
+	},
+	{
+		input: "C3808105",
+		ptr:   new(uint256Fields),
+		error: "rlp: non-canonical size information at offset 2 for *uint256.Int, decoding into (rlp.uint256Fields).B",
+	},
 
 	// structs
 	{
@@ -469,46 +666,114 @@ var decodeTests = []decodeTest{
 		value: recstruct{1, &recstruct{2, &recstruct{3, nil}}},
 	},
 
+	// maps
+	{input: "C0", ptr: new(map[string]uint), value: map[string]uint{}},
+	{input: "C6C26101C26202", ptr: new(map[string]uint), value: map[string]uint{"a": 1, "b": 2}},
+	{input: "CBC20179C2807AC482010078", ptr: new(map[uint]string), value: map[uint]string{256: "x", 1: "y", 0: "z"}},
+	{input: "C5C4C2010201", ptr: new(map[[2]uint]bool), value: map[[2]uint]bool{{1, 2}: true}},
+	{input: "C88363617483646F67", ptr: new(map[string]struct{}), value: map[string]struct{}{"cat": {}, "dog": {}}},
+	{
+		input: "C6C26101C26102",
+		ptr:   new(map[string]uint),
+		error: "rlp: duplicate map key at offset 5 for string, decoding into (map[string]uint)[1][0]",
+	},
+	{
+		input: "C6C26202C26101",
+		ptr:   new(map[string]uint),
+		error: "rlp: map keys not in ascending order at offset 5 for string, decoding into (map[string]uint)[1][0]",
+	},
+	{
+		input: "C88363617483636174",
+		ptr:   new(map[string]struct{}),
+		error: "rlp: duplicate map key at offset 5 for string, decoding into (map[string]struct {})[1]",
+	},
+	{
+		input: "C161",
+		ptr:   new(map[string]uint),
+		error: "rlp: expected input list at offset 1 for map[string]uint, decoding into (map[string]uint)[0]",
+	},
+	{
+		input: "C5C26101C162",
+		ptr:   new(map[string]uint),
+		error: "rlp: too few elements at offset 6 for map[string]uint, decoding into (map[string]uint)[1]",
+	},
+	{
+		input: "C4C3610102",
+		ptr:   new(map[string]uint),
+		error: "rlp: input list has too many elements at offset 4 for map[string]uint, decoding into (map[string]uint)[0]",
+	},
+	{
+		input: "C5C482010001",
+		ptr:   new(map[uint8]uint),
+		error: "rlp: input string too long at offset 2 for uint8, decoding into (map[uint8]uint)[0][0]",
+	},
+	{
+		input: "C3C261C0",
+		ptr:   new(map[string]uint),
+		error: "rlp: expected input string or byte at offset 3 for uint, decoding into (map[string]uint)[0][1]",
+	},
+	{input: "C0", ptr: new(map[interface{}]uint), error: "rlp: map key type interface {} is not decodable"},
+
 	// struct errors
 	{
 		input: "C0",
 		ptr:   new(simplestruct),
-		error: "rlp: too few elements for rlp.simplestruct",
+		error: "rlp: too few elements at offset 1 for rlp.simplestruct",
 	},
 	{
 		input: "C105",
 		ptr:   new(simplestruct),
-		error: "rlp: too few elements for rlp.simplestruct",
+		error: "rlp: too few elements at offset 2 for rlp.simplestruct",
 	},
 	{
 		input: "C7C50583343434C0",
 		ptr:   new([]*simplestruct),
-		error: "rlp: too few elements for rlp.simplestruct, decoding into ([]*rlp.simplestruct)[1]",
+		error: "rlp: too few elements at offset 8 for rlp.simplestruct, decoding into ([]*rlp.simplestruct)[1]",
 	},
 	{
 		input: "83222222",
 		ptr:   new(simplestruct),
-		error: "rlp: expected input list for rlp.simplestruct",
+		error: "rlp: expected input list at offset 0 for rlp.simplestruct",
 	},
 	{
 		input: "C3010101",
 		ptr:   new(simplestruct),
-		error: "rlp: input list has too many elements for rlp.simplestruct",
+		error: "rlp: input list has too many elements at offset 3 for rlp.simplestruct",
 	},
 	{
 		input: "C501C3C00000",
 		ptr:   new(recstruct),
-		error: "rlp: expected input string or byte for uint, decoding into (rlp.recstruct).Child.I",
+		error: "rlp: expected input string or byte at offset 3 for uint, decoding into (rlp.recstruct).Child.I",
 	},
 	{
 		input: "C103",
 		ptr:   new(intField),
 		error: "rlp: type int is not RLP-serializable (struct field rlp.intField.X)",
 	},
+	{
+		input: "C3017F03",
+		ptr:   new(signedFields),
+		value: signedFields{A: -1, B: -64, C: -2},
+	},
+	{
+		input: "C481FF8080",
+		ptr:   new(signedFields),
+		value: signedFields{A: -128},
+	},
+	{
+		input: "C58201008080",
+		ptr:   new(signedFields),
+		error: "rlp: input string too long at offset 1 for int8, decoding into (rlp.signedFields).A",
+	},
+	{
+		input: "C0",
+		ptr:   new(invalidSigned),
+		error: `rlp: invalid struct tag "signed" for rlp.invalidSigned.A (field type is not a signed integer)`,
+	},
 	{
 		input: "C50102C20102",
 		ptr:   new(tailUint),
-		error: "rlp: expected input string or byte for uint, decoding into (rlp.tailUint).Tail[1]",
+		error: "rlp: expected input string or byte at offset 3 for uint, decoding into (rlp.tailUint).Tail[1]",
 	},
 	{
 		input: "C0",
@@ -548,6 +813,88 @@ var decodeTests = []decodeTest{
 		error: `rlp: invalid struct tag "tail" for rlp.invalidTail2.B (field type is not slice)`,
 	},
 
+	// struct tag "optional"
+	{
+		input: "C101",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 0, 0},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 2, 0},
+	},
+	{
+		input: "C3010203",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 2, 3},
+	},
+	{
+		input: "C401020304",
+		ptr:   new(optionalFields),
+		error: "rlp: input list has too many elements at offset 4 for rlp.optionalFields",
+	},
+	{
+		input: "C0",
+		ptr:   new(optionalFields),
+		error: "rlp: too few elements at offset 1 for rlp.optionalFields",
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalAndTailField),
+		value: optionalAndTailField{A: 1},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalAndTailField),
+		value: optionalAndTailField{A: 1, B: 2, Tail: []uint{}},
+	},
+	{
+		input: "C401020304",
+		ptr:   new(optionalAndTailField),
+		value: optionalAndTailField{A: 1, B: 2, Tail: []uint{3, 4}},
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalBigIntField),
+		value: optionalBigIntField{A: 1, B: nil},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalBigIntField),
+		value: optionalBigIntField{A: 1, B: big.NewInt(2)},
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalPtrField),
+		value: optionalPtrField{A: 1},
+	},
+	{
+		input: "C20180", // not accepted because "optional" doesn't enable "nil"
+		ptr:   new(optionalPtrField),
+		error: "rlp: input string too short at offset 2 for [3]uint8, decoding into (rlp.optionalPtrField).B",
+	},
+	{
+		input: "C20180",
+		ptr:   new(optionalPtrFieldNil),
+		value: optionalPtrFieldNil{A: 1},
+	},
+	{
+		input: "C6018403040506",
+		ptr:   new(optionalPtrFieldNil),
+		error: "rlp: input string too long at offset 2 for [3]uint8, decoding into (rlp.optionalPtrFieldNil).B",
+	},
+	{
+		input: "C0",
+		ptr:   new(invalidOptional1),
+		error: `rlp: invalid struct tag "" for rlp.invalidOptional1.B (must be optional because preceding field "A" is optional)`,
+	},
+	{
+		input: "C0",
+		ptr:   new(invalidOptional2),
+		error: `rlp: invalid struct tag "tail" for rlp.invalidOptional2.A (also has "optional" tag)`,
+	},
+
 	// struct tag "-"
 	{
 		input: "C20102",
@@ -559,7 +906,7 @@ var decodeTests = []decodeTest{
 	{
 		input: "C180",
 		ptr:   new(nilListUint),
-		error: "rlp: wrong kind of empty value (got String, want List) for *uint, decoding into (rlp.nilListUint).X",
+		error: "rlp: wrong kind of empty value (got String, want List) at offset 1 for *uint, decoding into (rlp.nilListUint).X",
 	},
 	{
 		input: "C1C0",
@@ -579,7 +926,7 @@ var decodeTests = []decodeTest{
 	{
 		input: "C1C0",
 		ptr:   new(nilStringSlice),
-		error: "rlp: wrong kind of empty value (got List, want String) for *[]uint, decoding into (rlp.nilStringSlice).X",
+		error: "rlp: wrong kind of empty value (got List, want String) at offset 1 for *[]uint, decoding into (rlp.nilStringSlice).X",
 	},
 	{
 		input: "C180",
@@ -600,9 +947,9 @@ var decodeTests = []decodeTest{
 	// pointers
 	{input: "00", ptr: new(*[]byte), value: &[]byte{0}},
 	{input: "80", ptr: new(*uint), value: uintp(0)},
-	{input: "C0", ptr: new(*uint), error: "rlp: expected input string or byte for uint"},
+	{input: "C0", ptr: new(*uint), error: "rlp: expected input string or byte at offset 0 for uint"},
 	{input: "07", ptr: new(*uint), value: uintp(7)},
-	{input: "817F", ptr: new(*uint), error: "rlp: non-canonical size information for uint"},
+	{input: "817F", ptr: new(*uint), error: "rlp: non-canonical size information at offset 0 for uint"},
 	{input: "8180", ptr: new(*uint), value: uintp(0x80)},
 	{input: "C109", ptr: new(*[]uint), value: &[]uint{9}},
 	{input: "C58403030303", ptr: new(*[][]byte), value: &[][]byte{{3, 3, 3, 3}}},
@@ -627,7 +974,7 @@ var decodeTests = []decodeTest{
 	{
 		input: "c330f9c030f93030ce3030303030303030bd303030303030",
 		ptr:   new(interface{}),
-		error: "rlp: element is larger than containing list",
+		error: "rlp: element is larger than containing list at offset 2",
 	},
 }
 
@@ -690,6 +1037,110 @@ func TestDecodeWithNonByteReader(t *testing.T) {
 	})
 }
 
+func TestDecodeNoCopy(t *testing.T) {
+	runTests(t, DecodeBytesNoCopy)
+}
+
+type noCopyValues struct {
+	Byte   []byte
+	Short  []byte
+	Long   []byte
+	Raw    RawValue
+	RawStr RawValue
+	Str    string
+	List   [][]byte
+	Any    interface{}
+}
+
+func TestDecodeNoCopyAliasing(t *testing.T) {
+	want := noCopyValues{
+		Byte:   []byte{0x01},
+		Short:  []byte("dog"),
+		Long:   bytes.Repeat([]byte{0xAB}, 60),
+		Raw:    unhex("C20102"),
+		RawStr: unhex("83636174"),
+		Str:    "str",
+		List:   [][]byte{{0x7F}, []byte("cat")},
+		Any:    []interface{}{[]byte("x")},
+	}
+	input, _ := EncodeToBytes(&want)
+
+	var v noCopyValues
+	if err := DecodeBytesNoCopy(input, &v); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("decoded value mismatch\nhave %+v\nwant %+v", v, want)
+	}
+	// Slices must point into the input and end with their content.
+	for i, b := range [][]byte{v.Byte, v.Short, v.Long, v.Raw, v.RawStr, v.List[0], v.List[1], v.Any.([]interface{})[0].([]byte)} {
+		if !aliases(b, input) {
+			t.Errorf("slice %d (%x) doesn't alias the input", i, b)
+		}
+		if cap(b) != len(b) {
+			t.Errorf("slice %d has capacity %d, want %d", i, cap(b), len(b))
+		}
+	}
+	// The string doesn't change with the input.
+	for i := range input {
+		input[i] = 0
+	}
+	if v.Str != "str" {
+		t.Errorf("string changed to %q", v.Str)
+	}
+	if v.Short[0] != 0 {
+		t.Error("byte slice doesn't share memory with the input")
+	}
+}
+
+// aliases reports whether b is a part of input.
+func aliases(b, input []byte) bool {
+	for i := range input {
+		if &input[i] == &b[0] {
+			return i+len(b) <= len(input)
+		}
+	}
+	return false
+}
+
+// TestDecodeNoCopyConcurrent decodes the same input from several goroutines.
+// Run with -race: readers of the shared input must not race.
+func TestDecodeNoCopyConcurrent(t *testing.T) {
+	input, _ := EncodeToBytes([][]byte{[]byte("dog"), bytes.Repeat([]byte{1}, 100), {}})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var v [][]byte
+				if err := DecodeBytesNoCopy(input, &v); err != nil {
+					t.Errorf("decode error: %v", err)
+					return
+				}
+				if len(v) != 3 || string(v[0]) != "dog" || len(v[1]) != 100 {
+					t.Errorf("wrong value %x", v)
+					return
+				}
+				// Appending must not write into the input.
+				v[0] = append(v[0], 's')
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPutStreamReleasesInput(t *testing.T) {
+	input, _ := EncodeToBytes([]byte("dog"))
+	s := new(Stream)
+	s.Reset(bytes.NewReader(input), uint64(len(input)))
+	s.input = input
+	putStream(s)
+	if s.r != nil || s.input != nil {
+		t.Error("pooled stream still references the input")
+	}
+}
+
 func TestDecodeStreamReset(t *testing.T) {
 	s := NewStream(nil, 0)
 	runTests(t, func(input []byte, into interface{}) error {
@@ -893,6 +1344,71 @@ func BenchmarkDecode(b *testing.B) {
 	}
 }
 
+func BenchmarkDecodeByteSlices(b *testing.B) {
+	for _, nocopy := range []bool{false, true} {
+		b.Run(fmt.Sprintf("nocopy=%t", nocopy), func(b *testing.B) {
+			values := make([][]byte, 1000)
+			for i := range values {
+				values[i] = bytes.Repeat([]byte{byte(i)}, 100)
+			}
+			enc, _ := EncodeToBytes(values)
+			b.SetBytes(int64(len(enc)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				var s [][]byte
+				var err error
+				if nocopy {
+					err = DecodeBytesNoCopy(enc, &s)
+				} else {
+					err = DecodeBytes(enc, &s)
+				}
+				if err != nil {
+					b.Fatalf("Decode error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeBalances(b *testing.B) {
+	type bigAccount struct {
+		Nonce   uint64
+		Balance *big.Int
+	}
+	type uint256Account struct {
+		Nonce   uint64
+		Balance uint256.Int
+	}
+	accounts := make([]bigAccount, 1000)
+	for i := range accounts {
+		accounts[i] = bigAccount{uint64(i), new(big.Int).Lsh(big.NewInt(int64(i+1)), 100)}
+	}
+	enc, _ := EncodeToBytes(accounts)
+
+	b.Run("big", func(b *testing.B) {
+		b.SetBytes(int64(len(enc)))
+		b.ReportAllocs()
+		var s []bigAccount
+		for i := 0; i < b.N; i++ {
+			if err := DecodeBytes(enc, &s); err != nil {
+				b.Fatalf("Decode error: %v", err)
+			}
+		}
+	})
+	b.Run("uint256", func(b *testing.B) {
+		b.SetBytes(int64(len(enc)))
+		b.ReportAllocs()
+		var s []uint256Account
+		for i := 0; i < b.N; i++ {
+			if err := DecodeBytes(enc, &s); err != nil {
+				b.Fatalf("Decode error: %v", err)
+			}
+		}
+	})
+}
+
 func BenchmarkDecodeIntSliceReuse(b *testing.B) {
 	enc := encodeTestSlice(100000)
 	b.SetBytes(int64(len(enc)))
@@ -33,7 +33,8 @@ Encoding Rules
 Package rlp uses reflection and encodes RLP based on the Go type of the value.
 
 If the type implements the Encoder interface, Encode calls EncodeRLP. It does not
-call EncodeRLP on nil pointer values.
+call EncodeRLP on nil pointer values. EncodeRLP implementations can write their
+output incrementally through an EncoderBuffer created from the writer they're given.
 
 To encode a pointer, the value being pointed to is encoded. A nil pointer to a struct
 type, slice or array always encodes as an empty RLP list unless the slice or array has
@@ -49,14 +50,22 @@ as an RLP string.
 A Go string is encoded as an RLP string.
 
 An unsigned integer value is encoded as an RLP string. Zero always encodes as an empty RLP
-string. big.Int values are treated as integers. Signed integers (int, int8, int16, ...)
-are not supported and will return an error when encoding.
+string. big.Int and uint256.Int values are treated as integers; uint256.Int encodes
+exactly like a big.Int of the same value but doesn't allocate. Signed integers (int, int8,
+int16, ...) are not supported and will return an error when encoding, unless they are
+struct fields carrying the "signed" tag.
 
 Boolean values are encoded as the unsigned integers zero (false) and one (true).
 
 An interface value encodes as the value contained in the interface.
 
-Floating point numbers, maps, channels and functions are not supported.
+A map is encoded as an RLP list of [key, value] pairs, one for each entry. The pairs are
+sorted by the bytes of the encoded keys, so the encoding doesn't depend on the iteration
+order. Maps with element type struct{} are sets and encode as the sorted list of their
+keys. A nil map encodes like an empty one. Encoding fails if distinct keys have the same
+encoding, such as pointers to equal values.
+
+Floating point numbers, channels and functions are not supported.
 
 
 Decoding Rules
@@ -86,29 +95,64 @@ as-is and will not necessarily be valid UTF-8.
 To decode into an unsigned integer type, the input must also be an RLP string. The bytes
 are interpreted as a big endian representation of the integer. If the RLP string is larger
 than the bit size of the type, decoding will return an error. Decode also supports
-*big.Int. There is no size limit for big integers.
+*big.Int and uint256.Int. There is no size limit for big integers; uint256.Int accepts at
+most 32 bytes.
 
 To decode into a boolean, the input must contain an unsigned integer of value zero (false)
 or one (true).
 
+To decode into a map, the input must be a list of [key, value] pairs, or a list of keys
+for sets. The encoded keys must be in strictly ascending order, which rejects duplicates
+and keeps the encoding of every map unique. Decoding always creates a new map. Keys can't
+be of interface type or contain interface values.
+
 To decode into an interface value, one of these types is stored in the value:
 
 	  []interface{}, for RLP lists
 	  []byte, for RLP strings
 
 Non-empty interface types are not supported when decoding.
-Signed integers, floating point numbers, maps, channels and functions cannot be decoded into.
+Signed integers without the "signed" tag, floating point numbers, channels and functions
+cannot be decoded into.
 
 
 Struct Tags
 
-Package rlp honours certain struct tags: "-", "tail", "nil", "nilList" and "nilString".
+Package rlp honours certain struct tags: "-", "tail", "optional", "signed", "nil",
+"nilList" and "nilString".
 
 The "-" tag ignores fields.
 
 The "tail" tag, which may only be used on the last exported struct field, allows slurping
 up any excess list elements into a slice. See examples for more details.
 
+The "optional" tag says that the field may be omitted if it is zero-valued. If this tag is
+used on a struct field, all subsequent public fields must also be declared optional or
+carry the "tail" tag. This lets new fields be appended to a persisted struct while
+records written before the change still decode.
+
+When encoding a struct with optional fields, the output RLP list contains all values up to
+the last non-zero optional field.
+
+When decoding into a struct, optional fields may be omitted from the end of the input
+list. For the example below, this means input lists of one, two, or three elements are
+accepted.
+
+    type StructWithOptionalFields struct {
+        Required  uint64
+        Optional1 uint64 `rlp:"optional"`
+        Optional2 uint64 `rlp:"optional"`
+    }
+
+The "signed" tag applies to fields of type int, int8, int16, int32 and int64. It encodes
+the value as an unsigned integer using the zigzag mapping, which interleaves negative
+and non-negative numbers so that small magnitudes stay short:
+
+    0 => 0, -1 => 1, 1 => 2, -2 => 3, 2 => 4, ...
+
+That is, n is stored as (n << 1) ^ (n >> 63). Decoding inverts the mapping and rejects
+inputs that don't fit into the field's bit size, just like for unsigned integers.
+
 The "nil" tag applies to pointer-typed fields and changes the decoding rules for the field
 such that input values of size zero decode as a nil pointer. This tag can be useful when
 decoding recursive types.
@@ -126,5 +170,23 @@ an empty RLP list.
 The choice of null value can be made explicit with the "nilList" and "nilString" struct
 tags. Using these tags encodes/decodes a Go nil pointer value as the kind of empty
 RLP value defined by the tag.
+
+Decoding into []byte and RawValue copies the input. DecodeBytesNoCopy avoids the copies by
+returning slices of the input buffer instead; see its documentation for the rules on sharing
+the buffer.
+
+Decoding errors name the input offset of the offending value, and so do the errors of
+Stream methods, which are of type *StreamError. Only Validate also reports the path of list
+indices leading to the value. To check that input is canonical RLP without decoding it into
+Go values, use Validate.
+
+Input from untrusted sources should be decoded with DecodeOptions. They limit the nesting
+depth of lists, the number of elements per list, the size of strings and the total memory
+allocated for the decoded value. HardenedOptions returns limits suitable for network
+input. Exceeding a limit makes decoding fail with a *LimitError.
+
+Encoded values can also be inspected and patched without Go types. Walk visits every item
+with its kind, offset and nesting depth. Select returns the encoding of the item at a path
+of list indices, and Replace substitutes it, encoding only the enclosing list headers anew.
 */
 package rlp
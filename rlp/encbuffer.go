@@ -0,0 +1,180 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/pavelkrolevets/mpt/uint256"
+)
+
+// EncoderBuffer encodes RLP incrementally: lists are opened and closed and
+// their elements written one by one, without building the Go value first.
+// List headers need the size of their content, so the encoding is buffered
+// until Flush.
+//
+// The zero value is not ready for use. Create buffers with NewEncoderBuffer,
+// or call Reset. The internal buffer comes from a pool and is returned to it
+// by Flush.
+//
+// EncodeRLP implementations can pass their io.Writer to NewEncoderBuffer.
+// When called by Encode, the returned buffer then appends to the output of the
+// enclosing value without copying.
+//
+//	func (r *Receipts) EncodeRLP(w io.Writer) error {
+//		buf := rlp.NewEncoderBuffer(w)
+//		l := buf.List()
+//		for _, receipt := range r.list {
+//			if err := rlp.Encode(buf, receipt); err != nil {
+//				return err
+//			}
+//		}
+//		buf.ListEnd(l)
+//		return buf.Flush()
+//	}
+type EncoderBuffer struct {
+	buf       *encbuf
+	dst       io.Writer
+	ownBuffer bool
+}
+
+// NewEncoderBuffer creates a buffer writing its output to dst. Dst may be nil
+// if the output is retrieved with ToBytes or AppendToBytes.
+func NewEncoderBuffer(dst io.Writer) EncoderBuffer {
+	var w EncoderBuffer
+	w.Reset(dst)
+	return w
+}
+
+// Reset truncates the buffer and sets the output destination.
+func (w *EncoderBuffer) Reset(dst io.Writer) {
+	if w.buf != nil && !w.ownBuffer {
+		panic("rlp: can't Reset derived EncoderBuffer")
+	}
+	// If the destination is an encoder buffer itself, append to it.
+	if outer := encbufFromWriter(dst); outer != nil {
+		*w = EncoderBuffer{buf: outer}
+		return
+	}
+	if w.buf == nil {
+		w.buf = encbufPool.Get().(*encbuf)
+		w.ownBuffer = true
+	}
+	w.buf.reset()
+	w.dst = dst
+}
+
+// Flush writes the encoded data to the output destination and releases the
+// buffer. It may only be called once; call Reset to reuse the EncoderBuffer.
+func (w *EncoderBuffer) Flush() error {
+	var err error
+	if w.dst != nil {
+		err = w.buf.toWriter(w.dst)
+	}
+	if w.ownBuffer {
+		encbufPool.Put(w.buf)
+	}
+	*w = EncoderBuffer{}
+	return err
+}
+
+// ToBytes returns a copy of the encoded data.
+func (w EncoderBuffer) ToBytes() []byte {
+	return w.buf.toBytes()
+}
+
+// AppendToBytes appends the encoded data to dst.
+func (w EncoderBuffer) AppendToBytes(dst []byte) []byte {
+	return w.buf.appendTo(dst)
+}
+
+// Write appends b to the output as is. It is meant for data that is already
+// RLP encoded.
+func (w EncoderBuffer) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// WriteBool encodes b as the integer 0 (false) or 1 (true).
+func (w EncoderBuffer) WriteBool(b bool) {
+	if b {
+		w.buf.str = append(w.buf.str, 0x01)
+	} else {
+		w.buf.str = append(w.buf.str, 0x80)
+	}
+}
+
+// WriteUint64 encodes an unsigned integer.
+func (w EncoderBuffer) WriteUint64(i uint64) {
+	w.buf.encodeUint(i)
+}
+
+// WriteBigInt encodes a big integer. It panics if i is negative, callers must
+// reject negative values themselves, e.g. by returning ErrNegativeBigInt.
+func (w EncoderBuffer) WriteBigInt(i *big.Int) {
+	if i.Sign() < 0 {
+		panic(ErrNegativeBigInt)
+	}
+	w.buf.str = appendBigInt(w.buf.str, i)
+}
+
+// WriteUint256 encodes a 256-bit unsigned integer.
+func (w EncoderBuffer) WriteUint256(i *uint256.Int) {
+	w.buf.str = AppendUint256(w.buf.str, i)
+}
+
+// WriteBytes encodes b as an RLP string.
+func (w EncoderBuffer) WriteBytes(b []byte) {
+	w.buf.encodeString(b)
+}
+
+// WriteString encodes s as an RLP string.
+func (w EncoderBuffer) WriteString(s string) {
+	if len(s) == 1 && s[0] <= 0x7F {
+		// fits single byte, no string header
+		w.buf.str = append(w.buf.str, s[0])
+	} else {
+		w.buf.encodeStringHeader(len(s))
+		w.buf.str = append(w.buf.str, s...)
+	}
+}
+
+// List starts a list and returns its index. Write the list content and call
+// ListEnd with the index to finish the list.
+func (w EncoderBuffer) List() int {
+	return w.buf.list()
+}
+
+// ListEnd finishes the list with the given index.
+func (w EncoderBuffer) ListEnd(index int) {
+	w.buf.listEnd(index)
+}
+
+// encbufFromWriter returns the encbuf behind w, if w is one or an
+// EncoderBuffer.
+func encbufFromWriter(w io.Writer) *encbuf {
+	switch w := w.(type) {
+	case *encbuf:
+		return w
+	case EncoderBuffer:
+		return w.buf
+	case *EncoderBuffer:
+		return w.buf
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/pavelkrolevets/mpt/uint256"
+)
+
+// bufferEncoder encodes its fields through an EncoderBuffer.
+type bufferEncoder struct {
+	A    uint64
+	B    *big.Int
+	U    *uint256.Int
+	C    []byte
+	D    string
+	E    bool
+	Raw  RawValue
+	List []interface{}
+}
+
+// plainBufferEncoder has the layout of bufferEncoder but no EncodeRLP method.
+type plainBufferEncoder bufferEncoder
+
+func (e *bufferEncoder) EncodeRLP(w io.Writer) error {
+	buf := NewEncoderBuffer(w)
+	l := buf.List()
+	buf.WriteUint64(e.A)
+	buf.WriteBigInt(e.B)
+	buf.WriteUint256(e.U)
+	buf.WriteBytes(e.C)
+	buf.WriteString(e.D)
+	buf.WriteBool(e.E)
+	buf.Write(e.Raw)
+	inner := buf.List()
+	for _, v := range e.List {
+		if err := Encode(buf, v); err != nil {
+			return err
+		}
+	}
+	buf.ListEnd(inner)
+	buf.ListEnd(l)
+	return buf.Flush()
+}
+
+var bufferEncoderTests = []*bufferEncoder{
+	{B: new(big.Int), U: new(uint256.Int), Raw: RawValue{0x80}},
+	{
+		A:    0xFFFFFFFFFFFFFFFF,
+		B:    new(big.Int).Lsh(big.NewInt(1), 200),
+		U:    &uint256.Int{0, 0, 0, 1 << 63},
+		C:    bytes.Repeat([]byte{0xAB}, 60),
+		D:    "a",
+		E:    true,
+		Raw:  RawValue{0xC2, 0x01, 0x02},
+		List: []interface{}{uint(1), "dog", []uint{}, &bufferEncoder{B: big.NewInt(127), U: uint256.NewInt(1), Raw: RawValue{0xC0}}},
+	},
+	{A: 0x7F, B: big.NewInt(0x80), U: uint256.NewInt(0x80), C: []byte{0x00}, D: string(bytes.Repeat([]byte{'x'}, 56)), Raw: RawValue{0x05}},
+}
+
+func TestEncoderBuffer(t *testing.T) {
+	for i, test := range bufferEncoderTests {
+		want, err := EncodeToBytes((*plainBufferEncoder)(test))
+		if err != nil {
+			t.Fatalf("%d: reflective encoding error: %v", i, err)
+		}
+		// Called by Encode, EncodeRLP appends to the outer buffer.
+		have, err := EncodeToBytes([]interface{}{test})
+		if err != nil {
+			t.Fatalf("%d: encoding error: %v", i, err)
+		}
+		if wrapped, _ := EncodeToBytes([]RawValue{want}); !bytes.Equal(have, wrapped) {
+			t.Errorf("%d: encoding mismatch\nhave %x\nwant %x", i, have, wrapped)
+		}
+		// Called directly, it writes to the given writer on Flush.
+		out := new(bytes.Buffer)
+		if err := test.EncodeRLP(out); err != nil {
+			t.Fatalf("%d: EncodeRLP error: %v", i, err)
+		}
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%d: EncodeRLP output mismatch\nhave %x\nwant %x", i, out.Bytes(), want)
+		}
+	}
+}
+
+func TestEncoderBufferBytes(t *testing.T) {
+	var buf EncoderBuffer
+	for i := 0; i < 3; i++ {
+		buf.Reset(nil)
+		l := buf.List()
+		buf.WriteString("cat")
+		buf.WriteString("dog")
+		buf.ListEnd(l)
+		want := unhex("C88363617483646F67")
+		if have := buf.ToBytes(); !bytes.Equal(have, want) {
+			t.Fatalf("ToBytes: have %x, want %x", have, want)
+		}
+		prefix := []byte{0xFF, 0xFE}
+		if have := buf.AppendToBytes(prefix); !bytes.Equal(have, append(prefix, want...)) {
+			t.Fatalf("AppendToBytes: have %x", have)
+		}
+		if err := buf.Flush(); err != nil {
+			t.Fatalf("Flush error: %v", err)
+		}
+	}
+}
+
+func TestEncoderBufferResetDerived(t *testing.T) {
+	outer := NewEncoderBuffer(nil)
+	defer outer.Flush()
+	inner := NewEncoderBuffer(outer)
+	defer func() {
+		if recover() == nil {
+			t.Error("Reset of derived buffer didn't panic")
+		}
+	}()
+	inner.Reset(nil)
+}
+
+func TestEncoderBufferNegativeBigInt(t *testing.T) {
+	buf := NewEncoderBuffer(nil)
+	defer buf.Flush()
+	defer func() {
+		if err := recover(); err != ErrNegativeBigInt {
+			t.Errorf("expected panic with %v, have %v", ErrNegativeBigInt, err)
+		}
+	}()
+	buf.WriteBigInt(big.NewInt(-1))
+}
+
+func BenchmarkEncoderBuffer(b *testing.B) {
+	test := bufferEncoderTests[1]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := NewEncoderBuffer(io.Discard)
+		test.EncodeRLP(&buf)
+		buf.Flush()
+	}
+}
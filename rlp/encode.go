@@ -17,11 +17,16 @@
 package rlp
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"reflect"
+	"sort"
 	"sync"
+
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 var (
@@ -31,6 +36,9 @@ var (
 	EmptyList   = []byte{0xC0}
 )
 
+// ErrNegativeBigInt is returned when encoding a negative big integer.
+var ErrNegativeBigInt = errors.New("rlp: cannot encode negative *big.Int")
+
 // Encoder is implemented by types that require custom
 // encoding rules or want to encode private fields.
 type Encoder interface {
@@ -51,9 +59,10 @@ type Encoder interface {
 //
 // Please see package-level documentation of encoding rules.
 func Encode(w io.Writer, val interface{}) error {
-	if outer, ok := w.(*encbuf); ok {
-		// Encode was called by some type's EncodeRLP.
-		// Avoid copying by writing to the outer encbuf directly.
+	if outer := encbufFromWriter(w); outer != nil {
+		// Encode was called by some type's EncodeRLP, or w is an
+		// EncoderBuffer. Avoid copying by writing to the outer
+		// encbuf directly.
 		return outer.encode(val)
 	}
 	eb := encbufPool.Get().(*encbuf)
@@ -216,7 +225,14 @@ func (w *encbuf) size() int {
 }
 
 func (w *encbuf) toBytes() []byte {
-	out := make([]byte, w.size())
+	return w.appendTo(make([]byte, 0, w.size()))
+}
+
+// appendTo appends the encoded data to dst.
+func (w *encbuf) appendTo(dst []byte) []byte {
+	start := len(dst)
+	dst = append(dst, make([]byte, w.size())...)
+	out := dst[start:]
 	strpos := 0
 	pos := 0
 	for _, head := range w.lheads {
@@ -230,7 +246,7 @@ func (w *encbuf) toBytes() []byte {
 	}
 	// copy string data after the last list header
 	copy(out[pos:], w.str[strpos:])
-	return out
+	return dst
 }
 
 func (w *encbuf) toWriter(out io.Writer) (err error) {
@@ -324,7 +340,10 @@ func (r *encReader) next() []byte {
 	}
 }
 
-var encoderInterface = reflect.TypeOf(new(Encoder)).Elem()
+var (
+	encoderInterface = reflect.TypeOf(new(Encoder)).Elem()
+	emptyStruct      = reflect.TypeOf(struct{}{})
+)
 
 // makeWriter creates a writer function for the given type.
 func makeWriter(typ reflect.Type, ts tags) (writer, error) {
@@ -336,12 +355,18 @@ func makeWriter(typ reflect.Type, ts tags) (writer, error) {
 		return writeBigIntPtr, nil
 	case typ.AssignableTo(bigInt):
 		return writeBigIntNoPtr, nil
+	case typ == reflect.PtrTo(uint256Int):
+		return writeUint256Ptr, nil
+	case typ == uint256Int:
+		return writeUint256NoPtr, nil
 	case kind == reflect.Ptr:
 		return makePtrWriter(typ, ts)
 	case reflect.PtrTo(typ).Implements(encoderInterface):
 		return makeEncoderWriter(typ), nil
 	case isUint(kind):
 		return writeUint, nil
+	case ts.signed:
+		return writeSigned, nil
 	case kind == reflect.Bool:
 		return writeBool, nil
 	case kind == reflect.String:
@@ -356,6 +381,8 @@ func makeWriter(typ reflect.Type, ts tags) (writer, error) {
 		return makeStructWriter(typ)
 	case kind == reflect.Interface:
 		return writeInterface, nil
+	case kind == reflect.Map:
+		return makeMapWriter(typ)
 	default:
 		return nil, fmt.Errorf("rlp: type %v is not RLP-serializable", typ)
 	}
@@ -371,6 +398,14 @@ func writeUint(val reflect.Value, w *encbuf) error {
 	return nil
 }
 
+// writeSigned writes a signed integer in zigzag encoding, which maps
+// 0, -1, 1, -2, 2, ... to the unsigned integers 0, 1, 2, 3, 4, ...
+func writeSigned(val reflect.Value, w *encbuf) error {
+	i := val.Int()
+	w.encodeUint(uint64(i<<1) ^ uint64(i>>63))
+	return nil
+}
+
 func writeBool(val reflect.Value, w *encbuf) error {
 	if val.Bool() {
 		w.str = append(w.str, 0x01)
@@ -398,29 +433,24 @@ func writeBigIntNoPtr(val reflect.Value, w *encbuf) error {
 const wordBytes = (32 << (uint64(^big.Word(0)) >> 63)) / 8
 
 func writeBigInt(i *big.Int, w *encbuf) error {
-	if i.Sign() == -1 {
-		return fmt.Errorf("rlp: cannot encode negative *big.Int")
-	}
-	bitlen := i.BitLen()
-	if bitlen <= 64 {
-		w.encodeUint(i.Uint64())
+	var err error
+	w.str, err = AppendBigInt(w.str, i)
+	return err
+}
+
+func writeUint256Ptr(val reflect.Value, w *encbuf) error {
+	ptr := val.Interface().(*uint256.Int)
+	if ptr == nil {
+		w.str = append(w.str, 0x80)
 		return nil
 	}
-	// Integer is larger than 64 bits, encode from i.Bits().
-	// The minimal byte length is bitlen rounded up to the next
-	// multiple of 8, divided by 8.
-	length := ((bitlen + 7) & -8) >> 3
-	w.encodeStringHeader(length)
-	w.str = append(w.str, make([]byte, length)...)
-	index := length
-	buf := w.str[len(w.str)-length:]
-	for _, d := range i.Bits() {
-		for j := 0; j < wordBytes && index > 0; j++ {
-			index--
-			buf[index] = byte(d)
-			d >>= 8
-		}
-	}
+	w.str = AppendUint256(w.str, ptr)
+	return nil
+}
+
+func writeUint256NoPtr(val reflect.Value, w *encbuf) error {
+	i := val.Interface().(uint256.Int)
+	w.str = AppendUint256(w.str, &i)
 	return nil
 }
 
@@ -536,6 +566,84 @@ func makeSliceWriter(typ reflect.Type, ts tags) (writer, error) {
 	return writer, nil
 }
 
+// makeMapWriter creates a writer for maps. A map encodes as a list of
+// [key, value] pairs, sorted by the encoded keys. Sets, maps with
+// element type struct{}, encode as a sorted list of keys.
+func makeMapWriter(typ reflect.Type) (writer, error) {
+	kinfo := cachedTypeInfo1(typ.Key(), tags{})
+	if kinfo.writerErr != nil {
+		return nil, kinfo.writerErr
+	}
+	set := typ.Elem() == emptyStruct
+	vinfo := cachedTypeInfo1(typ.Elem(), tags{})
+	if vinfo.writerErr != nil {
+		return nil, vinfo.writerErr
+	}
+	writer := func(val reflect.Value, w *encbuf) error {
+		entries, err := encodeMapKeys(val, kinfo.writer)
+		if err != nil {
+			return err
+		}
+		// Map values aren't addressable, so they are copied for
+		// writers calling a pointer method.
+		elem := reflect.New(typ.Elem()).Elem()
+		lh := w.list()
+		for _, e := range entries {
+			if set {
+				w.str = append(w.str, e.key...)
+				continue
+			}
+			pair := w.list()
+			w.str = append(w.str, e.key...)
+			elem.Set(e.value)
+			if err := vinfo.writer(elem, w); err != nil {
+				return err
+			}
+			w.listEnd(pair)
+		}
+		w.listEnd(lh)
+		return nil
+	}
+	return writer, nil
+}
+
+type mapEntry struct {
+	key   []byte // the encoded key
+	value reflect.Value
+}
+
+// encodeMapKeys returns the entries of the map val with their keys encoded,
+// sorted by the encoded keys. Distinct keys with the same encoding, e.g.
+// pointers to equal values, are rejected.
+func encodeMapKeys(val reflect.Value, kwriter writer) ([]mapEntry, error) {
+	kbuf := encbufPool.Get().(*encbuf)
+	defer encbufPool.Put(kbuf)
+	var (
+		entries = make([]mapEntry, 0, val.Len())
+		key     = reflect.New(val.Type().Key()).Elem()
+		encKeys []byte
+	)
+	for it := val.MapRange(); it.Next(); {
+		kbuf.reset()
+		key.Set(it.Key())
+		if err := kwriter(key, kbuf); err != nil {
+			return nil, err
+		}
+		start := len(encKeys)
+		encKeys = kbuf.appendTo(encKeys)
+		entries = append(entries, mapEntry{key: encKeys[start:len(encKeys):len(encKeys)], value: it.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	for i := 1; i < len(entries); i++ {
+		if bytes.Equal(entries[i-1].key, entries[i].key) {
+			return nil, fmt.Errorf("rlp: map of type %v has several keys encoding to %x", val.Type(), entries[i].key)
+		}
+	}
+	return entries, nil
+}
+
 func makeStructWriter(typ reflect.Type) (writer, error) {
 	fields, err := structFields(typ)
 	if err != nil {
@@ -546,9 +654,18 @@ func makeStructWriter(typ reflect.Type) (writer, error) {
 			return nil, structFieldError{typ, f.index, f.info.writerErr}
 		}
 	}
+	firstOptional := firstOptionalField(fields)
 	writer := func(val reflect.Value, w *encbuf) error {
+		// Zero-valued optional fields at the end of the struct are
+		// left out of the list.
+		end := len(fields)
+		for ; end > firstOptional; end-- {
+			if !val.Field(fields[end-1].index).IsZero() {
+				break
+			}
+		}
 		lh := w.list()
-		for _, f := range fields {
+		for _, f := range fields[:end] {
 			if err := f.info.writer(val.Field(f.index), w); err != nil {
 				return err
 			}
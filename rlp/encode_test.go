@@ -23,10 +23,13 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 type testEncoder struct {
@@ -138,6 +141,22 @@ var encTests = []encTest{
 	// negative ints are not supported
 	{val: big.NewInt(-1), error: "rlp: cannot encode negative *big.Int"},
 
+	// uint256
+	{val: uint256.NewInt(0), output: "80"},
+	{val: uint256.NewInt(127), output: "7F"},
+	{val: uint256.NewInt(128), output: "8180"},
+	{val: uint256.NewInt(0xFFFFFFFFFFFFFF), output: "87FFFFFFFFFFFFFF"},
+	{
+		val:    new(uint256.Int).SetBytes(unhex("102030405060708090A0B0C0D0E0F2")),
+		output: "8F102030405060708090A0B0C0D0E0F2",
+	},
+	{
+		val:    &uint256.Int{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)},
+		output: "A0FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+	},
+	{val: *uint256.NewInt(0xFFFFFF), output: "83FFFFFF"},
+	{val: &uint256Fields{A: *uint256.NewInt(256)}, output: "C482010080"},
+
 	// byte arrays
 	{val: [0]byte{}, output: "80"},
 	{val: [1]byte{0}, output: "00"},
@@ -262,15 +281,60 @@ var encTests = []encTest{
 	{val: &tailRaw{A: 1, Tail: []RawValue{}}, output: "C101"},
 	{val: &tailRaw{A: 1, Tail: nil}, output: "C101"},
 	{val: &hasIgnoredField{A: 1, B: 2, C: 3}, output: "C20103"},
+
+	// struct tag "optional"
+	{val: &optionalFields{}, output: "C180"},
+	{val: &optionalFields{1, 2, 3}, output: "C3010203"},
+	{val: &optionalFields{1, 0, 3}, output: "C3018003"},
+	{val: &optionalFields{1, 2, 0}, output: "C20102"},
+	{val: &optionalAndTailField{A: 1}, output: "C101"},
+	{val: &optionalAndTailField{A: 1, B: 2}, output: "C20102"},
+	{val: &optionalAndTailField{A: 1, Tail: []uint{5, 6}}, output: "C401800506"},
+	{val: &optionalAndTailField{A: 1, Tail: []uint{}}, output: "C20180"},
+	{val: &optionalBigIntField{A: 1}, output: "C101"},
+	{val: &optionalPtrField{A: 1}, output: "C101"},
+	{val: &optionalPtrField{A: 1, B: &[3]byte{1, 2, 3}}, output: "C50183010203"},
+	{val: &optionalPtrFieldNil{A: 1}, output: "C101"},
 	{val: &intField{X: 3}, error: "rlp: type int is not RLP-serializable (struct field rlp.intField.X)"},
 
+	// struct tag "signed"
+	{val: &signedFields{}, output: "C3808080"},
+	{val: &signedFields{A: -1, B: -64, C: -2}, output: "C3017F03"},
+	{val: &signedFields{A: 1, B: 64, C: 2}, output: "C402818004"},
+	{
+		val:    &signedFields{A: math.MinInt8, B: math.MinInt64, C: math.MaxInt64},
+		output: "D481FF88FFFFFFFFFFFFFFFF88FFFFFFFFFFFFFFFE",
+	},
+	{val: &invalidSigned{}, error: `rlp: invalid struct tag "signed" for rlp.invalidSigned.A (field type is not a signed integer)`},
+
+	// maps
+	{val: map[string]uint{}, output: "C0"},
+	{val: map[string]uint(nil), output: "C0"},
+	{val: map[string]uint{"b": 2, "a": 1}, output: "C6C26101C26202"},
+	{val: map[uint]string{256: "x", 1: "y", 0: "z"}, output: "CBC20179C2807AC482010078"}, // sorted by encoding
+	{val: map[string][]uint{"a": {1, 2}}, output: "C5C461C20102"},
+	{val: map[[2]uint]bool{{1, 2}: true}, output: "C5C4C2010201"},
+	{val: map[string]testEncoder{"a": {}}, output: "CCCB6100010001000100010001"},
+	{val: map[string]struct{}{"dog": {}, "cat": {}}, output: "C88363617483646F67"}, // set
+	{val: map[int]uint{1: 1}, error: "rlp: type int is not RLP-serializable"},
+	{val: map[string]func(){"a": nil}, error: "rlp: type func() is not RLP-serializable"},
+	{
+		val: func() map[*uint]uint {
+			a, b := uint(1), uint(1)
+			return map[*uint]uint{&a: 1, &b: 2}
+		}(),
+		error: "rlp: map of type map[*uint]uint has several keys encoding to 01",
+	},
+
 	// nil
 	{val: (*uint)(nil), output: "80"},
 	{val: (*string)(nil), output: "80"},
 	{val: (*[]byte)(nil), output: "80"},
 	{val: (*[10]byte)(nil), output: "80"},
 	{val: (*big.Int)(nil), output: "80"},
+	{val: (*uint256.Int)(nil), output: "80"},
 	{val: (*[]string)(nil), output: "C0"},
+	{val: (*map[string]uint)(nil), output: "C0"},
 	{val: (*[10]string)(nil), output: "C0"},
 	{val: (*[]interface{})(nil), output: "C0"},
 	{val: (*[]struct{ uint })(nil), output: "C0"},
@@ -432,6 +496,37 @@ func TestEncodeToReaderReturnToPool(t *testing.T) {
 
 var sink interface{}
 
+// TestEncodeMapStable checks that map encodings don't depend on the
+// iteration order, which varies between runs.
+func TestEncodeMapStable(t *testing.T) {
+	type config struct {
+		Name  string
+		Attrs map[string][]byte
+		Flags map[uint64]struct{}
+	}
+	c := config{Name: "c", Attrs: make(map[string][]byte), Flags: make(map[uint64]struct{})}
+	for i := 0; i < 200; i++ {
+		c.Attrs[strings.Repeat("k", i%60)+fmt.Sprint(i)] = []byte{byte(i)}
+		c.Flags[uint64(i)<<(i%64)] = struct{}{}
+	}
+	want, err := EncodeToBytes(&c)
+	if err != nil {
+		t.Fatalf("encoding error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if have, _ := EncodeToBytes(&c); !bytes.Equal(have, want) {
+			t.Fatalf("encoding %d differs", i)
+		}
+	}
+	var dec config
+	if err := DecodeBytes(want, &dec); err != nil {
+		t.Fatalf("decoding error: %v", err)
+	}
+	if !reflect.DeepEqual(dec, c) {
+		t.Errorf("decoded value differs")
+	}
+}
+
 func BenchmarkIntsize(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		sink = intsize(0x12345678)
@@ -0,0 +1,134 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// These errors are the causes of a LimitError.
+var (
+	ErrDepthLimit    = errors.New("rlp: lists nested too deeply")
+	ErrListElemLimit = errors.New("rlp: too many list elements")
+	ErrStringLimit   = errors.New("rlp: string too large")
+	ErrAllocLimit    = errors.New("rlp: allocation limit exceeded")
+)
+
+// LimitError is returned when decoding exceeds one of the limits set by
+// DecodeOptions.
+type LimitError struct {
+	Offset uint64 // input position of the value being decoded
+	Max    uint64 // the limit that was exceeded
+	Err    error  // which limit was exceeded, e.g. ErrDepthLimit
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("%v at offset %d (limit %d)", err.Err, err.Offset, err.Max)
+}
+
+// Unwrap returns the underlying error, e.g. ErrDepthLimit.
+func (err *LimitError) Unwrap() error {
+	return err.Err
+}
+
+// DecodeOptions limits the resources used for decoding, to protect against
+// input crafted to exhaust memory, like trie nodes received from untrusted
+// peers. A zero field means no limit; the zero DecodeOptions decode like
+// Decode does.
+//
+// The input limit of a Stream only bounds the size of the input. Small input
+// can still declare deeply nested lists, or lists of many empty values that
+// decode into large Go values.
+type DecodeOptions struct {
+	// MaxDepth is the maximum number of lists enclosing a value.
+	MaxDepth int
+
+	// MaxListElems is the maximum number of elements of a single list.
+	MaxListElems int
+
+	// MaxStringSize is the maximum size of a string value in bytes.
+	MaxStringSize uint64
+
+	// MaxAlloc is the maximum number of bytes allocated for decoded values.
+	// It counts strings, byte slices, the backing arrays of slices including
+	// those discarded while growing them, map entries and pointer targets.
+	// Byte slices sharing memory with the input don't count.
+	MaxAlloc uint64
+}
+
+// HardenedOptions returns limits for decoding untrusted input such as trie
+// nodes and witnesses. They leave room for all values of the Ethereum wire
+// protocols while bounding the memory allocated by a single Decode call to
+// 64 MiB.
+func HardenedOptions() DecodeOptions {
+	return DecodeOptions{
+		MaxDepth:      64,
+		MaxListElems:  1 << 20,
+		MaxStringSize: 16 << 20,
+		MaxAlloc:      64 << 20,
+	}
+}
+
+// Decode is like the Decode function, but applies the limits of o.
+func (o DecodeOptions) Decode(r io.Reader, val interface{}) error {
+	return decode(r, val, o)
+}
+
+// DecodeBytes is like the DecodeBytes function, but applies the limits of o.
+func (o DecodeOptions) DecodeBytes(b []byte, val interface{}) error {
+	return decodeBytes(b, val, o, false)
+}
+
+// DecodeBytesNoCopy is like the DecodeBytesNoCopy function, but applies the
+// limits of o.
+func (o DecodeOptions) DecodeBytesNoCopy(b []byte, val interface{}) error {
+	return decodeBytes(b, val, o, true)
+}
+
+// NewStream is like the NewStream function, but the stream applies the
+// limits of o.
+func (o DecodeOptions) NewStream(r io.Reader, inputLimit uint64) *Stream {
+	s := NewStream(r, inputLimit)
+	s.SetOptions(o)
+	return s
+}
+
+// SetOptions sets the limits applied by the stream. They are kept by Reset.
+// Allocations made before the call count against the new MaxAlloc.
+//
+// Stream methods that exceed a limit return a *LimitError. Nesting depth,
+// list elements and string sizes are checked by Kind and List, so they also
+// apply to DecodeRLP methods. Allocations are only counted for the byte
+// slices returned by Bytes and Raw and for the values created by Decode.
+func (s *Stream) SetOptions(opts DecodeOptions) {
+	s.opts = opts
+}
+
+// alloc accounts for n bytes allocated while decoding the value at offset.
+func (s *Stream) alloc(n, offset uint64) error {
+	if s.opts.MaxAlloc == 0 {
+		return nil
+	}
+	// SetOptions may lower the limit below what was already allocated.
+	if s.allocated >= s.opts.MaxAlloc || n > s.opts.MaxAlloc-s.allocated {
+		return &LimitError{Offset: offset, Max: s.opts.MaxAlloc, Err: ErrAllocLimit}
+	}
+	s.allocated += n
+	return nil
+}
@@ -0,0 +1,327 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type limitsStruct struct {
+	A uint
+	B []byte
+	C []limitsStruct
+	D map[string][]uint `rlp:"optional"`
+	E *limitsStruct     `rlp:"optional,nil"`
+}
+
+func TestDecodeOptions(t *testing.T) {
+	tests := []struct {
+		input string
+		ptr   interface{}
+		opts  DecodeOptions
+		err   string
+		cause error
+	}{
+		// nesting depth
+		{input: "C3C2C1C0", ptr: new([]interface{}), opts: DecodeOptions{MaxDepth: 4}},
+		{
+			input: "C3C2C1C0", ptr: new([]interface{}), opts: DecodeOptions{MaxDepth: 3},
+			err: "rlp: lists nested too deeply at offset 3 (limit 3)", cause: ErrDepthLimit,
+		},
+		{
+			input: "C0", ptr: new([]uint), opts: DecodeOptions{MaxDepth: 0},
+		},
+		{
+			input: "C3C2C101", ptr: new(map[[1][1]uint16]struct{}), opts: DecodeOptions{MaxDepth: 3},
+		},
+		{
+			input: "C3C2C101", ptr: new(map[[1][1]uint16]struct{}), opts: DecodeOptions{MaxDepth: 2},
+			err: "rlp: lists nested too deeply at offset 2 (limit 2)", cause: ErrDepthLimit,
+		},
+
+		// list elements
+		{input: "C3010203", ptr: new([]uint), opts: DecodeOptions{MaxListElems: 3}},
+		{
+			input: "C3010203", ptr: new([]uint), opts: DecodeOptions{MaxListElems: 2},
+			err: "rlp: too many list elements at offset 3 (limit 2)", cause: ErrListElemLimit,
+		},
+		{
+			input: "C4C20102C0", ptr: new([]interface{}), opts: DecodeOptions{MaxListElems: 2},
+		},
+		{
+			input: "C4C3010203", ptr: new([]interface{}), opts: DecodeOptions{MaxListElems: 2},
+			err: "rlp: too many list elements at offset 4 (limit 2)", cause: ErrListElemLimit,
+		},
+		{
+			input: "C3010203", ptr: new([3]uint), opts: DecodeOptions{MaxListElems: 2},
+			err: "rlp: too many list elements at offset 3 (limit 2)", cause: ErrListElemLimit,
+		},
+
+		// string size
+		{input: "83616263", ptr: new(string), opts: DecodeOptions{MaxStringSize: 3}},
+		{input: "61", ptr: new([]byte), opts: DecodeOptions{MaxStringSize: 1}},
+		{
+			input: "83616263", ptr: new(string), opts: DecodeOptions{MaxStringSize: 2},
+			err: "rlp: string too large at offset 0 (limit 2)", cause: ErrStringLimit,
+		},
+		{
+			input: "C58083616263", ptr: new(RawValue), opts: DecodeOptions{MaxStringSize: 2},
+		},
+		{
+			input: "C58083616263", ptr: new([][]byte), opts: DecodeOptions{MaxStringSize: 2},
+			err: "rlp: string too large at offset 2 (limit 2)", cause: ErrStringLimit,
+		},
+
+		// allocations
+		{input: "83616263", ptr: new([]byte), opts: DecodeOptions{MaxAlloc: 3}},
+		{
+			input: "83616263", ptr: new([]byte), opts: DecodeOptions{MaxAlloc: 2},
+			err: "rlp: allocation limit exceeded at offset 0 (limit 2)", cause: ErrAllocLimit,
+		},
+		{input: "83616263", ptr: new(string), opts: DecodeOptions{MaxAlloc: 6}},
+		{
+			input: "83616263", ptr: new(string), opts: DecodeOptions{MaxAlloc: 5},
+			err: "rlp: allocation limit exceeded at offset 0 (limit 5)", cause: ErrAllocLimit,
+		},
+		{input: "C3010203", ptr: new([]uint64), opts: DecodeOptions{MaxAlloc: 32}},
+		{
+			input: "C3010203", ptr: new([]uint64), opts: DecodeOptions{MaxAlloc: 31},
+			err: "rlp: allocation limit exceeded at offset 1 (limit 31)", cause: ErrAllocLimit,
+		},
+		{input: "01", ptr: new(*uint64), opts: DecodeOptions{MaxAlloc: 8}},
+		{
+			input: "01", ptr: new(*uint64), opts: DecodeOptions{MaxAlloc: 7},
+			err: "rlp: allocation limit exceeded at offset 0 (limit 7)", cause: ErrAllocLimit,
+		},
+		{input: "C6C20102C20304", ptr: new(map[uint8]uint8), opts: DecodeOptions{MaxAlloc: 4}},
+		{
+			input: "C6C20102C20304", ptr: new(map[uint8]uint8), opts: DecodeOptions{MaxAlloc: 3},
+			err: "rlp: allocation limit exceeded at offset 4 (limit 3)", cause: ErrAllocLimit,
+		},
+		{
+			// Each empty list decodes into a struct of 72 bytes.
+			input: "C4C0C0C0C0", ptr: new([]limitsStruct), opts: DecodeOptions{MaxAlloc: 256},
+			err: "rlp: allocation limit exceeded at offset 1 (limit 256)", cause: ErrAllocLimit,
+		},
+	}
+
+	for i, test := range tests {
+		input := unhex(test.input)
+		ptr := reflect.New(reflect.TypeOf(test.ptr).Elem()).Interface()
+		err := test.opts.DecodeBytes(input, ptr)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("test %d: unexpected error %q\ninput %s", i, err, test.input)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("test %d: wrong error %q, want %q\ninput %s", i, err, test.err, test.input)
+			continue
+		}
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("test %d: error is %T, want *LimitError", i, err)
+		}
+		if !errors.Is(err, test.cause) {
+			t.Errorf("test %d: error doesn't wrap %v", i, test.cause)
+		}
+	}
+}
+
+func TestDecodeOptionsNoCopy(t *testing.T) {
+	opts := DecodeOptions{MaxAlloc: 1}
+	var b []byte
+	if err := opts.DecodeBytesNoCopy(unhex("83616263"), &b); err != nil {
+		t.Fatalf("DecodeBytesNoCopy error: %v", err)
+	}
+	if err := opts.DecodeBytes(unhex("83616263"), &b); !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("DecodeBytes error %v, want ErrAllocLimit", err)
+	}
+}
+
+func TestDecodeOptionsHugeString(t *testing.T) {
+	// Without an input limit, the declared size would be allocated.
+	input := unhex("BF7FFFFFFFFFFFFFFF")
+	for _, opts := range []DecodeOptions{{MaxStringSize: 1 << 20}, {MaxAlloc: 1 << 20}} {
+		var b []byte
+		err := opts.Decode(newPlainReader(input), &b)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("%+v: error %v, want *LimitError", opts, err)
+		}
+		if limitErr.Max != 1<<20 {
+			t.Errorf("%+v: wrong limit %d", opts, limitErr.Max)
+		}
+	}
+}
+
+func TestStreamOptions(t *testing.T) {
+	input := unhex("C2C0C0C1C0")
+	s := DecodeOptions{MaxDepth: 1}.NewStream(bytes.NewReader(input), 0)
+	if _, err := s.List(); err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if _, err := s.List(); !errors.Is(err, ErrDepthLimit) {
+		t.Fatalf("nested List error %v, want ErrDepthLimit", err)
+	}
+	// The limits are kept by Reset.
+	s.Reset(bytes.NewReader(input[3:]), 0)
+	var v interface{}
+	if err := s.Decode(&v); !errors.Is(err, ErrDepthLimit) {
+		t.Fatalf("Decode after Reset error %v, want ErrDepthLimit", err)
+	}
+	// Custom decoders are subject to the limits of the stream.
+	var d struct{ D []testDecoder }
+	s = DecodeOptions{MaxListElems: 1}.NewStream(bytes.NewReader(unhex("C3C20102")), 0)
+	if err := s.Decode(&d); !errors.Is(err, ErrListElemLimit) {
+		t.Fatalf("Decode error %v, want ErrListElemLimit", err)
+	}
+}
+
+func TestStreamOptionsLowerAlloc(t *testing.T) {
+	s := DecodeOptions{MaxAlloc: 10}.NewStream(bytes.NewReader(unhex("8361626383646566")), 0)
+	if _, err := s.Bytes(); err != nil {
+		t.Fatalf("Bytes error: %v", err)
+	}
+	// Lowering the limit below the allocated amount rejects further values.
+	s.SetOptions(DecodeOptions{MaxAlloc: 2})
+	if _, err := s.Bytes(); !errors.Is(err, ErrAllocLimit) {
+		t.Fatalf("Bytes error %v, want ErrAllocLimit", err)
+	}
+}
+
+func TestHardenedOptions(t *testing.T) {
+	var v interface{}
+	if err := HardenedOptions().DecodeBytes(nestedLists(65), &v); !errors.Is(err, ErrDepthLimit) {
+		t.Fatalf("error %v for 65 nested lists, want ErrDepthLimit", err)
+	}
+	if err := HardenedOptions().DecodeBytes(nestedLists(64), &v); err != nil {
+		t.Fatalf("error %v for 64 nested lists", err)
+	}
+}
+
+// nestedLists returns the encoding of n lists, each but the innermost holding
+// the next one.
+func nestedLists(n int) []byte {
+	var v interface{} = []interface{}{}
+	for i := 1; i < n; i++ {
+		v = []interface{}{v}
+	}
+	b, err := EncodeToBytes(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// fuzzOptions are tight limits, so that the fuzzer runs into them often.
+var fuzzOptions = DecodeOptions{
+	MaxDepth:      4,
+	MaxListElems:  8,
+	MaxStringSize: 16,
+	MaxAlloc:      1024,
+}
+
+func FuzzDecodeOptions(f *testing.F) {
+	f.Add(unhex("C3C2C1C0"))
+	f.Add(unhex("C4C1C1C1C0"))
+	f.Add(unhex("C9010203040506070809"))
+	f.Add(unhex("C4C0C0C0C0"))
+	f.Add(unhex("CB01830102038080C4C20180"))
+	f.Add(unhex("91" + strings.Repeat("AA", 17)))
+	f.Add(unhex("D00180C0CBCA83616263C3C28001"))
+	f.Add(unhex("BF7FFFFFFFFFFFFFFF"))
+	f.Fuzz(func(t *testing.T, input []byte) {
+		for _, typ := range []reflect.Type{
+			reflect.TypeOf([]interface{}{}),
+			reflect.TypeOf(limitsStruct{}),
+			reflect.TypeOf(map[string][][]byte{}),
+		} {
+			checkDecodeOptions(t, input, typ)
+		}
+	})
+}
+
+// checkDecodeOptions decodes input into a value of type typ, with and without
+// limits. The limits may only turn success into a *LimitError.
+func checkDecodeOptions(t *testing.T, input []byte, typ reflect.Type) {
+	free := reflect.New(typ)
+	freeErr := DecodeBytes(input, free.Interface())
+	limited := reflect.New(typ)
+	err := fuzzOptions.DecodeBytes(input, limited.Interface())
+
+	var limitErr *LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		var max uint64
+		switch limitErr.Err {
+		case ErrDepthLimit:
+			max = uint64(fuzzOptions.MaxDepth)
+		case ErrListElemLimit:
+			max = uint64(fuzzOptions.MaxListElems)
+		case ErrStringLimit:
+			max = fuzzOptions.MaxStringSize
+		case ErrAllocLimit:
+			max = fuzzOptions.MaxAlloc
+		default:
+			t.Fatalf("%v %x: unknown limit error %v", typ, input, limitErr.Err)
+		}
+		if limitErr.Max != max {
+			t.Fatalf("%v %x: wrong limit in %v", typ, input, err)
+		}
+		if limitErr.Offset >= uint64(len(input)) {
+			t.Fatalf("%v %x: offset beyond input in %v", typ, input, err)
+		}
+	case err != nil:
+		if freeErr == nil {
+			t.Fatalf("%v %x: error %v with limits, but none without", typ, input, err)
+		}
+	case freeErr != nil:
+		t.Fatalf("%v %x: no error with limits, but %v without", typ, input, freeErr)
+	case !reflect.DeepEqual(free.Interface(), limited.Interface()):
+		t.Fatalf("%v %x: limits change the decoded value", typ, input)
+	}
+	if err == nil && typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Interface {
+		checkLimitsRespected(t, input, limited.Elem().Interface(), 0)
+	}
+}
+
+// checkLimitsRespected checks v, a value decoded into an interface at the given
+// list depth, against fuzzOptions.
+func checkLimitsRespected(t *testing.T, input []byte, v interface{}, depth int) {
+	switch v := v.(type) {
+	case []interface{}:
+		if depth >= fuzzOptions.MaxDepth {
+			t.Fatalf("%x: decoded list at depth %d", input, depth)
+		}
+		if len(v) > fuzzOptions.MaxListElems {
+			t.Fatalf("%x: decoded list of %d elements", input, len(v))
+		}
+		for _, elem := range v {
+			checkLimitsRespected(t, input, elem, depth+1)
+		}
+	case []byte:
+		if uint64(len(v)) > fuzzOptions.MaxStringSize {
+			t.Fatalf("%x: decoded string of %d bytes", input, len(v))
+		}
+	}
+}
@@ -18,7 +18,10 @@ package rlp
 
 import (
 	"io"
+	"math/big"
 	"reflect"
+
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 // RawValue represents an encoded RLP value and can be used to delay
@@ -251,3 +254,75 @@ func AppendUint64(b []byte, i uint64) []byte {
 		)
 	}
 }
+
+// AppendString appends the RLP encoding of the byte string s to b, and
+// returns the resulting slice.
+func AppendString(b, s []byte) []byte {
+	if len(s) == 1 && s[0] <= 0x7F {
+		// fits single byte, no string header
+		return append(b, s[0])
+	}
+	var head [9]byte
+	b = append(b, head[:puthead(head[:], 0x80, 0xB7, uint64(len(s)))]...)
+	return append(b, s...)
+}
+
+// AppendBigInt appends the RLP encoding of i to b, and returns the resulting
+// slice. Negative integers can't be encoded.
+func AppendBigInt(b []byte, i *big.Int) ([]byte, error) {
+	if i.Sign() == -1 {
+		return b, ErrNegativeBigInt
+	}
+	return appendBigInt(b, i), nil
+}
+
+// appendBigInt appends the RLP encoding of the absolute value of i to b.
+func appendBigInt(b []byte, i *big.Int) []byte {
+	bitlen := i.BitLen()
+	if bitlen <= 64 {
+		return AppendUint64(b, i.Uint64())
+	}
+	// Integer is larger than 64 bits, encode from i.Bits().
+	// The minimal byte length is bitlen rounded up to the next
+	// multiple of 8, divided by 8.
+	length := ((bitlen + 7) & -8) >> 3
+	var head [9]byte
+	b = append(b, head[:puthead(head[:], 0x80, 0xB7, uint64(length))]...)
+	b = append(b, make([]byte, length)...)
+	index := length
+	buf := b[len(b)-length:]
+	for _, d := range i.Bits() {
+		for j := 0; j < wordBytes && index > 0; j++ {
+			index--
+			buf[index] = byte(d)
+			d >>= 8
+		}
+	}
+	return b
+}
+
+// AppendUint256 appends the RLP encoding of i to b, and returns the resulting
+// slice. The encoding matches that of a big.Int with the same value.
+func AppendUint256(b []byte, i *uint256.Int) []byte {
+	if i.IsUint64() {
+		return AppendUint64(b, i.Uint64())
+	}
+	enc := i.Bytes32()
+	length := i.ByteLen()
+	b = append(b, 0x80+byte(length))
+	return append(b, enc[32-length:]...)
+}
+
+// WrapList turns the encoded values in b[offset:] into the content of an RLP
+// list by inserting a list header at offset, and returns the resulting slice.
+// Encoders appending a list remember len(b) before the first element and
+// call WrapList after the last one.
+func WrapList(b []byte, offset int) []byte {
+	var head [9]byte
+	size := len(b) - offset
+	n := puthead(head[:], 0xC0, 0xF7, uint64(size))
+	b = append(b, head[:n]...)
+	copy(b[offset+n:], b[offset:offset+size])
+	copy(b[offset:], head[:n])
+	return b
+}
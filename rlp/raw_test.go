@@ -19,9 +19,12 @@ package rlp
 import (
 	"bytes"
 	"io"
+	"math/big"
 	"reflect"
 	"testing"
 	"testing/quick"
+
+	"github.com/pavelkrolevets/mpt/uint256"
 )
 
 func TestCountValues(t *testing.T) {
@@ -277,3 +280,74 @@ func TestAppendUint64Random(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAppendString(t *testing.T) {
+	for _, input := range [][]byte{
+		nil,
+		{0x00},
+		{0x7F},
+		{0x80},
+		[]byte("dog"),
+		bytes.Repeat([]byte{'a'}, 55),
+		bytes.Repeat([]byte{'a'}, 56),
+		bytes.Repeat([]byte{'a'}, 1024),
+	} {
+		want, _ := EncodeToBytes(input)
+		if have := AppendString([]byte{1, 2}, input); !bytes.Equal(have, append([]byte{1, 2}, want...)) {
+			t.Errorf("AppendString(%x): got %x, want 0102%x", input, have, want)
+		}
+	}
+}
+
+func TestAppendBigInt(t *testing.T) {
+	for _, input := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(127),
+		big.NewInt(0xFFFFFF),
+		new(big.Int).Lsh(big.NewInt(1), 64),
+		new(big.Int).Lsh(big.NewInt(0xFF), 480),
+	} {
+		want, _ := EncodeToBytes(input)
+		have, err := AppendBigInt(nil, input)
+		if err != nil || !bytes.Equal(have, want) {
+			t.Errorf("AppendBigInt(%v): got %x (%v), want %x", input, have, err, want)
+		}
+	}
+	if _, err := AppendBigInt(nil, big.NewInt(-1)); err == nil {
+		t.Error("AppendBigInt accepted a negative integer")
+	}
+}
+
+func TestAppendUint256(t *testing.T) {
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	for _, input := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(127),
+		big.NewInt(128),
+		new(big.Int).SetUint64(1<<64 - 1),
+		new(big.Int).Lsh(big.NewInt(1), 64),
+		new(big.Int).Lsh(big.NewInt(0xFF), 200),
+		max,
+	} {
+		want, _ := AppendBigInt(nil, input)
+		i, _ := uint256.FromBig(input)
+		if have := AppendUint256(nil, i); !bytes.Equal(have, want) {
+			t.Errorf("AppendUint256(%v): got %x, want %x", input, have, want)
+		}
+	}
+}
+
+func TestWrapList(t *testing.T) {
+	for _, size := range []int{0, 1, 55, 56, 300, 70000} {
+		// A list of small integers has one content byte per element.
+		elems := make([]uint, size)
+		for i := range elems {
+			elems[i] = 1
+		}
+		want, _ := EncodeToBytes(elems)
+		b := append([]byte{0xAA}, bytes.Repeat([]byte{0x01}, size)...)
+		if have := WrapList(b, 1); !bytes.Equal(have, append([]byte{0xAA}, want...)) {
+			t.Errorf("WrapList of %d bytes: got %x, want aa%x", size, have, want)
+		}
+	}
+}
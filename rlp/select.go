@@ -0,0 +1,147 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIndexOutOfRange is the cause of a PathError for an index beyond the
+// end of its list.
+var ErrIndexOutOfRange = errors.New("rlp: list index out of range")
+
+// PathError is returned by Select and Replace when a path doesn't lead to an
+// item.
+type PathError struct {
+	Offset uint64 // input position of the item or list end where the search failed
+	Path   []int  // the part of the path that was followed, outermost first
+	Err    error  // why the path can't be followed
+}
+
+func (err *PathError) Error() string {
+	if len(err.Path) == 0 {
+		return fmt.Sprintf("%v at offset %d", err.Err, err.Offset)
+	}
+	return fmt.Sprintf("%v at offset %d, path %s", err.Err, err.Offset, formatPath(err.Path))
+}
+
+// Unwrap returns the underlying error, e.g. ErrIndexOutOfRange.
+func (err *PathError) Unwrap() error {
+	return err.Err
+}
+
+// Select returns the encoded item at path in b, which must hold a single RLP
+// value. The path lists the index of the item in each enclosing list,
+// outermost first; an empty path selects the value itself. For example,
+// Select(b, 3, 0) returns the first element of the fourth element of b.
+//
+// Only the headers of the items up to the selected one are read, so Select
+// doesn't notice invalid encodings elsewhere in b. The result is a subslice
+// of b.
+func Select(b []byte, path ...int) ([]byte, error) {
+	start, end, _, err := locate(b, path)
+	if err != nil {
+		return nil, err
+	}
+	return b[start:end:end], nil
+}
+
+// Replace returns a copy of b in which the item at path, as for Select, is
+// replaced by value. value must hold a single RLP value, which is copied as
+// it is. Only the headers of the lists enclosing the item are encoded anew;
+// all other bytes of b are kept. The headers grow or shrink with the size of
+// the new list content.
+func Replace(b, value []byte, path ...int) ([]byte, error) {
+	if _, _, rest, err := Split(value); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, ErrMoreThanOneValue
+	}
+	start, end, lists, err := locate(b, path)
+	if err != nil {
+		return nil, err
+	}
+	// Compute the new content sizes, innermost list first.
+	sizes := make([]uint64, len(lists))
+	itemSize, newSize := uint64(end-start), uint64(len(value))
+	for i := len(lists) - 1; i >= 0; i-- {
+		l := lists[i]
+		sizes[i] = uint64(l.end-l.content) - itemSize + newSize
+		itemSize, newSize = uint64(l.end-l.start), ListSize(sizes[i])
+	}
+	out := make([]byte, 0, uint64(len(b))-itemSize+newSize)
+	pos := 0
+	for i, l := range lists {
+		var head [9]byte
+		out = append(out, b[pos:l.start]...)
+		out = append(out, head[:puthead(head[:], 0xC0, 0xF7, sizes[i])]...)
+		pos = l.content
+	}
+	out = append(out, b[pos:start]...)
+	out = append(out, value...)
+	return append(out, b[end:]...), nil
+}
+
+// listBounds holds the input positions of a list's header, content and end.
+type listBounds struct {
+	start, content, end int
+}
+
+// locate returns the bounds of the item at path in b, and those of the lists
+// enclosing it, outermost first.
+func locate(b []byte, path []int) (start, end int, lists []listBounds, err error) {
+	kind, content, rest, err := Split(b)
+	if err != nil {
+		return 0, 0, nil, &PathError{Err: err}
+	}
+	if len(rest) > 0 {
+		return 0, 0, nil, &PathError{Offset: uint64(len(b) - len(rest)), Err: ErrMoreThanOneValue}
+	}
+	end = len(b)
+	for depth, index := range path {
+		if kind != List {
+			return 0, 0, nil, &PathError{Offset: uint64(start), Path: copyPath(path[:depth]), Err: ErrExpectedList}
+		}
+		l := listBounds{start: start, content: end - len(content), end: end}
+		lists = append(lists, l)
+		pos := l.content
+		for i := 0; ; i++ {
+			if pos == l.end || index < 0 {
+				return 0, 0, nil, &PathError{Offset: uint64(pos), Path: copyPath(path[:depth+1]), Err: ErrIndexOutOfRange}
+			}
+			kind, content, rest, err = Split(b[pos:l.end])
+			if err != nil {
+				if err == ErrValueTooLarge {
+					err = ErrElemTooLarge
+				}
+				return 0, 0, nil, &PathError{Offset: uint64(pos), Path: copyPath(path[:depth+1]), Err: err}
+			}
+			next := l.end - len(rest)
+			if i == index {
+				start, end = pos, next
+				break
+			}
+			pos = next
+		}
+	}
+	return start, end, lists, nil
+}
+
+func copyPath(path []int) []int {
+	return append([]int{}, path...)
+}
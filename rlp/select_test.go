@@ -0,0 +1,146 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// selectInput is [1, ["a", ["bc", "def"]], ""].
+var selectInput = unhex("CC 01 C9 61 C7 826263 83646566 80")
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		path []int
+		want string
+	}{
+		{nil, "CC01C961C78262638364656680"},
+		{[]int{0}, "01"},
+		{[]int{1}, "C961C782626383646566"},
+		{[]int{1, 0}, "61"},
+		{[]int{1, 1, 0}, "826263"},
+		{[]int{1, 1, 1}, "83646566"},
+		{[]int{2}, "80"},
+	}
+	for _, test := range tests {
+		have, err := Select(selectInput, test.path...)
+		if err != nil {
+			t.Errorf("%v: error %v", test.path, err)
+			continue
+		}
+		if fmt.Sprintf("%X", have) != test.want {
+			t.Errorf("%v: got %X, want %s", test.path, have, test.want)
+		}
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		path  []int
+		err   string
+		cause error
+	}{
+		{
+			input: "CC01C961C78262638364656680", path: []int{3},
+			err: "rlp: list index out of range at offset 13, path [3]", cause: ErrIndexOutOfRange,
+		},
+		{
+			input: "CC01C961C78262638364656680", path: []int{1, 1, 2},
+			err: "rlp: list index out of range at offset 12, path [1][1][2]", cause: ErrIndexOutOfRange,
+		},
+		{
+			input: "CC01C961C78262638364656680", path: []int{-1},
+			err: "rlp: list index out of range at offset 1, path [-1]", cause: ErrIndexOutOfRange,
+		},
+		{
+			input: "CC01C961C78262638364656680", path: []int{0, 0},
+			err: "rlp: expected List at offset 1, path [0]", cause: ErrExpectedList,
+		},
+		{
+			input: "CC01C961C7826263836465668000", path: []int{0},
+			err: "rlp: input contains more than one value at offset 13", cause: ErrMoreThanOneValue,
+		},
+		{
+			input: "C3C38001", path: []int{0},
+			err: "rlp: element is larger than containing list at offset 1, path [0]", cause: ErrElemTooLarge,
+		},
+		{input: "", err: "unexpected EOF at offset 0", cause: io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		_, err := Select(unhex(test.input), test.path...)
+		var perr *PathError
+		if !errors.As(err, &perr) || err.Error() != test.err || !errors.Is(err, test.cause) {
+			t.Errorf("%s %v: got error %v, want %s", test.input, test.path, err, test.err)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	tests := []struct {
+		path  []int
+		value interface{}
+		want  interface{} // selectInput after the replacement
+	}{
+		{nil, uint(5), uint(5)},
+		{[]int{0}, uint(2), []interface{}{uint(2), []interface{}{"a", []string{"bc", "def"}}, ""}},
+		{[]int{1}, "", []interface{}{uint(1), "", ""}},
+		{[]int{2}, []uint{}, []interface{}{uint(1), []interface{}{"a", []string{"bc", "def"}}, []uint{}}},
+		{[]int{1, 1, 1}, "", []interface{}{uint(1), []interface{}{"a", []string{"bc", ""}}, ""}},
+		// The enclosing lists need long headers.
+		{[]int{1, 1, 0}, long, []interface{}{uint(1), []interface{}{"a", []string{long, "def"}}, ""}},
+	}
+	original := append([]byte{}, selectInput...)
+	for _, test := range tests {
+		value, _ := EncodeToBytes(test.value)
+		want, _ := EncodeToBytes(test.want)
+		have, err := Replace(selectInput, value, test.path...)
+		if err != nil {
+			t.Errorf("%v: error %v", test.path, err)
+			continue
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%v: got %X, want %X", test.path, have, want)
+		}
+		// Replacing it back restores the input, shrinking the headers again.
+		old, _ := Select(selectInput, test.path...)
+		if have, err := Replace(have, old, test.path...); err != nil || !bytes.Equal(have, selectInput) {
+			t.Errorf("%v: reverting got %X (%v), want %X", test.path, have, err, selectInput)
+		}
+	}
+	if !bytes.Equal(selectInput, original) {
+		t.Fatalf("Replace modified its input")
+	}
+}
+
+func TestReplaceErrors(t *testing.T) {
+	if _, err := Replace(selectInput, unhex("0102"), 0); err != ErrMoreThanOneValue {
+		t.Errorf("two values: got error %v", err)
+	}
+	if _, err := Replace(selectInput, unhex("8100"), 0); err != ErrCanonSize {
+		t.Errorf("invalid value: got error %v", err)
+	}
+	if _, err := Replace(selectInput, unhex("01"), 3); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("bad path: got error %v", err)
+	}
+}
@@ -51,6 +51,13 @@ type tags struct {
 
 	// rlp:"-" ignores fields.
 	ignored bool
+
+	// rlp:"optional" allows for a field to be missing in the input list.
+	// If this is set, all subsequent fields must also be optional or tail.
+	optional bool
+
+	// rlp:"signed" enables the zigzag encoding of signed integer fields.
+	signed bool
 }
 
 // typekey is the key of a type in typeCache. It includes the struct tags because
@@ -104,12 +111,14 @@ func cachedTypeInfo1(typ reflect.Type, tags tags) *typeinfo {
 }
 
 type field struct {
-	index int
-	info  *typeinfo
+	index    int
+	info     *typeinfo
+	optional bool
 }
 
 func structFields(typ reflect.Type) (fields []field, err error) {
 	lastPublic := lastPublicField(typ)
+	firstOptional := ""
 	for i := 0; i < typ.NumField(); i++ {
 		if f := typ.Field(i); f.PkgPath == "" { // exported
 			tags, err := parseStructTag(typ, i, lastPublic)
@@ -119,13 +128,34 @@ func structFields(typ reflect.Type) (fields []field, err error) {
 			if tags.ignored {
 				continue
 			}
+			// Once a field is optional, all fields after it must be
+			// optional too, or swallow the rest of the list.
+			if tags.optional || tags.tail {
+				if firstOptional == "" {
+					firstOptional = f.Name
+				}
+			} else if firstOptional != "" {
+				msg := fmt.Sprintf("must be optional because preceding field %q is optional", firstOptional)
+				return nil, structTagError{typ, f.Name, "", msg}
+			}
 			info := cachedTypeInfo1(f.Type, tags)
-			fields = append(fields, field{i, info})
+			fields = append(fields, field{i, info, tags.optional})
 		}
 	}
 	return fields, nil
 }
 
+// firstOptionalField returns the index of the first optional field, or
+// len(fields) if there is none.
+func firstOptionalField(fields []field) int {
+	for i, f := range fields {
+		if f.optional {
+			return i
+		}
+	}
+	return len(fields)
+}
+
 type structFieldError struct {
 	typ   reflect.Type
 	field int
@@ -166,14 +196,27 @@ func parseStructTag(typ reflect.Type, fi, lastPublic int) (tags, error) {
 			case "nilList":
 				ts.nilKind = List
 			}
+		case "optional":
+			ts.optional = true
+			if ts.tail {
+				return ts, structTagError{typ, f.Name, t, `also has "tail" tag`}
+			}
 		case "tail":
 			ts.tail = true
+			if ts.optional {
+				return ts, structTagError{typ, f.Name, t, `also has "optional" tag`}
+			}
 			if fi != lastPublic {
 				return ts, structTagError{typ, f.Name, t, "must be on last field"}
 			}
 			if f.Type.Kind() != reflect.Slice {
 				return ts, structTagError{typ, f.Name, t, "field type is not slice"}
 			}
+		case "signed":
+			ts.signed = true
+			if !isInt(f.Type.Kind()) {
+				return ts, structTagError{typ, f.Name, t, "field type is not a signed integer"}
+			}
 		default:
 			return ts, fmt.Errorf("rlp: unknown struct tag %q on %v.%s", t, typ, f.Name)
 		}
@@ -210,6 +253,10 @@ func isUint(k reflect.Kind) bool {
 	return k >= reflect.Uint && k <= reflect.Uintptr
 }
 
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
 func isByte(typ reflect.Type) bool {
 	return typ.Kind() == reflect.Uint8 && !typ.Implements(encoderInterface)
 }
@@ -0,0 +1,97 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is returned by Validate. It tells where in the input the
+// first invalid item is.
+type ValidationError struct {
+	Offset uint64 // input position of the invalid item
+	Path   []int  // list indices leading to the item, outermost first
+	Err    error  // what is wrong with the item
+}
+
+func (err *ValidationError) Error() string {
+	if len(err.Path) == 0 {
+		return fmt.Sprintf("%v at offset %d", err.Err, err.Offset)
+	}
+	return fmt.Sprintf("%v at offset %d, path %s", err.Err, err.Offset, formatPath(err.Path))
+}
+
+// Unwrap returns the underlying error, e.g. ErrCanonSize.
+func (err *ValidationError) Unwrap() error {
+	return err.Err
+}
+
+// formatPath returns path in index expression notation, e.g. [1][0].
+func formatPath(path []int) string {
+	var b strings.Builder
+	for _, i := range path {
+		fmt.Fprintf(&b, "[%d]", i)
+	}
+	return b.String()
+}
+
+// Validate checks that b holds exactly one RLP value in canonical encoding,
+// including all values nested in lists. Canonical encoding uses the shortest
+// form for sizes, without leading zero bytes, and encodes single bytes below
+// 0x80 as themselves. Every item must fit into its enclosing list.
+//
+// Validate doesn't know the Go types the values decode into, so it can't tell
+// integers from other strings. Leading zero bytes in integers are rejected by
+// Decode with ErrCanonInt.
+//
+// The returned error is a *ValidationError.
+func Validate(b []byte) error {
+	rest, err := validate(b, 0, nil)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return &ValidationError{Offset: uint64(len(b) - len(rest)), Err: ErrMoreThanOneValue}
+	}
+	return nil
+}
+
+// validate checks the value at the start of b, which is at the given offset
+// and path in the input, and returns the bytes after it.
+func validate(b []byte, offset uint64, path []int) ([]byte, error) {
+	kind, content, rest, err := Split(b)
+	if err != nil {
+		if err == ErrValueTooLarge && len(path) > 0 {
+			err = ErrElemTooLarge
+		}
+		return nil, &ValidationError{Offset: offset, Path: path, Err: err}
+	}
+	if kind == List {
+		elemOffset := offset + uint64(len(b)-len(rest)-len(content))
+		for i := 0; len(content) > 0; i++ {
+			elemPath := append(path[:len(path):len(path)], i)
+			next, err := validate(content, elemOffset, elemPath)
+			if err != nil {
+				return nil, err
+			}
+			elemOffset += uint64(len(content) - len(next))
+			content = next
+		}
+	}
+	return rest, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+		cause error
+	}{
+		{input: "00"},
+		{input: "80"},
+		{input: "C0"},
+		{input: "8180"},
+		{input: "C88363617483646F67"},
+		{input: "B838" + strings.Repeat("AB", 56)},
+		{input: "F83BC0B838" + strings.Repeat("01", 56)},
+		{input: "C7C0C1C0C3C0C1C0"},
+
+		{input: "", err: "unexpected EOF at offset 0", cause: io.ErrUnexpectedEOF},
+		{input: "8100", err: "rlp: non-canonical size information at offset 0", cause: ErrCanonSize},
+		{input: "B80100", err: "rlp: non-canonical size information at offset 0", cause: ErrCanonSize},
+		{input: "F80100", err: "rlp: non-canonical size information at offset 0", cause: ErrCanonSize},
+		{input: "B90038" + strings.Repeat("00", 56), err: "rlp: non-canonical size information at offset 0", cause: ErrCanonSize},
+		{input: "8201", err: "rlp: value size exceeds available input length at offset 0", cause: ErrValueTooLarge},
+		{input: "0102", err: "rlp: input contains more than one value at offset 1", cause: ErrMoreThanOneValue},
+		{input: "C0C0", err: "rlp: input contains more than one value at offset 1", cause: ErrMoreThanOneValue},
+		{
+			input: "C6C28180C28105",
+			err:   "rlp: non-canonical size information at offset 5, path [1][0]",
+			cause: ErrCanonSize,
+		},
+		{
+			input: "C5C3018201C0",
+			err:   "rlp: element is larger than containing list at offset 3, path [0][1]",
+			cause: ErrElemTooLarge,
+		},
+		{
+			input: "C50180C2C1F8",
+			err:   "unexpected EOF at offset 5, path [2][0][0]",
+			cause: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, test := range tests {
+		input, err := hex.DecodeString(test.input)
+		if err != nil {
+			t.Fatalf("invalid hex %q", test.input)
+		}
+		err = Validate(input)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: wrong error\nhave %v\nwant %s", test.input, err, test.err)
+		case test.err != "" && !errors.Is(err, test.cause):
+			t.Errorf("%s: error %v doesn't wrap %v", test.input, err, test.cause)
+		}
+	}
+}
+
+// TestValidateDecodeOffsets checks that Decode reports errors at the offsets
+// found by Validate.
+func TestValidateDecodeOffsets(t *testing.T) {
+	input := unhex("C7C20102C3820001")
+	var v [][]uint
+	err := DecodeBytes(input, &v)
+	want := "rlp: non-canonical integer (leading zero bytes) at offset 5 for uint, decoding into ([][]uint)[1][0]"
+	if err == nil || err.Error() != want {
+		t.Errorf("wrong Decode error\nhave %v\nwant %s", err, want)
+	}
+	// The same input is canonical RLP, the integer aside.
+	if err := Validate(input); err != nil {
+		t.Errorf("Validate error: %v", err)
+	}
+}
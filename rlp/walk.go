@@ -0,0 +1,95 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import "errors"
+
+//lint:ignore ST1012 SkipList is not an error.
+
+// SkipList can be returned by a Visitor for a list to skip its elements.
+// It has no effect for other items. Walk doesn't return it.
+var SkipList = errors.New("rlp: skip this list")
+
+// Element is an item of an RLP encoding, as found by Walk.
+type Element struct {
+	Kind    Kind
+	Offset  uint64 // input position of the item
+	Depth   int    // number of lists enclosing the item
+	Index   int    // position of the item in its list, or among the top-level items
+	Raw     []byte // the encoded item
+	Content []byte // string content, or the encoded list elements
+}
+
+// Visitor is called by Walk for every item. If it returns an error other than
+// SkipList, Walk stops and returns the error.
+type Visitor func(e Element) error
+
+// Walk calls visit for every item in b, including the items nested in lists,
+// in the order they appear in the input. A list is visited before its
+// elements. Raw and Content of the visited elements are subslices of b.
+//
+// b may hold any number of items. Walk checks their encoding like Validate
+// as it goes; invalid input makes it return a *ValidationError after visiting
+// the items before the invalid one.
+func Walk(b []byte, visit Visitor) error {
+	return walk(b, 0, 0, nil, visit)
+}
+
+// walk visits the items in b, which start at the given offset in the input.
+// They are nested in depth lists, the innermost of which is at path.
+func walk(b []byte, offset uint64, depth int, path []int, visit Visitor) error {
+	for i := 0; len(b) > 0; i++ {
+		kind, content, rest, err := Split(b)
+		if err != nil {
+			if err == ErrValueTooLarge && depth > 0 {
+				err = ErrElemTooLarge
+			}
+			return &ValidationError{Offset: offset, Path: itemPath(depth, path, i), Err: err}
+		}
+		size := len(b) - len(rest)
+		e := Element{
+			Kind:    kind,
+			Offset:  offset,
+			Depth:   depth,
+			Index:   i,
+			Raw:     b[:size],
+			Content: content,
+		}
+		switch err := visit(e); {
+		case err == SkipList:
+		case err != nil:
+			return err
+		case kind == List:
+			elemOffset := offset + uint64(size-len(content))
+			if err := walk(content, elemOffset, depth+1, itemPath(depth, path, i), visit); err != nil {
+				return err
+			}
+		}
+		offset += uint64(size)
+		b = rest
+	}
+	return nil
+}
+
+// itemPath returns the path of item i of the list at path. Top-level items
+// aren't part of paths.
+func itemPath(depth int, path []int, i int) []int {
+	if depth == 0 {
+		return nil
+	}
+	return append(path[:len(path):len(path)], i)
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	// [[], [""], "cat"], 5
+	input := unhex("C7C0C18083636174 05")
+	var have []string
+	err := Walk(input, func(e Element) error {
+		have = append(have, fmt.Sprintf("%v offset=%d depth=%d index=%d raw=%x content=%x",
+			e.Kind, e.Offset, e.Depth, e.Index, e.Raw, e.Content))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk error: %v", err)
+	}
+	want := []string{
+		"List offset=0 depth=0 index=0 raw=c7c0c18083636174 content=c0c18083636174",
+		"List offset=1 depth=1 index=0 raw=c0 content=",
+		"List offset=2 depth=1 index=1 raw=c180 content=80",
+		"String offset=3 depth=2 index=0 raw=80 content=",
+		"String offset=4 depth=1 index=2 raw=83636174 content=636174",
+		"Byte offset=8 depth=0 index=1 raw=05 content=05",
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("wrong elements visited\nhave %q\nwant %q", have, want)
+	}
+}
+
+func TestWalkSkipList(t *testing.T) {
+	input := unhex("C7C0C18083636174")
+	var offsets []uint64
+	err := Walk(input, func(e Element) error {
+		offsets = append(offsets, e.Offset)
+		if e.Depth == 1 {
+			return SkipList
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk error: %v", err)
+	}
+	if want := []uint64{0, 1, 2, 4}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("visited offsets %v, want %v", offsets, want)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	// The visitor's error stops the walk.
+	stop := errors.New("stop")
+	var visited int
+	err := Walk(unhex("C20102"), func(e Element) error {
+		if visited++; e.Offset == 1 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || visited != 2 {
+		t.Errorf("got error %v after %d items, want %v after 2", err, visited, stop)
+	}
+
+	tests := []struct {
+		input   string
+		visited int
+		err     string
+	}{
+		{"0181", 1, "rlp: value size exceeds available input length at offset 1"},
+		{"C3C38001", 1, "rlp: element is larger than containing list at offset 1, path [0]"},
+		{"C40102B801", 3, "rlp: non-canonical size information at offset 3, path [2]"},
+		{"C401C28105", 3, "rlp: non-canonical size information at offset 3, path [1][0]"},
+	}
+	for _, test := range tests {
+		visited := 0
+		err := Walk(unhex(test.input), func(Element) error {
+			visited++
+			return nil
+		})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || err.Error() != test.err {
+			t.Errorf("%s: got error %v, want %s", test.input, err, test.err)
+		}
+		if visited != test.visited {
+			t.Errorf("%s: visited %d items, want %d", test.input, visited, test.visited)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+// call is the context of a single JSON-RPC call.
+type call struct {
+	server *Server
+	ctx    context.Context
+}
+
+// methods maps the JSON-RPC method names to their handlers.
+var methods = map[string]func(c *call, params []json.RawMessage) (interface{}, error){
+	"mpt_get":      (*call).get,
+	"mpt_getProof": (*call).getProof,
+	"mpt_getNodes": (*call).getNodes,
+	"mpt_iterate":  (*call).iterate,
+	"mpt_stats":    (*call).stats,
+}
+
+// parseParams decodes positional parameters into args, which must match them
+// in number.
+func parseParams(params []json.RawMessage, args ...interface{}) error {
+	if len(params) != len(args) {
+		return invalidParams(fmt.Sprintf("expected %d params, got %d", len(args), len(params)))
+	}
+	for i, param := range params {
+		if err := json.Unmarshal(param, args[i]); err != nil {
+			return invalidParams(fmt.Sprintf("invalid argument %d: %v", i, err))
+		}
+	}
+	return nil
+}
+
+// openTrie opens the trie with the given root, resolving its nodes within the
+// lifetime of the call.
+func (c *call) openTrie(root mpt.NodeHash) (*mpt.MerklePatriciaTrie, error) {
+	trie, err := mpt.New(root, c.server.db)
+	if err != nil {
+		return nil, err
+	}
+	trie.SetContext(c.ctx)
+	return trie, nil
+}
+
+// get returns the value stored under key, or null if the key is missing.
+func (c *call) get(params []json.RawMessage) (interface{}, error) {
+	var (
+		root mpt.NodeHash
+		key  hexutil.Bytes
+	)
+	if err := parseParams(params, &root, &key); err != nil {
+		return nil, err
+	}
+	trie, err := c.openTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	value, err := trie.TryGet(key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return hexutil.Bytes(value), nil
+}
+
+// ProofResult is the result of mpt_getProof. It follows the storage part of
+// the EIP-1186 eth_getProof response, with values as raw bytes.
+type ProofResult struct {
+	StorageHash  mpt.NodeHash    `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the proof of a single key. Missing keys have an empty
+// value, with the proof showing their absence.
+type StorageResult struct {
+	Key   hexutil.Bytes   `json:"key"`
+	Value hexutil.Bytes   `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// getProof returns the value and the Merkle proof of each key.
+func (c *call) getProof(params []json.RawMessage) (interface{}, error) {
+	var (
+		root mpt.NodeHash
+		keys []hexutil.Bytes
+	)
+	if err := parseParams(params, &root, &keys); err != nil {
+		return nil, err
+	}
+	if len(keys) > c.server.config.MaxKeys {
+		return nil, invalidParams(fmt.Sprintf("too many keys (%d > %d)", len(keys), c.server.config.MaxKeys))
+	}
+	trie, err := c.openTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &ProofResult{StorageHash: root, StorageProof: make([]StorageResult, len(keys))}
+	for i, key := range keys {
+		value, err := trie.TryGet(key)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := trie.ProofNodes(key)
+		if err != nil {
+			return nil, err
+		}
+		proof := make([]hexutil.Bytes, len(nodes))
+		for j, node := range nodes {
+			proof[j] = node
+		}
+		result.StorageProof[i] = StorageResult{Key: key, Value: value, Proof: proof}
+	}
+	return result, nil
+}
+
+// getNodes returns the encoded nodes with the given hashes, with null for the
+// ones not stored.
+func (c *call) getNodes(params []json.RawMessage) (interface{}, error) {
+	var hashes []mpt.NodeHash
+	if err := parseParams(params, &hashes); err != nil {
+		return nil, err
+	}
+	if len(hashes) > c.server.config.MaxHashes {
+		return nil, invalidParams(fmt.Sprintf("too many hashes (%d > %d)", len(hashes), c.server.config.MaxHashes))
+	}
+	nodes := make([]*hexutil.Bytes, len(hashes))
+	for i, hash := range hashes {
+		if blob, err := c.server.db.Node(hash); err == nil {
+			nodes[i] = (*hexutil.Bytes)(&blob)
+		}
+	}
+	return nodes, nil
+}
+
+// IterateResult is the result of mpt_iterate. Next is the start key of the
+// following page, or null once the trie is exhausted.
+type IterateResult struct {
+	Entries []IterateEntry `json:"entries"`
+	Next    *hexutil.Bytes `json:"next"`
+}
+
+// IterateEntry is a single key-value pair of the trie.
+type IterateEntry struct {
+	Key   hexutil.Bytes `json:"key"`
+	Value hexutil.Bytes `json:"value"`
+}
+
+// iterate returns up to limit key-value pairs in key order, starting at start.
+func (c *call) iterate(params []json.RawMessage) (interface{}, error) {
+	var (
+		root  mpt.NodeHash
+		start hexutil.Bytes
+		limit hexutil.Uint64
+	)
+	if err := parseParams(params, &root, &start, &limit); err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > hexutil.Uint64(c.server.config.MaxIterate) {
+		return nil, invalidParams(fmt.Sprintf("limit must be between 1 and %d", c.server.config.MaxIterate))
+	}
+	trie, err := c.openTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &IterateResult{Entries: []IterateEntry{}}
+	err = trie.Iterate(start, func(key, value []byte) bool {
+		if len(result.Entries) == int(limit) {
+			next := hexutil.Bytes(common.CopyBytes(key))
+			result.Next = &next
+			return false
+		}
+		result.Entries = append(result.Entries, IterateEntry{Key: common.CopyBytes(key), Value: common.CopyBytes(value)})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StatsResult is the result of mpt_stats, see mpt.TrieStats.
+type StatsResult struct {
+	Nodes    hexutil.Uint64 `json:"nodes"`
+	Size     hexutil.Uint64 `json:"size"`
+	Shorts   hexutil.Uint64 `json:"shorts"`
+	Branches hexutil.Uint64 `json:"branches"`
+	Values   hexutil.Uint64 `json:"values"`
+	Depth    hexutil.Uint64 `json:"depth"`
+}
+
+// stats walks the whole trie and returns its statistics. Tries with more
+// stored nodes than the configured maximum are rejected.
+func (c *call) stats(params []json.RawMessage) (interface{}, error) {
+	var root mpt.NodeHash
+	if err := parseParams(params, &root); err != nil {
+		return nil, err
+	}
+	stats, err := mpt.StatsContext(c.ctx, c.server.db, root, c.server.config.MaxStats)
+	if errors.Is(err, mpt.ErrStatsLimit) {
+		return nil, &jsonError{Code: errcodeServer, Message: fmt.Sprintf("trie has more than %d nodes", c.server.config.MaxStats)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &StatsResult{
+		Nodes:    hexutil.Uint64(stats.Nodes),
+		Size:     hexutil.Uint64(stats.Size),
+		Shorts:   hexutil.Uint64(stats.Shorts),
+		Branches: hexutil.Uint64(stats.Branches),
+		Values:   hexutil.Uint64(stats.Values),
+		Depth:    hexutil.Uint64(stats.Depth),
+	}, nil
+}
@@ -0,0 +1,208 @@
+// Package server serves the tries of a mpt.Database over JSON-RPC 2.0 on HTTP,
+// so that several readers can share one database instead of opening it
+// directly.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+// Standard JSON-RPC 2.0 error codes, plus a generic server error code used for
+// failures of the trie database.
+const (
+	errcodeParse          = -32700
+	errcodeInvalidRequest = -32600
+	errcodeMethodNotFound = -32601
+	errcodeInvalidParams  = -32602
+	errcodeServer         = -32000
+)
+
+// Config holds the request limits of the server. Zero fields use the value of
+// DefaultConfig.
+type Config struct {
+	MaxBodySize int64 // Maximum size of a request body in bytes
+	MaxBatch    int   // Maximum number of calls in a batch request
+	MaxKeys     int   // Maximum number of keys in a mpt_getProof call
+	MaxHashes   int   // Maximum number of hashes in a mpt_getNodes call
+	MaxIterate  int   // Maximum number of entries returned by a mpt_iterate call
+	MaxStats    int   // Maximum number of stored nodes walked by a mpt_stats call
+}
+
+// DefaultConfig contains the default request limits.
+var DefaultConfig = Config{
+	MaxBodySize: 5 * 1024 * 1024,
+	MaxBatch:    100,
+	MaxKeys:     256,
+	MaxHashes:   1024,
+	MaxIterate:  1024,
+	MaxStats:    100000,
+}
+
+// sanitize replaces unset limits with their defaults.
+func (c Config) sanitize() Config {
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = DefaultConfig.MaxBodySize
+	}
+	if c.MaxBatch <= 0 {
+		c.MaxBatch = DefaultConfig.MaxBatch
+	}
+	if c.MaxKeys <= 0 {
+		c.MaxKeys = DefaultConfig.MaxKeys
+	}
+	if c.MaxHashes <= 0 {
+		c.MaxHashes = DefaultConfig.MaxHashes
+	}
+	if c.MaxIterate <= 0 {
+		c.MaxIterate = DefaultConfig.MaxIterate
+	}
+	if c.MaxStats <= 0 {
+		c.MaxStats = DefaultConfig.MaxStats
+	}
+	return c
+}
+
+// Server is an http.Handler answering JSON-RPC calls against a trie database.
+// Every call opens its own trie, so calls are served concurrently.
+type Server struct {
+	db     *mpt.Database
+	config Config
+}
+
+// New creates a server for the tries stored in db. A nil config uses the
+// default limits.
+func New(db *mpt.Database, config *Config) *Server {
+	if config == nil {
+		config = &DefaultConfig
+	}
+	return &Server{db: db, config: config.sanitize()}
+}
+
+type jsonrpcRequest struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type jsonrpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonError      `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *jsonError) Error() string { return err.Message }
+
+func invalidParams(msg string) *jsonError {
+	return &jsonError{Code: errcodeInvalidParams, Message: msg}
+}
+
+// ServeHTTP handles a single call or a batch of calls posted as JSON.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var (
+		enc   = json.NewEncoder(w)
+		batch []json.RawMessage
+	)
+	if !isBatch(body) {
+		enc.Encode(s.handleMessage(r, body))
+		return
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		enc.Encode(errorResponse(nil, &jsonError{Code: errcodeParse, Message: err.Error()}))
+		return
+	}
+	switch {
+	case len(batch) == 0:
+		enc.Encode(errorResponse(nil, &jsonError{Code: errcodeInvalidRequest, Message: "empty batch"}))
+		return
+	case len(batch) > s.config.MaxBatch:
+		enc.Encode(errorResponse(nil, &jsonError{Code: errcodeInvalidRequest, Message: "batch too large"}))
+		return
+	}
+	responses := make([]*jsonrpcResponse, len(batch))
+	for i, msg := range batch {
+		responses[i] = s.handleMessage(r, msg)
+	}
+	enc.Encode(responses)
+}
+
+// isBatch reports whether the body holds a JSON array.
+func isBatch(body []byte) bool {
+	for _, c := range body {
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return c == '['
+	}
+	return false
+}
+
+// handleMessage decodes and runs a single call.
+func (s *Server) handleMessage(r *http.Request, msg []byte) *jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return errorResponse(nil, &jsonError{Code: errcodeParse, Message: err.Error()})
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, &jsonError{Code: errcodeInvalidRequest, Message: "invalid request"})
+	}
+	handler, ok := methods[req.Method]
+	if !ok {
+		return errorResponse(req.ID, &jsonError{Code: errcodeMethodNotFound, Message: "the method " + req.Method + " does not exist"})
+	}
+	result, err := handler(&call{server: s, ctx: r.Context()}, req.Params)
+	if err != nil {
+		var jerr *jsonError
+		if !errors.As(err, &jerr) {
+			log.Debug("Trie RPC call failed", "method", req.Method, "err", err)
+			jerr = &jsonError{Code: errcodeServer, Message: err.Error()}
+		}
+		return errorResponse(req.ID, jerr)
+	}
+	// Results are marshalled up front so a nil result is sent as null.
+	enc, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, &jsonError{Code: errcodeServer, Message: err.Error()})
+	}
+	return &jsonrpcResponse{Version: "2.0", ID: idOrNull(req.ID), Result: enc}
+}
+
+func errorResponse(id json.RawMessage, err *jsonError) *jsonrpcResponse {
+	return &jsonrpcResponse{Version: "2.0", ID: idOrNull(id), Error: err}
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
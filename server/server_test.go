@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+	"github.com/pavelkrolevets/mpt/mpt"
+)
+
+// newTestServer serves a committed trie with n keys.
+func newTestServer(t *testing.T, n int, config *Config) (*httptest.Server, mpt.NodeHash) {
+	db := mpt.NewDatabase(memorydb.New())
+	trie, _ := mpt.New(mpt.NodeHash{}, db)
+	for i := 0; i < n; i++ {
+		trie.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	srv := httptest.NewServer(New(db, config))
+	t.Cleanup(srv.Close)
+	return srv, root
+}
+
+// post sends a raw request body and decodes the response into out.
+func post(t *testing.T, url string, body string, out interface{}) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("post error: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("can't decode response: %v", err)
+	}
+}
+
+// callRPC invokes a single method and decodes its result into out.
+func callRPC(t *testing.T, url string, out interface{}, method string, params ...interface{}) *jsonError {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	var resp jsonrpcResponse
+	post(t, url, string(body), &resp)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		t.Fatalf("%s: can't decode result %s: %v", method, resp.Result, err)
+	}
+	return nil
+}
+
+func TestGet(t *testing.T) {
+	srv, root := newTestServer(t, 100, nil)
+
+	var value *hexutil.Bytes
+	if err := callRPC(t, srv.URL, &value, "mpt_get", root, hexutil.Bytes("key-042")); err != nil || value == nil || string(*value) != "val-42" {
+		t.Errorf("get: have %v (%v)", value, err)
+	}
+	if err := callRPC(t, srv.URL, &value, "mpt_get", root, hexutil.Bytes("missing")); err != nil || value != nil {
+		t.Errorf("get missing: have %v (%v)", value, err)
+	}
+	if err := callRPC(t, srv.URL, &value, "mpt_get", mpt.CommonToNodeHash(common.Hash{1}), hexutil.Bytes("key-042")); err == nil || err.Code != errcodeServer {
+		t.Errorf("get from missing root: have %v", err)
+	}
+	if err := callRPC(t, srv.URL, &value, "mpt_get", root, "not hex"); err == nil || err.Code != errcodeInvalidParams {
+		t.Errorf("get with bad key: have %v", err)
+	}
+	if err := callRPC(t, srv.URL, &value, "mpt_get", root); err == nil || err.Code != errcodeInvalidParams {
+		t.Errorf("get without key: have %v", err)
+	}
+	if err := callRPC(t, srv.URL, &value, "mpt_set", root); err == nil || err.Code != errcodeMethodNotFound {
+		t.Errorf("unknown method: have %v", err)
+	}
+}
+
+func TestGetProof(t *testing.T) {
+	srv, root := newTestServer(t, 100, &Config{MaxKeys: 3})
+
+	var result ProofResult
+	keys := []hexutil.Bytes{hexutil.Bytes("key-007"), hexutil.Bytes("missing")}
+	if err := callRPC(t, srv.URL, &result, "mpt_getProof", root, keys); err != nil {
+		t.Fatalf("getProof error: %v", err)
+	}
+	if result.StorageHash != root || len(result.StorageProof) != 2 {
+		t.Fatalf("unexpected proof result: %+v", result)
+	}
+	for i, want := range []string{"val-7", ""} {
+		res := result.StorageProof[i]
+		proof := make([][]byte, len(res.Proof))
+		for j := range res.Proof {
+			proof[j] = res.Proof[j]
+		}
+		value, err := mpt.VerifyProof(root, res.Key, proof)
+		if err != nil || string(value) != want || string(res.Value) != want {
+			t.Errorf("key %q: proven %q (%v), returned %q, want %q", res.Key, value, err, res.Value, want)
+		}
+	}
+	keys = append(keys, keys...)
+	if err := callRPC(t, srv.URL, &result, "mpt_getProof", root, keys); err == nil || err.Code != errcodeInvalidParams {
+		t.Errorf("key limit not enforced: %v", err)
+	}
+}
+
+func TestGetNodes(t *testing.T) {
+	srv, root := newTestServer(t, 100, &Config{MaxHashes: 2})
+
+	var nodes []*hexutil.Bytes
+	if err := callRPC(t, srv.URL, &nodes, "mpt_getNodes", []mpt.NodeHash{root, mpt.CommonToNodeHash(common.Hash{1})}); err != nil {
+		t.Fatalf("getNodes error: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0] == nil || nodes[1] != nil {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+	var proof ProofResult
+	callRPC(t, srv.URL, &proof, "mpt_getProof", root, []hexutil.Bytes{hexutil.Bytes("key-001")})
+	if !bytes.Equal(*nodes[0], proof.StorageProof[0].Proof[0]) {
+		t.Errorf("root node mismatch")
+	}
+	if err := callRPC(t, srv.URL, &nodes, "mpt_getNodes", []mpt.NodeHash{root, root, root}); err == nil || err.Code != errcodeInvalidParams {
+		t.Errorf("hash limit not enforced: %v", err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	srv, root := newTestServer(t, 100, &Config{MaxIterate: 30})
+
+	var (
+		keys  []string
+		start = hexutil.Bytes("key-010")
+	)
+	for page := 0; ; page++ {
+		var result IterateResult
+		if err := callRPC(t, srv.URL, &result, "mpt_iterate", root, start, hexutil.Uint64(30)); err != nil {
+			t.Fatalf("iterate error: %v", err)
+		}
+		for _, entry := range result.Entries {
+			keys = append(keys, string(entry.Key))
+		}
+		if result.Next == nil {
+			break
+		}
+		if page == 3 {
+			t.Fatal("iteration didn't end")
+		}
+		start = *result.Next
+	}
+	if len(keys) != 90 || keys[0] != "key-010" || keys[89] != "key-099" {
+		t.Errorf("unexpected keys: %d, %v", len(keys), keys)
+	}
+	var result IterateResult
+	if err := callRPC(t, srv.URL, &result, "mpt_iterate", root, start, hexutil.Uint64(31)); err == nil || err.Code != errcodeInvalidParams {
+		t.Errorf("iterate limit not enforced: %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv, root := newTestServer(t, 100, nil)
+
+	var stats StatsResult
+	if err := callRPC(t, srv.URL, &stats, "mpt_stats", root); err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	if stats.Values != 100 || stats.Nodes == 0 || stats.Size == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	// Larger tries are rejected instead of walked.
+	srv, root = newTestServer(t, 100, &Config{MaxStats: int(stats.Nodes) - 1})
+	if err := callRPC(t, srv.URL, &stats, "mpt_stats", root); err == nil || err.Code != errcodeServer {
+		t.Errorf("stats limit not enforced: %v", err)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	srv, root := newTestServer(t, 10, &Config{MaxBatch: 2, MaxBodySize: 1024})
+
+	// Batches are answered in order.
+	var responses []jsonrpcResponse
+	batch := fmt.Sprintf(`[{"jsonrpc":"2.0","id":1,"method":"mpt_get","params":["%s","0x6b65792d303031"]},{"jsonrpc":"2.0","id":2,"method":"nope"}]`, root.Hex())
+	post(t, srv.URL, batch, &responses)
+	if len(responses) != 2 || string(responses[0].ID) != "1" || responses[0].Error != nil || responses[1].Error.Code != errcodeMethodNotFound {
+		t.Errorf("unexpected batch responses: %+v", responses)
+	}
+	var resp jsonrpcResponse
+	post(t, srv.URL, "["+strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"mpt_stats"},`, 2)+`{}]`, &resp)
+	if resp.Error == nil || resp.Error.Code != errcodeInvalidRequest {
+		t.Errorf("batch limit not enforced: %+v", resp)
+	}
+	post(t, srv.URL, `{"jsonrpc":"2.0",`, &resp)
+	if resp.Error == nil || resp.Error.Code != errcodeParse {
+		t.Errorf("expected parse error: %+v", resp)
+	}
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(strings.Repeat(" ", 2048)))
+	if err != nil {
+		t.Fatalf("post error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("body limit not enforced: status %d", res.StatusCode)
+	}
+	if res, err = http.Get(srv.URL); err != nil {
+		t.Fatalf("get error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET not rejected: status %d", res.StatusCode)
+	}
+}
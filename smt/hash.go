@@ -0,0 +1,60 @@
+package smt
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/gost3411"
+)
+
+// depth is the fixed number of levels between the root and the leaves. Every
+// key is mapped onto a 256 bit Streebog path, one level per bit.
+const depth = 256
+
+const (
+	leafPrefix     = byte(0x00) // Domain separator of leaf hashes and blobs
+	internalPrefix = byte(0x01) // Domain separator of internal node hashes and blobs
+)
+
+// defaultHashes[h] is the hash of an all-empty subtree of height h. Height 0 is
+// a single empty leaf, height depth is an empty tree.
+var defaultHashes [depth + 1]common.Hash
+
+func init() {
+	for h := 1; h <= depth; h++ {
+		defaultHashes[h] = hashInternal(defaultHashes[h-1], defaultHashes[h-1])
+	}
+}
+
+// EmptyRoot is the root hash of a tree without any keys.
+func EmptyRoot() common.Hash {
+	return defaultHashes[depth]
+}
+
+func hashData(data ...[]byte) common.Hash {
+	h := gost3411.New256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// keyPath maps an arbitrary key onto its fixed-depth position in the tree.
+func keyPath(key []byte) common.Hash {
+	return hashData(key)
+}
+
+// hashLeaf computes the hash of a shortcut leaf. The hash does not depend on
+// the height the leaf is stored at, so leaves can move up and down the tree as
+// neighbouring keys come and go.
+func hashLeaf(path, valueHash common.Hash) common.Hash {
+	return hashData([]byte{leafPrefix}, path[:], valueHash[:])
+}
+
+func hashInternal(left, right common.Hash) common.Hash {
+	return hashData([]byte{internalPrefix}, left[:], right[:])
+}
+
+// bit returns the direction taken at the given depth along path: 0 for the
+// left child and 1 for the right one.
+func bit(path common.Hash, d int) int {
+	return int(path[d/8]>>(7-uint(d%8))) & 1
+}
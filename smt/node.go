@@ -0,0 +1,99 @@
+package smt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The tree knows two kinds of stored nodes. Empty subtrees are never stored,
+// they are identified by their precomputed default hash instead.
+//
+//	leaf:     0x00 || path (32 bytes) || value
+//	internal: 0x01 || left hash (32 bytes) || right hash (32 bytes)
+//
+// A leaf is a shortcut: it sits at the root of the highest subtree that holds
+// only its own key, rather than at the bottom of the tree.
+
+type leafNode struct {
+	path  common.Hash
+	value []byte
+}
+
+type internalNode struct {
+	left, right common.Hash
+}
+
+var errEmptyNode = errors.New("empty node blob")
+
+func (n *leafNode) encode() []byte {
+	blob := make([]byte, 1+common.HashLength+len(n.value))
+	blob[0] = leafPrefix
+	copy(blob[1:], n.path[:])
+	copy(blob[1+common.HashLength:], n.value)
+	return blob
+}
+
+func (n *leafNode) hash() common.Hash {
+	return hashLeaf(n.path, hashData(n.value))
+}
+
+func (n *internalNode) encode() []byte {
+	blob := make([]byte, 1+2*common.HashLength)
+	blob[0] = internalPrefix
+	copy(blob[1:], n.left[:])
+	copy(blob[1+common.HashLength:], n.right[:])
+	return blob
+}
+
+func (n *internalNode) hash() common.Hash {
+	return hashInternal(n.left, n.right)
+}
+
+// child returns the hash of the left (0) or right (1) child.
+func (n *internalNode) child(dir int) common.Hash {
+	if dir == 0 {
+		return n.left
+	}
+	return n.right
+}
+
+// decodeNode parses a stored node blob into either a *leafNode or an
+// *internalNode.
+func decodeNode(blob []byte) (interface{}, error) {
+	if len(blob) == 0 {
+		return nil, errEmptyNode
+	}
+	switch blob[0] {
+	case leafPrefix:
+		if len(blob) < 1+common.HashLength {
+			return nil, fmt.Errorf("leaf node too short (%d bytes)", len(blob))
+		}
+		return &leafNode{
+			path:  common.BytesToHash(blob[1 : 1+common.HashLength]),
+			value: common.CopyBytes(blob[1+common.HashLength:]),
+		}, nil
+	case internalPrefix:
+		if len(blob) != 1+2*common.HashLength {
+			return nil, fmt.Errorf("invalid internal node size %d", len(blob))
+		}
+		return &internalNode{
+			left:  common.BytesToHash(blob[1 : 1+common.HashLength]),
+			right: common.BytesToHash(blob[1+common.HashLength:]),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown node prefix %#x", blob[0])
+	}
+}
+
+// MissingNodeError is returned by the tree functions when a node referenced
+// from the root can be found neither in memory nor in the database.
+type MissingNodeError struct {
+	NodeHash common.Hash // hash of the missing node
+	Depth    int         // depth of the missing node below the root
+}
+
+func (err *MissingNodeError) Error() string {
+	return fmt.Sprintf("missing tree node %x (depth %d)", err.NodeHash, err.Depth)
+}
@@ -0,0 +1,135 @@
+package smt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Proof is a compact (non-)membership proof for a single key.
+//
+// The proof walks Depth levels down from the root along the key's path. Only
+// siblings that differ from the default hash of their height are included; bit
+// d of Bitmap (most significant bit first) tells whether the sibling at depth d
+// is present in Siblings, which are ordered from the root downwards.
+//
+// The walk ends in one of three ways: at the key's own leaf (membership), at
+// an empty subtree, or at the shortcut leaf of another key sharing the first
+// Depth bits of the path. Only in the last case are LeafPath and LeafValueHash
+// set.
+type Proof struct {
+	Depth         uint
+	Bitmap        [depth / 8]byte
+	Siblings      []common.Hash
+	LeafPath      common.Hash
+	LeafValueHash common.Hash
+}
+
+func (p *Proof) hasSibling(d int) bool {
+	return p.Bitmap[d/8]&(0x80>>uint(d%8)) != 0
+}
+
+func (p *Proof) setSibling(d int) {
+	p.Bitmap[d/8] |= 0x80 >> uint(d%8)
+}
+
+// Prove constructs a proof for key against the current root. Whether the key
+// is present is decided by the verifier from the value it checks against.
+func (t *SparseMerkleTree) Prove(key []byte) (*Proof, error) {
+	var (
+		path  = keyPath(key)
+		proof = new(Proof)
+		hash  = t.root
+	)
+	for d := 0; d < depth; d++ {
+		if hash == defaultHashes[depth-d] {
+			proof.Depth = uint(d)
+			return proof, nil
+		}
+		n, err := t.resolve(hash, d)
+		if err != nil {
+			return nil, err
+		}
+		switch n := n.(type) {
+		case *leafNode:
+			if n.path != path {
+				proof.LeafPath, proof.LeafValueHash = n.path, hashData(n.value)
+			}
+			proof.Depth = uint(d)
+			return proof, nil
+		case *internalNode:
+			dir := bit(path, d)
+			if sibling := n.child(1 - dir); sibling != defaultHashes[depth-d-1] {
+				proof.setSibling(d)
+				proof.Siblings = append(proof.Siblings, sibling)
+			}
+			hash = n.child(dir)
+		}
+	}
+	// Two distinct paths always diverge above the bottom level, so only an
+	// empty leaf can be reached here.
+	proof.Depth = depth
+	return proof, nil
+}
+
+// VerifyProof checks proof against root. A non-empty value proves that key
+// maps to value, an empty one proves that key is absent from the tree.
+func VerifyProof(root common.Hash, key, value []byte, proof *Proof) error {
+	if proof.Depth > depth {
+		return fmt.Errorf("proof depth %d exceeds tree depth", proof.Depth)
+	}
+	var (
+		path = keyPath(key)
+		d    = int(proof.Depth)
+		hash common.Hash
+		want int
+	)
+	for i := 0; i < depth; i++ {
+		if proof.hasSibling(i) {
+			if i >= d {
+				return fmt.Errorf("sibling bit %d set below proof depth %d", i, d)
+			}
+			want++
+		}
+	}
+	if want != len(proof.Siblings) {
+		return fmt.Errorf("bitmap marks %d siblings, proof has %d", want, len(proof.Siblings))
+	}
+	hasLeaf := proof.LeafPath != (common.Hash{}) || proof.LeafValueHash != (common.Hash{})
+	switch {
+	case len(value) != 0:
+		if hasLeaf {
+			return errors.New("membership proof carries a foreign leaf")
+		}
+		hash = hashLeaf(path, hashData(value))
+	case hasLeaf:
+		if proof.LeafPath == path {
+			return errors.New("non-membership proof ends in the key's own leaf")
+		}
+		for i := 0; i < d; i++ {
+			if bit(proof.LeafPath, i) != bit(path, i) {
+				return fmt.Errorf("foreign leaf diverges from key at depth %d", i)
+			}
+		}
+		hash = hashLeaf(proof.LeafPath, proof.LeafValueHash)
+	default:
+		hash = defaultHashes[depth-d]
+	}
+	next := len(proof.Siblings) - 1
+	for i := d - 1; i >= 0; i-- {
+		sibling := defaultHashes[depth-i-1]
+		if proof.hasSibling(i) {
+			sibling, next = proof.Siblings[next], next-1
+		}
+		if bit(path, i) == 0 {
+			hash = hashInternal(hash, sibling)
+		} else {
+			hash = hashInternal(sibling, hash)
+		}
+	}
+	if hash != root {
+		return fmt.Errorf("proof root mismatch: have %x, want %x", hash, root)
+	}
+	return nil
+}
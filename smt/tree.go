@@ -0,0 +1,243 @@
+// Package smt implements a 256 level binary Sparse Merkle Tree hashed with
+// Streebog (GOST R 34.11-2012). Keys are mapped onto fixed-depth paths by
+// hashing them, all-empty subtrees collapse into precomputed default hashes and
+// subtrees holding a single key are replaced by a shortcut leaf.
+package smt
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb"
+	"github.com/pavelkrolevets/mpt/rawdb"
+)
+
+// SparseMerkleTree is a binary Merkle tree over the full 256 bit key space.
+// Modified nodes are kept in memory until Commit writes them into the backing
+// key-value store.
+//
+// SparseMerkleTree is not safe for concurrent use.
+type SparseMerkleTree struct {
+	db      ethdb.KeyValueStore
+	root    common.Hash
+	dirties map[common.Hash][]byte // Nodes created since the last commit
+}
+
+// New creates a tree with an existing root hash, reading its nodes from db.
+// A zero root is treated as the empty tree.
+func New(root common.Hash, db ethdb.KeyValueStore) (*SparseMerkleTree, error) {
+	if db == nil {
+		panic("smt.New called without a database")
+	}
+	t := &SparseMerkleTree{
+		db:      db,
+		root:    root,
+		dirties: make(map[common.Hash][]byte),
+	}
+	if root == (common.Hash{}) {
+		t.root = EmptyRoot()
+	}
+	if t.root != EmptyRoot() {
+		if _, err := t.resolve(t.root, 0); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Hash returns the current root hash of the tree.
+func (t *SparseMerkleTree) Hash() common.Hash {
+	return t.root
+}
+
+// resolve loads the node stored under hash, either from the in-memory dirty
+// set or from the database.
+func (t *SparseMerkleTree) resolve(hash common.Hash, d int) (interface{}, error) {
+	blob, ok := t.dirties[hash]
+	if !ok {
+		blob = rawdb.ReadTrieNode(t.db, hash[:])
+	}
+	if len(blob) == 0 {
+		return nil, &MissingNodeError{NodeHash: hash, Depth: d}
+	}
+	return decodeNode(blob)
+}
+
+func (t *SparseMerkleTree) store(hash common.Hash, blob []byte) common.Hash {
+	t.dirties[hash] = blob
+	return hash
+}
+
+func (t *SparseMerkleTree) storeLeaf(path common.Hash, value []byte) common.Hash {
+	n := &leafNode{path: path, value: common.CopyBytes(value)}
+	return t.store(n.hash(), n.encode())
+}
+
+func (t *SparseMerkleTree) storeInternal(left, right common.Hash) common.Hash {
+	n := &internalNode{left: left, right: right}
+	return t.store(n.hash(), n.encode())
+}
+
+// Get returns the value stored for key, or nil if the key is not present.
+func (t *SparseMerkleTree) Get(key []byte) ([]byte, error) {
+	path := keyPath(key)
+	hash := t.root
+	for d := 0; d <= depth; d++ {
+		if hash == defaultHashes[depth-d] {
+			return nil, nil
+		}
+		n, err := t.resolve(hash, d)
+		if err != nil {
+			return nil, err
+		}
+		switch n := n.(type) {
+		case *leafNode:
+			if n.path != path {
+				return nil, nil
+			}
+			return n.value, nil
+		case *internalNode:
+			hash = n.child(bit(path, d))
+		}
+	}
+	return nil, nil
+}
+
+// Update associates key with value in the tree. An empty value deletes the
+// key.
+func (t *SparseMerkleTree) Update(key, value []byte) error {
+	root, err := t.update(t.root, 0, keyPath(key), value)
+	if err != nil {
+		return err
+	}
+	t.root = root
+	return nil
+}
+
+// Delete removes key from the tree. Deleting a missing key is not an error.
+func (t *SparseMerkleTree) Delete(key []byte) error {
+	return t.Update(key, nil)
+}
+
+// update inserts (or, for an empty value, removes) path into the subtree rooted
+// at hash, d levels below the root, and returns the new subtree hash.
+func (t *SparseMerkleTree) update(hash common.Hash, d int, path common.Hash, value []byte) (common.Hash, error) {
+	if hash == defaultHashes[depth-d] {
+		if len(value) == 0 {
+			return hash, nil
+		}
+		return t.storeLeaf(path, value), nil
+	}
+	n, err := t.resolve(hash, d)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	switch n := n.(type) {
+	case *leafNode:
+		if n.path == path {
+			if len(value) == 0 {
+				return defaultHashes[depth-d], nil
+			}
+			return t.storeLeaf(path, value), nil
+		}
+		if len(value) == 0 {
+			return hash, nil
+		}
+		// Two keys now share this subtree, push both leaves down until
+		// their paths diverge.
+		return t.split(d, n.path, hash, path, t.storeLeaf(path, value)), nil
+
+	default:
+		in := n.(*internalNode)
+		left, right := in.left, in.right
+		if bit(path, d) == 0 {
+			left, err = t.update(left, d+1, path, value)
+		} else {
+			right, err = t.update(right, d+1, path, value)
+		}
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return t.join(d, left, right)
+	}
+}
+
+// split builds the smallest subtree at depth d that contains the two leaves a
+// and b, whose paths must differ.
+func (t *SparseMerkleTree) split(d int, pathA, a, pathB, b common.Hash) common.Hash {
+	bitA, bitB := bit(pathA, d), bit(pathB, d)
+	if bitA != bitB {
+		if bitA == 0 {
+			return t.storeInternal(a, b)
+		}
+		return t.storeInternal(b, a)
+	}
+	child, empty := t.split(d+1, pathA, a, pathB, b), defaultHashes[depth-d-1]
+	if bitA == 0 {
+		return t.storeInternal(child, empty)
+	}
+	return t.storeInternal(empty, child)
+}
+
+// join combines two child subtrees at depth d+1 into their parent, collapsing
+// the parent into a default hash or a shortcut leaf where possible.
+func (t *SparseMerkleTree) join(d int, left, right common.Hash) (common.Hash, error) {
+	empty := defaultHashes[depth-d-1]
+	switch {
+	case left == empty && right == empty:
+		return defaultHashes[depth-d], nil
+	case left == empty, right == empty:
+		only := left
+		if left == empty {
+			only = right
+		}
+		n, err := t.resolve(only, d+1)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if _, ok := n.(*leafNode); ok {
+			return only, nil
+		}
+	}
+	return t.storeInternal(left, right), nil
+}
+
+// Commit writes all nodes reachable from the current root that are not yet
+// persisted into the database and returns the root hash. Nodes that were
+// created but superseded before the commit are discarded.
+func (t *SparseMerkleTree) Commit() (common.Hash, error) {
+	batch := t.db.NewBatch()
+	if err := t.commit(t.root, batch); err != nil {
+		return common.Hash{}, err
+	}
+	if err := batch.Write(); err != nil {
+		return common.Hash{}, err
+	}
+	t.dirties = make(map[common.Hash][]byte)
+	return t.root, nil
+}
+
+func (t *SparseMerkleTree) commit(hash common.Hash, batch ethdb.Batch) error {
+	blob, ok := t.dirties[hash]
+	if !ok {
+		return nil
+	}
+	n, err := decodeNode(blob)
+	if err != nil {
+		return err
+	}
+	if n, ok := n.(*internalNode); ok {
+		if err := t.commit(n.left, batch); err != nil {
+			return err
+		}
+		if err := t.commit(n.right, batch); err != nil {
+			return err
+		}
+	}
+	rawdb.WriteTrieNode(batch, hash[:], blob)
+	if batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package smt
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pavelkrolevets/mpt/ethdb/memorydb"
+	"github.com/pavelkrolevets/mpt/rlp"
+)
+
+func newEmpty() *SparseMerkleTree {
+	tree, _ := New(common.Hash{}, memorydb.New())
+	return tree
+}
+
+func TestEmptyTree(t *testing.T) {
+	tree := newEmpty()
+	if root := tree.Hash(); root != EmptyRoot() {
+		t.Errorf("expected %x got %x", EmptyRoot(), root)
+	}
+	if val, err := tree.Get([]byte("missing")); val != nil || err != nil {
+		t.Errorf("unexpected result %x, %v", val, err)
+	}
+}
+
+func TestUpdateGetDelete(t *testing.T) {
+	tree := newEmpty()
+	vals := map[string]string{
+		"doe":          "reindeer",
+		"dog":          "puppy",
+		"dogglesworth": "cat",
+		"horse":        "stallion",
+	}
+	for k, v := range vals {
+		if err := tree.Update([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("update %q: %v", k, err)
+		}
+	}
+	for k, v := range vals {
+		res, err := tree.Get([]byte(k))
+		if err != nil || !bytes.Equal(res, []byte(v)) {
+			t.Errorf("get %q: have %q (%v), want %q", k, res, err, v)
+		}
+	}
+	root := tree.Hash()
+	if err := tree.Update([]byte("dog"), []byte("hound")); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Hash() == root {
+		t.Error("root unchanged after value update")
+	}
+	if err := tree.Update([]byte("dog"), []byte("puppy")); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Hash() != root {
+		t.Error("root differs after restoring value")
+	}
+	for k := range vals {
+		if err := tree.Delete([]byte(k)); err != nil {
+			t.Fatalf("delete %q: %v", k, err)
+		}
+	}
+	if tree.Hash() != EmptyRoot() {
+		t.Errorf("expected empty root after deleting all keys, got %x", tree.Hash())
+	}
+}
+
+func TestOrderIndependence(t *testing.T) {
+	keys := make([][]byte, 200)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+	}
+	a, b := newEmpty(), newEmpty()
+	for _, k := range keys {
+		a.Update(k, append([]byte("v-"), k...))
+	}
+	for _, i := range rand.Perm(len(keys)) {
+		b.Update(keys[i], append([]byte("v-"), keys[i]...))
+	}
+	if a.Hash() != b.Hash() {
+		t.Fatalf("insertion order changed root: %x != %x", a.Hash(), b.Hash())
+	}
+	// Deleting half of the keys must give the same tree as never adding them.
+	c := newEmpty()
+	for i, k := range keys {
+		if i%2 == 0 {
+			a.Delete(k)
+		} else {
+			c.Update(k, append([]byte("v-"), k...))
+		}
+	}
+	if a.Hash() != c.Hash() {
+		t.Fatalf("deletion left non-canonical tree: %x != %x", a.Hash(), c.Hash())
+	}
+}
+
+func TestCommitReopen(t *testing.T) {
+	db := memorydb.New()
+	tree, _ := New(common.Hash{}, db)
+	for i := 0; i < 100; i++ {
+		tree.Update([]byte{byte(i)}, []byte{byte(i), 0xff})
+	}
+	root, err := tree.Commit()
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	reopened, err := New(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen tree: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if val, _ := reopened.Get([]byte{byte(i)}); !bytes.Equal(val, []byte{byte(i), 0xff}) {
+			t.Errorf("key %d: have %x", i, val)
+		}
+	}
+	if _, err := New(common.Hash{1}, db); err == nil {
+		t.Error("expected error opening unknown root")
+	}
+}
+
+func TestProofs(t *testing.T) {
+	tree := newEmpty()
+	for i := 0; i < 64; i++ {
+		tree.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i)))
+	}
+	root := tree.Hash()
+
+	for i := 0; i < 64; i++ {
+		key, val := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("val-%d", i))
+		proof, err := tree.Prove(key)
+		if err != nil {
+			t.Fatalf("prove %q: %v", key, err)
+		}
+		if err := VerifyProof(root, key, val, proof); err != nil {
+			t.Errorf("membership proof of %q rejected: %v", key, err)
+		}
+		if err := VerifyProof(root, key, []byte("wrong"), proof); err == nil {
+			t.Errorf("proof of %q accepted a wrong value", key)
+		}
+		if err := VerifyProof(root, key, nil, proof); err == nil {
+			t.Errorf("membership proof of %q accepted as absence", key)
+		}
+	}
+	for i := 64; i < 128; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		proof, err := tree.Prove(key)
+		if err != nil {
+			t.Fatalf("prove %q: %v", key, err)
+		}
+		if err := VerifyProof(root, key, nil, proof); err != nil {
+			t.Errorf("non-membership proof of %q rejected: %v", key, err)
+		}
+		if err := VerifyProof(root, key, []byte("val"), proof); err == nil {
+			t.Errorf("non-membership proof of %q accepted as presence", key)
+		}
+	}
+}
+
+func TestProofEncoding(t *testing.T) {
+	tree := newEmpty()
+	for i := 0; i < 16; i++ {
+		tree.Update([]byte{byte(i)}, []byte{byte(i)})
+	}
+	proof, _ := tree.Prove([]byte{3})
+	enc, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	var dec Proof
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if err := VerifyProof(tree.Hash(), []byte{3}, []byte{3}, &dec); err != nil {
+		t.Errorf("decoded proof rejected: %v", err)
+	}
+	// A sparse tree of 16 keys needs only a handful of non-default siblings.
+	if len(dec.Siblings) > 8 {
+		t.Errorf("proof not compact: %d siblings", len(dec.Siblings))
+	}
+}
@@ -0,0 +1,178 @@
+// Package uint256 implements 256-bit unsigned integers. Unlike big.Int, an
+// Int is a plain array, so values of this type don't allocate.
+package uint256
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// Int is a 256-bit unsigned integer. The words are in little-endian order:
+// Int[0] holds the least significant 64 bits.
+type Int [4]uint64
+
+// NewInt returns a new Int set to v.
+func NewInt(v uint64) *Int {
+	return &Int{v}
+}
+
+// FromBig returns b as an Int. The boolean is true if b is negative or doesn't
+// fit into 256 bits.
+func FromBig(b *big.Int) (*Int, bool) {
+	z := new(Int)
+	overflow := z.SetFromBig(b)
+	return z, overflow
+}
+
+// SetUint64 sets z to v and returns z.
+func (z *Int) SetUint64(v uint64) *Int {
+	*z = Int{v}
+	return z
+}
+
+// SetBytes interprets b as a big-endian unsigned integer, sets z to it and
+// returns z. Only the last 32 bytes of b are used.
+func (z *Int) SetBytes(b []byte) *Int {
+	if len(b) > 32 {
+		b = b[len(b)-32:]
+	}
+	var buf [32]byte
+	copy(buf[32-len(b):], b)
+	z[3] = binary.BigEndian.Uint64(buf[0:8])
+	z[2] = binary.BigEndian.Uint64(buf[8:16])
+	z[1] = binary.BigEndian.Uint64(buf[16:24])
+	z[0] = binary.BigEndian.Uint64(buf[24:32])
+	return z
+}
+
+// SetFromBig sets z to b modulo 2^256 and reports whether b overflowed, i.e.
+// was negative or didn't fit into 256 bits. Negative values set z to zero.
+func (z *Int) SetFromBig(b *big.Int) bool {
+	*z = Int{}
+	if b.Sign() < 0 {
+		return true
+	}
+	words := b.Bits()
+	if bits.UintSize == 64 {
+		for i := 0; i < len(words) && i < 4; i++ {
+			z[i] = uint64(words[i])
+		}
+		return len(words) > 4
+	}
+	for i := 0; i < len(words) && i < 8; i++ {
+		z[i/2] |= uint64(words[i]) << (32 * uint(i%2))
+	}
+	return len(words) > 8
+}
+
+// ToBig returns z as a big.Int.
+func (z *Int) ToBig() *big.Int {
+	b := z.Bytes32()
+	return new(big.Int).SetBytes(b[:])
+}
+
+// Bytes32 returns z as a 32-byte big-endian array.
+func (z *Int) Bytes32() [32]byte {
+	var b [32]byte
+	binary.BigEndian.PutUint64(b[0:8], z[3])
+	binary.BigEndian.PutUint64(b[8:16], z[2])
+	binary.BigEndian.PutUint64(b[16:24], z[1])
+	binary.BigEndian.PutUint64(b[24:32], z[0])
+	return b
+}
+
+// Bytes returns z in big-endian byte order without leading zero bytes. The
+// result for zero is empty.
+func (z *Int) Bytes() []byte {
+	b := z.Bytes32()
+	return append([]byte{}, b[32-z.ByteLen():]...)
+}
+
+// BitLen returns the number of bits required to represent z.
+func (z *Int) BitLen() int {
+	for i := 3; i >= 0; i-- {
+		if z[i] != 0 {
+			return i*64 + bits.Len64(z[i])
+		}
+	}
+	return 0
+}
+
+// ByteLen returns the number of bytes required to represent z.
+func (z *Int) ByteLen() int {
+	return (z.BitLen() + 7) / 8
+}
+
+// IsZero reports whether z is zero.
+func (z *Int) IsZero() bool {
+	return z[0]|z[1]|z[2]|z[3] == 0
+}
+
+// IsUint64 reports whether z fits into a uint64.
+func (z *Int) IsUint64() bool {
+	return z[1]|z[2]|z[3] == 0
+}
+
+// Uint64 returns the low 64 bits of z.
+func (z *Int) Uint64() uint64 {
+	return z[0]
+}
+
+// Cmp compares z and x and returns -1, 0 or +1 if z is less than, equal to,
+// or greater than x.
+func (z *Int) Cmp(x *Int) int {
+	for i := 3; i >= 0; i-- {
+		switch {
+		case z[i] < x[i]:
+			return -1
+		case z[i] > x[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Eq reports whether z equals x.
+func (z *Int) Eq(x *Int) bool {
+	return *z == *x
+}
+
+// Add sets z to x+y modulo 2^256 and returns z.
+func (z *Int) Add(x, y *Int) *Int {
+	z.AddOverflow(x, y)
+	return z
+}
+
+// AddOverflow sets z to x+y modulo 2^256 and reports whether the sum
+// overflowed.
+func (z *Int) AddOverflow(x, y *Int) bool {
+	var carry uint64
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], carry = bits.Add64(x[3], y[3], carry)
+	return carry != 0
+}
+
+// Sub sets z to x-y modulo 2^256 and returns z.
+func (z *Int) Sub(x, y *Int) *Int {
+	z.SubOverflow(x, y)
+	return z
+}
+
+// SubOverflow sets z to x-y modulo 2^256 and reports whether the difference
+// underflowed, i.e. y was greater than x.
+func (z *Int) SubOverflow(x, y *Int) bool {
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], borrow = bits.Sub64(x[3], y[3], borrow)
+	return borrow != 0
+}
+
+// String returns z in decimal.
+func (z *Int) String() string {
+	return z.ToBig().String()
+}
@@ -0,0 +1,112 @@
+package uint256
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var (
+	two256   = new(big.Int).Lsh(big.NewInt(1), 256)
+	maxInt   = new(big.Int).Sub(two256, big.NewInt(1))
+	bigTests = []*big.Int{
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(0xFF),
+		new(big.Int).SetUint64(1<<64 - 1),
+		new(big.Int).Lsh(big.NewInt(1), 64),
+		new(big.Int).Lsh(big.NewInt(0xABCD), 150),
+		maxInt,
+	}
+)
+
+func randomBig(rnd *rand.Rand) *big.Int {
+	b := make([]byte, rnd.Intn(33))
+	rnd.Read(b)
+	return new(big.Int).SetBytes(b)
+}
+
+func TestConversions(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := append([]*big.Int{}, bigTests...)
+	for i := 0; i < 200; i++ {
+		values = append(values, randomBig(rnd))
+	}
+	for _, b := range values {
+		z, overflow := FromBig(b)
+		if overflow {
+			t.Fatalf("%v: overflow", b)
+		}
+		if z.ToBig().Cmp(b) != 0 {
+			t.Errorf("%v: ToBig returned %v", b, z.ToBig())
+		}
+		if !bytes.Equal(z.Bytes(), b.Bytes()) {
+			t.Errorf("%v: Bytes returned %x", b, z.Bytes())
+		}
+		if z.BitLen() != b.BitLen() {
+			t.Errorf("%v: BitLen returned %d", b, z.BitLen())
+		}
+		if have := new(Int).SetBytes(b.Bytes()); *have != *z {
+			t.Errorf("%v: SetBytes returned %v", b, have)
+		}
+		if z.String() != b.String() {
+			t.Errorf("%v: String returned %s", b, z.String())
+		}
+		if z.IsZero() != (b.Sign() == 0) || z.IsUint64() != b.IsUint64() {
+			t.Errorf("%v: wrong IsZero or IsUint64", b)
+		}
+	}
+	// 33 bytes keep the last 32.
+	long := append([]byte{0xFF}, maxInt.Bytes()...)
+	if z := new(Int).SetBytes(long); z.ToBig().Cmp(maxInt) != 0 {
+		t.Errorf("SetBytes of 33 bytes returned %v", z)
+	}
+}
+
+func TestFromBigOverflow(t *testing.T) {
+	if z, overflow := FromBig(two256); !overflow || !z.IsZero() {
+		t.Errorf("2^256: have %v, overflow %t", z, overflow)
+	}
+	if z, overflow := FromBig(new(big.Int).Add(two256, big.NewInt(5))); !overflow || z.Uint64() != 5 {
+		t.Errorf("2^256+5: have %v, overflow %t", z, overflow)
+	}
+	if z, overflow := FromBig(big.NewInt(-1)); !overflow || !z.IsZero() {
+		t.Errorf("-1: have %v, overflow %t", z, overflow)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	values := append([]*big.Int{}, bigTests...)
+	for i := 0; i < 50; i++ {
+		values = append(values, randomBig(rnd))
+	}
+	for _, x := range values {
+		for _, y := range values {
+			zx, _ := FromBig(x)
+			zy, _ := FromBig(y)
+
+			sum := new(big.Int).Add(x, y)
+			var z Int
+			if overflow := z.AddOverflow(zx, zy); overflow != (sum.Cmp(maxInt) > 0) {
+				t.Errorf("%v + %v: overflow %t", x, y, overflow)
+			}
+			if want := sum.Mod(sum, two256); z.ToBig().Cmp(want) != 0 {
+				t.Errorf("%v + %v: have %v, want %v", x, y, &z, want)
+			}
+
+			diff := new(big.Int).Sub(x, y)
+			if underflow := z.SubOverflow(zx, zy); underflow != (diff.Sign() < 0) {
+				t.Errorf("%v - %v: underflow %t", x, y, underflow)
+			}
+			if want := diff.Mod(diff, two256); z.ToBig().Cmp(want) != 0 {
+				t.Errorf("%v - %v: have %v, want %v", x, y, &z, want)
+			}
+
+			if have, want := zx.Cmp(zy), x.Cmp(y); have != want {
+				t.Errorf("Cmp(%v, %v): have %d, want %d", x, y, have, want)
+			}
+		}
+	}
+}